@@ -0,0 +1,372 @@
+package agora_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Defaults used by NewClient.
+const (
+	DefaultTimeout    = 10 * time.Second       // Timeout for each attempt of a request.
+	DefaultMaxRetries = 2                      // Number of retries for idempotent requests.
+	DefaultBaseDelay  = 200 * time.Millisecond // Delay before the first retry, doubled for each retry.
+	DefaultMaxDelay   = 2 * time.Second        // Maximum delay between retries.
+)
+
+// maxResponseSize is the largest Agora response body read, Agora's responses are a few kilobytes.
+const maxResponseSize = 1 << 20
+
+// ErrResponseTooLarge is returned when an Agora response body is larger than maxResponseSize.
+var ErrResponseTooLarge = fmt.Errorf("response body larger than %d bytes", maxResponseSize)
+
+// sharedTransport is the connection pool used by every Client that doesn't set its own http.Client.
+var sharedTransport = newTransport()
+
+// newTransport clones Go's default transport and keeps more idle connections per host, as all requests go to a few Agora hosts.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 20
+	return transport
+}
+
+// Client sends authenticated requests to the Agora REST APIs.
+// A Client is safe for concurrent use and should be shared by the services.
+type Client struct {
+	httpClient    *http.Client   // HTTP client used to send requests, backed by a pooled transport.
+	basicAuth     string         // Basic authentication credentials required for interacting with the Agora API.
+	timeout       time.Duration  // Default timeout for each attempt of a request.
+	maxRetries    int            // Number of retries for idempotent requests.
+	baseDelay     time.Duration  // Delay before the first retry.
+	maxDelay      time.Duration  // Maximum delay between retries.
+	requestHooks  []RequestHook  // Hooks called before each attempt.
+	responseHooks []ResponseHook // Hooks called after each attempt.
+	domains       *domainPool    // (Optional) Agora domains requests fail over between.
+
+	domainList    []string      // Domains set by WithDomains, parsed into the pool by NewClient.
+	ejectAfter    int           // Consecutive failures before a domain is ejected.
+	ejectDuration time.Duration // How long an ejected domain is skipped.
+}
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithHTTPClient sets the http.Client used to send requests, replacing the shared pooled transport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout sets the default timeout for each attempt of a request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetry sets the number of retries for idempotent requests and the exponential backoff between them.
+func WithRetry(maxRetries int, baseDelay time.Duration, maxDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.baseDelay = baseDelay
+		c.maxDelay = maxDelay
+	}
+}
+
+// WithRequestHook adds a hook that is called before each attempt of a request.
+func WithRequestHook(hook RequestHook) Option {
+	return func(c *Client) {
+		c.requestHooks = append(c.requestHooks, hook)
+	}
+}
+
+// WithResponseHook adds a hook that is called after each attempt of a request.
+func WithResponseHook(hook ResponseHook) Option {
+	return func(c *Client) {
+		c.responseHooks = append(c.responseHooks, hook)
+	}
+}
+
+// WithDomains sets the ordered list of Agora REST domains, e.g. "https://api.sd-rtn.com" followed by regional or backup domains.
+// Requests to any of these domains go to the first healthy one and fail over to the next, only the scheme and host of each domain are used.
+func WithDomains(domains ...string) Option {
+	return func(c *Client) {
+		c.domainList = append(c.domainList, domains...)
+	}
+}
+
+// WithDomainEjection sets how many consecutive failures eject a domain and for how long it is skipped.
+func WithDomainEjection(ejectAfter int, ejectDuration time.Duration) Option {
+	return func(c *Client) {
+		c.ejectAfter = ejectAfter
+		c.ejectDuration = ejectDuration
+	}
+}
+
+// NewClient returns a Client pointer with all configurations set.
+//
+// Parameters:
+//   - basicAuth: string - The basic authentication header value used for all requests.
+//   - opts: ...Option - (Optional) settings that replace the defaults.
+//
+// Returns:
+//   - *Client: The initialized Client struct.
+//
+// Notes:
+//   - Clients share a pooled transport unless WithHTTPClient is used.
+func NewClient(basicAuth string, opts ...Option) *Client {
+	c := &Client{
+		httpClient: &http.Client{Transport: sharedTransport},
+		basicAuth:  basicAuth,
+		timeout:    DefaultTimeout,
+		maxRetries: DefaultMaxRetries,
+		baseDelay:  DefaultBaseDelay,
+		maxDelay:   DefaultMaxDelay,
+
+		ejectAfter:    DefaultEjectAfter,
+		ejectDuration: DefaultEjectDuration,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.domainList) > 0 {
+		c.domains = newDomainPool(c.domainList, c.ejectAfter, c.ejectDuration)
+	}
+	return c
+}
+
+// MakeRequest sends a JSON request and returns the response body.
+//
+// Parameters:
+//   - ctx: context.Context - Context for the call, cancelling it stops the request and any retries.
+//   - method: string - The HTTP method (e.g., "GET", "POST") to be used for making the request.
+//   - url: string - The endpoint URL to which the request is sent.
+//   - body: interface{} (optional) - The payload for the request, nil to send the request without a body.
+//
+// Returns:
+//   - []byte: The raw response body received from the server.
+//   - error: An *APIError if Agora responded with a non-200 status code, or the error that prevented the request.
+func (c *Client) MakeRequest(ctx context.Context, method string, url string, body interface{}) ([]byte, error) {
+	resp, err := c.Do(ctx, Request{Method: method, URL: url, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Do sends a request to the Agora API, retrying idempotent requests that fail with a network error or a retryable status code.
+//
+// Behavior:
+//   - Marshals the body into JSON once and sets the Authorization and Content-Type headers.
+//   - Applies the request timeout to each attempt, the context bounds the whole call including retries.
+//   - When the URL points at one of the configured domains, sends each attempt to the next healthy domain.
+//   - Non-idempotent requests only fail over when the connection to a domain could not be made, so they are never sent twice.
+//   - Waits with exponential backoff and jitter before trying a domain again, or for the Retry-After delay sent by Agora.
+//   - Returns an *APIError for any non-200 status code.
+func (c *Client) Do(ctx context.Context, r Request) (*Response, error) {
+	var jsonBody []byte
+	if r.Body != nil {
+		var err error
+		jsonBody, err = json.Marshal(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request body into JSON: %v", err)
+		}
+	}
+
+	target, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	var domains []*url.URL
+	if c.domains != nil && c.domains.contains(target) {
+		domains = c.domains.order(time.Now())
+	}
+
+	timeout := c.timeout
+	if r.Timeout > 0 {
+		timeout = r.Timeout
+	}
+	idempotent := isIdempotent(r)
+	retries := 0
+	if idempotent {
+		// Try every domain at least once
+		retries = c.maxRetries
+		if retries < len(domains)-1 {
+			retries = len(domains) - 1
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		requestURL := r.URL
+		var domain *url.URL
+		if len(domains) > 0 {
+			domain = domains[attempt%len(domains)]
+			requestURL = withOrigin(target, domain)
+		}
+
+		resp, sent, err := c.attempt(ctx, r, requestURL, jsonBody, timeout)
+		if domain != nil && sent && ctx.Err() == nil {
+			c.domains.report(domain, isDomainFailure(err), time.Now())
+		}
+		if err == nil {
+			return resp, nil
+		}
+		if !sent || ctx.Err() != nil {
+			return nil, err
+		}
+
+		canRetry := idempotent && attempt < retries && isRetryable(err)
+		canFailover := !idempotent && attempt < len(domains)-1 && isDialError(err)
+		if !canRetry && !canFailover {
+			return nil, err
+		}
+
+		// Fail over to the next domain straight away, wait before trying the same domains again
+		if len(domains) > 1 && (attempt+1)%len(domains) != 0 {
+			continue
+		}
+		round := attempt
+		if len(domains) > 0 {
+			round = attempt / len(domains)
+		}
+		timer := time.NewTimer(c.retryDelay(round, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// Domains returns the health of the configured domains, nil when no domains are configured.
+func (c *Client) Domains() []DomainStatus {
+	if c.domains == nil {
+		return nil
+	}
+	return c.domains.status(time.Now())
+}
+
+// attempt sends a single attempt of a request and reports whether the request was sent.
+func (c *Client) attempt(ctx context.Context, r Request, requestURL string, jsonBody []byte, timeout time.Duration) (*Response, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var bodyReader io.Reader
+	if jsonBody != nil {
+		bodyReader = bytes.NewReader(jsonBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, requestURL, bodyReader)
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating request: %v", err)
+	}
+	for key, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Authorization", c.basicAuth)
+	req.Header.Set("Content-Type", "application/json")
+
+	for _, hook := range c.requestHooks {
+		if err := hook(req); err != nil {
+			return nil, false, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.send(req)
+	for _, hook := range c.responseHooks {
+		hook(req, resp, err, time.Since(start))
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return resp, true, nil
+}
+
+// send executes the request and reads the response body.
+func (c *Client) send(req *http.Request) (*Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if len(responseBody) > maxResponseSize {
+		return nil, ErrResponseTooLarge
+	}
+
+	response := &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: responseBody}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp.StatusCode, responseBody)
+		apiErr.retryAfter = resp.Header.Get("Retry-After")
+		return response, apiErr
+	}
+	return response, nil
+}
+
+// retryDelay returns the delay before the next attempt.
+// Uses the Retry-After header when Agora sends one, otherwise exponential backoff with jitter between half and the full delay.
+func (c *Client) retryDelay(attempt int, err error) time.Duration {
+	if apiErr, ok := AsAPIError(err); ok {
+		if seconds, parseErr := strconv.Atoi(apiErr.retryAfter); parseErr == nil && seconds >= 0 {
+			if delay := time.Duration(seconds) * time.Second; delay < c.maxDelay {
+				return delay
+			}
+			return c.maxDelay
+		}
+	}
+
+	delay := c.baseDelay << uint(attempt)
+	if delay <= 0 || delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// isIdempotent reports whether a request can safely be retried.
+func isIdempotent(r Request) bool {
+	if r.Idempotent != nil {
+		return *r.Idempotent
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// isRetryable reports whether a failed attempt should be retried.
+// Network errors and 429 / 5xx responses are retried, responses that are too large are not.
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+	if apiErr, ok := AsAPIError(err); ok {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
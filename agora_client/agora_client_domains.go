@@ -0,0 +1,163 @@
+package agora_client
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for ejecting unhealthy domains.
+const (
+	DefaultEjectAfter    = 3                // Consecutive failures before a domain is ejected.
+	DefaultEjectDuration = 30 * time.Second // How long an ejected domain is skipped.
+)
+
+// domainPool holds an ordered list of Agora REST domains and tracks their health.
+// Requests go to the first healthy domain and fail over to the next one, domains with repeated failures are ejected for a while.
+type domainPool struct {
+	mu            sync.Mutex
+	domains       []*domainHealth // Domains in order of preference.
+	ejectAfter    int             // Consecutive failures before a domain is ejected.
+	ejectDuration time.Duration   // How long an ejected domain is skipped.
+}
+
+// domainHealth tracks the health of a single domain.
+type domainHealth struct {
+	origin       *url.URL  // Scheme and host of the domain.
+	failures     int       // Consecutive failures.
+	ejectedUntil time.Time // Time until which the domain is skipped.
+}
+
+// DomainStatus describes the health of a domain, as returned by Client.Domains.
+type DomainStatus struct {
+	Domain       string    // Scheme and host of the domain, e.g. "https://api.sd-rtn.com".
+	Failures     int       // Consecutive failures.
+	EjectedUntil time.Time // (Optional) time until which the domain is skipped, zero when the domain is healthy.
+}
+
+// newDomainPool parses the domains into a pool, only the scheme and host of each domain are used.
+// Invalid domains are logged and skipped, nil is returned when no domain is valid.
+func newDomainPool(domains []string, ejectAfter int, ejectDuration time.Duration) *domainPool {
+	pool := &domainPool{ejectAfter: ejectAfter, ejectDuration: ejectDuration}
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
+		}
+		origin, err := url.Parse(domain)
+		if err != nil || origin.Scheme == "" || origin.Host == "" {
+			log.Printf("WARNING: skipping invalid Agora domain %q, expected a URL like https://api.sd-rtn.com", domain)
+			continue
+		}
+		origin = &url.URL{Scheme: origin.Scheme, Host: origin.Host}
+		if seen[origin.String()] {
+			continue
+		}
+		seen[origin.String()] = true
+		pool.domains = append(pool.domains, &domainHealth{origin: origin})
+	}
+	if len(pool.domains) == 0 {
+		return nil
+	}
+	return pool
+}
+
+// contains reports whether the URL points at one of the domains in the pool.
+// Only requests to a pooled domain are failed over, other URLs are sent as they are.
+func (p *domainPool) contains(u *url.URL) bool {
+	for _, domain := range p.domains {
+		if domain.origin.Scheme == u.Scheme && domain.origin.Host == u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// order returns the domains to try, healthy domains first in configured order.
+// When every domain is ejected all of them are returned, so requests are never refused without being sent.
+func (p *domainPool) order(now time.Time) []*url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var healthy, ejected []*url.URL
+	for _, domain := range p.domains {
+		if now.Before(domain.ejectedUntil) {
+			ejected = append(ejected, domain.origin)
+		} else {
+			healthy = append(healthy, domain.origin)
+		}
+	}
+	return append(healthy, ejected...)
+}
+
+// report records the outcome of a request sent to a domain.
+// A success resets the failure count, a domain failure ejects the domain once it reaches ejectAfter consecutive failures.
+func (p *domainPool) report(origin *url.URL, failed bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, domain := range p.domains {
+		if domain.origin != origin {
+			continue
+		}
+		if !failed {
+			domain.failures = 0
+			domain.ejectedUntil = time.Time{}
+			return
+		}
+		domain.failures++
+		if p.ejectAfter > 0 && domain.failures >= p.ejectAfter {
+			domain.ejectedUntil = now.Add(p.ejectDuration)
+		}
+		return
+	}
+}
+
+// status returns the health of every domain.
+func (p *domainPool) status(now time.Time) []DomainStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	statuses := make([]DomainStatus, 0, len(p.domains))
+	for _, domain := range p.domains {
+		status := DomainStatus{Domain: domain.origin.String(), Failures: domain.failures}
+		if now.Before(domain.ejectedUntil) {
+			status.EjectedUntil = domain.ejectedUntil
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// withOrigin returns a copy of the URL with the scheme and host of the domain.
+func withOrigin(u *url.URL, origin *url.URL) string {
+	rewritten := *u
+	rewritten.Scheme = origin.Scheme
+	rewritten.Host = origin.Host
+	return rewritten.String()
+}
+
+// isDomainFailure reports whether an error means the domain itself is unhealthy.
+// Network errors and 5xx responses count against a domain, other API errors are answers from a healthy domain.
+func isDomainFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// isDialError reports whether a request failed before a connection was made, so the request never reached Agora.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
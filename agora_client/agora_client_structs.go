@@ -0,0 +1,76 @@
+package agora_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Request describes a single call to an Agora REST API.
+type Request struct {
+	Method     string        // The HTTP method (e.g., "GET", "POST").
+	URL        string        // The endpoint URL to which the request is sent.
+	Body       interface{}   // (Optional) payload, marshaled into JSON.
+	Header     http.Header   // (Optional) additional headers, e.g. X-Request-ID.
+	Timeout    time.Duration // (Optional) timeout for each attempt, defaults to the client timeout.
+	Idempotent *bool         // (Optional) overrides whether the request is retried, defaults to true for GET, HEAD, PUT, DELETE and OPTIONS.
+}
+
+// Response contains the result of a successful call to an Agora REST API.
+type Response struct {
+	StatusCode int         // The HTTP status code returned by the Agora API.
+	Header     http.Header // The response headers.
+	Body       []byte      // The raw response body.
+}
+
+// RequestHook is called before each attempt of a request is sent.
+// Hooks can add headers or log the request, returning an error cancels the request.
+type RequestHook func(req *http.Request) error
+
+// ResponseHook is called after each attempt of a request, with the response if one was received and the error if the attempt failed.
+type ResponseHook func(req *http.Request, resp *Response, err error, elapsed time.Duration)
+
+// APIError is returned when the Agora API responds with a non-200 status code.
+// It keeps the status code and raw response body, along with the error fields Agora includes in its JSON error body.
+type APIError struct {
+	StatusCode int    // The HTTP status code returned by the Agora API.
+	Body       []byte // The raw response body returned by the Agora API.
+	Code       int    // (Optional) Agora's error code from the "code" field of the body.
+	Reason     string // (Optional) Agora's error reason from the "reason" field of the body.
+	Message    string // (Optional) Agora's error message from the "message" field of the body.
+
+	retryAfter string // The Retry-After header of the response, used to delay retries.
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, string(e.Body))
+}
+
+// newAPIError builds an APIError, decoding the error fields when the body is JSON.
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Body: body}
+	var errorBody struct {
+		Code    json.Number `json:"code"`
+		Reason  string      `json:"reason"`
+		Message string      `json:"message"`
+	}
+	if json.Unmarshal(body, &errorBody) == nil {
+		if code, err := errorBody.Code.Int64(); err == nil {
+			apiErr.Code = int(code)
+		}
+		apiErr.Reason = errorBody.Reason
+		apiErr.Message = errorBody.Message
+	}
+	return apiErr
+}
+
+// AsAPIError returns the APIError wrapped in err, if there is one.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
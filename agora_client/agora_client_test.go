@@ -0,0 +1,301 @@
+package agora_client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(opts ...Option) *Client {
+	opts = append([]Option{WithRetry(2, time.Millisecond, 5*time.Millisecond)}, opts...)
+	return NewClient("Basic test", opts...)
+}
+
+func TestMakeRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "Basic test", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"cname":"test"}`, string(body))
+		w.Write([]byte(`{"resourceId":"test_resource"}`))
+	}))
+	defer server.Close()
+
+	body, err := newTestClient().MakeRequest(context.Background(), "POST", server.URL, map[string]string{"cname": "test"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"resourceId":"test_resource"}`, string(body))
+}
+
+func TestResponseTooLarge(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(bytes.Repeat([]byte(" "), maxResponseSize+1))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().MakeRequest(context.Background(), "GET", server.URL, nil)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+	// The response is not retried
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404,"reason":"failed to find worker"}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().MakeRequest(context.Background(), "GET", server.URL, nil)
+	apiErr, ok := AsAPIError(err)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, 404, apiErr.Code)
+		assert.Equal(t, "failed to find worker", apiErr.Reason)
+		assert.Contains(t, apiErr.Error(), "API request failed with status 404")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("Idempotent request is retried", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		_, err := newTestClient().MakeRequest(context.Background(), "GET", server.URL, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Retries are limited", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := newTestClient().MakeRequest(context.Background(), "DELETE", server.URL, nil)
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Non idempotent request is not retried", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		_, err := newTestClient().MakeRequest(context.Background(), "POST", server.URL, map[string]string{})
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		_, err := newTestClient().MakeRequest(context.Background(), "GET", server.URL, nil)
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("Idempotent override", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 2 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		idempotent := true
+		_, err := newTestClient().Do(context.Background(), Request{Method: "POST", URL: server.URL, Body: map[string]string{}, Idempotent: &idempotent})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+}
+
+func TestTimeoutAndCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Per call timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := newTestClient(WithRetry(0, 0, 0)).Do(context.Background(), Request{Method: "GET", URL: server.URL, Timeout: 20 * time.Millisecond})
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("Cancelled context stops retries", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := newTestClient().MakeRequest(ctx, "GET", server.URL, nil)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+}
+
+func TestHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		json.NewEncoder(w).Encode(map[string]string{"hook": r.Header.Get("X-Hook")})
+	}))
+	defer server.Close()
+
+	var responses []*Response
+	client := newTestClient(
+		WithRequestHook(func(req *http.Request) error {
+			req.Header.Set("X-Hook", "set")
+			return nil
+		}),
+		WithResponseHook(func(req *http.Request, resp *Response, err error, elapsed time.Duration) {
+			responses = append(responses, resp)
+		}),
+	)
+
+	resp, err := client.Do(context.Background(), Request{Method: "GET", URL: server.URL, Header: http.Header{"X-Request-ID": []string{"test_request"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "test_request", resp.Header.Get("X-Request-ID"))
+	assert.JSONEq(t, `{"hook":"set"}`, string(resp.Body))
+	assert.Len(t, responses, 1)
+}
+
+// newDomainServer returns a test server that counts its requests and responds with the given status code.
+func newDomainServer(status int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+}
+
+// closedServerURL returns the URL of a server that no longer accepts connections.
+func closedServerURL() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func TestDomainFailover(t *testing.T) {
+	t.Run("Idempotent request fails over to the next domain", func(t *testing.T) {
+		var primaryCalls, backupCalls int32
+		primary := newDomainServer(http.StatusServiceUnavailable, &primaryCalls)
+		defer primary.Close()
+		backup := newDomainServer(http.StatusOK, &backupCalls)
+		defer backup.Close()
+
+		client := newTestClient(WithDomains(primary.URL, backup.URL))
+		body, err := client.MakeRequest(context.Background(), "GET", primary.URL+"/v1/apps/test/query", nil)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"path":"/v1/apps/test/query"}`, string(body))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCalls))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&backupCalls))
+
+		domains := client.Domains()
+		assert.Equal(t, 1, domains[0].Failures)
+		assert.Equal(t, 0, domains[1].Failures)
+	})
+
+	t.Run("Non idempotent request fails over when the domain is unreachable", func(t *testing.T) {
+		var backupCalls int32
+		backup := newDomainServer(http.StatusOK, &backupCalls)
+		defer backup.Close()
+		primaryURL := closedServerURL()
+
+		client := newTestClient(WithDomains(primaryURL, backup.URL))
+		_, err := client.MakeRequest(context.Background(), "POST", primaryURL+"/acquire", map[string]string{})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&backupCalls))
+	})
+
+	t.Run("Non idempotent request is not sent twice", func(t *testing.T) {
+		var primaryCalls, backupCalls int32
+		primary := newDomainServer(http.StatusBadGateway, &primaryCalls)
+		defer primary.Close()
+		backup := newDomainServer(http.StatusOK, &backupCalls)
+		defer backup.Close()
+
+		client := newTestClient(WithDomains(primary.URL, backup.URL))
+		_, err := client.MakeRequest(context.Background(), "POST", primary.URL+"/start", map[string]string{})
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCalls))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&backupCalls))
+	})
+
+	t.Run("Domain is ejected after repeated failures", func(t *testing.T) {
+		var primaryCalls, backupCalls int32
+		primary := newDomainServer(http.StatusInternalServerError, &primaryCalls)
+		defer primary.Close()
+		backup := newDomainServer(http.StatusOK, &backupCalls)
+		defer backup.Close()
+
+		client := newTestClient(WithDomains(primary.URL, backup.URL), WithDomainEjection(2, time.Minute))
+		for i := 0; i < 3; i++ {
+			_, err := client.MakeRequest(context.Background(), "GET", primary.URL+"/query", nil)
+			assert.NoError(t, err)
+		}
+		// The third request skips the ejected primary domain
+		assert.Equal(t, int32(2), atomic.LoadInt32(&primaryCalls))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&backupCalls))
+		assert.False(t, client.Domains()[0].EjectedUntil.IsZero())
+	})
+
+	t.Run("Client errors do not count against a domain", func(t *testing.T) {
+		var primaryCalls, backupCalls int32
+		primary := newDomainServer(http.StatusNotFound, &primaryCalls)
+		defer primary.Close()
+		backup := newDomainServer(http.StatusOK, &backupCalls)
+		defer backup.Close()
+
+		client := newTestClient(WithDomains(primary.URL, backup.URL))
+		_, err := client.MakeRequest(context.Background(), "GET", primary.URL+"/query", nil)
+		assert.Error(t, err)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&backupCalls))
+		assert.Equal(t, 0, client.Domains()[0].Failures)
+	})
+
+	t.Run("Other URLs are not rewritten", func(t *testing.T) {
+		var primaryCalls, otherCalls int32
+		primary := newDomainServer(http.StatusOK, &primaryCalls)
+		defer primary.Close()
+		other := newDomainServer(http.StatusOK, &otherCalls)
+		defer other.Close()
+
+		client := newTestClient(WithDomains(primary.URL))
+		_, err := client.MakeRequest(context.Background(), "GET", other.URL+"/query", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&primaryCalls))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&otherCalls))
+	})
+}
@@ -0,0 +1,164 @@
+package api_errors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader is the header with the ID of a request, returned in Error.RequestID.
+const RequestIDHeader = "X-Request-ID"
+
+// Error codes, derived from the HTTP status of the error.
+const (
+	CodeInvalidRequest  = "invalid_request"     // 400: the request is malformed or has invalid values
+	CodeUnauthorized    = "unauthorized"        // 401: the request has missing or invalid credentials
+	CodeForbidden       = "forbidden"           // 403: the caller may not make the request
+	CodeNotFound        = "not_found"           // 404: the resource does not exist
+	CodeConflict        = "conflict"            // 409: the request conflicts with the state of the resource
+	CodeGone            = "gone"                // 410: the resource is no longer available
+	CodeTooLarge        = "too_large"           // 413: the request body is too large
+	CodeRateLimited     = "rate_limited"        // 429: too many requests, retry later
+	CodeInternal        = "internal_error"      // 500: the request failed on the server
+	CodeUpstreamError   = "upstream_error"      // 502: the Agora API returned an unexpected error
+	CodeUnavailable     = "service_unavailable" // 503: the server or the Agora API is temporarily unavailable
+	CodeUpstreamTimeout = "upstream_timeout"    // 504: the Agora API did not respond in time
+	CodeError           = "error"               // Any other status
+)
+
+// Error is the error returned by every route, in the "error" field of the JSON response body:
+//
+//	{"error": {"code": "conflict", "message": "...", "upstreamStatus": 400, "upstreamCode": 7, "retryable": false}}
+type Error struct {
+	Status         int          `json:"-"`                        // The HTTP status of the response
+	Code           string       `json:"code"`                     // Machine readable code, see the Code constants
+	Message        string       `json:"message"`                  // Human readable description of the error
+	UpstreamStatus int          `json:"upstreamStatus,omitempty"` // The HTTP status returned by the Agora API, if it failed
+	UpstreamCode   int          `json:"upstreamCode,omitempty"`   // Agora's error code, if the Agora API returned one
+	RequestID      string       `json:"requestId,omitempty"`      // The X-Request-ID of the request, if it has one
+	Retryable      bool         `json:"retryable"`                // Whether the same request may succeed when retried later
+	Fields         []FieldError `json:"fields,omitempty"`         // The invalid fields of the request body, for validation errors
+}
+
+// FieldError describes an invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`   // The JSON path of the field, e.g. "recordingConfig.maxIdleTime"
+	Message string `json:"message"` // Why the value is invalid, e.g. "is required"
+}
+
+// response is the JSON body of an error response.
+type response struct {
+	Error *Error `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New returns an Error with the code of the HTTP status. Errors with a 429, 503 or 504 status are retryable.
+func New(status int, message string) *Error {
+	return &Error{
+		Status:    status,
+		Code:      CodeForStatus(status),
+		Message:   message,
+		Retryable: status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout,
+	}
+}
+
+// CodeForStatus returns the error code of an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusInternalServerError:
+		return CodeInternal
+	case http.StatusBadGateway:
+		return CodeUpstreamError
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeUpstreamTimeout
+	}
+	return CodeError
+}
+
+// Abort writes the error response for err and aborts the request.
+// An *Error in err is written with its own status, any other error with the given status and its message.
+func Abort(c *gin.Context, status int, err error) {
+	apiErr := asError(status, err)
+	apiErr.RequestID = c.GetHeader(RequestIDHeader)
+	c.AbortWithStatusJSON(apiErr.Status, response{Error: apiErr})
+}
+
+// AbortMessage writes an error response with the status and message, and aborts the request.
+func AbortMessage(c *gin.Context, status int, message string) {
+	Abort(c, status, New(status, message))
+}
+
+// AbortUpstream writes the error response for a failed call to an Agora API, and aborts the request.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context of the request.
+//   - service: Service - The Agora API that was called, its error codes are mapped to HTTP statuses, see FromAgora.
+//   - operation: string - Description of the failed operation, prefixed to the message, e.g. "Failed to start recording".
+//   - err: error - The error returned by the call.
+//
+// Behavior:
+//   - Errors from the Agora API, see agora_client.APIError, are mapped with FromAgora.
+//   - Timeouts are returned as a retryable 504, and network errors as a retryable 503.
+//   - Any other error, e.g. an invalid response, is returned as a 500.
+func AbortUpstream(c *gin.Context, service Service, operation string, err error) {
+	var apiErr *Error
+	if agoraErr, ok := agora_client.AsAPIError(err); ok {
+		apiErr = FromAgora(service, agoraErr)
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		apiErr = New(http.StatusGatewayTimeout, "the Agora API did not respond in time")
+	} else if netErr := (net.Error)(nil); errors.As(err, &netErr) {
+		apiErr = New(http.StatusServiceUnavailable, "the Agora API is unreachable: "+err.Error())
+	} else {
+		apiErr = New(http.StatusInternalServerError, err.Error())
+	}
+	if operation != "" {
+		apiErr.Message = fmt.Sprintf("%s: %s", operation, apiErr.Message)
+	}
+	Abort(c, apiErr.Status, apiErr)
+}
+
+// Write writes the error response for err to a response writer, for handlers without a Gin context.
+// An *Error in err is written with its own status, any other error with the given status and its message.
+func Write(w http.ResponseWriter, status int, err error) {
+	apiErr := asError(status, err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(response{Error: apiErr})
+}
+
+// asError returns a copy of the *Error in err, or a new Error with the status and the message of err.
+func asError(status int, err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		copied := *apiErr
+		return &copied
+	}
+	return New(status, err.Error())
+}
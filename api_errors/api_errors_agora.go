@@ -0,0 +1,134 @@
+package api_errors
+
+import (
+	"net/http"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+)
+
+// Service identifies an Agora API, the same error code means different things in each API.
+type Service string
+
+// Agora APIs called by the services.
+const (
+	ServiceCloudRecording Service = "cloud_recording" // Cloud Recording, errors are identified by the "code" of the body
+	ServiceRTT            Service = "rtt"             // Real-Time Transcription, errors are identified by the HTTP status
+	ServiceRTMP           Service = "rtmp"            // Media Push and Cloud Player, errors are identified by the HTTP status
+)
+
+// agoraError is how an Agora error is returned to the client.
+type agoraError struct {
+	status    int    // The HTTP status returned to the client
+	message   string // Description of the error
+	retryable bool   // Whether the same request may succeed when retried later
+}
+
+// cloudRecordingCodes maps the error codes of the Cloud Recording API.
+var cloudRecordingCodes = map[int]agoraError{
+	2:    {status: http.StatusBadRequest, message: "invalid request parameters"},
+	7:    {status: http.StatusConflict, message: "the recording is already running for this resource"},
+	8:    {status: http.StatusBadRequest, message: "invalid request header"},
+	49:   {status: http.StatusConflict, message: "the recording has already been stopped"},
+	53:   {status: http.StatusConflict, message: "a recording with the same UID is already running in the channel"},
+	65:   {status: http.StatusServiceUnavailable, message: "network jitter between the recording service and Agora", retryable: true},
+	109:  {status: http.StatusBadRequest, message: "the recording token has expired"},
+	110:  {status: http.StatusBadRequest, message: "the recording token is invalid"},
+	404:  {status: http.StatusNotFound, message: "the recording was not found"},
+	432:  {status: http.StatusBadRequest, message: "the request parameters do not match the resource"},
+	433:  {status: http.StatusNotFound, message: "the resource ID has expired, acquire a new resource"},
+	435:  {status: http.StatusNotFound, message: "no recorded files, nobody published in the channel"},
+	501:  {status: http.StatusConflict, message: "the recording is exiting", retryable: true},
+	1001: {status: http.StatusBadRequest, message: "the resource ID is invalid"},
+	1003: {status: http.StatusBadRequest, message: "the app ID or recording ID does not match the resource"},
+	1013: {status: http.StatusBadRequest, message: "the channel name is invalid"},
+	1028: {status: http.StatusBadRequest, message: "invalid layout parameters"},
+}
+
+// rttStatuses maps the HTTP statuses of the Real-Time Transcription API.
+var rttStatuses = map[int]agoraError{
+	http.StatusBadRequest:         {status: http.StatusBadRequest, message: "invalid transcription request"},
+	http.StatusNotFound:           {status: http.StatusNotFound, message: "the transcription task was not found"},
+	http.StatusConflict:           {status: http.StatusConflict, message: "a transcription task is already running for this builder token"},
+	http.StatusTooManyRequests:    {status: http.StatusTooManyRequests, message: "too many transcription requests", retryable: true},
+	http.StatusServiceUnavailable: {status: http.StatusServiceUnavailable, message: "the transcription service is unavailable", retryable: true},
+}
+
+// rtmpStatuses maps the HTTP statuses of the Media Push and Cloud Player APIs.
+var rtmpStatuses = map[int]agoraError{
+	http.StatusBadRequest:         {status: http.StatusBadRequest, message: "invalid Media Push or Cloud Player request"},
+	http.StatusNotFound:           {status: http.StatusNotFound, message: "the converter or player was not found"},
+	http.StatusConflict:           {status: http.StatusConflict, message: "a converter or player with the same name is already running"},
+	http.StatusTooManyRequests:    {status: http.StatusTooManyRequests, message: "too many Media Push or Cloud Player requests", retryable: true},
+	http.StatusServiceUnavailable: {status: http.StatusServiceUnavailable, message: "the Media Push or Cloud Player service is unavailable", retryable: true},
+}
+
+// FromAgora returns the Error for an error response of an Agora API.
+//
+// Parameters:
+//   - service: Service - The Agora API that returned the error.
+//   - apiErr: *agora_client.APIError - The error response.
+//
+// Returns:
+//   - *Error: The error with the upstream status and code, and Agora's reason or message appended to the description.
+//
+// Behavior:
+//   - Known Cloud Recording codes, and known RTT and Media Push statuses, are mapped to a status and description.
+//   - Otherwise 400, 404, 409 and 429 are kept, 5xx statuses become a retryable 503, and the others a 502,
+//     e.g. a 401 means the server's customer credentials are invalid, which the client can't fix.
+func FromAgora(service Service, apiErr *agora_client.APIError) *Error {
+	mapped, known := agoraError{}, false
+	switch service {
+	case ServiceCloudRecording:
+		mapped, known = cloudRecordingCodes[apiErr.Code]
+	case ServiceRTT:
+		mapped, known = rttStatuses[apiErr.StatusCode]
+	case ServiceRTMP:
+		mapped, known = rtmpStatuses[apiErr.StatusCode]
+	}
+	if !known {
+		mapped = agoraErrorForStatus(apiErr.StatusCode)
+	}
+
+	message := mapped.message
+	if detail := agoraDetail(apiErr); detail != "" {
+		message += " (" + detail + ")"
+	}
+	return &Error{
+		Status:         mapped.status,
+		Code:           CodeForStatus(mapped.status),
+		Message:        message,
+		UpstreamStatus: apiErr.StatusCode,
+		UpstreamCode:   apiErr.Code,
+		Retryable:      mapped.retryable,
+	}
+}
+
+// agoraErrorForStatus maps the HTTP status of an Agora error without a known code.
+func agoraErrorForStatus(status int) agoraError {
+	switch {
+	case status == http.StatusBadRequest:
+		return agoraError{status: http.StatusBadRequest, message: "the Agora API rejected the request"}
+	case status == http.StatusNotFound:
+		return agoraError{status: http.StatusNotFound, message: "the Agora resource was not found"}
+	case status == http.StatusConflict:
+		return agoraError{status: http.StatusConflict, message: "the request conflicts with the state of the Agora resource"}
+	case status == http.StatusTooManyRequests:
+		return agoraError{status: http.StatusTooManyRequests, message: "too many requests to the Agora API", retryable: true}
+	case status >= http.StatusInternalServerError:
+		return agoraError{status: http.StatusServiceUnavailable, message: "the Agora API is unavailable", retryable: true}
+	}
+	return agoraError{status: http.StatusBadGateway, message: "the Agora API returned an error"}
+}
+
+// agoraDetail returns Agora's description of an error: the reason or message of the body, or the raw body when it has neither.
+func agoraDetail(apiErr *agora_client.APIError) string {
+	switch {
+	case apiErr.Reason != "":
+		return apiErr.Reason
+	case apiErr.Message != "":
+		return apiErr.Message
+	case apiErr.Code == 0 && len(apiErr.Body) > 0 && len(apiErr.Body) <= 512:
+		return string(apiErr.Body)
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package api_errors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	err := New(http.StatusConflict, "already running")
+	assert.Equal(t, http.StatusConflict, err.Status)
+	assert.Equal(t, CodeConflict, err.Code)
+	assert.Equal(t, "already running", err.Error())
+	assert.False(t, err.Retryable)
+
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		assert.True(t, New(status, "retry").Retryable, status)
+	}
+	assert.Equal(t, CodeError, CodeForStatus(http.StatusTeapot))
+}
+
+func TestFromAgora(t *testing.T) {
+	tests := []struct {
+		name           string
+		service        Service
+		apiErr         *agora_client.APIError
+		expectedStatus int
+		retryable      bool
+	}{
+		{"Recording already running", ServiceCloudRecording, &agora_client.APIError{StatusCode: 400, Code: 7}, http.StatusConflict, false},
+		{"Recording not found", ServiceCloudRecording, &agora_client.APIError{StatusCode: 404, Code: 404}, http.StatusNotFound, false},
+		{"Recording network jitter", ServiceCloudRecording, &agora_client.APIError{StatusCode: 400, Code: 65}, http.StatusServiceUnavailable, true},
+		{"Unknown recording code", ServiceCloudRecording, &agora_client.APIError{StatusCode: 400, Code: 9999}, http.StatusBadRequest, false},
+		{"RTT task conflict", ServiceRTT, &agora_client.APIError{StatusCode: 409}, http.StatusConflict, false},
+		{"RTMP rate limited", ServiceRTMP, &agora_client.APIError{StatusCode: 429}, http.StatusTooManyRequests, true},
+		{"Upstream server error", ServiceRTMP, &agora_client.APIError{StatusCode: 502}, http.StatusServiceUnavailable, true},
+		{"Invalid customer credentials", ServiceRTT, &agora_client.APIError{StatusCode: 401}, http.StatusBadGateway, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromAgora(tt.service, tt.apiErr)
+			assert.Equal(t, tt.expectedStatus, err.Status)
+			assert.Equal(t, CodeForStatus(tt.expectedStatus), err.Code)
+			assert.Equal(t, tt.apiErr.StatusCode, err.UpstreamStatus)
+			assert.Equal(t, tt.apiErr.Code, err.UpstreamCode)
+			assert.Equal(t, tt.retryable, err.Retryable)
+		})
+	}
+
+	err := FromAgora(ServiceCloudRecording, &agora_client.APIError{StatusCode: 400, Code: 2, Reason: "invalid uid"})
+	assert.Equal(t, "invalid request parameters (invalid uid)", err.Message)
+	err = FromAgora(ServiceRTMP, &agora_client.APIError{StatusCode: 404, Body: []byte("no such converter")})
+	assert.Equal(t, "the converter or player was not found (no such converter)", err.Message)
+}
+
+// decodeError decodes the error of an error response body.
+func decodeError(t *testing.T, body []byte) Error {
+	var resp struct {
+		Error Error `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &resp))
+	return resp.Error
+}
+
+func TestAbortUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	netErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Agora error", fmt.Errorf("failed: %w", &agora_client.APIError{StatusCode: 400, Code: 53}), http.StatusConflict, CodeConflict},
+		{"Timeout", fmt.Errorf("failed: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, CodeUpstreamTimeout},
+		{"Network error", netErr, http.StatusServiceUnavailable, CodeUnavailable},
+		{"Other error", errors.New("invalid response"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/cloud_recording/start", nil)
+			c.Request.Header.Set(RequestIDHeader, "req-1")
+
+			AbortUpstream(c, ServiceCloudRecording, "Failed to start recording", tt.err)
+
+			assert.True(t, c.IsAborted())
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			apiErr := decodeError(t, w.Body.Bytes())
+			assert.Equal(t, tt.expectedCode, apiErr.Code)
+			assert.Equal(t, "req-1", apiErr.RequestID)
+			assert.Contains(t, apiErr.Message, "Failed to start recording: ")
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	w := httptest.NewRecorder()
+	Write(w, http.StatusBadRequest, errors.New("invalid uid"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, Error{Code: CodeInvalidRequest, Message: "invalid uid"}, decodeError(t, w.Body.Bytes()))
+
+	// An *Error keeps its own status, and is not modified
+	original := New(http.StatusForbidden, "not allowed")
+	w = httptest.NewRecorder()
+	Write(w, http.StatusBadRequest, fmt.Errorf("denied: %w", original))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, CodeForbidden, decodeError(t, w.Body.Bytes()).Code)
+	assert.Equal(t, http.StatusForbidden, original.Status)
+}
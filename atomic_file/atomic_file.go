@@ -0,0 +1,68 @@
+package atomic_file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WriteFile replaces the file at path with data, so that after a crash or power loss the file holds either
+// its previous contents or data, never a partial write.
+//
+// Parameters:
+//   - path: string - The path of the file to replace, its directory must exist.
+//   - data: []byte - The new contents of the file.
+//
+// Returns:
+//   - error: An error if the file couldn't be written, the previous file is left unchanged.
+//
+// Behavior:
+//   - Writes data to a temporary file in the same directory and syncs it to disk.
+//   - Renames the temporary file over path, then syncs the directory so the rename itself is durable.
+//   - The file is created with mode 0600.
+//
+// Notes:
+//   - Directories can't be synced on Windows, there the rename is durable once the OS flushes its metadata.
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing temporary file: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error syncing temporary file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing temporary file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error replacing file: %v", err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir syncs a directory, making the creation, rename and removal of its files durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening directory: %v", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing directory: %v", err)
+	}
+	return nil
+}
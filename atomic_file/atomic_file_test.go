@@ -0,0 +1,49 @@
+package atomic_file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+
+	// Creates the file
+	assert.NoError(t, WriteFile(path, []byte(`{"a":1}`)))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(data))
+
+	// Replaces the file
+	assert.NoError(t, WriteFile(path, []byte(`{}`)))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(data))
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// A missing directory fails without creating the file
+	assert.Error(t, WriteFile(filepath.Join(dir, "missing", "store.json"), []byte(`{}`)))
+}
+
+func TestWriteFileKeepsPreviousOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store")
+	// A directory at the path can't be replaced by a file
+	assert.NoError(t, os.Mkdir(path, 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(path, "keep"), []byte("x"), 0o600))
+
+	assert.Error(t, WriteFile(path, []byte(`{}`)))
+	_, err := os.Stat(filepath.Join(path, "keep"))
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -1,14 +1,18 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleAcquireResourceReq constructs a URL, marshals the request payload, sends it to the Agora cloud recording API,
 // and processes the response to acquire a resource for cloud recording.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
 //   - acquireReq: AcquireResourceRequest - The structured data containing the details necessary for acquiring a resource.
 //
 // Returns:
@@ -18,18 +22,18 @@ import (
 // Behavior:
 //   - Converts the acquireReq object into JSON format for the API request.
 //   - Constructs the URL for sending the acquisition request to the Agora cloud recording API.
-//   - Utilizes makeRequest to perform the POST operation with the constructed URL and marshaled data.
+//   - Utilizes s.agoraClient.MakeRequest to perform the POST operation with the constructed URL and marshaled data.
 //   - Interprets the API's JSON response to extract the resource ID if the operation succeeds.
 //
 // Notes:
 //   - Assumes the availability of s.baseURL for constructing the request URL.
-func (s *CloudRecordingService) HandleAcquireResourceReq(acquireReq AcquireResourceRequest) (string, error) {
+func (s *CloudRecordingService) HandleAcquireResourceReq(ctx context.Context, acquireReq AcquireResourceRequest) (string, error) {
 
 	// Construct the URL for the POST request to acquire a cloud recording resource.
-	url := fmt.Sprintf("%s/acquire", s.baseURL)
+	url := fmt.Sprintf("%s/acquire", tenant_registry.URLFor(ctx, s.baseURL, s.appID))
 
 	// Send the POST request to the Agora cloud recording API.
-	body, err := s.makeRequest("POST", url, acquireReq)
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "POST", url, acquireReq)
 	if err != nil {
 		return "", err
 	}
@@ -1,47 +1,69 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleGetStatus constructs the URL and sends a GET request to the Agora cloud recording API
 // to retrieve the status of a specific cloud recording session.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
 //   - resourceId: string - Unique identifier for the resource in Agora Cloud Recording.
 //   - recordingId: string - Session ID associated with the recording.
 //   - modeType: string - Recording mode (e.g., individual, mix).
 //
 // Returns:
-//   - json.RawMessage: JSON formatted response from the Agora cloud recording API.
-//   - error: Error object if an issue occurs during the API call.
+//   - json.RawMessage: JSON formatted RecordingStatusResponse with the parsed file list.
+//   - error: Error object if an issue occurs during the API call. Wraps ErrRecordingNotFound when Agora cannot find the session.
+//
+// Behavior:
+//   - Sends a GET request to the query endpoint for the given recording session.
+//   - Parses the Agora response and decodes the file list into FileDetail or FileListEntry values based on the FileListMode.
+//   - Appends a timestamp to the response before returning it.
 //
 // Notes:
 //   - Assumes availability of s.baseURL for constructing the request URL.
-//   - Uses s.makeRequest to send the HTTP request and handles the response.
-func (s *CloudRecordingService) HandleGetStatus(resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
+//   - Uses s.agoraClient.MakeRequest to send the HTTP request and handles the response.
+//   - The file list is only reported once the recording has produced files, so an empty file list is not treated as an error.
+func (s *CloudRecordingService) HandleGetStatus(ctx context.Context, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
 
 	// Construct the URL for the GET request to the cloud recording status endpoint.
-	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/query", s.baseURL, resourceId, recordingId, modeType)
+	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/query", tenant_registry.URLFor(ctx, s.baseURL, s.appID), resourceId, recordingId, modeType)
 
 	// Send the GET request to the Agora cloud recording API.
-	body, err := s.makeRequest("GET", url, nil)
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "GET", url, nil)
 	if err != nil {
-		return []byte{}, err
+		if isRecordingNotFound(err) {
+			return nil, recordingNotFoundError{err: err}
+		}
+		return nil, err
 	}
 
 	// Parse the response body to verify it conforms to the expected structure.
-	var response ActiveRecordingResponse
+	var response RecordingStatusResponse
 	err = json.Unmarshal(body, &response)
 	if err != nil {
-		return []byte{}, fmt.Errorf("error parsing response body into ActiveRecordingResponse: %v", err)
+		return nil, fmt.Errorf("error parsing response body into RecordingStatusResponse: %v", err)
 	}
+	response.RecordingMode = modeType
 
-	// Validate the structure of the FileList based on the specified FileListMode.
-	_, err = response.ServerResponse.UnmarshalFileList()
-	if err != nil {
-		return nil, fmt.Errorf("error parsing ServerResponse: %v", err)
+	// Decode the file list into typed entries when Agora has reported one.
+	if response.ServerResponse.FileListMode != nil && response.ServerResponse.FileList != nil {
+		fileList, err := response.ServerResponse.UnmarshalFileList()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ServerResponse: %v", err)
+		}
+		switch files := fileList.(type) {
+		case []FileDetail:
+			response.FileDetails = files
+		case []FileListEntry:
+			response.FileListEntries = files
+		}
 	}
 
 	// Append a timestamp to the response for auditing purposes.
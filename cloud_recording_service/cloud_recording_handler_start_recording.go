@@ -1,15 +1,19 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleStartRecordingReq initiates a cloud recording session using Agora's cloud recording service.
 // It validates the request parameters, constructs the request URL, and sends the start recording request
-// to the Agora API using the makeRequest helper function.
+// to the Agora API using the shared Agora client.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
 //   - startReq: StartRecordingRequest - Contains the configuration settings for the recording session.
 //   - resourceId: string - The resource ID previously acquired to identify the resource for the recording.
 //   - modeType: string - Specifies the recording mode (e.g., individual, mix) to be used.
@@ -26,15 +30,15 @@ import (
 //
 // Notes:
 //   - Assumes the presence of s.baseURL for constructing the request URL.
-//   - Utilizes s.makeRequest for sending the HTTP request and handling the response.
-func (s *CloudRecordingService) HandleStartRecordingReq(startReq StartRecordingRequest, resourceId string, modeType string) (json.RawMessage, error) {
+//   - Utilizes s.agoraClient.MakeRequest for sending the HTTP request and handling the response.
+func (s *CloudRecordingService) HandleStartRecordingReq(ctx context.Context, startReq StartRecordingRequest, resourceId string, modeType string) (json.RawMessage, error) {
 	// Construct the URL for the start recording endpoint.
-	url := fmt.Sprintf("%s/resourceid/%s/mode/%s/start", s.baseURL, resourceId, modeType)
+	url := fmt.Sprintf("%s/resourceid/%s/mode/%s/start", tenant_registry.URLFor(ctx, s.baseURL, s.appID), resourceId, modeType)
 
 	fmt.Println("HandleStartRecordingReq with url: ", url)
 
 	// Send a POST request to the start recording endpoint.
-	body, err := s.makeRequest("POST", url, startReq)
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "POST", url, startReq)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,18 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleStopRecording processes the request to stop an ongoing cloud recording session in Agora's cloud recording service.
-// It constructs the appropriate URL, validates the request parameters, and utilizes makeRequest to communicate with the Agora API.
+// It constructs the appropriate URL, validates the request parameters, and utilizes agoraClient.MakeRequest to communicate with the Agora API.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
 //   - stopReq: StopRecordingRequest - Object containing the necessary details to stop the recording.
 //   - resourceId: string - The unique identifier for the resource (channel) that is being recorded.
 //   - recordingId: string - The unique identifier for the ongoing recording session.
@@ -27,14 +31,14 @@ import (
 // Notes:
 //   - The function assumes the availability of s.baseURL to construct the request URL.
 //   - This function throws errors if any identifiers or request parameters are invalid or nil, ensuring robust error handling.
-func (s *CloudRecordingService) HandleStopRecording(stopReq StopRecordingRequest, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
+func (s *CloudRecordingService) HandleStopRecording(ctx context.Context, stopReq StopRecordingRequest, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
 	// Construct the URL for the stop recording endpoint.
-	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/stop", s.baseURL, resourceId, recordingId, modeType)
+	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/stop", tenant_registry.URLFor(ctx, s.baseURL, s.appID), resourceId, recordingId, modeType)
 
 	fmt.Println("HandleAcquireResourceReq with url: ", url)
 
 	// Send a POST request to the stop recording endpoint.
-	body, err := s.makeRequest("POST", url, stopReq)
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "POST", url, stopReq)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,18 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleUpdateLayout processes the request to update the video layout during an ongoing cloud recording session.
 // It constructs the request URL, validates the request data, and sends the update request to the Agora cloud recording API.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
 //   - updateReq: UpdateLayoutRequest - The request payload containing the new layout settings.
 //   - resourceId: string - The unique identifier for the resource (channel) that is being recorded.
 //   - recordingId: string - The unique identifier for the ongoing recording session.
@@ -26,15 +30,15 @@ import (
 //
 // Notes:
 //   - Assumes the presence of s.baseURL to construct the request URL.
-//   - The function uses s.makeRequest to handle the HTTP request and response handling efficiently.
-func (s *CloudRecordingService) HandleUpdateLayout(updateReq UpdateLayoutRequest, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
+//   - The function uses s.agoraClient.MakeRequest to handle the HTTP request and response handling efficiently.
+func (s *CloudRecordingService) HandleUpdateLayout(ctx context.Context, updateReq UpdateLayoutRequest, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
 	// Build the URL for the update layout endpoint.
-	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/updateLayout", s.baseURL, resourceId, recordingId, modeType)
+	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/updateLayout", tenant_registry.URLFor(ctx, s.baseURL, s.appID), resourceId, recordingId, modeType)
 
 	fmt.Println("HandleAcquireResourceReq with url: ", url)
 
 	// Send a POST request to the update layout endpoint with the new settings.
-	body, err := s.makeRequest("POST", url, updateReq)
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "POST", url, updateReq)
 	if err != nil {
 		return nil, err
 	}
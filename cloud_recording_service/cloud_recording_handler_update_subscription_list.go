@@ -1,14 +1,18 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleUpdateSubscriptionList processes the request to update the subscription list for a cloud recording session.
 // It validates the provided request parameters, constructs the request URL, and sends the request to the Agora cloud recording API.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
 //   - updateReq: UpdateSubscriptionRequest - The request payload containing the new subscription details.
 //   - resourceId: string - The unique identifier for the resource (channel) that is being recorded.
 //   - recordingId: string - The unique identifier for the ongoing recording session.
@@ -26,15 +30,15 @@ import (
 //
 // Notes:
 //   - Assumes the presence of s.baseURL to construct the request URL.
-//   - Utilizes s.makeRequest to handle the HTTP request and response efficiently.
-func (s *CloudRecordingService) HandleUpdateSubscriptionList(updateReq UpdateSubscriptionRequest, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
+//   - Utilizes s.agoraClient.MakeRequest to handle the HTTP request and response efficiently.
+func (s *CloudRecordingService) HandleUpdateSubscriptionList(ctx context.Context, updateReq UpdateSubscriptionRequest, resourceId string, recordingId string, modeType string) (json.RawMessage, error) {
 	// Construct the URL for the update subscription endpoint.
-	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/update", s.baseURL, resourceId, recordingId, modeType)
+	url := fmt.Sprintf("%s/resourceid/%s/sid/%s/mode/%s/update", tenant_registry.URLFor(ctx, s.baseURL, s.appID), resourceId, recordingId, modeType)
 
 	fmt.Println("HandleAcquireResourceReq with url: ", url)
 
 	// Send a POST request to the update subscription endpoint with the new details.
-	body, err := s.makeRequest("POST", url, updateReq)
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "POST", url, updateReq)
 	if err != nil {
 		return nil, err
 	}
@@ -2,31 +2,44 @@ package cloud_recording_service
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"math/rand"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
 	"github.com/gin-gonic/gin"
 )
 
 // CloudRecordingService represents the cloud recording service.
 // It holds the necessary configurations and dependencies for managing cloud recordings.
 type CloudRecordingService struct {
-	appID         string                      // The Agora app ID
-	baseURL       string                      // The base URL for the Agora cloud recording API
-	basicAuth     string                      // Middleware for handling requests
-	tokenService  *token_service.TokenService // Token service for generating tokens
-	storageConfig StorageConfig
+	appID                   string                      // The Agora app ID
+	baseURL                 string                      // The base URL for the Agora cloud recording API
+	agoraClient             *agora_client.Client        // Client for sending requests to the Agora API
+	tokenService            *token_service.TokenService // Token service for generating tokens
+	storageConfig           StorageConfig               // Default storage configuration, copied for each request
+	allowedStorageOverrides []string                    // Storage fields that clients are allowed to override when starting a recording
+	sessionStore            SessionStore                // Store for the active recording sessions
+	uidDirectory            *uid_directory.Directory    // (Optional) directory that resolves user accounts in UID lists to integer UIDs
 }
 
 // NewCloudRecordingService returns a CloudRecordingService pointer with all configurations set.
 // This function initializes a new CloudRecordingService with specified configurations. It ensures all provided parameters are valid and logs a fatal error if any required configurations are missing.
 //
 // Parameters:
+//   - agoraClient: *agora_client.Client - The shared client used to send requests to the Agora API.
 //   - tokenService: *token_service.TokenService - The token service for generating tokens.
+//   - storageConfig: StorageConfig - The default storage configuration.
+//   - allowedStorageOverrides: []string - The storage fields clients are allowed to override.
+//   - sessionStore: SessionStore - The store for active recording sessions, defaults to an in-memory store if nil.
 //
 // Returns:
 //   - *CloudRecordingService: The initialized CloudRecordingService struct.
@@ -36,21 +49,34 @@ type CloudRecordingService struct {
 //
 // Notes:
 //   - Logs a fatal error and exits if any required environment variables are missing.
-func NewCloudRecordingService(appID string, baseURL string, basicAuth string, tokenService *token_service.TokenService, storageConfig StorageConfig) *CloudRecordingService {
+func NewCloudRecordingService(appID string, baseURL string, agoraClient *agora_client.Client, tokenService *token_service.TokenService, storageConfig StorageConfig, allowedStorageOverrides []string, sessionStore SessionStore) *CloudRecordingService {
 
 	// Seed the random number generator with the current time
 	rand.Seed(time.Now().UnixNano())
 
+	// Default to keeping sessions in memory
+	if sessionStore == nil {
+		sessionStore = NewMemorySessionStore()
+	}
+
 	// Return a new instance of the service
 	return &CloudRecordingService{
-		appID:         appID,         // The Agora app ID used to identify the application within Agora services.
-		baseURL:       baseURL,       // The base URL for the Agora cloud recording API where all API requests are sent.
-		basicAuth:     basicAuth,     // Basic authentication credentials required for interacting with the Agora API.
-		tokenService:  tokenService,  // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
-		storageConfig: storageConfig, // Configuration for storage options including directory structure and file naming.
+		appID:                   appID,                   // The Agora app ID used to identify the application within Agora services.
+		baseURL:                 baseURL,                 // The base URL for the Agora cloud recording API where all API requests are sent.
+		agoraClient:             agoraClient,             // Shared client used to send authenticated requests to the Agora API.
+		tokenService:            tokenService,            // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
+		storageConfig:           storageConfig,           // Configuration for storage options including directory structure and file naming.
+		allowedStorageOverrides: allowedStorageOverrides, // Storage fields that clients are allowed to override when starting a recording.
+		sessionStore:            sessionStore,            // Store for the active recording sessions.
 	}
 }
 
+// SetUIDDirectory sets the directory that resolves the user accounts in subscribe and unsubscribe lists to integer UIDs.
+// Without a directory the lists are sent to Agora unchanged.
+func (s *CloudRecordingService) SetUIDDirectory(directory *uid_directory.Directory) {
+	s.uidDirectory = directory
+}
+
 // RegisterRoutes registers the routes for the CloudRecordingService.
 // It sets up the API endpoints and applies necessary middleware for request handling.
 //
@@ -60,7 +86,7 @@ func NewCloudRecordingService(appID string, baseURL string, basicAuth string, to
 // Behavior:
 //   - Creates an API group for cloud recording routes.
 //   - Applies middleware for NoCache and CORS.
-//   - Registers routes for ping, acquireResource, startRecording, stopRecording, getStatus, update subscriber list, and update layout.
+//   - Registers routes for ping, acquireResource, startRecording, stopRecording, getStatus, list sessions, update subscriber list, and update layout.
 //
 // Notes:
 //   - This function organizes the API routes and ensures that requests are handled with appropriate middleware.
@@ -71,6 +97,8 @@ func (s *CloudRecordingService) RegisterRoutes(r *gin.Engine) {
 	api.POST("/start", s.StartRecording)
 	api.POST("/stop", s.StopRecording)
 	api.GET("/status", s.GetStatus)
+	api.GET("/status/:resourceId/:sid/:mode", s.GetStatus)
+	api.GET("/sessions", s.ListSessions)
 	// "update" group route
 	updateAPI := api.Group("/update")
 	updateAPI.POST("/subscriber-list", s.UpdateSubscriptionList)
@@ -78,19 +106,16 @@ func (s *CloudRecordingService) RegisterRoutes(r *gin.Engine) {
 }
 
 func (s *CloudRecordingService) StartRecording(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientStartReq ClientStartRecordingRequest
-	if err := c.ShouldBindJSON(&clientStartReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !request_validation.BindJSON(c, &clientStartReq) {
 		return
 	}
 
 	sceneMode := 0
 	sceneModes := map[string]int{"realtime": 0, "web": 1, "postponed": 2}
 	if clientStartReq.SceneMode != nil {
-		if mode, ok := sceneModes[*clientStartReq.SceneMode]; ok {
-			sceneMode = mode
-		}
+		sceneMode = sceneModes[*clientStartReq.SceneMode]
 	}
 
 	// Default RecordingMode to "composite" if nil
@@ -99,12 +124,6 @@ func (s *CloudRecordingService) StartRecording(c *gin.Context) {
 		recordingMode = *clientStartReq.RecordingMode
 	}
 
-	// Validate recording mode against a set list
-	if !s.ValidateRecordingMode(recordingMode) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording mode."})
-		return
-	}
-
 	// Generate a unique UID for this recording session
 	uid := s.GenerateUID()
 
@@ -114,17 +133,22 @@ func (s *CloudRecordingService) StartRecording(c *gin.Context) {
 		Channel:   clientStartReq.ChannelName,
 		Uid:       uid,
 	}
-	token, err := s.tokenService.GenRtcToken(tokenRequest)
+	token, err := s.tokenService.ForContext(c.Request.Context()).GenRtcToken(tokenRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		api_errors.Abort(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	// Add dynamic directory structure ChannelName/YYYYMMDD/HHMMSS
+	// Build the storage config for this request, default to the dynamic directory structure ChannelName/YYYYMMDD/HHMMSS
 	currentTimeUTC := time.Now().UTC()
 	dateStr := currentTimeUTC.Format("20060102")
 	hrsMinSecStr := currentTimeUTC.Format("150405")
-	s.storageConfig.FileNamePrefix = &[]string{strings.ReplaceAll(clientStartReq.ChannelName, "-", ""), dateStr, hrsMinSecStr}
+	fileNamePrefix := []string{strings.ReplaceAll(clientStartReq.ChannelName, "-", ""), dateStr, hrsMinSecStr}
+	storageConfig, err := BuildStorageConfig(TenantStorageConfig(c.Request.Context(), s.storageConfig), clientStartReq.StorageConfig, s.allowedStorageOverrides, fileNamePrefix)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
 
 	// Check if RecordingConfig is nil, if so, create a default one
 	if clientStartReq.RecordingConfig == nil {
@@ -149,14 +173,20 @@ func (s *CloudRecordingService) StartRecording(c *gin.Context) {
 			SubscribeUidGroup:  &subscribeUidGroup,
 		}
 	}
+	// Replace the user accounts in the UID lists with their integer UIDs
+	recordingConfig := clientStartReq.RecordingConfig
+	if err := s.resolveUidLists(c.Request.Context(), clientStartReq.ChannelName, recordingConfig.SubscribeAudioUids, recordingConfig.UnsubscribeAudioUids, recordingConfig.SubscribeVideoUids, recordingConfig.UnsubscribeVideoUids); err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
 
 	// Assemble recording client request
 	recClientReq := AquireClientRequest{
 		Scene:               sceneMode,
-		ResourceExpiredHour: 24, // Assuming 24 hours, adjust as needed
+		ResourceExpiredHour: resourceExpiredHour, // The session is tracked until the resource expires, see maxSessionAge
 		StartParameter: ClientRequest{
 			Token:           token,
-			StorageConfig:   s.storageConfig,
+			StorageConfig:   storageConfig,
 			RecordingConfig: *clientStartReq.RecordingConfig,
 		},
 		ExcludeResourceIds: clientStartReq.ExcludeResourceIds,
@@ -168,9 +198,9 @@ func (s *CloudRecordingService) StartRecording(c *gin.Context) {
 		Uid:           uid,
 		ClientRequest: &recClientReq, // Initialize as an empty map
 	}
-	resourceID, err := s.HandleAcquireResourceReq(acquireReq)
+	resourceID, err := s.HandleAcquireResourceReq(c.Request.Context(), acquireReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acquire resource: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceCloudRecording, "Failed to acquire resource", err)
 		return
 	}
 
@@ -182,32 +212,66 @@ func (s *CloudRecordingService) StartRecording(c *gin.Context) {
 		Uid:   uid,
 		ClientRequest: ClientRequest{
 			Token:           token,
-			StorageConfig:   s.storageConfig,
+			StorageConfig:   storageConfig,
 			RecordingConfig: *clientStartReq.RecordingConfig,
 		},
 	}
 
 	// Start Recording
-	response, err := s.HandleStartRecordingReq(startReq, resourceID, recordingMode)
+	response, err := s.HandleStartRecordingReq(c.Request.Context(), startReq, resourceID, recordingMode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start recording: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceCloudRecording, "Failed to start recording", err)
 		return
 	}
 
+	// Record the session so it can be stopped, queried or updated using the channel name or recording ID
+	var startResponse StartRecordingResponse
+	if err := json.Unmarshal(response, &startResponse); err != nil {
+		api_errors.AbortMessage(c, http.StatusInternalServerError, "Failed to parse start response: "+err.Error())
+		return
+	}
+	session := RecordingSession{
+		RecordingId:   NewRecordingId(),
+		ChannelName:   clientStartReq.ChannelName,
+		Uid:           uid,
+		ResourceId:    startResponse.ResourceId,
+		Sid:           startResponse.Sid,
+		RecordingMode: recordingMode,
+		StartedAt:     time.Now().UTC(),
+		TenantID:      tenant_registry.IDFromContext(c.Request.Context()),
+	}
+	s.expireSessions(session.StartedAt)
+	if err := s.sessionStore.Save(session); err != nil {
+		// The recording is running, so return the Agora response without a recording ID
+		log.Println("Failed to save recording session:", err)
+	} else {
+		startResponse.RecordingId = session.RecordingId
+	}
+
 	// Return the wrapped Agora response
-	c.Data(http.StatusOK, "application/json", response)
+	c.JSON(http.StatusOK, startResponse)
 }
 
 // StopRecording
 func (s *CloudRecordingService) StopRecording(c *gin.Context) {
-	var respWriter = c.Writer
 	var clientStopReq ClientStopRecordingRequest
-	err := json.NewDecoder(c.Request.Body).Decode(&clientStopReq)
+	if !request_validation.BindJSON(c, &clientStopReq) {
+		return
+	}
+
+	// Look up the session when the recording is identified by recording ID or channel name
+	session, err := s.resolveSession(c.Request.Context(), clientStopReq.RecordingId, clientStopReq.Cname, clientStopReq.ResourceId, clientStopReq.Sid)
 	if err != nil {
-		// invalid request
-		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+		api_errors.Abort(c, sessionErrorStatus(err), err)
 		return
 	}
+	if session != nil {
+		clientStopReq.Cname = session.ChannelName
+		clientStopReq.Uid = session.Uid
+		clientStopReq.ResourceId = session.ResourceId
+		clientStopReq.Sid = session.Sid
+		clientStopReq.RecordingMode = &session.RecordingMode
+	}
 
 	// build the stop request from user request
 	stopReq := StopRecordingRequest{
@@ -222,37 +286,138 @@ func (s *CloudRecordingService) StopRecording(c *gin.Context) {
 		recordingMode = *clientStopReq.RecordingMode
 	}
 	// Send Stop Recording Request to Agora
-	response, err := s.HandleStopRecording(stopReq, clientStopReq.ResourceId, clientStopReq.Sid, recordingMode)
+	response, err := s.HandleStopRecording(c.Request.Context(), stopReq, clientStopReq.ResourceId, clientStopReq.Sid, recordingMode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// The recording has already stopped, so the session is no longer active
+		if isRecordingNotFound(err) {
+			s.removeSession(c.Request.Context(), session, clientStopReq.Sid)
+		}
+		api_errors.AbortUpstream(c, api_errors.ServiceCloudRecording, "Failed to stop recording", err)
 		return
 	}
+	s.removeSession(c.Request.Context(), session, clientStopReq.Sid)
 
 	// Return the wrapped Agora response
 	c.Data(http.StatusOK, "application/json", response)
 }
 
-// GetStatus
+// GetStatus handles querying the status of an ongoing cloud recording session.
+// The resourceId, sid and mode are read from the path when present, otherwise from the query string.
+// The session can also be identified using the "recordingId" or "channelName" query parameters.
+// Returns an HTTP 404 error when Agora reports that the recording does not exist, see api_errors.FromAgora.
 func (s *CloudRecordingService) GetStatus(c *gin.Context) {
-	// s.HandleGetStatus(c.Writer, c.Request)
+	resourceId := paramOrQuery(c, "resourceId")
+	sid := paramOrQuery(c, "sid")
+	recordingMode := "mix"
+	if mode := paramOrQuery(c, "mode"); mode != "" {
+		recordingMode = mode
+	}
+
+	// Look up the session when the recording is identified by recording ID or channel name
+	var recordingId *string
+	if id := c.Query("recordingId"); id != "" {
+		recordingId = &id
+	}
+	session, err := s.resolveSession(c.Request.Context(), recordingId, c.Query("channelName"), resourceId, sid)
+	if err != nil {
+		if errors.Is(err, errMissingSessionIdentifiers) {
+			api_errors.AbortMessage(c, http.StatusBadRequest, "resourceId and sid are required.")
+			return
+		}
+		api_errors.Abort(c, sessionErrorStatus(err), err)
+		return
+	}
+	if session != nil {
+		resourceId = session.ResourceId
+		sid = session.Sid
+		recordingMode = session.RecordingMode
+	}
+
+	// Validate recording mode against a set list
+	if !s.ValidateRecordingMode(recordingMode) {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid recording mode.")
+		return
+	}
+
+	// Query the recording status from Agora
+	response, err := s.HandleGetStatus(c.Request.Context(), resourceId, sid, recordingMode)
+	if err != nil {
+		// The recording has stopped, e.g. on its own after maxIdleTime, so the session is no longer active
+		if isRecordingNotFound(err) {
+			s.removeSession(c.Request.Context(), session, sid)
+		}
+		api_errors.AbortUpstream(c, api_errors.ServiceCloudRecording, "Failed to get recording status", err)
+		return
+	}
+
+	// Return the wrapped Agora response
+	c.Data(http.StatusOK, "application/json", response)
+}
+
+// ListSessions returns the active recording sessions.
+// The list can be filtered using the optional "channelName" query parameter, and only has the sessions of the request's tenant.
+func (s *CloudRecordingService) ListSessions(c *gin.Context) {
+	s.expireSessions(time.Now())
+	var sessions []RecordingSession
+	var err error
+	if channelName := c.Query("channelName"); channelName != "" {
+		sessions, err = FindSessionsByChannel(s.sessionStore, channelName)
+	} else {
+		sessions, err = s.sessionStore.List()
+	}
+	if err != nil {
+		api_errors.AbortMessage(c, http.StatusInternalServerError, "Failed to list recording sessions: "+err.Error())
+		return
+	}
+	sessions = FilterSessionsByTenant(sessions, tenant_registry.IDFromContext(c.Request.Context()))
+	if sessions == nil {
+		sessions = []RecordingSession{}
+	}
+
+	response, err := s.AddTimestamp(&RecordingSessionsResponse{Sessions: sessions})
+	if err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", response)
 }
 
 // UpdateSubscriptionList
 func (s *CloudRecordingService) UpdateSubscriptionList(c *gin.Context) {
-	var respWriter = c.Writer
 	var clientUpdateReq ClientUpdateSubscriptionRequest
-	err := json.NewDecoder(c.Request.Body).Decode(&clientUpdateReq)
-	if err != nil {
-		// invalid request
-		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+	if !request_validation.BindJSON(c, &clientUpdateReq) {
 		return
 	}
-	// Validate the update request
-	if !clientUpdateReq.UpdateConfig.IsValid() {
-		http.Error(respWriter, "Invalid update configuration", http.StatusBadRequest)
+	// Look up the session when the recording is identified by recording ID or channel name
+	session, err := s.resolveSession(c.Request.Context(), clientUpdateReq.RecordingId, clientUpdateReq.Cname, clientUpdateReq.ResourceId, clientUpdateReq.Sid)
+	if err != nil {
+		api_errors.Abort(c, sessionErrorStatus(err), err)
 		return
 	}
-	// build the stop request from user request
+	if session != nil {
+		clientUpdateReq.Cname = session.ChannelName
+		clientUpdateReq.Uid = session.Uid
+		clientUpdateReq.ResourceId = session.ResourceId
+		clientUpdateReq.Sid = session.Sid
+		clientUpdateReq.RecordingMode = &session.RecordingMode
+	}
+	// Replace the user accounts in the UID lists with their integer UIDs
+	if streamSubscribe := clientUpdateReq.UpdateConfig.StreamSubscribe; streamSubscribe != nil {
+		var uidLists []*[]string
+		if streamSubscribe.AudioUidList != nil {
+			uidLists = append(uidLists, streamSubscribe.AudioUidList.SubscribeAudioUids, streamSubscribe.AudioUidList.UnsubscribeAudioUids)
+		}
+		if streamSubscribe.VideoUidList != nil {
+			uidLists = append(uidLists, streamSubscribe.VideoUidList.SubscribeVideoUids, streamSubscribe.VideoUidList.UnsubscribeVideoUids)
+		}
+		if err := s.resolveUidLists(c.Request.Context(), clientUpdateReq.Cname, uidLists...); err != nil {
+			api_errors.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// build the update request from user request
 	updateReq := UpdateSubscriptionRequest{
 		Cname:         clientUpdateReq.Cname,
 		Uid:           clientUpdateReq.Uid,
@@ -265,9 +430,12 @@ func (s *CloudRecordingService) UpdateSubscriptionList(c *gin.Context) {
 	}
 
 	// Send Stop Recording Request to Agora
-	response, err := s.HandleUpdateSubscriptionList(updateReq, clientUpdateReq.ResourceId, clientUpdateReq.Sid, recordingMode)
+	response, err := s.HandleUpdateSubscriptionList(c.Request.Context(), updateReq, clientUpdateReq.ResourceId, clientUpdateReq.Sid, recordingMode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if isRecordingNotFound(err) {
+			s.removeSession(c.Request.Context(), session, clientUpdateReq.Sid)
+		}
+		api_errors.AbortUpstream(c, api_errors.ServiceCloudRecording, "Failed to update subscription list", err)
 		return
 	}
 
@@ -277,16 +445,26 @@ func (s *CloudRecordingService) UpdateSubscriptionList(c *gin.Context) {
 
 // UpdateLayout
 func (s *CloudRecordingService) UpdateLayout(c *gin.Context) {
-	var respWriter = c.Writer
 	var clientUpdateReq ClientUpdateLayoutRequest
-	err := json.NewDecoder(c.Request.Body).Decode(&clientUpdateReq)
+	if !request_validation.BindJSON(c, &clientUpdateReq) {
+		return
+	}
+
+	// Look up the session when the recording is identified by recording ID or channel name
+	session, err := s.resolveSession(c.Request.Context(), clientUpdateReq.RecordingId, clientUpdateReq.Cname, clientUpdateReq.ResourceId, clientUpdateReq.Sid)
 	if err != nil {
-		// invalid request
-		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+		api_errors.Abort(c, sessionErrorStatus(err), err)
 		return
 	}
+	if session != nil {
+		clientUpdateReq.Cname = session.ChannelName
+		clientUpdateReq.Uid = session.Uid
+		clientUpdateReq.ResourceId = session.ResourceId
+		clientUpdateReq.Sid = session.Sid
+		clientUpdateReq.RecordingMode = &session.RecordingMode
+	}
 
-	// build the stop request from user request
+	// build the update request from user request
 	updateReq := UpdateLayoutRequest{
 		Cname:         clientUpdateReq.Cname,
 		Uid:           clientUpdateReq.Uid,
@@ -299,9 +477,12 @@ func (s *CloudRecordingService) UpdateLayout(c *gin.Context) {
 	}
 
 	// Send Stop Recording Request to Agora
-	response, err := s.HandleUpdateLayout(updateReq, clientUpdateReq.ResourceId, clientUpdateReq.Sid, recordingMode)
+	response, err := s.HandleUpdateLayout(c.Request.Context(), updateReq, clientUpdateReq.ResourceId, clientUpdateReq.Sid, recordingMode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if isRecordingNotFound(err) {
+			s.removeSession(c.Request.Context(), session, clientUpdateReq.Sid)
+		}
+		api_errors.AbortUpstream(c, api_errors.ServiceCloudRecording, "Failed to update layout", err)
 		return
 	}
 
@@ -4,13 +4,21 @@ package cloud_recording_service
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
 	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
 )
 
 type MockCloudRecordingService struct {
@@ -200,3 +208,530 @@ func TestAddTimestamp(t *testing.T) {
 		t.Errorf("Timestamp is not recent: %v", *updatedResponse.Timestamp)
 	}
 }
+
+func TestGetStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora cloud recording API
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/resourceid/test_resource_id/sid/test_sid/mode/mix/query":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"resourceId":"test_resource_id","sid":"test_sid","serverResponse":{"status":5,"fileListMode":"json","fileList":[{"fileName":"test.m3u8","trackType":"audio_and_video","uid":"0","mixedAllUser":true,"isPlayable":true,"sliceStartTime":1609459200}]}}`))
+		case "/resourceid/test_resource_id/sid/test_sid/mode/individual/query":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"resourceId":"test_resource_id","sid":"test_sid","serverResponse":{"status":4}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"resourceId":"stopped_resource_id","sid":"stopped_sid","code":404}`))
+		}
+	}))
+	defer agoraServer.Close()
+
+	service := NewCloudRecordingService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), nil, StorageConfig{}, nil, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	t.Run("Query Parameters", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud_recording/status?resourceId=test_resource_id&sid=test_sid&mode=mix", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response RecordingStatusResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, 5, *response.ServerResponse.Status)
+		assert.Len(t, response.FileListEntries, 1)
+		assert.Equal(t, "test.m3u8", response.FileListEntries[0].FileName)
+		assert.NotNil(t, response.Timestamp)
+	})
+
+	t.Run("Path Parameters Without File List", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud_recording/status/test_resource_id/test_sid/individual", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response RecordingStatusResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "individual", response.RecordingMode)
+		assert.Empty(t, response.FileListEntries)
+	})
+
+	t.Run("Recording Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud_recording/status?resourceId=stopped_resource_id&sid=stopped_sid&mode=mix", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Invalid Mode", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud_recording/status?resourceId=test_resource_id&sid=test_sid&mode=invalid", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Invalid recording mode")
+	})
+
+	t.Run("Missing Sid", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud_recording/status?resourceId=test_resource_id", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestUnmarshalFileList(t *testing.T) {
+	stringMode := "string"
+	playlist := json.RawMessage(`"test_channel.m3u8"`)
+	response := ServerResponse{FileListMode: &stringMode, FileList: &playlist}
+
+	fileList, err := response.UnmarshalFileList()
+	assert.NoError(t, err)
+	assert.Equal(t, []FileDetail{{Filename: "test_channel.m3u8"}}, fileList)
+}
+
+func TestStartRecordingParallelStorageConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora cloud recording API, capturing the storage config sent for each channel
+	var mu sync.Mutex
+	startedStorage := make(map[string]StorageConfig)
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/acquire") {
+			w.Write([]byte(`{"resourceId":"test_resource_id"}`))
+			return
+		}
+		var startReq StartRecordingRequest
+		if err := json.NewDecoder(r.Body).Decode(&startReq); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		startedStorage[startReq.Cname] = startReq.ClientRequest.StorageConfig
+		mu.Unlock()
+		w.Write([]byte(`{"resourceId":"test_resource_id","sid":"test_sid","cname":"` + startReq.Cname + `","uid":"` + startReq.Uid + `"}`))
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	defaults := StorageConfig{Vendor: 1, Region: 0, Bucket: "default-bucket", AccessKey: "key", SecretKey: "secret"}
+	service := NewCloudRecordingService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, defaults, []string{StorageOverrideBucket}, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	const starts = 20
+	var wg sync.WaitGroup
+	for i := 0; i < starts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"channelName":"channel%d"}`, i)
+			if i%2 == 0 {
+				body = fmt.Sprintf(`{"channelName":"channel%d","storageConfig":{"bucket":"bucket%d"}}`, i, i)
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/cloud_recording/start", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, startedStorage, starts)
+	for i := 0; i < starts; i++ {
+		channel := fmt.Sprintf("channel%d", i)
+		storage := startedStorage[channel]
+		if assert.NotNil(t, storage.FileNamePrefix) {
+			assert.Equal(t, channel, (*storage.FileNamePrefix)[0])
+		}
+		if i%2 == 0 {
+			assert.Equal(t, fmt.Sprintf("bucket%d", i), storage.Bucket)
+		} else {
+			assert.Equal(t, "default-bucket", storage.Bucket)
+		}
+	}
+
+	// The shared defaults are never modified
+	assert.Nil(t, service.storageConfig.FileNamePrefix)
+	assert.Equal(t, "default-bucket", service.storageConfig.Bucket)
+
+	t.Run("Override not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/cloud_recording/start", strings.NewReader(`{"channelName":"test","storageConfig":{"vendor":2}}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestBuildStorageConfig(t *testing.T) {
+	sse := "aws:kms"
+	tag := "default"
+	defaults := StorageConfig{Vendor: 1, Bucket: "default-bucket", ExtensionParams: &ExtensionParams{Tag: &tag}}
+	allowed := []string{StorageOverrideFileNamePrefix, StorageOverrideExtensionParams}
+
+	storage, err := BuildStorageConfig(defaults, &ClientStorageConfig{
+		FileNamePrefix:  &[]string{"custom", "prefix"},
+		ExtensionParams: &ExtensionParams{SSE: &sse},
+	}, allowed, []string{"default"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"custom", "prefix"}, *storage.FileNamePrefix)
+	assert.Equal(t, sse, *storage.ExtensionParams.SSE)
+	assert.Equal(t, tag, *storage.ExtensionParams.Tag)
+	// Defaults are copied, not shared
+	assert.Nil(t, defaults.ExtensionParams.SSE)
+	assert.Nil(t, defaults.FileNamePrefix)
+
+	_, err = BuildStorageConfig(defaults, &ClientStorageConfig{FileNamePrefix: &[]string{"bad/prefix"}}, allowed, nil)
+	assert.Error(t, err)
+
+	bucket := "other-bucket"
+	_, err = BuildStorageConfig(defaults, &ClientStorageConfig{Bucket: &bucket}, allowed, nil)
+	assert.Error(t, err)
+}
+
+func TestRecordingSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora cloud recording API
+	var mu sync.Mutex
+	var requestedPaths []string
+	var layoutRequest UpdateLayoutRequest
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestedPaths = append(requestedPaths, r.URL.Path)
+		mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/acquire"):
+			w.Write([]byte(`{"resourceId":"test_resource_id"}`))
+		case strings.HasSuffix(r.URL.Path, "/start"):
+			var startReq StartRecordingRequest
+			json.NewDecoder(r.Body).Decode(&startReq)
+			w.Write([]byte(`{"resourceId":"test_resource_id","sid":"sid_` + startReq.Cname + `","cname":"` + startReq.Cname + `","uid":"` + startReq.Uid + `"}`))
+		case strings.HasSuffix(r.URL.Path, "/query"):
+			w.Write([]byte(`{"resourceId":"test_resource_id","sid":"sid_test","serverResponse":{"status":5}}`))
+		case strings.HasSuffix(r.URL.Path, "/updateLayout"):
+			mu.Lock()
+			json.NewDecoder(r.Body).Decode(&layoutRequest)
+			mu.Unlock()
+			w.Write([]byte(`{"resourceId":"test_resource_id","sid":"sid_test"}`))
+		case strings.HasSuffix(r.URL.Path, "/stop"):
+			w.Write([]byte(`{"resourceId":"test_resource_id","sid":"sid_test","serverResponse":{"fileListMode":"string","fileList":"test.m3u8","uploadingStatus":"uploaded"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	service := NewCloudRecordingService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, StorageConfig{}, nil, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Start a recording and check the recording ID is returned
+	w := serve("POST", "/cloud_recording/start", `{"channelName":"test"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var startResponse StartRecordingResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &startResponse))
+	assert.NotEmpty(t, startResponse.RecordingId)
+	assert.Equal(t, "sid_test", startResponse.Sid)
+
+	// The session is listed
+	w = serve("GET", "/cloud_recording/sessions", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessionsResponse RecordingSessionsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sessionsResponse))
+	if assert.Len(t, sessionsResponse.Sessions, 1) {
+		assert.Equal(t, startResponse.RecordingId, sessionsResponse.Sessions[0].RecordingId)
+		assert.Equal(t, "test", sessionsResponse.Sessions[0].ChannelName)
+	}
+
+	// Status by channel name
+	w = serve("GET", "/cloud_recording/status?channelName=test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, requestedPaths, "/resourceid/test_resource_id/sid/sid_test/mode/mix/query")
+
+	// Status for an unknown channel
+	w = serve("GET", "/cloud_recording/status?channelName=unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Update layout by channel name
+	w = serve("POST", "/cloud_recording/update/layout", `{"cname":"test","recordingConfig":{}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The upstream request uses the resource, SID, channel and UID of the resolved session
+	assert.Equal(t, "/resourceid/"+sessionsResponse.Sessions[0].ResourceId+"/sid/"+startResponse.Sid+"/mode/mix/updateLayout", requestedPaths[len(requestedPaths)-1])
+	assert.Equal(t, "test", layoutRequest.Cname)
+	assert.NotEmpty(t, layoutRequest.Uid)
+	assert.Equal(t, sessionsResponse.Sessions[0].Uid, layoutRequest.Uid)
+
+	// A second recording in the same channel makes the channel ambiguous
+	w = serve("POST", "/cloud_recording/start", `{"channelName":"test"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var secondResponse StartRecordingResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &secondResponse))
+	w = serve("POST", "/cloud_recording/stop", `{"cname":"test"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Stop both by recording ID
+	w = serve("POST", "/cloud_recording/stop", `{"recordingId":"`+startResponse.RecordingId+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("POST", "/cloud_recording/stop", `{"recordingId":"`+secondResponse.RecordingId+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// No active sessions remain
+	w = serve("GET", "/cloud_recording/sessions?channelName=test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, string(mustMarshalSessions(t, w.Body.Bytes())))
+
+	// Stopping an unknown recording ID returns 404
+	w = serve("POST", "/cloud_recording/stop", `{"recordingId":"unknown"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRecordingSessionCleanup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora cloud recording API, the recordings with a "gone" sid no longer exist
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/sid/gone") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"reason":"failed to find worker"}`))
+			return
+		}
+		w.Write([]byte(`{"resourceId":"test_resource_id","sid":"test_sid","serverResponse":{"status":5}}`))
+	}))
+	defer agoraServer.Close()
+
+	now := time.Now().UTC()
+	store := NewMemorySessionStore()
+	for _, session := range []RecordingSession{
+		{RecordingId: "stopped", ChannelName: "stopped", ResourceId: "test_resource_id", Sid: "gone-1", RecordingMode: "mix", StartedAt: now},
+		{RecordingId: "tenant", ChannelName: "tenant", ResourceId: "test_resource_id", Sid: "gone-2", RecordingMode: "mix", StartedAt: now, TenantID: "video"},
+		{RecordingId: "expired", ChannelName: "expired", ResourceId: "test_resource_id", Sid: "expired", RecordingMode: "mix", StartedAt: now.Add(-maxSessionAge - time.Minute)},
+		{RecordingId: "exited", ChannelName: "exited", ResourceId: "test_resource_id", Sid: "exited", RecordingMode: "mix", StartedAt: now},
+		{RecordingId: "running", ChannelName: "running", ResourceId: "test_resource_id", Sid: "running", RecordingMode: "mix", StartedAt: now},
+	} {
+		assert.NoError(t, store.Save(session))
+	}
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	service := NewCloudRecordingService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, StorageConfig{}, nil, store)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	recordingIds := func() []string {
+		sessions, err := store.List()
+		assert.NoError(t, err)
+		var ids []string
+		for _, session := range sessions {
+			ids = append(ids, session.RecordingId)
+		}
+		return ids
+	}
+
+	// A query for a recording that no longer exists drops its session
+	assert.Equal(t, http.StatusNotFound, serve("/cloud_recording/status?channelName=stopped"))
+	assert.NotContains(t, recordingIds(), "stopped")
+
+	// Sessions matched by sid are only dropped for the request's tenant
+	assert.Equal(t, http.StatusNotFound, serve("/cloud_recording/status/test_resource_id/gone-2/mix"))
+	assert.Contains(t, recordingIds(), "tenant")
+
+	// Sessions are dropped once their resource has expired
+	assert.Equal(t, http.StatusOK, serve("/cloud_recording/sessions"))
+	assert.NotContains(t, recordingIds(), "expired")
+
+	// The webhook's exit event drops the session of its channel and sid
+	service.EndSession("other", "exited")
+	assert.Contains(t, recordingIds(), "exited")
+	service.EndSession("exited", "exited")
+	assert.ElementsMatch(t, []string{"tenant", "running"}, recordingIds())
+}
+
+func mustMarshalSessions(t *testing.T, body []byte) []byte {
+	var response RecordingSessionsResponse
+	assert.NoError(t, json.Unmarshal(body, &response))
+	sessions, err := json.Marshal(response.Sessions)
+	assert.NoError(t, err)
+	return sessions
+}
+
+func TestFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	store, err := NewFileSessionStore(path)
+	assert.NoError(t, err)
+
+	session := RecordingSession{
+		RecordingId:   "recording1",
+		ChannelName:   "test",
+		Uid:           "123",
+		ResourceId:    "test_resource_id",
+		Sid:           "test_sid",
+		RecordingMode: "mix",
+		StartedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	assert.NoError(t, store.Save(session))
+	assert.NoError(t, store.Save(RecordingSession{RecordingId: "recording2", ChannelName: "other", StartedAt: session.StartedAt.Add(time.Second)}))
+
+	// Sessions survive a restart
+	reloaded, err := NewFileSessionStore(path)
+	assert.NoError(t, err)
+	loaded, err := reloaded.Get("recording1")
+	assert.NoError(t, err)
+	assert.Equal(t, session, loaded)
+
+	matches, err := FindSessionsByChannel(reloaded, "other")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	assert.NoError(t, reloaded.Delete("recording1"))
+	reloaded, err = NewFileSessionStore(path)
+	assert.NoError(t, err)
+	_, err = reloaded.Get("recording1")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	sessions, err := reloaded.List()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestRecordingTenants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora cloud recording API, recording the path, credentials and bucket of each request
+	var mu sync.Mutex
+	var paths, auths, buckets []string
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		auths = append(auths, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/acquire") {
+			w.Write([]byte(`{"resourceId":"test_resource_id"}`))
+			return
+		}
+		var startReq StartRecordingRequest
+		json.NewDecoder(r.Body).Decode(&startReq)
+		mu.Lock()
+		buckets = append(buckets, startReq.ClientRequest.StorageConfig.Bucket)
+		mu.Unlock()
+		w.Write([]byte(`{"resourceId":"test_resource_id","sid":"test_sid","cname":"` + startReq.Cname + `","uid":"` + startReq.Uid + `"}`))
+	}))
+	defer agoraServer.Close()
+
+	const serverAppID = "6ce46dd303d54056a52f9a34c13c547e"
+	const tenantAppID = "0123456789abcdef0123456789abcdef"
+	registry, err := tenant_registry.NewRegistry([]*tenant_registry.Tenant{{
+		ID:             "video",
+		AppID:          tenantAppID,
+		AppCertificate: "fedcba9876543210fedcba9876543210",
+		CustomerID:     "video_customer",
+		CustomerSecret: "video_secret",
+		Storage:        &tenant_registry.TenantStorage{Vendor: 1, Bucket: "video-bucket"},
+		APIKeys:        []string{"video-key"},
+	}}, "")
+	assert.NoError(t, err)
+
+	tokenService := token_service.NewTokenService(serverAppID, "77be7e16f7482cef9fe796205b85831e")
+	defaults := StorageConfig{Vendor: 1, Bucket: "default-bucket"}
+	service := NewCloudRecordingService(serverAppID, agoraServer.URL+"/v1/apps/"+serverAppID+"/cloud_recording", agora_client.NewClient("Basic server"), tokenService, defaults, nil, nil)
+	router := gin.New()
+	router.Use(registry.Middleware())
+	service.RegisterRoutes(router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/cloud_recording/start", strings.NewReader(`{"channelName":"test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(tenant_registry.TenantKeyHeader, "video-key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for i := range paths {
+		assert.Contains(t, paths[i], "/v1/apps/"+tenantAppID+"/")
+		assert.NotEqual(t, "Basic server", auths[i])
+	}
+	assert.Equal(t, []string{"video-bucket"}, buckets)
+
+	// Sessions are only visible to the tenant that started them
+	listSessions := func(tenantID string) []RecordingSession {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/cloud_recording/sessions?channelName=test", nil)
+		if tenantID != "" {
+			req.Header.Set(tenant_registry.TenantKeyHeader, tenantID+"-key")
+		}
+		router.ServeHTTP(w, req)
+		var response RecordingSessionsResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Sessions
+	}
+	assert.Len(t, listSessions("video"), 1)
+	assert.Empty(t, listSessions(""))
+}
+
+func TestRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to Agora: %s", r.URL.Path)
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	service := NewCloudRecordingService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, StorageConfig{}, nil, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	testCases := []struct {
+		name          string
+		path          string
+		body          string
+		expectedField string
+	}{
+		{"Channel name too long", "/cloud_recording/start", `{"channelName":"` + strings.Repeat("a", 65) + `"}`, "channelName"},
+		{"Invalid scene mode", "/cloud_recording/start", `{"channelName":"test","sceneMode":"live"}`, "sceneMode"},
+		{"Misspelled unsubscribe list", "/cloud_recording/update/subscriber-list", `{"cname":"test","recordingConfig":{"streamSubscribe":{"videoUidList":{"unsunscribeVideoUids":["123"]}}}}`, "unsunscribeVideoUids"},
+		{"Two update configurations", "/cloud_recording/update/subscriber-list", `{"recordingId":"id","recordingConfig":{"webRecordingConfig":{"onhold":true},"rtmpPublishConfig":{"outputs":[]}}}`, "recordingConfig"},
+		{"Sid without resource ID", "/cloud_recording/stop", `{"cname":"test","uid":"123","sid":"sid"}`, "resourceId"},
+		{"Missing session identifiers", "/cloud_recording/update/layout", `{"recordingConfig":{}}`, "recordingId"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response struct {
+				Error api_errors.Error `json:"error"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if assert.Len(t, response.Error.Fields, 1) {
+				assert.Equal(t, tc.expectedField, response.Error.Fields[0].Field)
+			}
+		})
+	}
+
+	// The corrected field name is accepted
+	var update ClientUpdateSubscriptionRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"recordingConfig":{"streamSubscribe":{"videoUidList":{"unsubscribeVideoUids":["123"]}}}}`), &update))
+	assert.Equal(t, []string{"123"}, *update.UpdateConfig.StreamSubscribe.VideoUidList.UnsubscribeVideoUids)
+}
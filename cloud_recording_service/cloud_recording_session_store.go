@@ -0,0 +1,242 @@
+package cloud_recording_service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/atomic_file"
+)
+
+// ErrSessionNotFound is returned when no active recording session matches the given recording ID or channel.
+var ErrSessionNotFound = errors.New("recording session not found")
+
+// ErrAmbiguousSession is returned when a channel has more than one active recording session,
+// in which case the client must identify the session using its recording ID.
+var ErrAmbiguousSession = errors.New("multiple active recording sessions for channel, use recordingId")
+
+// RecordingSession holds the identifiers of a started cloud recording.
+// It allows clients to stop, query and update a recording using only the channel name or recording ID.
+type RecordingSession struct {
+	RecordingId   string    `json:"recordingId"`        // Our own identifier for the recording session.
+	ChannelName   string    `json:"channelName"`        // The channel name for the recording session.
+	Uid           string    `json:"uid"`                // The UID used by the recording bot.
+	ResourceId    string    `json:"resourceId"`         // The resource ID returned when acquiring the recording resource.
+	Sid           string    `json:"sid"`                // The session ID returned by Agora when the recording started.
+	RecordingMode string    `json:"recordingMode"`      // The recording mode (individual, mix, web).
+	StartedAt     time.Time `json:"startedAt"`          // The time the recording was started.
+	TenantID      string    `json:"tenantId,omitempty"` // (Optional) the tenant that started the recording.
+}
+
+// SessionStore is the interface for storing active cloud recording sessions.
+// Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Save adds or replaces a recording session.
+	Save(session RecordingSession) error
+	// Get returns the session with the given recording ID, or ErrSessionNotFound.
+	Get(recordingId string) (RecordingSession, error)
+	// List returns all active sessions, ordered by start time.
+	List() ([]RecordingSession, error)
+	// Delete removes the session with the given recording ID. Deleting a missing session is not an error.
+	Delete(recordingId string) error
+}
+
+// NewRecordingId generates a random identifier for a new recording session.
+func NewRecordingId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand should never fail, fall back to a time based identifier
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// FilterSessionsByTenant returns the sessions started by the given tenant, "" for sessions started without a tenant.
+func FilterSessionsByTenant(sessions []RecordingSession, tenantID string) []RecordingSession {
+	var matches []RecordingSession
+	for _, session := range sessions {
+		if session.TenantID == tenantID {
+			matches = append(matches, session)
+		}
+	}
+	return matches
+}
+
+// FindSessionsByChannel returns the active sessions in the store for the given channel name.
+func FindSessionsByChannel(store SessionStore, channelName string) ([]RecordingSession, error) {
+	sessions, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var matches []RecordingSession
+	for _, session := range sessions {
+		if session.ChannelName == channelName {
+			matches = append(matches, session)
+		}
+	}
+	return matches, nil
+}
+
+// MemorySessionStore keeps recording sessions in memory. Sessions are lost when the server restarts.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]RecordingSession
+}
+
+// NewMemorySessionStore returns an empty in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]RecordingSession)}
+}
+
+// Save adds or replaces a recording session.
+func (m *MemorySessionStore) Save(session RecordingSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.RecordingId] = session
+	return nil
+}
+
+// Get returns the session with the given recording ID.
+func (m *MemorySessionStore) Get(recordingId string) (RecordingSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[recordingId]
+	if !ok {
+		return RecordingSession{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// List returns all active sessions, ordered by start time.
+func (m *MemorySessionStore) List() ([]RecordingSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sortedSessions(m.sessions), nil
+}
+
+// Delete removes the session with the given recording ID.
+func (m *MemorySessionStore) Delete(recordingId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, recordingId)
+	return nil
+}
+
+// FileSessionStore keeps recording sessions in memory and persists them to a JSON file on every change,
+// so active recordings can still be stopped after the server restarts.
+type FileSessionStore struct {
+	mu       sync.RWMutex
+	path     string
+	sessions map[string]RecordingSession
+}
+
+// NewFileSessionStore returns a session store backed by the JSON file at path.
+// Existing sessions are loaded from the file, a missing file is treated as an empty store.
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	store := &FileSessionStore{path: path, sessions: make(map[string]RecordingSession)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("error reading session store file: %v", err)
+	}
+	if len(data) == 0 {
+		return store, nil
+	}
+
+	var sessions []RecordingSession
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("error parsing session store file: %v", err)
+	}
+	for _, session := range sessions {
+		store.sessions[session.RecordingId] = session
+	}
+	return store, nil
+}
+
+// Save adds or replaces a recording session and persists the store.
+func (f *FileSessionStore) Save(session RecordingSession) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, existed := f.sessions[session.RecordingId]
+	f.sessions[session.RecordingId] = session
+	if err := f.persist(); err != nil {
+		// Keep memory consistent with the file
+		if existed {
+			f.sessions[session.RecordingId] = previous
+		} else {
+			delete(f.sessions, session.RecordingId)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns the session with the given recording ID.
+func (f *FileSessionStore) Get(recordingId string) (RecordingSession, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	session, ok := f.sessions[recordingId]
+	if !ok {
+		return RecordingSession{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// List returns all active sessions, ordered by start time.
+func (f *FileSessionStore) List() ([]RecordingSession, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return sortedSessions(f.sessions), nil
+}
+
+// Delete removes the session with the given recording ID and persists the store.
+func (f *FileSessionStore) Delete(recordingId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[recordingId]
+	if !ok {
+		return nil
+	}
+	delete(f.sessions, recordingId)
+	if err := f.persist(); err != nil {
+		f.sessions[recordingId] = session
+		return err
+	}
+	return nil
+}
+
+// persist writes all sessions to the store file, see atomic_file.WriteFile. Must be called with f.mu held.
+func (f *FileSessionStore) persist() error {
+	data, err := json.MarshalIndent(sortedSessions(f.sessions), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding session store: %v", err)
+	}
+	if err := atomic_file.WriteFile(f.path, data); err != nil {
+		return fmt.Errorf("error writing session store file: %v", err)
+	}
+	return nil
+}
+
+// sortedSessions returns the sessions in the map ordered by start time, then recording ID.
+func sortedSessions(sessions map[string]RecordingSession) []RecordingSession {
+	list := make([]RecordingSession, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, session)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].StartedAt.Equal(list[j].StartedAt) {
+			return list[i].RecordingId < list[j].RecordingId
+		}
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	return list
+}
@@ -5,44 +5,58 @@ import "encoding/json"
 // ClientStartRecordingRequest represents the JSON payload structure sent by the client to start a cloud recording.
 // It includes channel name, optional scene mode, recording mode, excluded resource IDs, and recording configuration details.
 type ClientStartRecordingRequest struct {
-	ChannelName        string           `json:"channelName"`                  // The name of the channel to record.
-	SceneMode          *string          `json:"sceneMode,omitempty"`          // The recording scene type.
-	RecordingMode      *string          `json:"recordingMode,omitempty"`      // The recording mode (indvidual, mix, web).
-	ExcludeResourceIds *[]string        `json:"excludeResourceIds,omitempty"` // UID's to other recording or rtt services in the channel.
-	RecordingConfig    *RecordingConfig `json:"recordingConfig,omitempty"`    // The configuration to use for the new cloud recording session.
+	ChannelName        string               `json:"channelName"`                  // The name of the channel to record.
+	SceneMode          *string              `json:"sceneMode,omitempty"`          // The recording scene type.
+	RecordingMode      *string              `json:"recordingMode,omitempty"`      // The recording mode (indvidual, mix, web).
+	ExcludeResourceIds *[]string            `json:"excludeResourceIds,omitempty"` // UID's to other recording or rtt services in the channel.
+	RecordingConfig    *RecordingConfig     `json:"recordingConfig,omitempty"`    // The configuration to use for the new cloud recording session.
+	StorageConfig      *ClientStorageConfig `json:"storageConfig,omitempty"`      // (Optional) overrides for the default storage configuration.
+}
+
+// ClientStorageConfig represents the storage settings a client can override when starting a recording or transcription.
+// Each field is optional and only applied when the field is included in the server's storage override allow-list.
+type ClientStorageConfig struct {
+	Vendor          *int             `json:"vendor,omitempty"`          // (Optional) identifier for the storage service provider.
+	Region          *int             `json:"region,omitempty"`          // (Optional) geographical region of the storage.
+	Bucket          *string          `json:"bucket,omitempty"`          // (Optional) storage bucket name.
+	FileNamePrefix  *[]string        `json:"fileNamePrefix,omitempty"`  // (Optional) prefixes for generating file paths within the bucket.
+	ExtensionParams *ExtensionParams `json:"extensionParams,omitempty"` // (Optional) additional parameters such as SSE and tag.
 }
 
 // ClientUpdateSubscriptionRequest represents the JSON payload structure sent by the client to update a cloud recording's subscription.
 // It includes identifiers and a nested update configuration specific to the recording session.
 type ClientUpdateSubscriptionRequest struct {
-	Cname         string                          `json:"cname"`                   // The name of the channel being recorded.
-	Uid           string                          `json:"uid"`                     // The UID for the existing cloud recording session.
-	ResourceId    string                          `json:"resourceId"`              // The ResourceId for the existing cloud recording session.
-	Sid           string                          `json:"sid"`                     // The Sid for the existing cloud recording session.
-	RecordingMode *string                         `json:"recordingMode,omitempty"` // The recording mode (indvidual, mix, web).
-	UpdateConfig  UpdateSubscriptionClientRequest `json:"recordingConfig"`         // The updated recording configuration for the given cloud recording session.
+	RecordingId   *string                         `json:"recordingId,omitempty"`         // (Optional) recording ID returned by start, used instead of the session identifiers.
+	Cname         string                          `json:"cname" openapi:"optional"`      // The name of the channel being recorded.
+	Uid           string                          `json:"uid" openapi:"optional"`        // The UID for the existing cloud recording session.
+	ResourceId    string                          `json:"resourceId" openapi:"optional"` // The ResourceId for the existing cloud recording session.
+	Sid           string                          `json:"sid" openapi:"optional"`        // The Sid for the existing cloud recording session.
+	RecordingMode *string                         `json:"recordingMode,omitempty"`       // The recording mode (indvidual, mix, web).
+	UpdateConfig  UpdateSubscriptionClientRequest `json:"recordingConfig"`               // The updated recording configuration for the given cloud recording session.
 }
 
 // ClientUpdateLayoutRequest represents the JSON payload for updating the layout of a cloud recording session.
 // It includes channel and session identifiers and layout update configurations.
 type ClientUpdateLayoutRequest struct {
-	Cname         string                    `json:"cname"`                   // The name of the channel being recorded.
-	Uid           string                    `json:"uid"`                     // The UID for the existing cloud recording session.
-	ResourceId    string                    `json:"resourceId"`              // The ResourceId for the existing cloud recording session.
-	Sid           string                    `json:"sid"`                     // The Sid for the existing cloud recording session.
-	RecordingMode *string                   `json:"recordingMode,omitempty"` // The recording mode (indvidual, mix, web).
-	UpdateConfig  UpdateLayoutClientRequest `json:"recordingConfig"`         // The updated layout configuration for the given cloud recording session.
+	RecordingId   *string                   `json:"recordingId,omitempty"`         // (Optional) recording ID returned by start, used instead of the session identifiers.
+	Cname         string                    `json:"cname" openapi:"optional"`      // The name of the channel being recorded.
+	Uid           string                    `json:"uid" openapi:"optional"`        // The UID for the existing cloud recording session.
+	ResourceId    string                    `json:"resourceId" openapi:"optional"` // The ResourceId for the existing cloud recording session.
+	Sid           string                    `json:"sid" openapi:"optional"`        // The Sid for the existing cloud recording session.
+	RecordingMode *string                   `json:"recordingMode,omitempty"`       // The recording mode (indvidual, mix, web).
+	UpdateConfig  UpdateLayoutClientRequest `json:"recordingConfig"`               // The updated layout configuration for the given cloud recording session.
 }
 
 // ClientStopRecordingRequest represents the JSON payload structure for requesting the stop of a cloud recording.
 // It contains identifiers necessary to identify the recording session to be stopped.
 type ClientStopRecordingRequest struct {
-	Cname         string  `json:"cname"`                   // The name of the channel being recorded.
-	Uid           string  `json:"uid"`                     // The UID for an existing cloud recording session.
-	ResourceId    string  `json:"resourceId"`              // The ResourceId for the existing cloud recording session.
-	Sid           string  `json:"sid"`                     // The Sid for the existing cloud recording session.
-	RecordingMode *string `json:"recordingMode,omitempty"` // The recording mode (indvidual, mix, web).
-	AsyncStop     *bool   `json:"async_stop,omitempty"`    // Stop immediately or asynchronously.
+	RecordingId   *string `json:"recordingId,omitempty"`         // (Optional) recording ID returned by start, used instead of the session identifiers.
+	Cname         string  `json:"cname" openapi:"optional"`      // The name of the channel being recorded.
+	Uid           string  `json:"uid" openapi:"optional"`        // The UID for an existing cloud recording session.
+	ResourceId    string  `json:"resourceId" openapi:"optional"` // The ResourceId for the existing cloud recording session.
+	Sid           string  `json:"sid" openapi:"optional"`        // The Sid for the existing cloud recording session.
+	RecordingMode *string `json:"recordingMode,omitempty"`       // The recording mode (indvidual, mix, web).
+	AsyncStop     *bool   `json:"async_stop,omitempty"`          // Stop immediately or asynchronously.
 }
 
 // AcquireResourceRequest defines the structure for a request to acquire resources for cloud recording.
@@ -120,7 +134,7 @@ type AudioUidList struct {
 // VideoUidList defines the UIDs for subscribing to or unsubscribing from video streams.
 type VideoUidList struct {
 	SubscribeVideoUids   *[]string `json:"subscribeVideoUids,omitempty"`
-	UnsubscribeVideoUids *[]string `json:"unsunscribeVideoUids,omitempty"`
+	UnsubscribeVideoUids *[]string `json:"unsubscribeVideoUids,omitempty"`
 }
 
 // WebRecordingConfig specifies the on-hold status of a web recording.
@@ -175,11 +189,12 @@ type Timestampable interface {
 // StartRecordingResponse represents the response received from the Agora server after successfully starting a recording.
 // It includes the identifiers of the recording session along with an optional timestamp.
 type StartRecordingResponse struct {
-	Cname      string  `json:"cname"`               // The channel name for the recording session.
-	Uid        string  `json:"uid"`                 // The UID for the recording session.
-	ResourceId string  `json:"resourceId"`          // The unique resource identifier for the recording session.
-	Sid        string  `json:"sid"`                 // The session identifier for the recording.
-	Timestamp  *string `json:"timestamp,omitempty"` // Optional timestamp for when the recording was started.
+	Cname       string  `json:"cname"`                 // The channel name for the recording session.
+	Uid         string  `json:"uid"`                   // The UID for the recording session.
+	ResourceId  string  `json:"resourceId"`            // The unique resource identifier for the recording session.
+	Sid         string  `json:"sid"`                   // The session identifier for the recording.
+	RecordingId string  `json:"recordingId,omitempty"` // Our own recording ID, used to stop, query or update the recording.
+	Timestamp   *string `json:"timestamp,omitempty"`   // Optional timestamp for when the recording was started.
 }
 
 func (s *StartRecordingResponse) SetTimestamp(timestamp string) {
@@ -201,6 +216,24 @@ func (s *ActiveRecordingResponse) SetTimestamp(timestamp string) {
 	s.Timestamp = &timestamp
 }
 
+// RecordingStatusResponse represents the status of a recording session returned to the client by the status endpoint.
+// It wraps the Agora query response and exposes the recorded files as typed entries.
+type RecordingStatusResponse struct {
+	ResourceId      *string         `json:"resourceId"`                // The unique resource identifier for the recording session.
+	Sid             *string         `json:"sid"`                       // The session identifier for the recording.
+	Cname           *string         `json:"cname"`                     // The channel name for the recording session.
+	Uid             *string         `json:"uid"`                       // The UID for the recording session.
+	RecordingMode   string          `json:"recordingMode"`             // The recording mode (individual, mix, web) used for the query.
+	ServerResponse  ServerResponse  `json:"serverResponse"`            // Detailed server response as returned by Agora.
+	FileDetails     []FileDetail    `json:"fileDetails,omitempty"`     // Parsed file list when fileListMode is "string".
+	FileListEntries []FileListEntry `json:"fileListEntries,omitempty"` // Parsed file list when fileListMode is "json".
+	Timestamp       *string         `json:"timestamp,omitempty"`       // Optional timestamp for the current state of the recording.
+}
+
+func (s *RecordingStatusResponse) SetTimestamp(timestamp string) {
+	s.Timestamp = &timestamp
+}
+
 // UpdateRecordingResponse represents the response from updating a recording session's settings.
 // It includes session identifiers and an optional timestamp.
 type UpdateRecordingResponse struct {
@@ -220,8 +253,10 @@ func (s *UpdateRecordingResponse) SetTimestamp(timestamp string) {
 type ServerResponse struct {
 	ExtensionServiceState   *ExtensionServiceState `json:"extensionServiceState,omitempty"`
 	UploadingStatusResponse *string                `json:"uploadingStatus,omitempty"`
-	FileListMode            *string                `json:"fileListMode,omitempty"` // Specifies how the file list is presented, e.g., as a string or JSON.
-	FileList                *json.RawMessage       `json:"fileList,omitempty"`     // Contains details about the recorded files, format dependent on fileListMode.
+	Status                  *int                   `json:"status,omitempty"`         // The status code of the recording service, reported by the query endpoint.
+	SliceStartTime          *int64                 `json:"sliceStartTime,omitempty"` // UNIX timestamp (ms) when the recording started.
+	FileListMode            *string                `json:"fileListMode,omitempty"`   // Specifies how the file list is presented, e.g., as a string or JSON.
+	FileList                *json.RawMessage       `json:"fileList,omitempty"`       // Contains details about the recorded files, format dependent on fileListMode.
 }
 
 // ExtensionServiceState details the state of any extension services used during the recording, such as additional data streaming or processing services.
@@ -325,13 +360,13 @@ type TranscodingConfig struct {
 
 // LayoutConfig defines individual video layout positions and dimensions for participants in a recorded session.
 type LayoutConfig struct {
-	Uid        string `json:"uid"`         // User identifier for the layout configuration.
-	XAxis      int    `json:"x_axis"`      // X-axis position for the layout.
-	YAxis      int    `json:"y_axis"`      // Y-axis position for the layout.
-	Width      int    `json:"width"`       // Width of the video in the layout.
-	Height     int    `json:"height"`      // Height of the video in the layout.
-	Alpha      int    `json:"alpha"`       // Transparency level of the video in the layout.
-	RenderMode int    `json:"render_mode"` // Rendering mode for the video.
+	Uid        string `json:"uid" openapi:"optional"`         // User identifier for the layout configuration.
+	XAxis      int    `json:"x_axis"`                         // X-axis position for the layout.
+	YAxis      int    `json:"y_axis"`                         // Y-axis position for the layout.
+	Width      int    `json:"width"`                          // Width of the video in the layout.
+	Height     int    `json:"height"`                         // Height of the video in the layout.
+	Alpha      int    `json:"alpha" openapi:"optional"`       // Transparency level of the video in the layout.
+	RenderMode int    `json:"render_mode" openapi:"optional"` // Rendering mode for the video.
 }
 
 // BackgroundConfig specifies the background settings for individual participants or the entire session.
@@ -412,3 +447,13 @@ type Audio struct {
 	Bitrate    *string `json:"bitrate,omitempty"`    // Bitrate of the audio.
 	Channels   *string `json:"channels,omitempty"`   // Number of audio channels.
 }
+
+// RecordingSessionsResponse represents the list of active recording sessions returned to the client.
+type RecordingSessionsResponse struct {
+	Sessions  []RecordingSession `json:"sessions"`            // The active recording sessions.
+	Timestamp *string            `json:"timestamp,omitempty"` // Optional timestamp for when the list was retrieved.
+}
+
+func (s *RecordingSessionsResponse) SetTimestamp(timestamp string) {
+	s.Timestamp = &timestamp
+}
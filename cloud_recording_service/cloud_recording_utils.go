@@ -1,13 +1,30 @@
 package cloud_recording_service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"math/rand"
+	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	resourceExpiredHour = 24                              // Hours the resource acquired for a recording stays valid.
+	maxSessionAge       = resourceExpiredHour * time.Hour // Sessions are no longer tracked this long after they started, the recording can't be queried or stopped once its resource expired.
 )
 
+// ErrRecordingNotFound is returned when Agora reports that the requested recording session does not exist,
+// either because it was never started or because it has already stopped.
+var ErrRecordingNotFound = errors.New("recording not found")
+
 // generateUID generates a unique user identifier for use within cloud recording sessions.
 // This function ensures the UID is never zero, which is reserved, by generating a random
 // number between 1 and the maximum possible 32-bit integer value.
@@ -22,7 +39,6 @@ func (s *CloudRecordingService) GenerateUID() string {
 // ValidateRecordingMode checks if a specific string is present within a slice of strings.
 // This is useful for determining if a particular item exists within a list.
 func (s *CloudRecordingService) ValidateRecordingMode(modeToCheck string) bool {
-	validRecordingModes := []string{"individual", "mix", "web"}
 	for _, mode := range validRecordingModes {
 		if mode == modeToCheck {
 			return true
@@ -31,6 +47,119 @@ func (s *CloudRecordingService) ValidateRecordingMode(modeToCheck string) bool {
 	return false
 }
 
+// errMissingSessionIdentifiers is returned when a request does not identify a recording session.
+var errMissingSessionIdentifiers = errors.New("recordingId, channel name or resourceId and sid are required")
+
+// resolveSession looks up the active recording session when the client identifies it by recording ID or channel name.
+// It returns nil when the client passed the resourceId and sid directly. Only the sessions of the request's tenant are matched.
+func (s *CloudRecordingService) resolveSession(ctx context.Context, recordingId *string, channelName string, resourceId string, sid string) (*RecordingSession, error) {
+	s.expireSessions(time.Now())
+	tenantID := tenant_registry.IDFromContext(ctx)
+	if recordingId != nil && *recordingId != "" {
+		session, err := s.sessionStore.Get(*recordingId)
+		if err != nil {
+			return nil, err
+		}
+		if session.TenantID != tenantID {
+			return nil, ErrSessionNotFound
+		}
+		return &session, nil
+	}
+	if resourceId != "" && sid != "" {
+		return nil, nil
+	}
+	if channelName == "" {
+		return nil, errMissingSessionIdentifiers
+	}
+
+	sessions, err := FindSessionsByChannel(s.sessionStore, channelName)
+	if err != nil {
+		return nil, err
+	}
+	sessions = FilterSessionsByTenant(sessions, tenantID)
+	if len(sessions) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	if len(sessions) > 1 {
+		return nil, ErrAmbiguousSession
+	}
+	return &sessions[0], nil
+}
+
+// removeSession deletes the stored session for a recording that has stopped.
+// Sessions are matched by recording ID when known, otherwise by sid among the sessions of the request's tenant.
+func (s *CloudRecordingService) removeSession(ctx context.Context, session *RecordingSession, sid string) {
+	if session != nil {
+		if err := s.sessionStore.Delete(session.RecordingId); err != nil {
+			log.Println("Failed to remove recording session:", err)
+		}
+		return
+	}
+	s.removeSessions(func(stored RecordingSession) bool {
+		return stored.Sid == sid && stored.TenantID == tenant_registry.IDFromContext(ctx)
+	})
+}
+
+// EndSession deletes the stored session of a recording that has exited, e.g. on the Cloud Recording webhook's session exit event.
+// Recordings that end on their own, e.g. after maxIdleTime, are never stopped through the server, so their sessions would otherwise stay listed.
+//
+// Parameters:
+//   - channelName: string - The channel name of the recording.
+//   - sid: string - The session ID of the recording.
+//
+// Notes:
+//   - Webhook notifications have no tenant, the session is matched by its channel name and the sid Agora generated for the recording.
+func (s *CloudRecordingService) EndSession(channelName string, sid string) {
+	s.removeSessions(func(stored RecordingSession) bool {
+		return stored.Sid == sid && stored.ChannelName == channelName
+	})
+}
+
+// expireSessions deletes the sessions that started more than maxSessionAge before now.
+func (s *CloudRecordingService) expireSessions(now time.Time) {
+	s.removeSessions(func(stored RecordingSession) bool {
+		return now.Sub(stored.StartedAt) > maxSessionAge
+	})
+}
+
+// removeSessions deletes the stored sessions that match, failures are logged.
+func (s *CloudRecordingService) removeSessions(match func(stored RecordingSession) bool) {
+	sessions, err := s.sessionStore.List()
+	if err != nil {
+		log.Println("Failed to list recording sessions:", err)
+		return
+	}
+	for _, stored := range sessions {
+		if match(stored) {
+			if err := s.sessionStore.Delete(stored.RecordingId); err != nil {
+				log.Println("Failed to remove recording session:", err)
+			}
+		}
+	}
+}
+
+// sessionErrorStatus maps a session lookup error to the HTTP status code returned to the client.
+func sessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errMissingSessionIdentifiers):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAmbiguousSession):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// paramOrQuery returns the named path parameter if it is set, otherwise the query parameter with the same name.
+func paramOrQuery(c *gin.Context, name string) string {
+	if value := c.Param(name); value != "" {
+		return value
+	}
+	return c.Query(name)
+}
+
 // AddTimestamp adds a current timestamp to any response object that supports the Timestampable interface.
 // It then marshals the updated object back into JSON format for further use or storage.
 func (s *CloudRecordingService) AddTimestamp(response Timestampable) (json.RawMessage, error) {
@@ -55,6 +184,11 @@ func (sr *ServerResponse) UnmarshalFileList() (interface{}, error) {
 	}
 	switch *sr.FileListMode {
 	case "string":
+		// Individual recordings report a single playlist name instead of a list.
+		var fileName string
+		if err := json.Unmarshal(*sr.FileList, &fileName); err == nil {
+			return []FileDetail{{Filename: fileName}}, nil
+		}
 		// Parse the file list as a slice of FileDetail structures.
 		var fileList []FileDetail
 		if err := json.Unmarshal(*sr.FileList, &fileList); err != nil {
@@ -73,3 +207,185 @@ func (sr *ServerResponse) UnmarshalFileList() (interface{}, error) {
 		return nil, fmt.Errorf("unknown FileListMode: %s", *sr.FileListMode)
 	}
 }
+
+// recordingNotFoundError wraps the Agora error for a recording that does not exist.
+// It matches ErrRecordingNotFound, and keeps the Agora error so its status and code reach the client.
+type recordingNotFoundError struct {
+	err error
+}
+
+func (e recordingNotFoundError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrRecordingNotFound, e.err)
+}
+
+func (e recordingNotFoundError) Is(target error) bool {
+	return target == ErrRecordingNotFound
+}
+
+func (e recordingNotFoundError) Unwrap() error {
+	return e.err
+}
+
+// isRecordingNotFound reports whether an error returned by the Agora client is Agora's "recording not found" error.
+// Agora signals this with an HTTP 404 status, or with a 404 code in the response body.
+func isRecordingNotFound(err error) bool {
+	apiErr, ok := agora_client.AsAPIError(err)
+	if !ok {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.Code == http.StatusNotFound
+}
+
+// Storage override fields that can be enabled in the server's storage override allow-list.
+const (
+	StorageOverrideVendor          = "vendor"
+	StorageOverrideRegion          = "region"
+	StorageOverrideBucket          = "bucket"
+	StorageOverrideFileNamePrefix  = "fileNamePrefix"
+	StorageOverrideExtensionParams = "extensionParams"
+)
+
+// Clone returns a deep copy of the storage config, so request specific changes never modify the shared defaults.
+func (c StorageConfig) Clone() StorageConfig {
+	clone := c
+	if c.FileNamePrefix != nil {
+		fileNamePrefix := append([]string(nil), (*c.FileNamePrefix)...)
+		clone.FileNamePrefix = &fileNamePrefix
+	}
+	if c.ExtensionParams != nil {
+		extensionParams := *c.ExtensionParams
+		clone.ExtensionParams = &extensionParams
+	}
+	return clone
+}
+
+// BuildStorageConfig creates the storage config for a single request from the server defaults and the client overrides.
+//
+// Parameters:
+//   - defaults: StorageConfig - The storage config loaded from the server's environment.
+//   - overrides: *ClientStorageConfig - (Optional) storage settings sent by the client.
+//   - allowedOverrides: []string - The override fields enabled in the server config.
+//   - defaultFileNamePrefix: []string - The file name prefix to use when the client does not set one.
+//
+// Returns:
+//   - StorageConfig: A copy of the defaults with the client overrides applied.
+//   - error: Non-nil if the client sets a field that is not allowed or sets an invalid value.
+//
+// Notes:
+//   - The returned config never shares memory with the defaults, so it is safe to modify per request.
+func BuildStorageConfig(defaults StorageConfig, overrides *ClientStorageConfig, allowedOverrides []string, defaultFileNamePrefix []string) (StorageConfig, error) {
+	storageConfig := defaults.Clone()
+	if storageConfig.FileNamePrefix == nil && defaultFileNamePrefix != nil {
+		fileNamePrefix := append([]string(nil), defaultFileNamePrefix...)
+		storageConfig.FileNamePrefix = &fileNamePrefix
+	}
+	if overrides == nil {
+		return storageConfig, nil
+	}
+
+	allowed := make(map[string]bool, len(allowedOverrides))
+	for _, field := range allowedOverrides {
+		allowed[field] = true
+	}
+	checkAllowed := func(field string) error {
+		if !allowed[field] {
+			return fmt.Errorf("storage override not allowed: %s", field)
+		}
+		return nil
+	}
+
+	if overrides.Vendor != nil {
+		if err := checkAllowed(StorageOverrideVendor); err != nil {
+			return StorageConfig{}, err
+		}
+		storageConfig.Vendor = *overrides.Vendor
+	}
+	if overrides.Region != nil {
+		if err := checkAllowed(StorageOverrideRegion); err != nil {
+			return StorageConfig{}, err
+		}
+		storageConfig.Region = *overrides.Region
+	}
+	if overrides.Bucket != nil {
+		if err := checkAllowed(StorageOverrideBucket); err != nil {
+			return StorageConfig{}, err
+		}
+		if *overrides.Bucket == "" {
+			return StorageConfig{}, errors.New("storage bucket cannot be empty")
+		}
+		storageConfig.Bucket = *overrides.Bucket
+	}
+	if overrides.FileNamePrefix != nil {
+		if err := checkAllowed(StorageOverrideFileNamePrefix); err != nil {
+			return StorageConfig{}, err
+		}
+		// Agora only accepts letters and numbers in each prefix entry.
+		for _, prefix := range *overrides.FileNamePrefix {
+			if prefix == "" || !isAlphanumeric(prefix) {
+				return StorageConfig{}, fmt.Errorf("invalid fileNamePrefix entry %q: only letters and numbers are allowed", prefix)
+			}
+		}
+		fileNamePrefix := append([]string(nil), (*overrides.FileNamePrefix)...)
+		storageConfig.FileNamePrefix = &fileNamePrefix
+	}
+	if overrides.ExtensionParams != nil {
+		if err := checkAllowed(StorageOverrideExtensionParams); err != nil {
+			return StorageConfig{}, err
+		}
+		extensionParams := ExtensionParams{}
+		if storageConfig.ExtensionParams != nil {
+			extensionParams = *storageConfig.ExtensionParams
+		}
+		if overrides.ExtensionParams.SSE != nil {
+			extensionParams.SSE = overrides.ExtensionParams.SSE
+		}
+		if overrides.ExtensionParams.Tag != nil {
+			extensionParams.Tag = overrides.ExtensionParams.Tag
+		}
+		storageConfig.ExtensionParams = &extensionParams
+	}
+
+	return storageConfig, nil
+}
+
+// isAlphanumeric checks if a string only contains ASCII letters and numbers.
+func isAlphanumeric(value string) bool {
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// TenantStorageConfig returns the storage configuration of the tenant of a request, or the server's default when the tenant has none.
+func TenantStorageConfig(ctx context.Context, defaultConfig StorageConfig) StorageConfig {
+	tenant, ok := tenant_registry.FromContext(ctx)
+	if !ok || tenant.Storage == nil {
+		return defaultConfig
+	}
+	return StorageConfig{
+		Vendor:    tenant.Storage.Vendor,
+		Region:    tenant.Storage.Region,
+		Bucket:    tenant.Storage.Bucket,
+		AccessKey: tenant.Storage.AccessKey,
+		SecretKey: tenant.Storage.SecretKey,
+	}
+}
+
+// resolveUidLists replaces the user accounts in the UID lists with their integer UIDs in the channel, for the tenant of a request.
+// Nil lists are skipped, see uid_directory.Directory.ResolveUids.
+func (s *CloudRecordingService) resolveUidLists(ctx context.Context, channel string, uidLists ...*[]string) error {
+	tenantID := tenant_registry.IDFromContext(ctx)
+	for _, uidList := range uidLists {
+		if uidList == nil {
+			continue
+		}
+		resolved, err := s.uidDirectory.ResolveUids(tenantID, channel, *uidList)
+		if err != nil {
+			return fmt.Errorf("error resolving user accounts: %v", err)
+		}
+		*uidList = resolved
+	}
+	return nil
+}
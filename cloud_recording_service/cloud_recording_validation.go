@@ -0,0 +1,72 @@
+package cloud_recording_service
+
+import (
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+)
+
+// Allowed values of the client request fields.
+var (
+	validSceneModes     = []string{"realtime", "web", "postponed"}
+	validRecordingModes = []string{"individual", "mix", "web"}
+)
+
+// Validate checks the channel name, modes and recording configuration of a start request.
+func (r *ClientStartRecordingRequest) Validate(errs *request_validation.Errors) {
+	errs.ChannelName("channelName", r.ChannelName)
+	if r.SceneMode != nil {
+		errs.OneOf("sceneMode", *r.SceneMode, validSceneModes...)
+	}
+	if r.RecordingMode != nil {
+		errs.OneOf("recordingMode", *r.RecordingMode, validRecordingModes...)
+	}
+	if config := r.RecordingConfig; config != nil {
+		if config.ChannelType != 0 && config.ChannelType != 1 {
+			errs.Add("recordingConfig.channelType", "must be 0 (communication) or 1 (live broadcast)")
+		}
+		errs.Range("recordingConfig.maxIdleTime", config.MaxIdleTime, 5, 2592000)
+		errs.Range("recordingConfig.streamTypes", config.StreamTypes, 0, 2)
+		errs.Range("recordingConfig.videoStreamType", config.VideoStreamType, 0, 1)
+	}
+}
+
+// Validate checks that a stop request identifies a recording session.
+func (r *ClientStopRecordingRequest) Validate(errs *request_validation.Errors) {
+	validateSessionIdentifiers(errs, r.RecordingId, r.Cname, r.Uid, r.ResourceId, r.Sid, r.RecordingMode)
+}
+
+// Validate checks that an update request identifies a recording session and updates exactly one configuration.
+func (r *ClientUpdateSubscriptionRequest) Validate(errs *request_validation.Errors) {
+	validateSessionIdentifiers(errs, r.RecordingId, r.Cname, r.Uid, r.ResourceId, r.Sid, r.RecordingMode)
+	if !r.UpdateConfig.IsValid() {
+		errs.Add("recordingConfig", "must set exactly one of streamSubscribe, webRecordingConfig or rtmpPublishConfig")
+	}
+}
+
+// Validate checks that a layout update request identifies a recording session.
+func (r *ClientUpdateLayoutRequest) Validate(errs *request_validation.Errors) {
+	validateSessionIdentifiers(errs, r.RecordingId, r.Cname, r.Uid, r.ResourceId, r.Sid, r.RecordingMode)
+	errs.Range("recordingConfig.mixedVideoLayout", r.UpdateConfig.MixedVideoLayout, 0, 3)
+}
+
+// validateSessionIdentifiers checks that a request identifies a recording session, see resolveSession:
+// by recording ID, by channel name, or by resourceId and sid with the channel name and UID Agora needs.
+func validateSessionIdentifiers(errs *request_validation.Errors, recordingId *string, cname string, uid string, resourceId string, sid string, recordingMode *string) {
+	if recordingMode != nil {
+		errs.OneOf("recordingMode", *recordingMode, validRecordingModes...)
+	}
+	if recordingId != nil && *recordingId != "" {
+		return
+	}
+	if (resourceId == "") != (sid == "") {
+		errs.Add("resourceId", "resourceId and sid must be set together")
+		return
+	}
+	if resourceId == "" && cname == "" {
+		errs.Add("recordingId", "recordingId, cname or resourceId and sid are required")
+		return
+	}
+	errs.ChannelName("cname", cname)
+	if resourceId != "" {
+		errs.Required("uid", uid)
+	}
+}
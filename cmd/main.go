@@ -13,11 +13,18 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/cloud_recording_service"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/http_headers"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/invite_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/openapi"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/rate_limiter"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/real_time_transcription_service"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/rtmp_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/webhook_service"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -32,10 +39,13 @@ func setupServer() *http.Server {
 	// Retrieve all configuration values from environment variables.
 	appIDEnv, appIDExists := os.LookupEnv("APP_ID")
 	appCertEnv, appCertExists := os.LookupEnv("APP_CERTIFICATE")
+	appCertSecondaryEnv, _ := os.LookupEnv("APP_CERTIFICATE_SECONDARY")
+	appCertActiveEnv, _ := os.LookupEnv("APP_CERTIFICATE_ACTIVE")
 	customerIDEnv, customerIDExists := os.LookupEnv("CUSTOMER_ID")
 	customerSecretEnv, customerSecretExists := os.LookupEnv("CUSTOMER_SECRET")
 	corsAllowOrigin, _ := os.LookupEnv("CORS_ALLOW_ORIGIN")
 	baseURLEnv, baseURLExists := os.LookupEnv("AGORA_BASE_URL")
+	failoverBaseURLsEnv, _ := os.LookupEnv("AGORA_FAILOVER_BASE_URLS")
 	cloudRecordingURLEnv, cloudRecordingURLExists := os.LookupEnv("AGORA_CLOUD_RECORDING_URL")
 	realTimeTranscriptionURLEnv, realTimeTranscriptionURLExists := os.LookupEnv("AGORA_RTT_URL")
 	rtmpURLEnv, rtmpURLExists := os.LookupEnv("AGORA_RTMP_URL")
@@ -45,6 +55,31 @@ func setupServer() *http.Server {
 	storageBucketEnv, bucketExists := os.LookupEnv("STORAGE_BUCKET")
 	storageAccessKeyEnv, accessKeyExists := os.LookupEnv("STORAGE_BUCKET_ACCESS_KEY")
 	storageSecretKeyEnv, secretKeyExists := os.LookupEnv("STORAGE_BUCKET_SECRET_KEY")
+	storageOverrideAllowListEnv, _ := os.LookupEnv("STORAGE_OVERRIDE_ALLOWLIST")
+	tokenBatchMaxSizeEnv, tokenBatchMaxSizeExists := os.LookupEnv("TOKEN_BATCH_MAX_SIZE")
+	recordingSessionStoreFileEnv, recordingSessionStoreFileExists := os.LookupEnv("RECORDING_SESSION_STORE_FILE")
+	ncsSecretEnv, ncsSecretExists := os.LookupEnv("AGORA_NCS_SECRET")
+	tokenAPIKeysEnv, _ := os.LookupEnv("TOKEN_API_KEYS")
+	tokenHMACKeysEnv, _ := os.LookupEnv("TOKEN_HMAC_KEYS")
+	tokenCallerTenantsEnv, _ := os.LookupEnv("TOKEN_CALLER_TENANTS")
+	tokenJWKSFileEnv, _ := os.LookupEnv("TOKEN_JWKS_FILE")
+	tokenJWTIssuerEnv, _ := os.LookupEnv("TOKEN_JWT_ISSUER")
+	tokenJWTAudienceEnv, _ := os.LookupEnv("TOKEN_JWT_AUDIENCE")
+	tokenPolicyFileEnv, _ := os.LookupEnv("TOKEN_POLICY_FILE")
+	tokenAdminAPIKeysEnv, _ := os.LookupEnv("TOKEN_ADMIN_API_KEYS")
+	tokenLegacyRoutesEnv, _ := os.LookupEnv("TOKEN_LEGACY_ROUTES")
+	tokenAuditLogFileEnv, _ := os.LookupEnv("TOKEN_AUDIT_LOG_FILE")
+	tenantsFileEnv, _ := os.LookupEnv("TENANTS_FILE")
+	uidDirectoryFileEnv, _ := os.LookupEnv("UID_DIRECTORY_FILE")
+	uidDirectoryScopeEnv, _ := os.LookupEnv("UID_DIRECTORY_SCOPE")
+	uidDirectoryMaxAccountsEnv, _ := os.LookupEnv("UID_DIRECTORY_MAX_ACCOUNTS")
+	inviteSecretEnv, _ := os.LookupEnv("INVITE_SECRET")
+	inviteStoreFileEnv, _ := os.LookupEnv("INVITE_STORE_FILE")
+	rateLimitsEnv, _ := os.LookupEnv("RATE_LIMITS")
+	rateLimitKeyEnv, _ := os.LookupEnv("RATE_LIMIT_KEY")
+	openAPIValidateRequestsEnv, _ := os.LookupEnv("OPENAPI_VALIDATE_REQUESTS")
+	openAPIDocsAssetsDirEnv, _ := os.LookupEnv("OPENAPI_DOCS_ASSETS_DIR")
+	trustedProxiesEnv, _ := os.LookupEnv("TRUSTED_PROXIES")
 
 	// Check for for the presence of core environment variables
 	if !appIDExists || !appCertExists {
@@ -53,14 +88,174 @@ func setupServer() *http.Server {
 
 	// Set up the Gin HTTP router with headers for CORS, caching, and timestamp.
 	router := gin.Default()
+	// Only take the client IP from X-Forwarded-For when the request is sent by a trusted proxy, otherwise clients could spoof it
+	if err := router.SetTrustedProxies(parseList(trustedProxiesEnv)); err != nil {
+		log.Fatalf("FATAL ERROR: Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Register the Agora webhook routes before the CORS middleware, Agora's notifications are sent server to server without an Origin header.
+	var webhookService *webhook_service.WebhookService
+	if ncsSecretExists && ncsSecretEnv != "" {
+		webhookService = webhook_service.NewWebhookService(ncsSecretEnv)
+		webhookService.RegisterRoutes(router)
+	}
 	var httpHeaders = http_headers.NewHttpHeaders(corsAllowOrigin)
 	router.Use(httpHeaders.NoCache())
 	router.Use(httpHeaders.CORShttpHeaders())
 	router.Use(httpHeaders.Timestamp())
 
+	// Resolve the tenant of each request when several Agora projects are hosted, the services use the tenant's credentials
+	var tenantRegistry *tenant_registry.Registry
+	if tenantsFileEnv != "" {
+		tenantDomains := append([]string{baseURLEnv}, parseList(failoverBaseURLsEnv)...)
+		var err error
+		tenantRegistry, err = tenant_registry.LoadRegistry(tenantsFileEnv, agora_client.WithDomains(tenantDomains...))
+		if err != nil {
+			log.Fatal("FATAL ERROR: Unable to load TENANTS_FILE: ", err)
+		}
+		router.Use(tenantRegistry.Middleware())
+	}
+
+	// Assign integer UIDs to user accounts when configured, so requests can reference users by account
+	var uidDirectory *uid_directory.Directory
+	if uidDirectoryFileEnv != "" || uidDirectoryScopeEnv != "" {
+		var err error
+		uidDirectory, err = uid_directory.NewDirectory(uidDirectoryFileEnv, uidDirectoryScopeEnv)
+		if err != nil {
+			log.Fatal("FATAL ERROR: Unable to load the UID directory: ", err)
+		}
+		if uidDirectoryMaxAccountsEnv != "" {
+			maxAccounts, err := strconv.Atoi(uidDirectoryMaxAccountsEnv)
+			if err == nil {
+				err = uidDirectory.SetMaxAccounts(maxAccounts)
+			}
+			if err != nil {
+				log.Fatal("FATAL ERROR: Invalid UID_DIRECTORY_MAX_ACCOUNTS: ", err)
+			}
+		}
+	}
+
 	// Initialize services & register routes.
 	tokenService := token_service.NewTokenService(appIDEnv, appCertEnv)
+	tokenService.SetUIDDirectory(uidDirectory)
+	if err := tokenService.SetTenantRegistry(tenantRegistry); err != nil {
+		log.Fatalf("FATAL ERROR: Invalid tenant app certificates: %v", err)
+	}
+	// Sign new tokens with the active certificate, tokens signed with either certificate stay valid
+	if err := tokenService.Certificates().Update(appCertEnv, appCertSecondaryEnv, appCertActiveEnv); err != nil {
+		log.Fatalf("FATAL ERROR: Invalid app certificates: %v", err)
+	}
+	reloadCertificatesOnHangup(tokenService, tenantsFileEnv)
+	if tokenBatchMaxSizeExists && tokenBatchMaxSizeEnv != "" {
+		tokenBatchMaxSize, err := strconv.Atoi(tokenBatchMaxSizeEnv)
+		if err != nil || tokenBatchMaxSize < 1 {
+			log.Fatal("FATAL ERROR: Invalid TOKEN_BATCH_MAX_SIZE not properly configured")
+		}
+		tokenService.SetMaxBatchSize(tokenBatchMaxSize)
+	}
+	// Require callers of the token routes to authenticate when any credentials are configured
+	// Bind the API key subjects and HMAC key IDs to their tenants, JWT callers carry their tenant in a claim
+	callerTenants, err := newCallerTenants(tokenCallerTenantsEnv, tenantRegistry)
+	if err != nil {
+		log.Fatalf("FATAL ERROR: Invalid TOKEN_CALLER_TENANTS: %v", err)
+	}
+	authenticators, err := newTokenAuthenticators(tokenAPIKeysEnv, tokenHMACKeysEnv, callerTenants, tokenJWKSFileEnv, tokenJWTIssuerEnv, tokenJWTAudienceEnv)
+	if err != nil {
+		log.Fatalf("FATAL ERROR: Invalid token authentication settings: %v", err)
+	}
+	tokenService.SetAuthenticators(authenticators...)
+	if tokenPolicyFileEnv != "" {
+		if len(authenticators) == 0 {
+			log.Fatal("FATAL ERROR: TOKEN_POLICY_FILE requires TOKEN_API_KEYS, TOKEN_HMAC_KEYS or TOKEN_JWKS_FILE")
+		}
+		policy, err := token_service.LoadPolicy(tokenPolicyFileEnv)
+		if err != nil {
+			log.Fatalf("FATAL ERROR: Invalid TOKEN_POLICY_FILE: %v", err)
+		}
+		tokenService.SetPolicy(policy)
+	}
+	// Allow switching the signing certificate at runtime when admin API keys are configured
+	if tokenAdminAPIKeysEnv != "" {
+		adminAuthenticator, err := newAPIKeyAuthenticator(tokenAdminAPIKeysEnv)
+		if err != nil {
+			log.Fatalf("FATAL ERROR: Invalid TOKEN_ADMIN_API_KEYS: %v", err)
+		}
+		tokenService.SetAdminAuthenticators(adminAuthenticator)
+	}
+	// Serve the routes of the community agora-token-service for clients built against it
+	if tokenLegacyRoutesEnv != "" {
+		legacyRoutes, err := strconv.ParseBool(tokenLegacyRoutesEnv)
+		if err != nil {
+			log.Fatal("FATAL ERROR: Invalid TOKEN_LEGACY_ROUTES, use true or false")
+		}
+		tokenService.SetLegacyRoutes(legacyRoutes)
+	}
+	// Record every token request in an append-only JSON lines audit log
+	if tokenAuditLogFileEnv != "" {
+		auditSink, err := token_service.NewJSONLAuditSink(tokenAuditLogFileEnv)
+		if err != nil {
+			log.Fatal("FATAL ERROR: Unable to open TOKEN_AUDIT_LOG_FILE: ", err)
+		}
+		tokenService.SetAuditSink(auditSink)
+	}
+	// Limit the request rate of each client per route group, after the tenant is resolved and the caller is verified so limits can be keyed by them
+	if rateLimitsEnv != "" {
+		limits, err := rate_limiter.ParseLimits(rateLimitsEnv)
+		if err != nil {
+			log.Fatalf("FATAL ERROR: Invalid rate limit settings: %v", err)
+		}
+		limiter, err := rate_limiter.NewLimiter(limits, rateLimitKeyEnv, nil)
+		if err != nil {
+			log.Fatalf("FATAL ERROR: Invalid rate limit settings: %v", err)
+		}
+		if rateLimitKeyEnv == rate_limiter.KeyByAPIKey {
+			router.Use(tokenService.Identify())
+		}
+		router.Use(limiter.Middleware())
+	}
+
+	// Document the routes at /openapi.json, and validate requests against the document when enabled
+	openAPIService := openapi.NewService("Agora Go Backend Middleware", "1.0.0")
+	// Serve the Swagger UI files of the docs UI from a local copy when configured, instead of loading them from unpkg.com
+	if openAPIDocsAssetsDirEnv != "" {
+		if err := openAPIService.SetDocsAssets(openAPIDocsAssetsDirEnv); err != nil {
+			log.Fatal("FATAL ERROR: Invalid OPENAPI_DOCS_ASSETS_DIR: ", err)
+		}
+	}
+	if openAPIValidateRequestsEnv != "" {
+		validateRequests, err := strconv.ParseBool(openAPIValidateRequestsEnv)
+		if err != nil {
+			log.Fatal("FATAL ERROR: Invalid OPENAPI_VALIDATE_REQUESTS, use true or false")
+		}
+		if validateRequests {
+			router.Use(openAPIService.ValidateRequests())
+		}
+	}
+
 	tokenService.RegisterRoutes(router)
+	if uidDirectory != nil {
+		// Resolving accounts assigns UIDs, so it has the same authentication as the token routes
+		uidDirectory.RegisterRoutes(router, tokenService.Authenticate())
+	}
+
+	// Let guests redeem signed invite links for tokens when an invite secret is configured
+	if inviteSecretEnv != "" {
+		var inviteStore invite_service.InviteStore
+		if inviteStoreFileEnv != "" {
+			fileInviteStore, err := invite_service.NewFileInviteStore(inviteStoreFileEnv)
+			if err != nil {
+				log.Fatal("FATAL ERROR: Unable to load INVITE_STORE_FILE: ", err)
+			}
+			inviteStore = fileInviteStore
+		}
+		inviteService, err := invite_service.NewInviteService(inviteSecretEnv, inviteStore, tokenService)
+		if err != nil {
+			log.Fatalf("FATAL ERROR: Invalid INVITE_SECRET: %v", err)
+		}
+		inviteService.SetTenantRegistry(tenantRegistry)
+		inviteService.SetUIDDirectory(uidDirectory)
+		inviteService.RegisterRoutes(router)
+	}
 
 	if baseURLExists {
 		// Check for Basic Auth settings if baseURL is provided
@@ -69,6 +264,9 @@ func setupServer() *http.Server {
 		}
 		// get basicAuth key
 		basicAuthKey := getBasicAuth(customerIDEnv, customerSecretEnv)
+		// Shared client for all requests to the Agora API, with pooled connections, retries and failover to the backup domains in order
+		agoraDomains := append([]string{baseURLEnv}, parseList(failoverBaseURLsEnv)...)
+		agoraClient := agora_client.NewClient(basicAuthKey, agora_client.WithDomains(agoraDomains...))
 
 		if cloudRecordingURLExists || realTimeTranscriptionURLExists {
 			if !vendorExists || !regionExists || !bucketExists || !accessKeyExists || !secretKeyExists {
@@ -91,18 +289,39 @@ func setupServer() *http.Server {
 				AccessKey: storageAccessKeyEnv,
 				SecretKey: storageSecretKeyEnv,
 			}
+			// Storage fields clients are allowed to override, e.g. "bucket,fileNamePrefix,extensionParams"
+			allowedStorageOverrides := parseList(storageOverrideAllowListEnv)
 
 			if cloudRecordingURLExists {
+				// Keep recording sessions in a file when configured, otherwise in memory
+				var sessionStore cloud_recording_service.SessionStore
+				if recordingSessionStoreFileExists && recordingSessionStoreFileEnv != "" {
+					fileSessionStore, err := cloud_recording_service.NewFileSessionStore(recordingSessionStoreFileEnv)
+					if err != nil {
+						log.Fatal("FATAL ERROR: Unable to load RECORDING_SESSION_STORE_FILE: ", err)
+					}
+					sessionStore = fileSessionStore
+				}
 				// Init Cloud Recording Service
 				cloudRecordingUrl := baseURLEnv + strings.Replace(cloudRecordingURLEnv, "{appId}", appIDEnv, 1) // replace the place-holder value with appID from Env
-				cloudRecordingService := cloud_recording_service.NewCloudRecordingService(appIDEnv, cloudRecordingUrl, basicAuthKey, tokenService, storageConfig)
+				cloudRecordingService := cloud_recording_service.NewCloudRecordingService(appIDEnv, cloudRecordingUrl, agoraClient, tokenService, storageConfig, allowedStorageOverrides, sessionStore)
+				cloudRecordingService.SetUIDDirectory(uidDirectory)
 				cloudRecordingService.RegisterRoutes(router)
+				// Drop the sessions of recordings that exit on their own, e.g. after maxIdleTime
+				if webhookService != nil {
+					webhookService.OnCloudRecording(func(notification webhook_service.Notification, event webhook_service.CloudRecordingEvent) {
+						if notification.EventType == webhook_service.CloudRecordingEventSessionExit {
+							cloudRecordingService.EndSession(event.Cname, event.Sid)
+						}
+					})
+				}
 			}
 
 			if realTimeTranscriptionURLExists {
 				// Init Real Time Transcription Service
 				realTimeTranscriptionUrl := baseURLEnv + strings.Replace(realTimeTranscriptionURLEnv, "{appId}", appIDEnv, 1) //replace the place-holder value with appID
-				realTimeTranscriptionService := real_time_transcription_service.NewRTTService(appIDEnv, realTimeTranscriptionUrl, basicAuthKey, tokenService, storageConfig)
+				realTimeTranscriptionService := real_time_transcription_service.NewRTTService(appIDEnv, realTimeTranscriptionUrl, agoraClient, tokenService, storageConfig, allowedStorageOverrides)
+				realTimeTranscriptionService.SetUIDDirectory(uidDirectory)
 				realTimeTranscriptionService.RegisterRoutes(router)
 			}
 		}
@@ -118,7 +337,8 @@ func setupServer() *http.Server {
 				cloudPlayerURL = strings.Replace(cloudPlayerURLEnv, "{appId}", appIDEnv, 1)
 			}
 			// Init RTMP Service
-			rtmpService := rtmp_service.NewRtmpService(appIDEnv, baseURLEnv, rtmpURL, cloudPlayerURL, basicAuthKey, tokenService)
+			rtmpService := rtmp_service.NewRtmpService(appIDEnv, baseURLEnv, rtmpURL, cloudPlayerURL, agoraClient, tokenService)
+			rtmpService.SetUIDDirectory(uidDirectory)
 			rtmpService.RegisterRoutes(router)
 		}
 	} else {
@@ -128,6 +348,9 @@ func setupServer() *http.Server {
 	// Register healthcheck route
 	router.GET("/ping", Ping)
 
+	// Register the OpenAPI document and docs UI routes last, the document describes the routes registered before
+	openAPIService.RegisterRoutes(router)
+
 	// Retrieve server port from environment variables or default to 8080.
 	serverPort, exists := os.LookupEnv("SERVER_PORT")
 	if !exists {
@@ -185,3 +408,139 @@ func getBasicAuth(customerID string, customerSecret string) string {
 	auth := fmt.Sprintf("%s:%s", customerID, customerSecret)
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
 }
+
+// parseList splits a comma separated environment value into a list, ignoring empty entries.
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parsePairs splits a comma separated list of "name:value" pairs into a map, the value may contain colons.
+func parsePairs(value string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range parseList(value) {
+		name, pairValue, found := strings.Cut(item, ":")
+		if !found || name == "" || pairValue == "" {
+			return nil, fmt.Errorf("expected name:value, got %q", item)
+		}
+		pairs[name] = pairValue
+	}
+	return pairs, nil
+}
+
+// newCallerTenants parses a comma separated list of "subjectOrKeyId:tenantId" pairs, every tenant must exist in the registry.
+// It returns nil when no pairs are configured and an error when pairs are configured without a tenant registry.
+func newCallerTenants(value string, registry *tenant_registry.Registry) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("requires TENANTS_FILE")
+	}
+	tenants, err := parsePairs(value)
+	if err != nil {
+		return nil, err
+	}
+	for caller, tenantID := range tenants {
+		if _, ok := registry.Get(tenantID); !ok {
+			return nil, fmt.Errorf("unknown tenant %q for %q", tenantID, caller)
+		}
+	}
+	return tenants, nil
+}
+
+// newTokenAuthenticators returns the authenticators for the token routes that have credentials configured.
+// The API keys are "subject:key" pairs, the HMAC keys are "keyId:secret" pairs, the JWKS file enables JWT authentication.
+// The caller tenants bind API key subjects and HMAC key IDs to a tenant ID.
+func newTokenAuthenticators(apiKeys string, hmacKeys string, callerTenants map[string]string, jwksFile string, jwtIssuer string, jwtAudience string) ([]token_service.Authenticator, error) {
+	var authenticators []token_service.Authenticator
+	if apiKeys != "" {
+		apiKeyAuthenticator, err := newAPIKeyAuthenticator(apiKeys)
+		if err != nil {
+			return nil, fmt.Errorf("TOKEN_API_KEYS: %v", err)
+		}
+		apiKeyAuthenticator.SetTenants(callerTenants)
+		authenticators = append(authenticators, apiKeyAuthenticator)
+	}
+	if hmacKeys != "" {
+		secrets, err := parsePairs(hmacKeys)
+		if err != nil {
+			return nil, fmt.Errorf("TOKEN_HMAC_KEYS: %v", err)
+		}
+		hmacAuthenticator := token_service.NewHMACAuthenticator(secrets)
+		hmacAuthenticator.SetTenants(callerTenants)
+		authenticators = append(authenticators, hmacAuthenticator)
+	}
+	if jwksFile != "" {
+		jwtAuthenticator, err := token_service.NewJWTAuthenticator(jwksFile, jwtIssuer, jwtAudience)
+		if err != nil {
+			return nil, fmt.Errorf("TOKEN_JWKS_FILE: %v", err)
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+	return authenticators, nil
+}
+
+// newAPIKeyAuthenticator returns the authenticator for a comma separated list of "subject:key" pairs.
+func newAPIKeyAuthenticator(apiKeys string) (*token_service.APIKeyAuthenticator, error) {
+	subjects, err := parsePairs(apiKeys)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for subject, key := range subjects {
+		keys[key] = subject
+	}
+	return token_service.NewAPIKeyAuthenticator(keys), nil
+}
+
+// reloadCertificatesOnHangup reloads the app certificates on SIGHUP, see reloadCertificates,
+// and the app certificates of the tenants when a tenants file is set, see reloadTenantCertificates.
+func reloadCertificatesOnHangup(tokenService *token_service.TokenService, tenantsFile string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			certificates := tokenService.Certificates()
+			if err := reloadCertificates(certificates); err != nil {
+				log.Printf("ERROR: Failed to reload app certificates, keeping the current ones: %v", err)
+			} else {
+				log.Printf("Reloaded app certificates, the %s certificate signs new tokens", certificates.Status().Active)
+			}
+			if tenantsFile == "" {
+				continue
+			}
+			if err := reloadTenantCertificates(tokenService, tenantsFile); err != nil {
+				log.Printf("ERROR: Failed to reload the tenants' app certificates, keeping the current ones: %v", err)
+				continue
+			}
+			log.Printf("Reloaded the tenants' app certificates from %s", tenantsFile)
+		}
+	}()
+}
+
+// reloadCertificates updates the app certificates from the .env file and the environment,
+// so the signing certificate can be switched or a new certificate added without a restart.
+// Values in the .env file override the environment.
+func reloadCertificates(certificates *token_service.AppCertificates) error {
+	if err := godotenv.Overload(); err != nil {
+		log.Println("Warning: Error loading .env file. Using existing environment variables.")
+	}
+	return certificates.Update(os.Getenv("APP_CERTIFICATE"), os.Getenv("APP_CERTIFICATE_SECONDARY"), os.Getenv("APP_CERTIFICATE_ACTIVE"))
+}
+
+// reloadTenantCertificates updates the app certificates of the tenants from the tenants file,
+// so a tenant's signing certificate can be switched or a new certificate added without a restart.
+// Other changes to the tenants file, e.g. new tenants, require a restart.
+func reloadTenantCertificates(tokenService *token_service.TokenService, tenantsFile string) error {
+	registry, err := tenant_registry.LoadRegistry(tenantsFile)
+	if err != nil {
+		return err
+	}
+	return tokenService.UpdateTenantCertificates(registry)
+}
@@ -14,11 +14,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/cloud_recording_service"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/http_headers"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/invite_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/openapi"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/rate_limiter"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/real_time_transcription_service"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/rtmp_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/webhook_service"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -321,6 +328,99 @@ func TestSetupRouterErrors(t *testing.T) {
 			},
 			expectedError: "FATAL ERROR: ENV not properly configured for Basic Auth",
 		},
+		{
+			name: "Secondary certificate active without a secondary certificate",
+			envVars: map[string]string{
+				"APP_ID":                 "testAppID",
+				"APP_CERTIFICATE":        "testAppCertificate",
+				"APP_CERTIFICATE_ACTIVE": "secondary",
+			},
+			expectedError: "FATAL ERROR: Invalid app certificates",
+		},
+		{
+			name: "Caller tenants without a tenants file",
+			envVars: map[string]string{
+				"APP_ID":               "testAppID",
+				"APP_CERTIFICATE":      "testAppCertificate",
+				"TOKEN_API_KEYS":       "backend:key",
+				"TOKEN_CALLER_TENANTS": "backend:video",
+			},
+			expectedError: "FATAL ERROR: Invalid TOKEN_CALLER_TENANTS",
+		},
+		{
+			name: "Invite secret too short",
+			envVars: map[string]string{
+				"APP_ID":          "testAppID",
+				"APP_CERTIFICATE": "testAppCertificate",
+				"INVITE_SECRET":   "short",
+			},
+			expectedError: "FATAL ERROR: Invalid INVITE_SECRET",
+		},
+		{
+			name: "UID directory maximum below the resolve limit",
+			envVars: map[string]string{
+				"APP_ID":                     "testAppID",
+				"APP_CERTIFICATE":            "testAppCertificate",
+				"UID_DIRECTORY_SCOPE":        "app",
+				"UID_DIRECTORY_MAX_ACCOUNTS": "10",
+			},
+			expectedError: "FATAL ERROR: Invalid UID_DIRECTORY_MAX_ACCOUNTS",
+		},
+		{
+			name: "Audit log file in missing directory",
+			envVars: map[string]string{
+				"APP_ID":               "testAppID",
+				"APP_CERTIFICATE":      "testAppCertificate",
+				"TOKEN_AUDIT_LOG_FILE": "/nonexistent-dir/audit.jsonl",
+			},
+			expectedError: "FATAL ERROR: Unable to open TOKEN_AUDIT_LOG_FILE",
+		},
+		{
+			name: "Invalid rate limits",
+			envVars: map[string]string{
+				"APP_ID":          "testAppID",
+				"APP_CERTIFICATE": "testAppCertificate",
+				"RATE_LIMITS":     "token=lots",
+			},
+			expectedError: "FATAL ERROR: Invalid rate limit settings",
+		},
+		{
+			name: "Unknown rate limit key",
+			envVars: map[string]string{
+				"APP_ID":          "testAppID",
+				"APP_CERTIFICATE": "testAppCertificate",
+				"RATE_LIMITS":     "token=100/m",
+				"RATE_LIMIT_KEY":  "user",
+			},
+			expectedError: "FATAL ERROR: Invalid rate limit settings",
+		},
+		{
+			name: "Invalid OpenAPI request validation setting",
+			envVars: map[string]string{
+				"APP_ID":                    "testAppID",
+				"APP_CERTIFICATE":           "testAppCertificate",
+				"OPENAPI_VALIDATE_REQUESTS": "sometimes",
+			},
+			expectedError: "FATAL ERROR: Invalid OPENAPI_VALIDATE_REQUESTS",
+		},
+		{
+			name: "Missing OpenAPI docs assets",
+			envVars: map[string]string{
+				"APP_ID":                  "testAppID",
+				"APP_CERTIFICATE":         "testAppCertificate",
+				"OPENAPI_DOCS_ASSETS_DIR": "/nonexistent/swagger-ui-dist",
+			},
+			expectedError: "FATAL ERROR: Invalid OPENAPI_DOCS_ASSETS_DIR",
+		},
+		{
+			name: "Invalid trusted proxies",
+			envVars: map[string]string{
+				"APP_ID":          "testAppID",
+				"APP_CERTIFICATE": "testAppCertificate",
+				"TRUSTED_PROXIES": "not-an-ip",
+			},
+			expectedError: "FATAL ERROR: Invalid TRUSTED_PROXIES",
+		},
 		// TODO: Add more error cases
 	}
 
@@ -345,6 +445,97 @@ func TestSetupRouterErrors(t *testing.T) {
 	}
 }
 
+func TestOpenAPIDocument(t *testing.T) {
+	os.Clearenv()
+	setMockEnvVars()
+	// Enable every service, so every route is registered
+	os.Setenv("AGORA_CLOUD_PLAYER_URL", "v1/projects/{appId}/cloud-player")
+	os.Setenv("AGORA_NCS_SECRET", "ncs-secret")
+	os.Setenv("TOKEN_ADMIN_API_KEYS", "admin:admin-key")
+	os.Setenv("TOKEN_AUDIT_LOG_FILE", t.TempDir()+"/audit.jsonl")
+	os.Setenv("TOKEN_LEGACY_ROUTES", "true")
+	os.Setenv("UID_DIRECTORY_SCOPE", "channel")
+	os.Setenv("INVITE_SECRET", "0123456789abcdef0123456789abcdef")
+	os.Setenv("OPENAPI_VALIDATE_REQUESTS", "true")
+
+	router, err := setupRouter()
+	if err != nil {
+		t.Fatalf("Failed to setup router: %v", err)
+	}
+
+	w := performRequest(router, "GET", "/openapi.json", nil)
+	assertStatusCode(t, w, http.StatusOK)
+	var document openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatalf("Unable to parse the OpenAPI document: %v", err)
+	}
+
+	// Every registered route must be described in openapi.Routes
+	described := make(map[string]bool)
+	for _, route := range openapi.Routes {
+		described[route.Method+" "+route.Path] = true
+	}
+	for _, route := range router.Routes() {
+		if !described[route.Method+" "+route.Path] {
+			t.Errorf("Route %s %s is not described in openapi.Routes", route.Method, route.Path)
+		}
+	}
+	if operation := document.Paths["/rtt/status/{taskId}"]["get"]; operation == nil || operation.OperationID != "queryTranscription" {
+		t.Errorf("Expected the queryTranscription operation at /rtt/status/{taskId}, got %+v", operation)
+	}
+
+	w = performRequest(router, "GET", "/docs", nil)
+	assertStatusCode(t, w, http.StatusOK)
+
+	// Requests are validated against the document before reaching the handlers
+	w = performRequest(router, "POST", "/token/getNew", []byte(`{"tokenType": 1}`))
+	assertStatusCode(t, w, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), `"field":"tokenType","message":"must be of type string"`) {
+		t.Errorf("Expected a tokenType field error, got %s", w.Body.String())
+	}
+	w = performRequest(router, "POST", "/token/getNew", []byte(`{"tokenType": "rtc", "channel": "test", "role": "publisher", "uid": "1"}`))
+	assertStatusCode(t, w, http.StatusOK)
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	send := func(router *gin.Engine, remoteAddr string, forwardedFor string) int {
+		req, _ := http.NewRequest("GET", "/rtc/test/publisher/uid/1/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	os.Clearenv()
+	setMockEnvVars()
+	os.Setenv("TOKEN_LEGACY_ROUTES", "true")
+	os.Setenv("RATE_LIMITS", "token=1/m")
+	router, err := setupRouter()
+	if err != nil {
+		t.Fatalf("Failed to setup router: %v", err)
+	}
+	// A spoofed X-Forwarded-For doesn't get a new bucket
+	if code := send(router, "203.0.113.7:1000", "198.51.100.1"); code != http.StatusOK {
+		t.Errorf("First request status = %d, want %d", code, http.StatusOK)
+	}
+	if code := send(router, "203.0.113.7:1000", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Spoofed X-Forwarded-For status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Behind a trusted proxy each forwarded client has its own bucket
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	router, err = setupRouter()
+	if err != nil {
+		t.Fatalf("Failed to setup router: %v", err)
+	}
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := send(router, "10.1.2.3:1000", client); code != http.StatusOK {
+			t.Errorf("Forwarded client %s status = %d, want %d", client, code, http.StatusOK)
+		}
+	}
+}
+
 func TestGracefulShutdown(t *testing.T) {
 	os.Clearenv()
 	setMockEnvVars()
@@ -405,6 +596,69 @@ func setupPingTestRouter() *gin.Engine {
 	return router
 }
 
+func TestReloadCertificates(t *testing.T) {
+	certificates, _ := token_service.NewAppCertificates("f9e8d7c6b5a40918273e6d5c4b3a2f1c", "", "")
+
+	t.Setenv("APP_CERTIFICATE", "f9e8d7c6b5a40918273e6d5c4b3a2f1c")
+	t.Setenv("APP_CERTIFICATE_SECONDARY", "0c5a1f8bd7d24d1bb1a4b4e5d8f0c9e2")
+	t.Setenv("APP_CERTIFICATE_ACTIVE", "secondary")
+	if err := reloadCertificates(certificates); err != nil {
+		t.Fatalf("reloadCertificates() error = %v", err)
+	}
+	if status := certificates.Status(); status.Active != "secondary" || !status.SecondaryAvailable {
+		t.Errorf("Status() = %+v, want the secondary certificate active", status)
+	}
+
+	// An invalid configuration keeps the current certificates
+	t.Setenv("APP_CERTIFICATE_SECONDARY", "")
+	if err := reloadCertificates(certificates); err == nil {
+		t.Errorf("Expected an error for an active secondary certificate without a secondary certificate")
+	}
+	if active := certificates.Status().Active; active != "secondary" {
+		t.Errorf("Active = %q, want the certificates unchanged", active)
+	}
+}
+
+func TestReloadTenantCertificates(t *testing.T) {
+	tenantsFile := t.TempDir() + "/tenants.json"
+	writeTenants := func(tenant string) {
+		if err := os.WriteFile(tenantsFile, []byte(`{"tenants": [`+tenant+`]}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTenants(`{"id": "video", "appId": "0123456789abcdef0123456789abcdef", "appCertificate": "fedcba9876543210fedcba9876543210"}`)
+	registry, err := tenant_registry.LoadRegistry(tenantsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenService := token_service.NewTokenService("testAppID", "f9e8d7c6b5a40918273e6d5c4b3a2f1c")
+	if err := tokenService.SetTenantRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	tenant, _ := registry.Get("video")
+	certificates := tokenService.ForContext(tenant_registry.NewContext(context.Background(), tenant)).Certificates()
+
+	writeTenants(`{"id": "video", "appId": "0123456789abcdef0123456789abcdef", "appCertificate": "fedcba9876543210fedcba9876543210", "appCertificateSecondary": "0c5a1f8bd7d24d1bb1a4b4e5d8f0c9e2", "appCertificateActive": "secondary"}`)
+	if err := reloadTenantCertificates(tokenService, tenantsFile); err != nil {
+		t.Fatalf("reloadTenantCertificates() error = %v", err)
+	}
+	if status := certificates.Status(); status.Active != "secondary" || !status.SecondaryAvailable {
+		t.Errorf("Status() = %+v, want the tenant's secondary certificate active", status)
+	}
+	if active := tokenService.Certificates().Status().Active; active != "primary" {
+		t.Errorf("server certificate = %q, want it unchanged", active)
+	}
+
+	// An invalid tenants file keeps the current certificates
+	writeTenants(`{"id": "video", "appId": "0123456789abcdef0123456789abcdef", "appCertificate": "fedcba9876543210fedcba9876543210", "appCertificateActive": "secondary"}`)
+	if err := reloadTenantCertificates(tokenService, tenantsFile); err == nil {
+		t.Errorf("Expected an error for an active secondary certificate without a secondary certificate")
+	}
+	if active := certificates.Status().Active; active != "secondary" {
+		t.Errorf("Active = %q, want the certificates unchanged", active)
+	}
+}
+
 func setupRouter() (*gin.Engine, error) {
 	router := gin.New()
 	router.GET("/ping", Ping)
@@ -412,10 +666,13 @@ func setupRouter() (*gin.Engine, error) {
 	// Retrieve all configuration values from environment variables.
 	appIDEnv, appIDExists := os.LookupEnv("APP_ID")
 	appCertEnv, appCertExists := os.LookupEnv("APP_CERTIFICATE")
+	appCertSecondaryEnv, _ := os.LookupEnv("APP_CERTIFICATE_SECONDARY")
+	appCertActiveEnv, _ := os.LookupEnv("APP_CERTIFICATE_ACTIVE")
 	customerIDEnv, customerIDExists := os.LookupEnv("CUSTOMER_ID")
 	customerSecretEnv, customerSecretExists := os.LookupEnv("CUSTOMER_SECRET")
 	corsAllowOrigin, _ := os.LookupEnv("CORS_ALLOW_ORIGIN")
 	baseURLEnv, baseURLExists := os.LookupEnv("AGORA_BASE_URL")
+	failoverBaseURLsEnv, _ := os.LookupEnv("AGORA_FAILOVER_BASE_URLS")
 	cloudRecordingURLEnv, cloudRecordingURLExists := os.LookupEnv("AGORA_CLOUD_RECORDING_URL")
 	realTimeTranscriptionURLEnv, realTimeTranscriptionURLExists := os.LookupEnv("AGORA_RTT_URL")
 	rtmpURLEnv, rtmpURLExists := os.LookupEnv("AGORA_RTMP_URL")
@@ -425,6 +682,31 @@ func setupRouter() (*gin.Engine, error) {
 	storageBucketEnv, bucketExists := os.LookupEnv("STORAGE_BUCKET")
 	storageAccessKeyEnv, accessKeyExists := os.LookupEnv("STORAGE_BUCKET_ACCESS_KEY")
 	storageSecretKeyEnv, secretKeyExists := os.LookupEnv("STORAGE_BUCKET_SECRET_KEY")
+	storageOverrideAllowListEnv, _ := os.LookupEnv("STORAGE_OVERRIDE_ALLOWLIST")
+	tokenBatchMaxSizeEnv, tokenBatchMaxSizeExists := os.LookupEnv("TOKEN_BATCH_MAX_SIZE")
+	recordingSessionStoreFileEnv, recordingSessionStoreFileExists := os.LookupEnv("RECORDING_SESSION_STORE_FILE")
+	ncsSecretEnv, ncsSecretExists := os.LookupEnv("AGORA_NCS_SECRET")
+	tokenAPIKeysEnv, _ := os.LookupEnv("TOKEN_API_KEYS")
+	tokenHMACKeysEnv, _ := os.LookupEnv("TOKEN_HMAC_KEYS")
+	tokenCallerTenantsEnv, _ := os.LookupEnv("TOKEN_CALLER_TENANTS")
+	tokenJWKSFileEnv, _ := os.LookupEnv("TOKEN_JWKS_FILE")
+	tokenJWTIssuerEnv, _ := os.LookupEnv("TOKEN_JWT_ISSUER")
+	tokenJWTAudienceEnv, _ := os.LookupEnv("TOKEN_JWT_AUDIENCE")
+	tokenPolicyFileEnv, _ := os.LookupEnv("TOKEN_POLICY_FILE")
+	tokenAdminAPIKeysEnv, _ := os.LookupEnv("TOKEN_ADMIN_API_KEYS")
+	tokenLegacyRoutesEnv, _ := os.LookupEnv("TOKEN_LEGACY_ROUTES")
+	tokenAuditLogFileEnv, _ := os.LookupEnv("TOKEN_AUDIT_LOG_FILE")
+	tenantsFileEnv, _ := os.LookupEnv("TENANTS_FILE")
+	uidDirectoryFileEnv, _ := os.LookupEnv("UID_DIRECTORY_FILE")
+	uidDirectoryScopeEnv, _ := os.LookupEnv("UID_DIRECTORY_SCOPE")
+	uidDirectoryMaxAccountsEnv, _ := os.LookupEnv("UID_DIRECTORY_MAX_ACCOUNTS")
+	inviteSecretEnv, _ := os.LookupEnv("INVITE_SECRET")
+	inviteStoreFileEnv, _ := os.LookupEnv("INVITE_STORE_FILE")
+	rateLimitsEnv, _ := os.LookupEnv("RATE_LIMITS")
+	rateLimitKeyEnv, _ := os.LookupEnv("RATE_LIMIT_KEY")
+	openAPIValidateRequestsEnv, _ := os.LookupEnv("OPENAPI_VALIDATE_REQUESTS")
+	openAPIDocsAssetsDirEnv, _ := os.LookupEnv("OPENAPI_DOCS_ASSETS_DIR")
+	trustedProxiesEnv, _ := os.LookupEnv("TRUSTED_PROXIES")
 
 	// log.Printf("appIDExists: %v, appIDEnv: %v", appIDExists, appIDEnv)
 	// log.Printf("appCertExists: %v, appCertEnv: %v", appCertExists, appCertEnv)
@@ -445,15 +727,175 @@ func setupRouter() (*gin.Engine, error) {
 		return nil, fmt.Errorf("FATAL ERROR: ENV not properly configured, APP ID and APP CERTIFICATE are required.")
 	}
 
+	// Only take the client IP from X-Forwarded-For when the request is sent by a trusted proxy, otherwise clients could spoof it
+	if err := router.SetTrustedProxies(parseList(trustedProxiesEnv)); err != nil {
+		return nil, fmt.Errorf("FATAL ERROR: Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Register the Agora webhook routes before the CORS middleware, Agora's notifications are sent server to server without an Origin header.
+	var webhookService *webhook_service.WebhookService
+	if ncsSecretExists && ncsSecretEnv != "" {
+		webhookService = webhook_service.NewWebhookService(ncsSecretEnv)
+		webhookService.RegisterRoutes(router)
+	}
+
 	// Set up the Gin HTTP router with headers for CORS, caching, and timestamp.
 	var httpHeaders = http_headers.NewHttpHeaders(corsAllowOrigin)
 	router.Use(httpHeaders.NoCache())
 	router.Use(httpHeaders.CORShttpHeaders())
 	router.Use(httpHeaders.Timestamp())
 
+	// Resolve the tenant of each request when several Agora projects are hosted, the services use the tenant's credentials
+	var tenantRegistry *tenant_registry.Registry
+	if tenantsFileEnv != "" {
+		tenantDomains := append([]string{baseURLEnv}, parseList(failoverBaseURLsEnv)...)
+		var err error
+		tenantRegistry, err = tenant_registry.LoadRegistry(tenantsFileEnv, agora_client.WithDomains(tenantDomains...))
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Unable to load TENANTS_FILE: %v", err)
+		}
+		router.Use(tenantRegistry.Middleware())
+	}
+
+	// Assign integer UIDs to user accounts when configured, so requests can reference users by account
+	var uidDirectory *uid_directory.Directory
+	if uidDirectoryFileEnv != "" || uidDirectoryScopeEnv != "" {
+		var err error
+		uidDirectory, err = uid_directory.NewDirectory(uidDirectoryFileEnv, uidDirectoryScopeEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Unable to load the UID directory: %v", err)
+		}
+		if uidDirectoryMaxAccountsEnv != "" {
+			maxAccounts, err := strconv.Atoi(uidDirectoryMaxAccountsEnv)
+			if err == nil {
+				err = uidDirectory.SetMaxAccounts(maxAccounts)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("FATAL ERROR: Invalid UID_DIRECTORY_MAX_ACCOUNTS: %v", err)
+			}
+		}
+	}
+
 	// Initialize services & register routes.
 	tokenService := token_service.NewTokenService(appIDEnv, appCertEnv)
+	tokenService.SetUIDDirectory(uidDirectory)
+	if err := tokenService.SetTenantRegistry(tenantRegistry); err != nil {
+		return nil, fmt.Errorf("FATAL ERROR: Invalid tenant app certificates: %v", err)
+	}
+	// Sign new tokens with the active certificate, tokens signed with either certificate stay valid
+	if err := tokenService.Certificates().Update(appCertEnv, appCertSecondaryEnv, appCertActiveEnv); err != nil {
+		return nil, fmt.Errorf("FATAL ERROR: Invalid app certificates: %v", err)
+	}
+	if tokenBatchMaxSizeExists && tokenBatchMaxSizeEnv != "" {
+		tokenBatchMaxSize, err := strconv.Atoi(tokenBatchMaxSizeEnv)
+		if err != nil || tokenBatchMaxSize < 1 {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid TOKEN_BATCH_MAX_SIZE not properly configured")
+		}
+		tokenService.SetMaxBatchSize(tokenBatchMaxSize)
+	}
+	// Require callers of the token routes to authenticate when any credentials are configured
+	// Bind the API key subjects and HMAC key IDs to their tenants, JWT callers carry their tenant in a claim
+	callerTenants, err := newCallerTenants(tokenCallerTenantsEnv, tenantRegistry)
+	if err != nil {
+		return nil, fmt.Errorf("FATAL ERROR: Invalid TOKEN_CALLER_TENANTS: %v", err)
+	}
+	authenticators, err := newTokenAuthenticators(tokenAPIKeysEnv, tokenHMACKeysEnv, callerTenants, tokenJWKSFileEnv, tokenJWTIssuerEnv, tokenJWTAudienceEnv)
+	if err != nil {
+		return nil, fmt.Errorf("FATAL ERROR: Invalid token authentication settings: %v", err)
+	}
+	tokenService.SetAuthenticators(authenticators...)
+	if tokenPolicyFileEnv != "" {
+		if len(authenticators) == 0 {
+			return nil, fmt.Errorf("FATAL ERROR: TOKEN_POLICY_FILE requires TOKEN_API_KEYS, TOKEN_HMAC_KEYS or TOKEN_JWKS_FILE")
+		}
+		policy, err := token_service.LoadPolicy(tokenPolicyFileEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid TOKEN_POLICY_FILE: %v", err)
+		}
+		tokenService.SetPolicy(policy)
+	}
+	// Allow switching the signing certificate at runtime when admin API keys are configured
+	if tokenAdminAPIKeysEnv != "" {
+		adminAuthenticator, err := newAPIKeyAuthenticator(tokenAdminAPIKeysEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid TOKEN_ADMIN_API_KEYS: %v", err)
+		}
+		tokenService.SetAdminAuthenticators(adminAuthenticator)
+	}
+	// Serve the routes of the community agora-token-service for clients built against it
+	if tokenLegacyRoutesEnv != "" {
+		legacyRoutes, err := strconv.ParseBool(tokenLegacyRoutesEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid TOKEN_LEGACY_ROUTES, use true or false")
+		}
+		tokenService.SetLegacyRoutes(legacyRoutes)
+	}
+	// Record every token request in an append-only JSON lines audit log
+	if tokenAuditLogFileEnv != "" {
+		auditSink, err := token_service.NewJSONLAuditSink(tokenAuditLogFileEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Unable to open TOKEN_AUDIT_LOG_FILE: %v", err)
+		}
+		tokenService.SetAuditSink(auditSink)
+	}
+	// Limit the request rate of each client per route group, after the tenant is resolved and the caller is verified so limits can be keyed by them
+	if rateLimitsEnv != "" {
+		limits, err := rate_limiter.ParseLimits(rateLimitsEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid rate limit settings: %v", err)
+		}
+		limiter, err := rate_limiter.NewLimiter(limits, rateLimitKeyEnv, nil)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid rate limit settings: %v", err)
+		}
+		if rateLimitKeyEnv == rate_limiter.KeyByAPIKey {
+			router.Use(tokenService.Identify())
+		}
+		router.Use(limiter.Middleware())
+	}
+
+	// Document the routes at /openapi.json, and validate requests against the document when enabled
+	openAPIService := openapi.NewService("Agora Go Backend Middleware", "1.0.0")
+	// Serve the Swagger UI files of the docs UI from a local copy when configured, instead of loading them from unpkg.com
+	if openAPIDocsAssetsDirEnv != "" {
+		if err := openAPIService.SetDocsAssets(openAPIDocsAssetsDirEnv); err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid OPENAPI_DOCS_ASSETS_DIR: %v", err)
+		}
+	}
+	if openAPIValidateRequestsEnv != "" {
+		validateRequests, err := strconv.ParseBool(openAPIValidateRequestsEnv)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid OPENAPI_VALIDATE_REQUESTS, use true or false")
+		}
+		if validateRequests {
+			router.Use(openAPIService.ValidateRequests())
+		}
+	}
+
 	tokenService.RegisterRoutes(router)
+	if uidDirectory != nil {
+		// Resolving accounts assigns UIDs, so it has the same authentication as the token routes
+		uidDirectory.RegisterRoutes(router, tokenService.Authenticate())
+	}
+
+	// Let guests redeem signed invite links for tokens when an invite secret is configured
+	if inviteSecretEnv != "" {
+		var inviteStore invite_service.InviteStore
+		if inviteStoreFileEnv != "" {
+			fileInviteStore, err := invite_service.NewFileInviteStore(inviteStoreFileEnv)
+			if err != nil {
+				return nil, fmt.Errorf("FATAL ERROR: Unable to load INVITE_STORE_FILE: %v", err)
+			}
+			inviteStore = fileInviteStore
+		}
+		inviteService, err := invite_service.NewInviteService(inviteSecretEnv, inviteStore, tokenService)
+		if err != nil {
+			return nil, fmt.Errorf("FATAL ERROR: Invalid INVITE_SECRET: %v", err)
+		}
+		inviteService.SetTenantRegistry(tenantRegistry)
+		inviteService.SetUIDDirectory(uidDirectory)
+		inviteService.RegisterRoutes(router)
+	}
 
 	if baseURLExists && baseURLEnv != "" {
 		// Check for Basic Auth settings if baseURL is provided
@@ -462,6 +904,9 @@ func setupRouter() (*gin.Engine, error) {
 		}
 		// get basicAuth key
 		basicAuthKey := getBasicAuth(customerIDEnv, customerSecretEnv)
+		// Shared client for all requests to the Agora API, with pooled connections, retries and failover to the backup domains in order
+		agoraDomains := append([]string{baseURLEnv}, parseList(failoverBaseURLsEnv)...)
+		agoraClient := agora_client.NewClient(basicAuthKey, agora_client.WithDomains(agoraDomains...))
 
 		if cloudRecordingURLExists || realTimeTranscriptionURLExists {
 			if !vendorExists || !regionExists || !bucketExists || !accessKeyExists || !secretKeyExists {
@@ -485,18 +930,39 @@ func setupRouter() (*gin.Engine, error) {
 				AccessKey: storageAccessKeyEnv,
 				SecretKey: storageSecretKeyEnv,
 			}
+			// Storage fields clients are allowed to override, e.g. "bucket,fileNamePrefix,extensionParams"
+			allowedStorageOverrides := parseList(storageOverrideAllowListEnv)
 
 			if cloudRecordingURLExists {
+				// Keep recording sessions in a file when configured, otherwise in memory
+				var sessionStore cloud_recording_service.SessionStore
+				if recordingSessionStoreFileExists && recordingSessionStoreFileEnv != "" {
+					fileSessionStore, err := cloud_recording_service.NewFileSessionStore(recordingSessionStoreFileEnv)
+					if err != nil {
+						return nil, fmt.Errorf("FATAL ERROR: Unable to load RECORDING_SESSION_STORE_FILE: %v", err)
+					}
+					sessionStore = fileSessionStore
+				}
 				// Init Cloud Recording Service
 				cloudRecordingUrl := baseURLEnv + strings.Replace(cloudRecordingURLEnv, "{appId}", appIDEnv, 1) // replace the place-holder value with appID from Env
-				cloudRecordingService := cloud_recording_service.NewCloudRecordingService(appIDEnv, cloudRecordingUrl, basicAuthKey, tokenService, storageConfig)
+				cloudRecordingService := cloud_recording_service.NewCloudRecordingService(appIDEnv, cloudRecordingUrl, agoraClient, tokenService, storageConfig, allowedStorageOverrides, sessionStore)
+				cloudRecordingService.SetUIDDirectory(uidDirectory)
 				cloudRecordingService.RegisterRoutes(router)
+				// Drop the sessions of recordings that exit on their own, e.g. after maxIdleTime
+				if webhookService != nil {
+					webhookService.OnCloudRecording(func(notification webhook_service.Notification, event webhook_service.CloudRecordingEvent) {
+						if notification.EventType == webhook_service.CloudRecordingEventSessionExit {
+							cloudRecordingService.EndSession(event.Cname, event.Sid)
+						}
+					})
+				}
 			}
 
 			if realTimeTranscriptionURLExists {
 				// Init Real Time Transcription Service
 				realTimeTranscriptionUrl := baseURLEnv + strings.Replace(realTimeTranscriptionURLEnv, "{appId}", appIDEnv, 1) //replace the place-holder value with appID
-				realTimeTranscriptionService := real_time_transcription_service.NewRTTService(appIDEnv, realTimeTranscriptionUrl, basicAuthKey, tokenService, storageConfig)
+				realTimeTranscriptionService := real_time_transcription_service.NewRTTService(appIDEnv, realTimeTranscriptionUrl, agoraClient, tokenService, storageConfig, allowedStorageOverrides)
+				realTimeTranscriptionService.SetUIDDirectory(uidDirectory)
 				realTimeTranscriptionService.RegisterRoutes(router)
 			}
 		}
@@ -511,13 +977,17 @@ func setupRouter() (*gin.Engine, error) {
 			if cloudPlayerURLExists {
 				cloudPlayerURL = strings.Replace(cloudPlayerURLEnv, "{appId}", appIDEnv, 1)
 			}
-			rtmpService := rtmp_service.NewRtmpService(appIDEnv, baseURLEnv, rtmpURL, cloudPlayerURL, basicAuthKey, tokenService)
+			rtmpService := rtmp_service.NewRtmpService(appIDEnv, baseURLEnv, rtmpURL, cloudPlayerURL, agoraClient, tokenService)
+			rtmpService.SetUIDDirectory(uidDirectory)
 			rtmpService.RegisterRoutes(router)
 		}
 	} else {
 		log.Println("WARNING: baseURLEnv Not Found - SKIPPING Cloud Recording, RTT and RTMP services ")
 	}
 
+	// Register the OpenAPI document and docs UI routes last, the document describes the routes registered before
+	openAPIService.RegisterRoutes(router)
+
 	return router, nil
 }
 
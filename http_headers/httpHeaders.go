@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
 	"github.com/gin-gonic/gin"
 )
 
@@ -36,17 +37,13 @@ func (m *HttpHeaders) CORShttpHeaders() gin.HandlerFunc {
 		// Check if the origin of the request is allowed to access the resource.
 		if !m.isOriginAllowed(origin) {
 			// If not allowed, return a JSON error and abort the request.
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Origin not allowed",
-			})
-			c.Abort()
+			api_errors.AbortMessage(c, http.StatusForbidden, "Origin not allowed")
 			return
 		}
 		// Set CORS headers to allow requests from the specified origin.
 		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, PATCH, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-API-Key, X-Auth-Key-Id, X-Auth-Timestamp, X-Auth-Signature, X-Tenant-ID")
 		// Handle pre-flight OPTIONS requests.
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
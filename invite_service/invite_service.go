@@ -0,0 +1,408 @@
+package invite_service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults and limits of new invites.
+const (
+	DefaultInviteExpire = 86400       // Seconds until an invite expires, unless set in the request (1 day)
+	MaxInviteExpire     = 30 * 86400  // The longest an invite can be valid in seconds (30 days)
+	DefaultTokenExpire  = 3600        // The longest token expiration of an invite, unless set in the request (1 hour)
+	MaxTokenExpire      = 24 * 3600   // The longest token expiration an invite can allow in seconds (1 day)
+	MinSecretLength     = 16          // The minimum length of the signing secret in bytes
+	signatureLength     = sha256.Size // Length of the HMAC in an invite code
+)
+
+// InviteService creates and redeems signed invite links, which let guests join a channel without access to the token routes.
+type InviteService struct {
+	secret         []byte                      // Secret that signs the invite codes
+	store          InviteStore                 // Store of the invites and their usage counters
+	tokenService   *token_service.TokenService // Token service that generates the tokens and authenticates the callers that manage invites
+	tenantRegistry *tenant_registry.Registry   // (Optional) registry of the tenants, tokens are signed with the credentials of the invite's tenant
+	uidDirectory   *uid_directory.Directory    // (Optional) directory that assigns the UID of guests that redeem with an account
+}
+
+// NewInviteService initializes a new instance of InviteService with the provided configurations.
+//
+// Parameters:
+//   - secret: string - Secret that signs the invite codes, at least MinSecretLength bytes.
+//   - store: InviteStore - Store of the invites, nil keeps them in memory.
+//   - tokenService: *token_service.TokenService - Token service that generates the tokens.
+//
+// Returns:
+//   - *InviteService: The initialized InviteService.
+//   - error: An error if the secret is too short.
+//
+// Notes:
+//   - Changing the secret invalidates the codes of all existing invites.
+func NewInviteService(secret string, store InviteStore, tokenService *token_service.TokenService) (*InviteService, error) {
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("invite secret must be at least %d bytes", MinSecretLength)
+	}
+	if store == nil {
+		store = NewMemoryInviteStore()
+	}
+	return &InviteService{
+		secret:       []byte(secret),
+		store:        store,
+		tokenService: tokenService,
+	}, nil
+}
+
+// SetTenantRegistry sets the registry used to sign the tokens of an invite with the credentials of the tenant that created it,
+// so guests don't need to identify the tenant when they redeem the invite.
+func (s *InviteService) SetTenantRegistry(registry *tenant_registry.Registry) {
+	s.tenantRegistry = registry
+}
+
+// SetUIDDirectory sets the directory that assigns the UID of guests that redeem an invite with an "account".
+// Without a directory guests always get a random UID.
+func (s *InviteService) SetUIDDirectory(directory *uid_directory.Directory) {
+	s.uidDirectory = directory
+}
+
+// RegisterRoutes registers the routes for the InviteService.
+//
+// Parameters:
+//   - r: *gin.Engine - The Gin engine instance to register the routes with.
+//
+// Behavior:
+//   - Creates an API group for the invite routes.
+//   - Registers the routes to create, list and revoke invites, with the same authentication as the token routes.
+//   - Registers the route to redeem an invite, which is only protected by the signed invite code.
+func (s *InviteService) RegisterRoutes(r *gin.Engine) {
+	api := r.Group("/invites")
+	api.GET("/:code/redeem", s.RedeemInvite)
+
+	manage := api.Group("")
+	manage.Use(s.tokenService.Authenticate())
+	manage.POST("", s.CreateInvite)
+	manage.GET("", s.ListInvites)
+	manage.DELETE("/:code", s.RevokeInvite)
+}
+
+// CreateInvite handles the HTTP request to create an invite to a channel.
+// Returns an HTTP 400 error if the request is invalid, and an HTTP 403 error if the token policy doesn't allow the caller
+// to request the tokens of the invite.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Behavior:
+//   - Defaults the role to "subscriber", the invite expiration to DefaultInviteExpire and the token expiration to DefaultTokenExpire.
+//   - Checks the invite against the token policy as an "rtc" (or "rtc+rtm") request for the channel, role and token expiration.
+//   - Saves the invite for the request's tenant and responds with its signed code.
+//
+// Notes:
+//   - Policy rules that limit the UIDs of a caller don't allow invites, the UID is only assigned when the invite is redeemed.
+//
+// Example usage:
+//
+//	router.POST("/invites", InviteService.CreateInvite)
+func (s *InviteService) CreateInvite(c *gin.Context) {
+	var createReq CreateInviteRequest
+	if !request_validation.BindJSON(c, &createReq) {
+		return
+	}
+	createReq.setDefaults()
+	if len(createReq.Accounts) > 0 && s.uidDirectory == nil {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "accounts require the UID directory")
+		return
+	}
+
+	tokenType := "rtc"
+	if createReq.Rtm {
+		tokenType = "rtc+rtm"
+	}
+	policyReq := token_service.TokenRequest{TokenType: tokenType, Channel: createReq.Channel, RtcRole: createReq.Role, ExpirationSeconds: createReq.MaxTokenExpire}
+	if err := s.tokenService.Authorize(c, policyReq); err != nil {
+		api_errors.Abort(c, http.StatusForbidden, err)
+		return
+	}
+
+	id, err := newInviteID()
+	if err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+	now := time.Now().UTC()
+	invite := Invite{
+		ID:             id,
+		Channel:        createReq.Channel,
+		Role:           createReq.Role,
+		MaxTokenExpire: createReq.MaxTokenExpire,
+		Rtm:            createReq.Rtm,
+		MaxUses:        createReq.MaxUses,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(time.Duration(createReq.ExpiresIn) * time.Second),
+		TenantID:       tenant_registry.IDFromContext(c.Request.Context()),
+		Accounts:       createReq.Accounts,
+	}
+	if caller, ok := token_service.CallerFromContext(c); ok {
+		invite.CreatedBy = caller.Subject
+	}
+	if err := s.store.Save(invite); err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	code := s.inviteCode(invite.ID)
+	c.JSON(http.StatusOK, CreateInviteResponse{Invite: invite, Code: code, RedeemPath: "/invites/" + code + "/redeem"})
+}
+
+// ListInvites handles the HTTP request to list the invites of the request's tenant, with their usage counters.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.GET("/invites", InviteService.ListInvites)
+func (s *InviteService) ListInvites(c *gin.Context) {
+	invites, err := s.store.List()
+	if err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+	tenantID := tenant_registry.IDFromContext(c.Request.Context())
+	tenantInvites := []Invite{}
+	for _, invite := range invites {
+		if invite.TenantID == tenantID {
+			tenantInvites = append(tenantInvites, invite)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"invites": tenantInvites})
+}
+
+// RevokeInvite handles the HTTP request to revoke an invite, so it can no longer be redeemed.
+// The path takes either the invite's code or its ID.
+// Returns an HTTP 404 error if the invite doesn't exist or belongs to another tenant.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Notes:
+//   - Tokens that were already issued for the invite stay valid until they expire.
+//
+// Example usage:
+//
+//	router.DELETE("/invites/:code", InviteService.RevokeInvite)
+func (s *InviteService) RevokeInvite(c *gin.Context) {
+	id := c.Param("code")
+	if inviteID, ok := s.parseInviteCode(id); ok {
+		id = inviteID
+	}
+	invite, err := s.store.Get(id)
+	if err != nil || invite.TenantID != tenant_registry.IDFromContext(c.Request.Context()) {
+		api_errors.Abort(c, http.StatusNotFound, ErrInviteNotFound)
+		return
+	}
+	invite, err = s.store.Revoke(id, time.Now().UTC())
+	if err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, invite)
+}
+
+// RedeemInvite handles the HTTP request to redeem an invite code for the tokens of the invite.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Behavior:
+//  1. Verifies the signature of the code and loads the invite, HTTP 404 if either fails.
+//  2. Assigns the guest's UID: the UID of the "account" query parameter when a UID directory is set, otherwise a random UID.
+//  3. Generates the RTC token (and RTM token) with the credentials of the invite's tenant,
+//     for the "expire" query parameter in seconds, up to and defaulting to the invite's maximum.
+//  4. Counts the use, HTTP 410 if the invite has expired, was revoked or has no uses left.
+//  5. Records the redemption in the token service's audit log when an audit sink is set, with "invite:<id>" as the caller.
+//
+// Example usage:
+//
+//	router.GET("/invites/:code/redeem", InviteService.RedeemInvite)
+func (s *InviteService) RedeemInvite(c *gin.Context) {
+	id, ok := s.parseInviteCode(c.Param("code"))
+	if !ok {
+		api_errors.Abort(c, http.StatusNotFound, ErrInviteNotFound)
+		return
+	}
+	invite, err := s.store.Get(id)
+	if err != nil {
+		api_errors.Abort(c, http.StatusNotFound, ErrInviteNotFound)
+		return
+	}
+	if err := checkRedeemable(invite, time.Now()); err != nil {
+		api_errors.Abort(c, http.StatusGone, err)
+		return
+	}
+
+	expire := invite.MaxTokenExpire
+	if expireParam := c.Query("expire"); expireParam != "" {
+		expire, err = strconv.Atoi(expireParam)
+		if err != nil || expire < 1 || expire > invite.MaxTokenExpire {
+			api_errors.AbortMessage(c, http.StatusBadRequest, fmt.Sprintf("expire must be between 1 and %d seconds", invite.MaxTokenExpire))
+			return
+		}
+	}
+
+	tenantID, tokenService, err := s.inviteTokenService(c, invite)
+	if err != nil {
+		api_errors.Abort(c, http.StatusNotFound, ErrInviteNotFound)
+		return
+	}
+	// Guests only get the UID of an account the invite was created for, so they can't take the UID of another user
+	if account := c.Query("account"); account != "" && !allowsAccount(invite, account) {
+		api_errors.AbortMessage(c, http.StatusForbidden, "account is not allowed by the invite")
+		return
+	}
+	uid, err := s.assignUid(tenantID, invite.Channel, c.Query("account"))
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+
+	response := RedeemInviteResponse{Channel: invite.Channel, Uid: uid, Role: invite.Role}
+	response.RtcToken, err = tokenService.GenRtcToken(token_service.TokenRequest{TokenType: "rtc", Channel: invite.Channel, RtcRole: invite.Role, Uid: uid, ExpirationSeconds: expire})
+	if err == nil && invite.Rtm {
+		response.RtmToken, err = tokenService.GenRtmToken(token_service.TokenRequest{TokenType: "rtm", Uid: uid, ExpirationSeconds: expire})
+	}
+	auditReq := token_service.TokenRequest{TokenType: "rtc", Channel: invite.Channel, RtcRole: invite.Role, Uid: uid, Account: c.Query("account"), ExpirationSeconds: expire}
+	if invite.Rtm {
+		auditReq.TokenType = "rtc+rtm"
+	}
+	if err != nil {
+		s.recordAudit(c, invite, auditReq, 0, err)
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Count the use last, so the check and the counter are updated together and failed redemptions aren't counted
+	if _, err := s.store.Use(invite.ID, time.Now()); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInviteExpired) || errors.Is(err, ErrInviteRevoked) || errors.Is(err, ErrInviteUsedUp) {
+			status = http.StatusGone
+		}
+		api_errors.Abort(c, status, err)
+		return
+	}
+	if inspection, err := tokenService.ParseToken(response.RtcToken); err == nil {
+		response.ExpiresAt = inspection.ExpiresAt
+	}
+	s.recordAudit(c, invite, auditReq, response.ExpiresAt, nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// recordAudit records a redemption in the token service's audit log, with the invite as the caller.
+func (s *InviteService) recordAudit(c *gin.Context, invite Invite, tokenReq token_service.TokenRequest, expiresAt int64, err error) {
+	event := token_service.NewAuditEvent("invite", tokenReq, expiresAt, err)
+	event.Caller = "invite:" + invite.ID
+	event.TenantID = invite.TenantID
+	s.tokenService.RecordAudit(c, event)
+}
+
+// inviteTokenService returns the tenant of the invite and the token service that signs its tokens.
+// Invites without a tenant use the server's credentials. The tenant is looked up in the tenant registry when set,
+// otherwise the request must resolve to the invite's tenant.
+func (s *InviteService) inviteTokenService(c *gin.Context, invite Invite) (string, *token_service.TokenService, error) {
+	if invite.TenantID == "" {
+		return "", s.tokenService, nil
+	}
+	ctx := c.Request.Context()
+	if s.tenantRegistry != nil {
+		tenant, ok := s.tenantRegistry.Get(invite.TenantID)
+		if !ok {
+			return "", nil, ErrInviteNotFound
+		}
+		ctx = tenant_registry.NewContext(ctx, tenant)
+	}
+	if tenant_registry.IDFromContext(ctx) != invite.TenantID {
+		return "", nil, ErrInviteNotFound
+	}
+	return invite.TenantID, s.tokenService.ForContext(ctx), nil
+}
+
+// allowsAccount reports whether guests can redeem an invite with the user account.
+func allowsAccount(invite Invite, account string) bool {
+	for _, allowed := range invite.Accounts {
+		if allowed == account {
+			return true
+		}
+	}
+	return false
+}
+
+// assignUid returns the UID of a guest: the UID of the account in the UID directory, or a random UID without an account.
+func (s *InviteService) assignUid(tenantID string, channel string, account string) (string, error) {
+	if account != "" {
+		if s.uidDirectory == nil {
+			return "", errors.New("account requires the UID directory")
+		}
+		uids, err := s.uidDirectory.Resolve(tenantID, channel, []string{account})
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(uint64(uids[0]), 10), nil
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating UID: %v", err)
+	}
+	// Keep random UIDs below 2^31 and non-zero, some SDKs treat the UID as a signed integer
+	uid := binary.BigEndian.Uint32(b)&0x7fffffff | 1
+	return strconv.FormatUint(uint64(uid), 10), nil
+}
+
+// inviteCode returns the signed code of an invite: its ID and the HMAC of the ID.
+func (s *InviteService) inviteCode(id string) string {
+	return id + "." + base64.RawURLEncoding.EncodeToString(s.sign(id))
+}
+
+// parseInviteCode returns the invite ID of a code, and whether its signature is valid.
+func (s *InviteService) parseInviteCode(code string) (string, bool) {
+	id, signature, found := strings.Cut(code, ".")
+	if !found {
+		return "", false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || len(decoded) != signatureLength {
+		return "", false
+	}
+	return id, hmac.Equal(decoded, s.sign(id))
+}
+
+// sign returns the HMAC-SHA256 of an invite ID with the secret.
+func (s *InviteService) sign(id string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
+
+// newInviteID generates a random identifier for a new invite.
+func newInviteID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating invite ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
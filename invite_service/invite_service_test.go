@@ -0,0 +1,305 @@
+package invite_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test-invite-secret-0123456789"
+
+// newTestRouter returns a router with the invite routes, managed with the "host-key" API key.
+func newTestRouter(t *testing.T, store InviteStore) (*gin.Engine, *InviteService, *token_service.TokenService) {
+	gin.SetMode(gin.TestMode)
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	tokenService.SetAuthenticators(token_service.NewAPIKeyAuthenticator(map[string]string{"host-key": "host"}))
+	service, err := NewInviteService(testSecret, store, tokenService)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	router := gin.New()
+	service.RegisterRoutes(router)
+	return router, service, tokenService
+}
+
+// createInvite creates an invite through the API and returns the response.
+func createInvite(t *testing.T, router *gin.Engine, body string) (int, CreateInviteResponse) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/invites", bytes.NewBufferString(body))
+	req.Header.Set(token_service.APIKeyHeader, "host-key")
+	router.ServeHTTP(w, req)
+	var response CreateInviteResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+// redeem redeems an invite path and returns the response.
+func redeem(router *gin.Engine, path string) (int, RedeemInviteResponse) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+	var response RedeemInviteResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestNewInviteService(t *testing.T) {
+	_, err := NewInviteService("short", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestCreateInvite(t *testing.T) {
+	router, _, _ := newTestRouter(t, nil)
+
+	tests := []struct {
+		name           string
+		body           string
+		apiKey         string
+		wantStatusCode int
+	}{
+		{name: "Defaults", body: `{"channel": "room-1"}`, apiKey: "host-key", wantStatusCode: http.StatusOK},
+		{name: "Publisher with RTM", body: `{"channel": "room-1", "role": "publisher", "rtm": true, "maxUses": 1, "expiresIn": 600, "maxTokenExpire": 600}`, apiKey: "host-key", wantStatusCode: http.StatusOK},
+		{name: "Missing API key", body: `{"channel": "room-1"}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "Missing channel", body: `{}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Unknown role", body: `{"channel": "room-1", "role": "admin"}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Invite expiration too long", body: `{"channel": "room-1", "expiresIn": 2678400}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Token expiration too long", body: `{"channel": "room-1", "maxTokenExpire": 86401}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Negative uses", body: `{"channel": "room-1", "maxUses": -1}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Invalid channel name", body: `{"channel": "room/1"}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Unknown field", body: `{"channel": "room-1", "uses": 1}`, apiKey: "host-key", wantStatusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/invites", bytes.NewBufferString(tt.body))
+			if tt.apiKey != "" {
+				req.Header.Set(token_service.APIKeyHeader, tt.apiKey)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatusCode, w.Code, w.Body.String())
+		})
+	}
+
+	_, response := createInvite(t, router, `{"channel": "room-1"}`)
+	assert.Equal(t, "subscriber", response.Role)
+	assert.Equal(t, DefaultTokenExpire, response.MaxTokenExpire)
+	assert.Equal(t, "host", response.CreatedBy)
+	assert.WithinDuration(t, time.Now().Add(DefaultInviteExpire*time.Second), response.ExpiresAt, time.Minute)
+	assert.Equal(t, "/invites/"+response.Code+"/redeem", response.RedeemPath)
+}
+
+func TestCreateInvitePolicy(t *testing.T) {
+	router, _, tokenService := newTestRouter(t, nil)
+	tokenService.SetPolicy(&token_service.Policy{Rules: []token_service.PolicyRule{{Channels: []string{"lobby"}, Roles: []string{"subscriber"}, MaxExpire: 3600}}})
+
+	status, _ := createInvite(t, router, `{"channel": "lobby"}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = createInvite(t, router, `{"channel": "stage"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = createInvite(t, router, `{"channel": "lobby", "role": "publisher"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = createInvite(t, router, `{"channel": "lobby", "maxTokenExpire": 7200}`)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestRedeemInvite(t *testing.T) {
+	router, _, tokenService := newTestRouter(t, nil)
+	_, invite := createInvite(t, router, `{"channel": "room-1", "role": "publisher", "rtm": true, "maxTokenExpire": 600}`)
+
+	status, response := redeem(router, invite.RedeemPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "room-1", response.Channel)
+	assert.Equal(t, "publisher", response.Role)
+	assert.NotEmpty(t, response.Uid)
+	assert.NotEmpty(t, response.RtmToken)
+	assert.InDelta(t, time.Now().Unix()+600, response.ExpiresAt, 5)
+
+	inspection, err := tokenService.ParseToken(response.RtcToken)
+	if assert.NoError(t, err) {
+		assert.True(t, inspection.SignatureValid)
+		assert.Equal(t, "room-1", inspection.Services[0].Channel)
+		assert.Equal(t, uint32(600), inspection.Expire)
+	}
+
+	// Each guest gets their own UID
+	_, second := redeem(router, invite.RedeemPath)
+	assert.NotEqual(t, response.Uid, second.Uid)
+
+	// Shorter token expiration
+	status, response = redeem(router, invite.RedeemPath+"?expire=60")
+	assert.Equal(t, http.StatusOK, status)
+	assert.InDelta(t, time.Now().Unix()+60, response.ExpiresAt, 5)
+	status, _ = redeem(router, invite.RedeemPath+"?expire=601")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Tampered and unknown codes
+	status, _ = redeem(router, "/invites/"+invite.ID+".AAAA/redeem")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = redeem(router, "/invites/"+invite.ID+"/redeem")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestRedeemInviteLimits(t *testing.T) {
+	router, service, _ := newTestRouter(t, nil)
+
+	_, singleUse := createInvite(t, router, `{"channel": "room-1", "maxUses": 1}`)
+	status, _ := redeem(router, singleUse.RedeemPath)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = redeem(router, singleUse.RedeemPath)
+	assert.Equal(t, http.StatusGone, status)
+
+	_, revoked := createInvite(t, router, `{"channel": "room-1"}`)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/invites/"+revoked.ID, nil)
+	req.Header.Set(token_service.APIKeyHeader, "host-key")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	status, _ = redeem(router, revoked.RedeemPath)
+	assert.Equal(t, http.StatusGone, status)
+
+	_, expired := createInvite(t, router, `{"channel": "room-1", "expiresIn": 1}`)
+	invite, _ := service.store.Get(expired.ID)
+	invite.ExpiresAt = time.Now().Add(-time.Second)
+	service.store.Save(invite)
+	status, _ = redeem(router, expired.RedeemPath)
+	assert.Equal(t, http.StatusGone, status)
+
+	// The usage counters are listed with the invites
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/invites", nil)
+	req.Header.Set(token_service.APIKeyHeader, "host-key")
+	router.ServeHTTP(w, req)
+	var list struct {
+		Invites []Invite `json:"invites"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if assert.Len(t, list.Invites, 3) {
+		assert.Equal(t, 1, list.Invites[0].Uses)
+		assert.NotNil(t, list.Invites[1].RevokedAt)
+	}
+}
+
+func TestRedeemInviteAccount(t *testing.T) {
+	router, service, _ := newTestRouter(t, nil)
+
+	// Accounts require the UID directory
+	status, _ := createInvite(t, router, `{"channel": "room-1", "accounts": ["alice"]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	directory, _ := uid_directory.NewDirectory("", uid_directory.ScopeApp)
+	service.SetUIDDirectory(directory)
+	status, _ = createInvite(t, router, `{"channel": "room-1", "accounts": [""]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	_, invite := createInvite(t, router, `{"channel": "room-1", "accounts": ["alice"]}`)
+	assert.Equal(t, []string{"alice"}, invite.Accounts)
+
+	status, response := redeem(router, invite.RedeemPath+"?account=alice")
+	assert.Equal(t, http.StatusOK, status)
+	uids, _ := directory.Resolve("", "room-1", []string{"alice"})
+	assert.Equal(t, uids[0], parseUid(t, response.Uid))
+
+	// Guests can't take the UID of an account the invite wasn't created for
+	status, _ = redeem(router, invite.RedeemPath+"?account=bob")
+	assert.Equal(t, http.StatusForbidden, status)
+	_, open := createInvite(t, router, `{"channel": "room-1"}`)
+	status, _ = redeem(router, open.RedeemPath+"?account=alice")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Without an account the guest gets a random UID
+	status, response = redeem(router, open.RedeemPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, uids[0], parseUid(t, response.Uid))
+}
+
+func TestRedeemInviteAudit(t *testing.T) {
+	router, _, tokenService := newTestRouter(t, nil)
+	sink := token_service.NewMemoryAuditSink()
+	tokenService.SetAuditSink(sink)
+	_, created := createInvite(t, router, `{"channel":"lobby","rtm":true}`)
+
+	status, redeemed := redeem(router, created.RedeemPath)
+	assert.Equal(t, http.StatusOK, status)
+	events, _ := sink.Query(token_service.AuditFilter{})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "invite", events[0].Source)
+		assert.Equal(t, "invite:"+created.ID, events[0].Caller)
+		assert.Equal(t, "rtc+rtm", events[0].TokenType)
+		assert.Equal(t, redeemed.Uid, events[0].Uid)
+		assert.Equal(t, token_service.AuditOutcomeIssued, events[0].Outcome)
+	}
+}
+
+func TestRedeemInviteTenant(t *testing.T) {
+	router, service, tokenService := newTestRouter(t, nil)
+	registry, _ := tenant_registry.NewRegistry([]*tenant_registry.Tenant{{ID: "video", AppID: "0123456789abcdef0123456789abcdef", AppCertificate: "fedcba9876543210fedcba9876543210"}}, "")
+	service.SetTenantRegistry(registry)
+	// The host's API key is bound to the tenant, so its invites are for the tenant
+	authenticator := token_service.NewAPIKeyAuthenticator(map[string]string{"host-key": "host"})
+	authenticator.SetTenants(map[string]string{"host": "video"})
+	tokenService.SetAuthenticators(authenticator)
+	assert.NoError(t, tokenService.SetTenantRegistry(registry))
+	router = gin.New()
+	router.Use(registry.Middleware())
+	service.RegisterRoutes(router)
+
+	_, invite := createInvite(t, router, `{"channel": "room-1"}`)
+	assert.Equal(t, "video", invite.TenantID)
+
+	// Redeemed without identifying the tenant, the token is still signed for the tenant's app
+	status, response := redeem(router, invite.RedeemPath)
+	assert.Equal(t, http.StatusOK, status)
+	inspection, err := tokenService.ParseToken(response.RtcToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0123456789abcdef0123456789abcdef", inspection.AppID)
+	}
+}
+
+func TestFileInviteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invites.json")
+	store, err := NewFileInviteStore(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	now := time.Now()
+	assert.NoError(t, store.Save(Invite{ID: "invite-1", Channel: "room-1", MaxUses: 2, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	_, err = store.Use("invite-1", now)
+	assert.NoError(t, err)
+
+	reloaded, err := NewFileInviteStore(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	invite, err := reloaded.Use("invite-1", now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, invite.Uses)
+	_, err = reloaded.Use("invite-1", now)
+	assert.ErrorIs(t, err, ErrInviteUsedUp)
+
+	_, err = reloaded.Revoke("invite-1", now)
+	assert.NoError(t, err)
+	reloaded, _ = NewFileInviteStore(path)
+	invite, _ = reloaded.Get("invite-1")
+	assert.NotNil(t, invite.RevokedAt)
+
+	_, err = reloaded.Use("missing", now)
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+}
+
+// parseUid parses a UID of a redeem response.
+func parseUid(t *testing.T, uid string) uint32 {
+	var value uint32
+	if err := json.Unmarshal([]byte(uid), &value); err != nil {
+		t.Fatalf("invalid uid %q: %v", uid, err)
+	}
+	return value
+}
@@ -0,0 +1,257 @@
+package invite_service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/atomic_file"
+)
+
+// Errors returned when an invite can't be redeemed.
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteExpired  = errors.New("invite has expired")
+	ErrInviteRevoked  = errors.New("invite has been revoked")
+	ErrInviteUsedUp   = errors.New("invite has no uses left")
+)
+
+// InviteStore is the interface for storing invites and their usage counters.
+// Implementations must be safe for concurrent use.
+type InviteStore interface {
+	// Save adds or replaces an invite.
+	Save(invite Invite) error
+	// Get returns the invite with the given ID, or ErrInviteNotFound.
+	Get(id string) (Invite, error)
+	// List returns all invites, ordered by creation time.
+	List() ([]Invite, error)
+	// Use checks that the invite can be redeemed at the given time and counts the use, as one atomic step.
+	Use(id string, now time.Time) (Invite, error)
+	// Revoke marks the invite as revoked at the given time, revoking a revoked invite keeps its first revocation time.
+	Revoke(id string, now time.Time) (Invite, error)
+}
+
+// checkRedeemable returns the reason the invite can't be redeemed at the given time, or nil.
+func checkRedeemable(invite Invite, now time.Time) error {
+	switch {
+	case invite.RevokedAt != nil:
+		return ErrInviteRevoked
+	case !now.Before(invite.ExpiresAt):
+		return ErrInviteExpired
+	case invite.MaxUses > 0 && invite.Uses >= invite.MaxUses:
+		return ErrInviteUsedUp
+	}
+	return nil
+}
+
+// useInvite counts a use of the invite if it can be redeemed.
+func useInvite(invite *Invite, now time.Time) error {
+	if err := checkRedeemable(*invite, now); err != nil {
+		return err
+	}
+	invite.Uses++
+	return nil
+}
+
+// revokeInvite sets the revocation time of the invite unless it is already revoked.
+func revokeInvite(invite *Invite, now time.Time) error {
+	if invite.RevokedAt == nil {
+		revokedAt := now
+		invite.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+// MemoryInviteStore keeps invites in memory. Invites and their usage counters are lost when the server restarts.
+type MemoryInviteStore struct {
+	mu      sync.Mutex
+	invites map[string]Invite
+}
+
+// NewMemoryInviteStore returns an empty in-memory invite store.
+func NewMemoryInviteStore() *MemoryInviteStore {
+	return &MemoryInviteStore{invites: make(map[string]Invite)}
+}
+
+// Save adds or replaces an invite.
+func (m *MemoryInviteStore) Save(invite Invite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invites[invite.ID] = invite
+	return nil
+}
+
+// Get returns the invite with the given ID.
+func (m *MemoryInviteStore) Get(id string) (Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invite, ok := m.invites[id]
+	if !ok {
+		return Invite{}, ErrInviteNotFound
+	}
+	return invite, nil
+}
+
+// List returns all invites, ordered by creation time.
+func (m *MemoryInviteStore) List() ([]Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedInvites(m.invites), nil
+}
+
+// Use checks that the invite can be redeemed and counts the use.
+func (m *MemoryInviteStore) Use(id string, now time.Time) (Invite, error) {
+	return m.update(id, func(invite *Invite) error { return useInvite(invite, now) })
+}
+
+// Revoke marks the invite as revoked.
+func (m *MemoryInviteStore) Revoke(id string, now time.Time) (Invite, error) {
+	return m.update(id, func(invite *Invite) error { return revokeInvite(invite, now) })
+}
+
+// update applies a change to the invite with the given ID, the invite is unchanged when the change returns an error.
+func (m *MemoryInviteStore) update(id string, change func(*Invite) error) (Invite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	invite, ok := m.invites[id]
+	if !ok {
+		return Invite{}, ErrInviteNotFound
+	}
+	if err := change(&invite); err != nil {
+		return Invite{}, err
+	}
+	m.invites[id] = invite
+	return invite, nil
+}
+
+// FileInviteStore keeps invites in memory and persists them to a JSON file on every change,
+// so usage counters and revocations survive a server restart.
+type FileInviteStore struct {
+	mu      sync.Mutex
+	path    string
+	invites map[string]Invite
+}
+
+// NewFileInviteStore returns an invite store backed by the JSON file at path.
+// Existing invites are loaded from the file, a missing file is treated as an empty store.
+func NewFileInviteStore(path string) (*FileInviteStore, error) {
+	store := &FileInviteStore{path: path, invites: make(map[string]Invite)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("error reading invite store file: %v", err)
+	}
+	if len(data) == 0 {
+		return store, nil
+	}
+
+	var invites []Invite
+	if err := json.Unmarshal(data, &invites); err != nil {
+		return nil, fmt.Errorf("error parsing invite store file: %v", err)
+	}
+	for _, invite := range invites {
+		store.invites[invite.ID] = invite
+	}
+	return store, nil
+}
+
+// Save adds or replaces an invite and persists the store.
+func (f *FileInviteStore) Save(invite Invite) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, existed := f.invites[invite.ID]
+	f.invites[invite.ID] = invite
+	if err := f.persist(); err != nil {
+		// Keep memory consistent with the file
+		if existed {
+			f.invites[invite.ID] = previous
+		} else {
+			delete(f.invites, invite.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns the invite with the given ID.
+func (f *FileInviteStore) Get(id string) (Invite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	invite, ok := f.invites[id]
+	if !ok {
+		return Invite{}, ErrInviteNotFound
+	}
+	return invite, nil
+}
+
+// List returns all invites, ordered by creation time.
+func (f *FileInviteStore) List() ([]Invite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedInvites(f.invites), nil
+}
+
+// Use checks that the invite can be redeemed, counts the use and persists the store.
+func (f *FileInviteStore) Use(id string, now time.Time) (Invite, error) {
+	return f.update(id, func(invite *Invite) error { return useInvite(invite, now) })
+}
+
+// Revoke marks the invite as revoked and persists the store.
+func (f *FileInviteStore) Revoke(id string, now time.Time) (Invite, error) {
+	return f.update(id, func(invite *Invite) error { return revokeInvite(invite, now) })
+}
+
+// update applies a change to the invite with the given ID and persists the store,
+// the invite is unchanged when the change returns an error or the store can't be persisted.
+func (f *FileInviteStore) update(id string, change func(*Invite) error) (Invite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, ok := f.invites[id]
+	if !ok {
+		return Invite{}, ErrInviteNotFound
+	}
+	invite := previous
+	if err := change(&invite); err != nil {
+		return Invite{}, err
+	}
+	f.invites[id] = invite
+	if err := f.persist(); err != nil {
+		f.invites[id] = previous
+		return Invite{}, err
+	}
+	return invite, nil
+}
+
+// persist writes all invites to the store file, see atomic_file.WriteFile. Must be called with f.mu held.
+func (f *FileInviteStore) persist() error {
+	data, err := json.MarshalIndent(sortedInvites(f.invites), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding invite store: %v", err)
+	}
+	if err := atomic_file.WriteFile(f.path, data); err != nil {
+		return fmt.Errorf("error writing invite store file: %v", err)
+	}
+	return nil
+}
+
+// sortedInvites returns the invites in the map ordered by creation time, then ID.
+func sortedInvites(invites map[string]Invite) []Invite {
+	list := make([]Invite, 0, len(invites))
+	for _, invite := range invites {
+		list = append(list, invite)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
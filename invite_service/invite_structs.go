@@ -0,0 +1,49 @@
+package invite_service
+
+import "time"
+
+// Invite is a link that lets a guest join a channel without access to the token routes.
+// Redeeming it returns an RTC token, and optionally an RTM token, for a newly assigned UID.
+type Invite struct {
+	ID             string     `json:"id"`                  // Identifier of the invite, part of its code
+	Channel        string     `json:"channel"`             // The channel the tokens are for
+	Role           string     `json:"role"`                // The RTC role of the tokens: "publisher" or "subscriber"
+	MaxTokenExpire int        `json:"maxTokenExpire"`      // The longest token expiration in seconds a redemption can request
+	Rtm            bool       `json:"rtm,omitempty"`       // Whether redemptions also get an RTM token
+	MaxUses        int        `json:"maxUses,omitempty"`   // The number of times the invite can be redeemed, 0 for no limit
+	Uses           int        `json:"uses"`                // The number of times the invite was redeemed
+	CreatedAt      time.Time  `json:"createdAt"`           // The time the invite was created
+	ExpiresAt      time.Time  `json:"expiresAt"`           // The time after which the invite can't be redeemed
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"` // The time the invite was revoked, if it was
+	CreatedBy      string     `json:"createdBy,omitempty"` // (Optional) the authenticated caller that created the invite
+	TenantID       string     `json:"tenantId,omitempty"`  // (Optional) the tenant whose credentials sign the tokens
+	Accounts       []string   `json:"accounts,omitempty"`  // (Optional) the user accounts guests can redeem the invite with, see CreateInviteRequest
+}
+
+// CreateInviteRequest is the JSON payload of the create endpoint.
+type CreateInviteRequest struct {
+	Channel        string   `json:"channel"`                  // The channel the tokens are for
+	Role           string   `json:"role,omitempty"`           // (Optional) the RTC role: "publisher" or "subscriber", defaults to "subscriber"
+	ExpiresIn      int      `json:"expiresIn,omitempty"`      // (Optional) seconds until the invite expires, defaults to DefaultInviteExpire
+	MaxUses        int      `json:"maxUses,omitempty"`        // (Optional) the number of times the invite can be redeemed, 0 for no limit
+	MaxTokenExpire int      `json:"maxTokenExpire,omitempty"` // (Optional) the longest token expiration in seconds, defaults to DefaultTokenExpire
+	Rtm            bool     `json:"rtm,omitempty"`            // (Optional) also return an RTM token for the same UID
+	Accounts       []string `json:"accounts,omitempty"`       // (Optional) the user accounts guests can redeem the invite with, to get the account's UID. Requires the UID directory
+}
+
+// CreateInviteResponse is the response of the create endpoint, with the code to share with the guest.
+type CreateInviteResponse struct {
+	Invite
+	Code       string `json:"code"`       // The signed code of the invite
+	RedeemPath string `json:"redeemPath"` // The path that redeems the invite, relative to the server
+}
+
+// RedeemInviteResponse is the response of the redeem endpoint.
+type RedeemInviteResponse struct {
+	Channel   string `json:"channel"`            // The channel the tokens are for
+	Uid       string `json:"uid"`                // The UID assigned to the guest, the tokens are for this UID
+	Role      string `json:"role"`               // The RTC role of the token
+	RtcToken  string `json:"rtcToken"`           // The RTC token
+	RtmToken  string `json:"rtmToken,omitempty"` // The RTM token, if the invite includes RTM
+	ExpiresAt int64  `json:"expiresAt"`          // Unix timestamp (s) when the tokens expire
+}
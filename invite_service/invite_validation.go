@@ -0,0 +1,38 @@
+package invite_service
+
+import (
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+)
+
+// Validate checks the channel, role, expirations, uses and accounts of a create request.
+// Optional fields that are not set are allowed, their defaults are applied by setDefaults.
+func (r *CreateInviteRequest) Validate(errs *request_validation.Errors) {
+	errs.ChannelName("channel", r.Channel)
+	if r.Role != "" {
+		errs.OneOf("role", r.Role, "publisher", "subscriber")
+	}
+	if r.ExpiresIn != 0 {
+		errs.Range("expiresIn", &r.ExpiresIn, 1, MaxInviteExpire)
+	}
+	if r.MaxUses < 0 {
+		errs.Add("maxUses", "must not be negative")
+	}
+	if r.MaxTokenExpire != 0 {
+		errs.Range("maxTokenExpire", &r.MaxTokenExpire, 1, MaxTokenExpire)
+	}
+	uid_directory.ValidateAccounts(errs, "accounts", r.Accounts)
+}
+
+// setDefaults applies the defaults of the optional fields of a valid create request.
+func (r *CreateInviteRequest) setDefaults() {
+	if r.Role == "" {
+		r.Role = "subscriber"
+	}
+	if r.ExpiresIn == 0 {
+		r.ExpiresIn = DefaultInviteExpire
+	}
+	if r.MaxTokenExpire == 0 {
+		r.MaxTokenExpire = DefaultTokenExpire
+	}
+}
@@ -0,0 +1,219 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version of the generated documents.
+const Version = "3.0.3"
+
+// SwaggerUIVersion is the exact version of swagger-ui-dist the docs UI loads from unpkg.com when no local assets are set, see SetDocsAssets.
+const SwaggerUIVersion = "5.17.14"
+
+// docsAssets are the Swagger UI files loaded by the docs UI.
+var docsAssets = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+// docsPageTemplate is the docs UI, it loads Swagger UI from AssetsURL and renders /openapi.json.
+//
+//go:embed openapi_docs.html
+var docsPageTemplate string
+
+var docsPage = template.Must(template.New("docs").Parse(docsPageTemplate))
+
+// Service serves the OpenAPI document of the server at /openapi.json and the docs UI at /docs.
+// The document is generated from the Go types of the request and response bodies, see Routes.
+type Service struct {
+	info         Info                  // Title and version of the API
+	routes       []Route               // The routes that can be documented
+	document     *Document             // The document, generated when the routes are registered
+	documentJSON []byte                // The encoded document
+	operations   map[string]*Operation // The documented operations, keyed by method and gin path, e.g. "GET /rtt/status/:taskId"
+	docsAssets   string                // (Optional) the directory of the Swagger UI files served for the docs UI
+}
+
+// NewService returns a Service that documents the registered routes of Routes.
+//
+// Parameters:
+//   - title: string - The title of the API.
+//   - version: string - The version of the API.
+//
+// Returns:
+//   - *Service: The initialized Service.
+func NewService(title string, version string) *Service {
+	return &Service{
+		info:       Info{Title: title, Version: version},
+		routes:     Routes,
+		operations: make(map[string]*Operation),
+	}
+}
+
+// SetDocsAssets serves the Swagger UI files of the docs UI from a directory, instead of loading them from unpkg.com.
+// The directory must have the swagger-ui.css and swagger-ui-bundle.js files of swagger-ui-dist, e.g. its dist folder.
+// Returns an error if one of the files is missing.
+func (s *Service) SetDocsAssets(dir string) error {
+	for _, name := range docsAssets {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("missing Swagger UI file: %w", err)
+		}
+	}
+	s.docsAssets = dir
+	return nil
+}
+
+// RegisterRoutes registers the routes of the document and the docs UI, then generates the document.
+//
+// Parameters:
+//   - r: *gin.Engine - The Gin engine instance to register the routes with.
+//
+// Behavior:
+//   - Registers GET /openapi.json for the document and GET /docs for the docs UI.
+//   - Registers GET /docs/assets/ for the Swagger UI files when local assets are set, see SetDocsAssets.
+//   - Generates the document from the routes registered on r, so it must be called after the other services register their routes.
+//
+// Notes:
+//   - Registered routes that are not in Routes are logged and documented without request or response bodies.
+func (s *Service) RegisterRoutes(r *gin.Engine) {
+	r.GET("/openapi.json", s.GetDocument)
+	r.GET("/docs", s.GetDocs)
+	if s.docsAssets != "" {
+		for _, name := range docsAssets {
+			path := filepath.Join(s.docsAssets, name)
+			r.GET("/docs/assets/"+name, func(c *gin.Context) { c.File(path) })
+		}
+	}
+
+	registered := r.Routes()
+	s.document = NewDocument(s.info, s.routes, registered)
+	for _, route := range registered {
+		s.operations[route.Method+" "+route.Path] = s.document.Paths[openAPIPath(route.Path)][strings.ToLower(route.Method)]
+	}
+	documentJSON, err := json.MarshalIndent(s.document, "", "  ")
+	if err != nil {
+		log.Printf("WARNING: Unable to encode the OpenAPI document: %v", err)
+		return
+	}
+	s.documentJSON = documentJSON
+}
+
+// Document returns the generated document, or nil before RegisterRoutes is called.
+func (s *Service) Document() *Document {
+	return s.document
+}
+
+// GetDocument handles the HTTP request for the OpenAPI document.
+func (s *Service) GetDocument(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", s.documentJSON)
+}
+
+// GetDocs handles the HTTP request for the docs UI.
+// The page loads the pinned Swagger UI version from unpkg.com, or the local files when they are set, see SetDocsAssets.
+func (s *Service) GetDocs(c *gin.Context) {
+	assetsURL := "https://unpkg.com/swagger-ui-dist@" + SwaggerUIVersion
+	if s.docsAssets != "" {
+		assetsURL = "docs/assets"
+	}
+	var page bytes.Buffer
+	if err := docsPage.Execute(&page, struct{ AssetsURL string }{assetsURL}); err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// NewDocument generates the OpenAPI document of the registered routes.
+//
+// Parameters:
+//   - info: Info - Title and version of the API.
+//   - routes: []Route - The routes that can be documented, with the types of their request and response bodies.
+//   - registered: gin.RoutesInfo - The routes registered on the router, see gin.Engine.Routes.
+//
+// Returns:
+//   - *Document: The document, with an operation for each registered route and a component schema for each named struct type.
+//
+// Behavior:
+//   - Path parameters are converted to the OpenAPI syntax, e.g. "/rtt/status/:taskId" is documented as "/rtt/status/{taskId}".
+//   - Every operation has a "default" response with the error envelope, see api_errors.Error.
+func NewDocument(info Info, routes []Route, registered gin.RoutesInfo) *Document {
+	known := make(map[string]Route, len(routes))
+	for _, route := range routes {
+		known[route.Method+" "+route.Path] = route
+	}
+
+	schemas := newSchemaGenerator()
+	errorSchema := schemas.Schema(ErrorResponse{})
+	document := &Document{OpenAPI: Version, Info: info, Paths: make(map[string]PathItem)}
+	for _, routeInfo := range registered {
+		route, ok := known[routeInfo.Method+" "+routeInfo.Path]
+		if !ok {
+			log.Printf("WARNING: Route %s %s is not described in the OpenAPI routes", routeInfo.Method, routeInfo.Path)
+			route = Route{Method: routeInfo.Method, Path: routeInfo.Path}
+		}
+
+		operation := &Operation{
+			Summary:     route.Summary,
+			OperationID: route.OperationID,
+			Parameters:  append(pathParameters(route.Path), route.Parameters...),
+			Deprecated:  route.Deprecated,
+			Responses: map[string]*Response{
+				"200":     {Description: "OK"},
+				"default": {Description: "Error", Content: jsonContent(errorSchema)},
+			},
+		}
+		if route.Tag != "" {
+			operation.Tags = []string{route.Tag}
+		}
+		if route.Request != nil {
+			operation.RequestBody = &RequestBody{Required: !route.OptionalBody, Content: jsonContent(schemas.Schema(route.Request))}
+		}
+		if route.Response != nil {
+			operation.Responses["200"].Content = jsonContent(schemas.Schema(route.Response))
+		}
+
+		path := openAPIPath(route.Path)
+		if document.Paths[path] == nil {
+			document.Paths[path] = PathItem{}
+		}
+		document.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+	document.Components.Schemas = schemas.schemas
+	return document
+}
+
+// jsonContent returns the content of a JSON body with the schema.
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// pathParameters returns the required path parameters of a gin path.
+func pathParameters(path string) []Parameter {
+	var parameters []Parameter
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			parameters = append(parameters, Parameter{Name: segment[1:], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	return parameters
+}
+
+// openAPIPath converts the parameters of a gin path to the OpenAPI syntax, e.g. "/invites/:code" to "/invites/{code}".
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
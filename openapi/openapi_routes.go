@@ -0,0 +1,210 @@
+package openapi
+
+import (
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/cloud_recording_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/invite_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/real_time_transcription_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/rtmp_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/webhook_service"
+)
+
+// Route describes a route of the server, with the Go types of its JSON request and response bodies.
+type Route struct {
+	Method       string      // The HTTP method
+	Path         string      // The gin path, e.g. "/rtt/status/:taskId", path parameters are documented as required strings
+	Tag          string      // The service of the route
+	OperationID  string      // Unique name of the route, e.g. "startRecording"
+	Summary      string      // Short description of the route
+	Request      interface{} // (Optional) zero value of the request body type, e.g. token_service.TokenRequest{}
+	OptionalBody bool        // Whether the request body can be empty
+	Response     interface{} // (Optional) zero value of the response body type
+	Parameters   []Parameter // (Optional) the query and header parameters
+	Deprecated   bool        // Whether the route is kept only for compatibility
+}
+
+// ErrorResponse is the JSON body of an error response, see api_errors.Error.
+type ErrorResponse struct {
+	Error api_errors.Error `json:"error"` // The error
+}
+
+// Response bodies of the routes that respond with a gin.H map.
+type (
+	pingResponse struct {
+		Message string `json:"message"` // Always "pong"
+	}
+	webhookResponse struct {
+		Status string `json:"status"` // "ok", or "duplicate" when the notification was already received
+	}
+	auditLogResponse struct {
+		Events []token_service.AuditEvent `json:"events"` // The matching events, most recent first
+		Count  int                        `json:"count"`  // The number of events
+	}
+	auditStatsResponse struct {
+		Stats []token_service.AuditStats `json:"stats"` // The counters per channel and role
+	}
+	inviteListResponse struct {
+		Invites []invite_service.Invite `json:"invites"` // The invites of the tenant
+	}
+	startRTTResponse struct {
+		Acquire   real_time_transcription_service.AcquireBuilderTokenResponse `json:"acquire"`   // The builder token acquired for the task
+		Start     real_time_transcription_service.AgpraRTTResponse            `json:"start"`     // The started task
+		Timestamp time.Time                                                   `json:"timestamp"` // The time of the response
+	}
+	stopRTTResponse struct {
+		Stop      real_time_transcription_service.StopRTTResponse `json:"stop"`      // The result of the stop request
+		Timestamp time.Time                                       `json:"timestamp"` // The time of the response
+	}
+	queryRTTResponse struct {
+		Query     real_time_transcription_service.AgpraRTTResponse `json:"query"`     // The status of the task
+		Timestamp time.Time                                        `json:"timestamp"` // The time of the response
+	}
+)
+
+// Parameters shared by several routes.
+var (
+	requestIDHeader   = Parameter{Name: "X-Request-ID", In: "header", Required: true, Description: "ID of the request, forwarded to the Agora API", Schema: &Schema{Type: "string"}}
+	channelNameQuery  = queryParameter("channelName", "The channel name, used to find the session or task", "string")
+	regionQuery       = queryParameter("region", "The region of the service: na, eu, ap or cn", "string")
+	builderTokenQuery = queryParameter("builderToken", "Builder token, only needed for tasks not tracked by the server", "string")
+	expireQuery       = queryParameter("expire", "Token expiration in seconds", "integer")
+	expiryQuery       = queryParameter("expiry", "Token expiration in seconds", "integer")
+)
+
+// Routes are the routes of the server.
+// Only the routes registered on the router are added to the document, so the document matches the enabled services.
+var Routes = []Route{
+	{Method: "GET", Path: "/ping", Tag: "health", OperationID: "ping", Summary: "Health check", Response: pingResponse{}},
+	{Method: "GET", Path: "/openapi.json", Tag: "docs", OperationID: "getOpenAPIDocument", Summary: "The OpenAPI document of the server"},
+	{Method: "GET", Path: "/docs", Tag: "docs", OperationID: "getDocs", Summary: "The API docs UI"},
+	{Method: "GET", Path: "/docs/assets/swagger-ui.css", Tag: "docs", OperationID: "getDocsStylesheet", Summary: "The Swagger UI stylesheet of the docs UI"},
+	{Method: "GET", Path: "/docs/assets/swagger-ui-bundle.js", Tag: "docs", OperationID: "getDocsScript", Summary: "The Swagger UI script of the docs UI"},
+
+	// Token service
+	{Method: "POST", Path: "/token/getNew", Tag: "token", OperationID: "getToken", Summary: "Generate a token",
+		Request: token_service.TokenRequest{}, Response: token_service.TokenResponse{}},
+	{Method: "POST", Path: "/token/batch", Tag: "token", OperationID: "getTokenBatch", Summary: "Generate several tokens",
+		Request: []token_service.TokenRequest{}, Response: token_service.TokenBatchResponse{}},
+	{Method: "POST", Path: "/token/inspect", Tag: "token", OperationID: "inspectToken", Summary: "Decode a token",
+		Request: token_service.TokenInspectRequest{}, Response: token_service.TokenInspection{}},
+	{Method: "GET", Path: "/token/admin/certificates", Tag: "token admin", OperationID: "getCertificates", Summary: "The certificate that signs new tokens",
+		Response: token_service.CertificateStatus{}},
+	{Method: "POST", Path: "/token/admin/certificates/activate", Tag: "token admin", OperationID: "activateCertificate", Summary: "Switch the certificate that signs new tokens",
+		Request: token_service.CertificateActivateRequest{}, Response: token_service.CertificateStatus{}},
+	{Method: "GET", Path: "/token/admin/audit", Tag: "token admin", OperationID: "getAuditLog", Summary: "Query the token audit log",
+		Response: auditLogResponse{}, Parameters: auditQueryParameters(queryParameter("limit", "Maximum number of events", "integer"))},
+	{Method: "GET", Path: "/token/admin/audit/stats", Tag: "token admin", OperationID: "getAuditStats", Summary: "Token counters per channel and role",
+		Response: auditStatsResponse{}, Parameters: auditQueryParameters()},
+
+	// Routes of the community agora-token-service
+	{Method: "GET", Path: "/rtc/:channelName/:role/:tokentype/:uid/", Tag: "token legacy", OperationID: "getLegacyRtcToken", Summary: "Generate an RTC token",
+		Response: map[string]string{}, Parameters: []Parameter{expiryQuery}, Deprecated: true},
+	{Method: "GET", Path: "/rtm/:uid/", Tag: "token legacy", OperationID: "getLegacyRtmToken", Summary: "Generate an RTM token",
+		Response: map[string]string{}, Parameters: []Parameter{expiryQuery}, Deprecated: true},
+	{Method: "GET", Path: "/rte/:channelName/:role/:tokentype/:uid/", Tag: "token legacy", OperationID: "getLegacyRteTokens", Summary: "Generate RTC and RTM tokens",
+		Response: map[string]string{}, Parameters: []Parameter{expiryQuery}, Deprecated: true},
+	{Method: "GET", Path: "/rte/:channelName/:role/:tokentype/:uid/:rtmuid/", Tag: "token legacy", OperationID: "getLegacyRteTokensWithRtmUid", Summary: "Generate RTC and RTM tokens for different UIDs",
+		Response: map[string]string{}, Parameters: []Parameter{expiryQuery}, Deprecated: true},
+	{Method: "GET", Path: "/chat/app/", Tag: "token legacy", OperationID: "getLegacyChatAppToken", Summary: "Generate a chat app token",
+		Response: map[string]string{}, Parameters: []Parameter{expiryQuery}, Deprecated: true},
+	{Method: "GET", Path: "/chat/account/:uid/", Tag: "token legacy", OperationID: "getLegacyChatUserToken", Summary: "Generate a chat user token",
+		Response: map[string]string{}, Parameters: []Parameter{expiryQuery}, Deprecated: true},
+
+	// UID directory and invites
+	{Method: "POST", Path: "/uid/resolve", Tag: "uid", OperationID: "resolveUids", Summary: "Resolve user accounts to integer UIDs",
+		Request: uid_directory.ResolveRequest{}, Response: uid_directory.ResolveResponse{}},
+	{Method: "POST", Path: "/invites", Tag: "invites", OperationID: "createInvite", Summary: "Create an invite link",
+		Request: invite_service.CreateInviteRequest{}, Response: invite_service.CreateInviteResponse{}},
+	{Method: "GET", Path: "/invites", Tag: "invites", OperationID: "listInvites", Summary: "List the invites",
+		Response: inviteListResponse{}},
+	{Method: "DELETE", Path: "/invites/:code", Tag: "invites", OperationID: "revokeInvite", Summary: "Revoke an invite",
+		Response: invite_service.Invite{}},
+	{Method: "GET", Path: "/invites/:code/redeem", Tag: "invites", OperationID: "redeemInvite", Summary: "Redeem an invite for tokens",
+		Response: invite_service.RedeemInviteResponse{}, Parameters: []Parameter{expireQuery, queryParameter("account", "User account to assign the UID to", "string")}},
+
+	// Webhooks
+	{Method: "POST", Path: "/webhooks/agora", Tag: "webhooks", OperationID: "receiveNotification", Summary: "Receive an Agora notification",
+		Request: webhook_service.Notification{}, Response: webhookResponse{}, Parameters: []Parameter{
+			{Name: "Agora-Signature", In: "header", Description: "HMAC/SHA1 signature of the body", Schema: &Schema{Type: "string"}},
+			{Name: "Agora-Signature-V2", In: "header", Description: "HMAC/SHA256 signature of the body", Schema: &Schema{Type: "string"}},
+		}},
+
+	// Cloud recording
+	{Method: "POST", Path: "/cloud_recording/start", Tag: "cloud recording", OperationID: "startRecording", Summary: "Start a recording",
+		Request: cloud_recording_service.ClientStartRecordingRequest{}, Response: cloud_recording_service.StartRecordingResponse{}},
+	{Method: "POST", Path: "/cloud_recording/stop", Tag: "cloud recording", OperationID: "stopRecording", Summary: "Stop a recording",
+		Request: cloud_recording_service.ClientStopRecordingRequest{}, Response: cloud_recording_service.ActiveRecordingResponse{}},
+	{Method: "GET", Path: "/cloud_recording/status", Tag: "cloud recording", OperationID: "getRecordingStatus", Summary: "Query the status of a recording",
+		Response: cloud_recording_service.RecordingStatusResponse{}, Parameters: []Parameter{
+			queryParameter("recordingId", "Recording ID returned by start", "string"),
+			channelNameQuery,
+			queryParameter("resourceId", "Resource ID of the recording", "string"),
+			queryParameter("sid", "Session ID of the recording", "string"),
+			queryParameter("mode", "Recording mode: individual, mix or web", "string"),
+		}},
+	{Method: "GET", Path: "/cloud_recording/status/:resourceId/:sid/:mode", Tag: "cloud recording", OperationID: "getRecordingStatusBySession", Summary: "Query the status of a recording by session",
+		Response: cloud_recording_service.RecordingStatusResponse{}},
+	{Method: "GET", Path: "/cloud_recording/sessions", Tag: "cloud recording", OperationID: "listRecordingSessions", Summary: "List the active recordings",
+		Response: cloud_recording_service.RecordingSessionsResponse{}, Parameters: []Parameter{channelNameQuery}},
+	{Method: "POST", Path: "/cloud_recording/update/subscriber-list", Tag: "cloud recording", OperationID: "updateSubscriberList", Summary: "Update the streams of a recording",
+		Request: cloud_recording_service.ClientUpdateSubscriptionRequest{}, Response: cloud_recording_service.UpdateRecordingResponse{}},
+	{Method: "POST", Path: "/cloud_recording/update/layout", Tag: "cloud recording", OperationID: "updateLayout", Summary: "Update the layout of a mixed recording",
+		Request: cloud_recording_service.ClientUpdateLayoutRequest{}, Response: cloud_recording_service.UpdateRecordingResponse{}},
+
+	// Real-time transcription
+	{Method: "POST", Path: "/rtt/start", Tag: "real-time transcription", OperationID: "startTranscription", Summary: "Start a transcription",
+		Request: real_time_transcription_service.ClientStartRTTRequest{}, Response: startRTTResponse{}},
+	{Method: "DELETE", Path: "/rtt/stop", Tag: "real-time transcription", OperationID: "stopTranscriptionByChannel", Summary: "Stop the transcription of a channel",
+		Request: real_time_transcription_service.ClientStopRTTRequest{}, OptionalBody: true, Response: stopRTTResponse{}, Parameters: []Parameter{channelNameQuery, builderTokenQuery}},
+	{Method: "DELETE", Path: "/rtt/stop/:taskId", Tag: "real-time transcription", OperationID: "stopTranscription", Summary: "Stop a transcription",
+		Request: real_time_transcription_service.ClientStopRTTRequest{}, OptionalBody: true, Response: stopRTTResponse{}, Parameters: []Parameter{builderTokenQuery}},
+	{Method: "GET", Path: "/rtt/status", Tag: "real-time transcription", OperationID: "queryTranscriptionByChannel", Summary: "Query the transcription of a channel",
+		Response: queryRTTResponse{}, Parameters: []Parameter{channelNameQuery, builderTokenQuery}},
+	{Method: "GET", Path: "/rtt/status/:taskId", Tag: "real-time transcription", OperationID: "queryTranscription", Summary: "Query a transcription",
+		Response: queryRTTResponse{}, Parameters: []Parameter{builderTokenQuery}},
+	{Method: "PATCH", Path: "/rtt/update/:taskId", Tag: "real-time transcription", OperationID: "updateTranscription", Summary: "Update the languages or streams of a transcription",
+		Request: real_time_transcription_service.ClientUpdateRTTRequest{}, Response: real_time_transcription_service.AgpraRTTResponse{}},
+
+	// Media Push and Cloud Player
+	{Method: "POST", Path: "/rtmp/push/start", Tag: "media push", OperationID: "startPush", Summary: "Start pushing a channel to an RTMP server",
+		Request: rtmp_service.ClientStartRtmpRequest{}, Response: rtmp_service.StartRtmpResponse{}, Parameters: []Parameter{requestIDHeader}},
+	{Method: "POST", Path: "/rtmp/push/stop", Tag: "media push", OperationID: "stopPush", Summary: "Stop a push",
+		Request: rtmp_service.ClientStopRtmpRequest{}, Response: rtmp_service.StopRtmpResponse{}, Parameters: []Parameter{requestIDHeader}},
+	{Method: "GET", Path: "/rtmp/push/list", Tag: "media push", OperationID: "listPushes", Summary: "List the running pushes",
+		Response: rtmp_service.ConverterListResponse{}, Parameters: []Parameter{requestIDHeader, queryParameter("channel", "Only list the pushes of this channel", "string"), regionQuery,
+			queryParameter("cursor", "Continue a truncated list from its nextCursor", "integer")}},
+	{Method: "POST", Path: "/rtmp/push/update", Tag: "media push", OperationID: "updatePush", Summary: "Update a push",
+		Request: rtmp_service.ClientUpdateRtmpRequest{}, Response: rtmp_service.StartRtmpResponse{}, Parameters: []Parameter{requestIDHeader}},
+	{Method: "POST", Path: "/rtmp/pull/start", Tag: "cloud player", OperationID: "startPull", Summary: "Start pulling a stream into a channel",
+		Request: rtmp_service.ClientStartCloudPlayerRequest{}, Response: rtmp_service.StartCloudPlayerResponse{}, Parameters: []Parameter{requestIDHeader}},
+	{Method: "POST", Path: "/rtmp/pull/stop", Tag: "cloud player", OperationID: "stopPull", Summary: "Stop a pull",
+		Request: rtmp_service.ClientStopPullRequest{}, Response: rtmp_service.CloudPlayerUpdateResponse{}, Parameters: []Parameter{requestIDHeader}},
+	{Method: "POST", Path: "/rtmp/pull/update", Tag: "cloud player", OperationID: "updatePull", Summary: "Update a pull",
+		Request: rtmp_service.ClientUpdatePullRequest{}, Response: rtmp_service.CloudPlayerUpdateResponse{}, Parameters: []Parameter{requestIDHeader}},
+	{Method: "GET", Path: "/rtmp/pull/list", Tag: "cloud player", OperationID: "listPulls", Summary: "List the running pulls",
+		Response: rtmp_service.CloudPlayerListResponse{}, Parameters: []Parameter{requestIDHeader, channelNameQuery, regionQuery,
+			queryParameter("pageSize", "Number of players per page", "integer"), queryParameter("pageToken", "Token of the page, from nextPageToken", "string")}},
+}
+
+// queryParameter returns an optional query parameter of the JSON type, e.g. "string" or "integer".
+func queryParameter(name string, description string, jsonType string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: jsonType}}
+}
+
+// auditQueryParameters returns the filter parameters of the audit routes, followed by extra parameters.
+func auditQueryParameters(extra ...Parameter) []Parameter {
+	parameters := []Parameter{
+		queryParameter("channel", "Only events for this channel", "string"),
+		queryParameter("uid", "Only events for this UID", "string"),
+		queryParameter("caller", "Only events of this caller", "string"),
+		queryParameter("tenant", "Only events of this tenant", "string"),
+		queryParameter("outcome", "Only events with this outcome: issued, denied or failed", "string"),
+		queryParameter("from", "Only events at or after this RFC 3339 time or unix timestamp (s)", "string"),
+		queryParameter("to", "Only events before this RFC 3339 time or unix timestamp (s)", "string"),
+	}
+	return append(parameters, extra...)
+}
@@ -0,0 +1,171 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schemaRefPrefix is the prefix of the references to component schemas.
+const schemaRefPrefix = "#/components/schemas/"
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaGenerator generates the schemas of Go types, as they are encoded and decoded by encoding/json.
+// Named struct types are added to the component schemas and referenced by name, so each type is described once.
+type schemaGenerator struct {
+	schemas map[string]*Schema      // The component schemas, keyed by name
+	names   map[reflect.Type]string // The component name of each named struct type
+}
+
+// newSchemaGenerator returns a schemaGenerator without component schemas.
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+// Schema returns the schema of the type of value, e.g. token_service.TokenRequest{}.
+func (g *schemaGenerator) Schema(value interface{}) *Schema {
+	return g.schemaFor(reflect.TypeOf(value))
+}
+
+// schemaFor returns the schema of a type.
+//
+// Behavior:
+//   - Pointers are nullable, except references, which can't have other keywords in OpenAPI 3.0.
+//   - time.Time is a date-time string, json.RawMessage and interfaces are any value, and []byte is a base64 string.
+//   - Maps are objects with the schema of their values, named structs are references to a component schema.
+func (g *schemaGenerator) schemaFor(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := g.schemaFor(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := 0.0
+		return &Schema{Type: "integer", Minimum: &minimum}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.ref(t)
+	}
+	return &Schema{}
+}
+
+// ref returns a reference to the component schema of a named struct type, adding the schema the first time the type is seen.
+// Types with the same name in different packages are named after their package, e.g. "rtmp_service.TranscodeOptions".
+func (g *schemaGenerator) ref(t reflect.Type) *Schema {
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.schemas[name]; taken {
+			name = path.Base(t.PkgPath()) + "." + t.Name()
+		}
+		// Name the type before generating its schema, so recursive types reference themselves
+		g.names[t] = name
+		g.schemas[name] = &Schema{}
+		g.schemas[name] = g.structSchema(t)
+	}
+	return &Schema{Ref: schemaRefPrefix + name}
+}
+
+// structSchema returns the object schema of a struct type, which doesn't allow unknown properties.
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	g.addFields(schema, t)
+	return schema
+}
+
+// addFields adds the fields of a struct type to an object schema, including the fields of embedded structs.
+//
+// Behavior:
+//   - Fields are named after their json tag, fields tagged json:"-" and unexported fields are skipped.
+//   - Fields that are neither pointers nor tagged omitempty are required.
+//   - The openapi:"optional" and openapi:"required" tags override the required fields, for fields that are only required
+//     in some requests, or pointers that must be set.
+func (g *schemaGenerator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		// Fields of untagged embedded structs are encoded as fields of the outer struct
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = g.schemaFor(field.Type)
+		required := field.Type.Kind() != reflect.Ptr && !hasOption(options, "omitempty")
+		switch field.Tag.Get("openapi") {
+		case "optional":
+			required = false
+		case "required":
+			required = true
+		}
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// hasOption reports whether the comma separated options of a json tag include option.
+func hasOption(options string, option string) bool {
+	for _, candidate := range strings.Split(options, ",") {
+		if candidate == option {
+			return true
+		}
+	}
+	return false
+}
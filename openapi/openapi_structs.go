@@ -0,0 +1,74 @@
+package openapi
+
+// Document is an OpenAPI 3 document, with the subset of the specification used to describe this server.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`    // The OpenAPI version of the document
+	Info       Info                `json:"info"`       // Title and version of the API
+	Paths      map[string]PathItem `json:"paths"`      // The operations of each path, keyed by the OpenAPI path, e.g. "/rtt/status/{taskId}"
+	Components Components          `json:"components"` // The schemas referenced by the operations
+}
+
+// Info is the title and version of the API.
+type Info struct {
+	Title       string `json:"title"`                 // The title of the API
+	Description string `json:"description,omitempty"` // (Optional) description of the API
+	Version     string `json:"version"`               // The version of the API
+}
+
+// PathItem is the operations of a single path, keyed by the lowercase HTTP method.
+type PathItem map[string]*Operation
+
+// Operation describes a single route.
+type Operation struct {
+	Tags        []string             `json:"tags,omitempty"`        // The service of the route, used to group the routes in the docs UI
+	Summary     string               `json:"summary,omitempty"`     // Short description of the route
+	OperationID string               `json:"operationId,omitempty"` // Unique name of the route, e.g. "startRecording"
+	Parameters  []Parameter          `json:"parameters,omitempty"`  // The path, query and header parameters of the route
+	RequestBody *RequestBody         `json:"requestBody,omitempty"` // (Optional) the JSON request body
+	Responses   map[string]*Response `json:"responses"`             // The responses, keyed by HTTP status code
+	Deprecated  bool                 `json:"deprecated,omitempty"`  // Whether the route is kept only for compatibility
+}
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name"`                  // The name of the parameter
+	In          string  `json:"in"`                    // The location of the parameter: "path", "query" or "header"
+	Description string  `json:"description,omitempty"` // (Optional) description of the parameter
+	Required    bool    `json:"required,omitempty"`    // Whether the parameter is required, always true for path parameters
+	Schema      *Schema `json:"schema"`                // The type of the parameter
+}
+
+// RequestBody is the JSON request body of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"` // Whether the body is required
+	Content  map[string]MediaType `json:"content"`            // The body schema, keyed by media type
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string               `json:"description"`       // Description of the response
+	Content     map[string]MediaType `json:"content,omitempty"` // (Optional) the body schema, keyed by media type
+}
+
+// MediaType is the schema of a request or response body.
+type MediaType struct {
+	Schema *Schema `json:"schema"` // The body schema
+}
+
+// Components holds the schemas referenced by the operations, keyed by type name.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"` // The schemas of the named request and response types
+}
+
+// Schema is a JSON schema, either inline or a reference to a component schema.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`                 // Reference to a component schema, e.g. "#/components/schemas/TokenRequest"
+	Type                 string             `json:"type,omitempty"`                 // The JSON type: "object", "array", "string", "integer", "number" or "boolean", empty for any value
+	Format               string             `json:"format,omitempty"`               // (Optional) format of the type, e.g. "int64" or "date-time"
+	Nullable             bool               `json:"nullable,omitempty"`             // Whether the value can be null
+	Minimum              *float64           `json:"minimum,omitempty"`              // (Optional) minimum of a number, e.g. 0 for unsigned integers
+	Properties           map[string]*Schema `json:"properties,omitempty"`           // The properties of an object
+	Required             []string           `json:"required,omitempty"`             // The required properties of an object
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // false for structs, or the schema of the values of a map
+	Items                *Schema            `json:"items,omitempty"`                // The schema of the items of an array
+}
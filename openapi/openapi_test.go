@@ -0,0 +1,311 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// testEmbedded is embedded in testRequest, its fields are properties of testRequest.
+type testEmbedded struct {
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// testRequest is a request struct with the kinds of fields used by the services.
+type testRequest struct {
+	testEmbedded
+	Channel  string            `json:"channel"`
+	Uid      string            `json:"uid" openapi:"optional"`
+	Count    *int              `json:"count,omitempty"`
+	Hint     *string           `json:"hint"`
+	Url      *string           `json:"url" openapi:"required"`
+	Uids     []uint32          `json:"uids,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Options  *testOptions      `json:"options,omitempty"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	At       time.Time         `json:"at,omitempty"`
+	Internal string            `json:"-"`
+	private  string
+}
+
+type testOptions struct {
+	Mode    string       `json:"mode"`
+	Enabled bool         `json:"enabled,omitempty"`
+	Next    *testOptions `json:"next,omitempty"`
+}
+
+func TestSchema(t *testing.T) {
+	generator := newSchemaGenerator()
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testRequest"}, generator.Schema(testRequest{}))
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/testRequest"}}, generator.Schema([]testRequest{}))
+
+	schema := generator.schemas["testRequest"]
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, false, schema.AdditionalProperties)
+	assert.Equal(t, []string{"channel", "url"}, schema.Required)
+	assert.ElementsMatch(t, []string{"tenant", "channel", "uid", "count", "hint", "url", "uids", "labels", "options", "raw", "at"}, keys(schema.Properties))
+
+	assert.Equal(t, &Schema{Type: "integer", Format: "int64", Nullable: true}, schema.Properties["count"])
+	assert.Equal(t, &Schema{Type: "string", Nullable: true}, schema.Properties["hint"])
+	minimum := 0.0
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "integer", Minimum: &minimum}}, schema.Properties["uids"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, schema.Properties["labels"])
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testOptions"}, schema.Properties["options"])
+	assert.Equal(t, &Schema{}, schema.Properties["raw"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, schema.Properties["at"])
+
+	// Recursive types reference their own component schema
+	options := generator.schemas["testOptions"]
+	assert.Equal(t, []string{"mode"}, options.Required)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testOptions"}, options.Properties["next"])
+}
+
+func TestSchemaNameCollision(t *testing.T) {
+	generator := newSchemaGenerator()
+	generator.Schema(struct {
+		Error api_errors.Error `json:"error"`
+	}{})
+	generator.Schema(ErrorResponse{})
+	type Error struct {
+		Reason string `json:"reason"`
+	}
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/openapi.Error"}, generator.Schema(Error{}))
+	assert.Contains(t, generator.schemas, "Error")
+	assert.Contains(t, generator.schemas, "ErrorResponse")
+}
+
+// newTestRouter returns a router with the middleware and the routes, whose handlers respond with the request body.
+func newTestRouter(routes []Route) (*gin.Engine, *Service) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	service := NewService("Test API", "1.0.0")
+	service.routes = routes
+	router.Use(service.ValidateRequests())
+	for _, route := range routes {
+		router.Handle(route.Method, route.Path, func(c *gin.Context) {
+			body, _ := c.GetRawData()
+			c.Data(http.StatusOK, "application/json", body)
+		})
+	}
+	router.GET("/undocumented", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	service.RegisterRoutes(router)
+	return router, service
+}
+
+var testRoutes = []Route{
+	{Method: "POST", Path: "/items", Tag: "items", OperationID: "createItem", Summary: "Create an item", Request: testRequest{}, Response: testRequest{}},
+	{Method: "DELETE", Path: "/items/:id", Tag: "items", OperationID: "deleteItem", Request: testOptions{}, OptionalBody: true,
+		Parameters: []Parameter{requestIDHeader, queryParameter("limit", "Maximum number of items", "integer")}},
+	{Method: "POST", Path: "/items/batch", Tag: "items", OperationID: "createItems", Request: []testOptions{}},
+}
+
+func TestNewDocument(t *testing.T) {
+	_, service := newTestRouter(testRoutes)
+	document := service.Document()
+
+	assert.Equal(t, Version, document.OpenAPI)
+	assert.Equal(t, Info{Title: "Test API", Version: "1.0.0"}, document.Info)
+	assert.ElementsMatch(t, []string{"/items", "/items/{id}", "/items/batch", "/undocumented", "/openapi.json", "/docs"}, keys(document.Paths))
+
+	create := document.Paths["/items"]["post"]
+	assert.Equal(t, "createItem", create.OperationID)
+	assert.Equal(t, []string{"items"}, create.Tags)
+	assert.True(t, create.RequestBody.Required)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testRequest"}, create.RequestBody.Content["application/json"].Schema)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/testRequest"}, create.Responses["200"].Content["application/json"].Schema)
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/ErrorResponse"}, create.Responses["default"].Content["application/json"].Schema)
+
+	remove := document.Paths["/items/{id}"]["delete"]
+	assert.False(t, remove.RequestBody.Required)
+	if assert.Len(t, remove.Parameters, 3) {
+		assert.Equal(t, Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}, remove.Parameters[0])
+		assert.Equal(t, "X-Request-ID", remove.Parameters[1].Name)
+	}
+	assert.Nil(t, remove.Responses["200"].Content)
+
+	// Routes that are not described are documented without bodies
+	undocumented := document.Paths["/undocumented"]["get"]
+	assert.Empty(t, undocumented.OperationID)
+	assert.Nil(t, undocumented.RequestBody)
+}
+
+func TestServeDocument(t *testing.T) {
+	router, _ := newTestRouter(testRoutes)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var document map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+	assert.Equal(t, Version, document["openapi"])
+	assert.Contains(t, w.Body.String(), `"$ref": "#/components/schemas/testRequest"`)
+	assert.Contains(t, w.Body.String(), `"additionalProperties": false`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/docs", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `url: "openapi.json"`)
+	assert.Contains(t, w.Body.String(), `src="https://unpkg.com/swagger-ui-dist@`+SwaggerUIVersion+`/swagger-ui-bundle.js"`)
+}
+
+func TestDocsAssets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewService("Test API", "1.0.0")
+	dir := t.TempDir()
+	assert.Error(t, service.SetDocsAssets(dir))
+
+	os.WriteFile(filepath.Join(dir, "swagger-ui.css"), []byte("body {}"), 0644)
+	os.WriteFile(filepath.Join(dir, "swagger-ui-bundle.js"), []byte("var SwaggerUIBundle;"), 0644)
+	if !assert.NoError(t, service.SetDocsAssets(dir)) {
+		t.FailNow()
+	}
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/docs", nil)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `src="docs/assets/swagger-ui-bundle.js"`)
+	assert.NotContains(t, w.Body.String(), "unpkg.com")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/docs/assets/swagger-ui-bundle.js", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "var SwaggerUIBundle;", w.Body.String())
+}
+
+func TestValidateRequests(t *testing.T) {
+	router, _ := newTestRouter(testRoutes)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		fields  []api_errors.FieldError
+	}{
+		{
+			name: "Valid request", method: "POST", path: "/items",
+			body: `{"channel":"test","url":null,"count":3,"uids":[1,2],"labels":{"a":"b"},"options":{"mode":"a","next":{"mode":"b"}},"raw":[1,"a"]}`,
+		},
+		{
+			name: "Missing required fields", method: "POST", path: "/items",
+			body:   `{"uid":"1"}`,
+			fields: []api_errors.FieldError{{Field: "channel", Message: "is required"}, {Field: "url", Message: "is required"}},
+		},
+		{
+			name: "Wrong types", method: "POST", path: "/items",
+			body: `{"channel":1,"url":"u","count":1.5,"uids":[-1,"2"],"labels":{"a":1},"options":{"mode":"a","enabled":"yes"}}`,
+			fields: []api_errors.FieldError{
+				{Field: "channel", Message: "must be of type string"},
+				{Field: "count", Message: "must be of type integer"},
+				{Field: "labels.a", Message: "must be of type string"},
+				{Field: "options.enabled", Message: "must be of type boolean"},
+				{Field: "uids[0]", Message: "must be at least 0"},
+				{Field: "uids[1]", Message: "must be of type integer"},
+			},
+		},
+		{
+			name: "Unknown and null fields", method: "POST", path: "/items",
+			body:   `{"channel":null,"url":"u","chanel":"test","options":{"mode":"a","mdoe":"b"}}`,
+			fields: []api_errors.FieldError{{Field: "chanel", Message: "is not a known field"}, {Field: "channel", Message: "must not be null"}, {Field: "options.mdoe", Message: "is not a known field"}},
+		},
+		{
+			name: "Missing body", method: "POST", path: "/items",
+			fields: []api_errors.FieldError{{Field: "body", Message: "is required"}},
+		},
+		{
+			name: "Body of the wrong type", method: "POST", path: "/items",
+			body:   `[]`,
+			fields: []api_errors.FieldError{{Field: "body", Message: "must be of type object"}},
+		},
+		{
+			name: "Array body", method: "POST", path: "/items/batch",
+			body:   `[{"mode":"a"},{}]`,
+			fields: []api_errors.FieldError{{Field: "[1].mode", Message: "is required"}},
+		},
+		{
+			name: "Optional body and parameters", method: "DELETE", path: "/items/1?limit=10",
+			headers: map[string]string{"X-Request-ID": "abc"},
+		},
+		{
+			name: "Missing header and invalid query parameter", method: "DELETE", path: "/items/1?limit=ten",
+			fields: []api_errors.FieldError{{Field: "X-Request-ID", Message: "is required"}, {Field: "limit", Message: "must be of type integer"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			router.ServeHTTP(w, req)
+
+			if tt.fields == nil {
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				// The handler reads the same body
+				assert.Equal(t, tt.body, w.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var resp struct {
+				Error api_errors.Error `json:"error"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, api_errors.CodeInvalidRequest, resp.Error.Code)
+			assert.Equal(t, tt.fields, resp.Error.Fields)
+		})
+	}
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/items", strings.NewReader(`{"channel":`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Routes not in the document", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/undocumented", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", "/unknown", strings.NewReader(`{}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	assert.Equal(t, "/rte/{channelName}/{role}/{tokentype}/{uid}/", openAPIPath("/rte/:channelName/:role/:tokentype/:uid/"))
+	assert.Equal(t, "/token/getNew", openAPIPath("/token/getNew"))
+	assert.Equal(t, []Parameter{
+		{Name: "code", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+	}, pathParameters("/invites/:code/redeem"))
+}
+
+// keys returns the keys of a map.
+func keys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBodySize is the maximum size of a validated request body, larger bodies are rejected.
+const maxBodySize = 1 << 20
+
+// ValidateRequests returns a middleware that validates requests against the OpenAPI document before they reach the handlers.
+//
+// Returns:
+//   - gin.HandlerFunc: The middleware, it must be added before the routes are registered.
+//
+// Behavior:
+//   - Checks that the required header and query parameters are set, and that integer query parameters are integers.
+//   - Checks the JSON request body against the schema of its type: required properties, unknown properties, types, and null values.
+//   - Responds with an HTTP 400 error with the invalid fields when the request is invalid, see request_validation.Errors.
+//   - Requests to routes that are not in the document, e.g. unknown paths, are passed on unchanged.
+//
+// Notes:
+//   - The handlers still validate the values of the requests, e.g. channel names, which the document doesn't describe.
+func (s *Service) ValidateRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		operation, ok := s.operations[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		var errs request_validation.Errors
+		validateParameters(&errs, c, operation.Parameters)
+		if operation.RequestBody != nil {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+			if err != nil {
+				api_errors.Abort(c, http.StatusBadRequest, err)
+				return
+			}
+			// Let the handler read the body again
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+			if len(bytes.TrimSpace(body)) == 0 {
+				if operation.RequestBody.Required {
+					errs.Add("body", "is required")
+				}
+			} else {
+				var value interface{}
+				decoder := json.NewDecoder(bytes.NewReader(body))
+				decoder.UseNumber()
+				if err := decoder.Decode(&value); err != nil {
+					api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid request: malformed JSON")
+					return
+				}
+				s.validateValue(&errs, "", operation.RequestBody.Content["application/json"].Schema, value)
+			}
+		}
+		if err := errs.Err(); err != nil {
+			api_errors.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateParameters adds an error for each missing required header or query parameter, and each query parameter of the wrong type.
+func validateParameters(errs *request_validation.Errors, c *gin.Context, parameters []Parameter) {
+	for _, parameter := range parameters {
+		var value string
+		switch parameter.In {
+		case "header":
+			value = c.GetHeader(parameter.Name)
+		case "query":
+			value = c.Query(parameter.Name)
+		default:
+			continue
+		}
+		if value == "" {
+			if parameter.Required {
+				errs.Add(parameter.Name, "is required")
+			}
+			continue
+		}
+		if parameter.Schema.Type == "integer" {
+			if _, err := strconv.Atoi(value); err != nil {
+				errs.Add(parameter.Name, "must be of type integer")
+			}
+		}
+	}
+}
+
+// validateValue adds an error for each part of a decoded JSON value that doesn't match the schema.
+// The field of each error is the JSON path of the value, e.g. "recordingConfig.maxIdleTime" or "languages[0]".
+func (s *Service) validateValue(errs *request_validation.Errors, field string, schema *Schema, value interface{}) {
+	if schema.Ref != "" {
+		schema = s.document.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			errs.Add(bodyField(field), "must not be null")
+		}
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs.Add(bodyField(field), "must be of type object")
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				errs.Add(childField(field, name), "is required")
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				s.validateValue(errs, childField(field, name), property, object[name])
+			} else if additional, ok := schema.AdditionalProperties.(*Schema); ok {
+				s.validateValue(errs, childField(field, name), additional, object[name])
+			} else {
+				errs.Add(childField(field, name), "is not a known field")
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			errs.Add(bodyField(field), "must be of type array")
+			return
+		}
+		for i, item := range items {
+			s.validateValue(errs, fmt.Sprintf("%s[%d]", field, i), schema.Items, item)
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			errs.Add(bodyField(field), "must be of type %s", schema.Type)
+			return
+		}
+		numberValue, err := number.Float64()
+		if err == nil && schema.Type == "integer" {
+			_, err = number.Int64()
+		}
+		if err != nil {
+			errs.Add(bodyField(field), "must be of type %s", schema.Type)
+		} else if schema.Minimum != nil && numberValue < *schema.Minimum {
+			errs.Add(bodyField(field), "must be at least %v", *schema.Minimum)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs.Add(bodyField(field), "must be of type string")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs.Add(bodyField(field), "must be of type boolean")
+		}
+	}
+}
+
+// childField returns the JSON path of a property of the value at field.
+func childField(field string, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// bodyField returns the name of the field in errors, the body itself is named "body".
+func bodyField(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
@@ -0,0 +1,157 @@
+package rate_limiter
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/gin-gonic/gin"
+)
+
+// Route groups of the legacy token routes, see token_service.TokenService.SetLegacyRoutes.
+// They hand out the same tokens as the token routes, so they share the "token" limit unless they have their own.
+var legacyTokenGroups = map[string]bool{"rtc": true, "rtm": true, "rte": true, "chat": true}
+
+// Limiter limits the request rate of each client per route group, with a token bucket per client and group.
+// A route group is the first segment of the request path, e.g. "token" for "/token/getNew".
+type Limiter struct {
+	limits map[string]Limit // Limits by route group, groups without a limit are not limited
+	keyBy  string           // The source of the client key: "apikey", "ip" or "tenant"
+	store  Store            // The store of the token buckets
+}
+
+// NewLimiter returns a Limiter for the limits of the route groups.
+//
+// Parameters:
+//   - limits: map[string]Limit - Limits by route group, e.g. "token" or "cloud_recording", see ParseLimits.
+//   - keyBy: string - The source of the key that identifies a client: "apikey" for the verified caller, "ip" or "tenant", defaults to "ip".
+//   - store: Store - (Optional) the store of the token buckets, defaults to a MemoryStore.
+//
+// Returns:
+//   - *Limiter: The limiter, see Middleware.
+//   - error: An error if keyBy is unknown or a limit has no rate or burst.
+func NewLimiter(limits map[string]Limit, keyBy string, store Store) (*Limiter, error) {
+	switch keyBy {
+	case "":
+		keyBy = KeyByIP
+	case KeyByAPIKey, KeyByIP, KeyByTenant:
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q, use %q, %q or %q", keyBy, KeyByAPIKey, KeyByIP, KeyByTenant)
+	}
+	for group, limit := range limits {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return nil, fmt.Errorf("rate limit of %q must have a positive rate and burst", group)
+		}
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Limiter{limits: limits, keyBy: keyBy, store: store}, nil
+}
+
+// ParseLimits parses the limits of the route groups from a comma separated list of "group=requests/period[:burst]".
+// The period is "s", "m" or "h", and the burst defaults to the number of requests.
+//
+// Example: "token=100/m,cloud_recording=10/m:20" allows 100 token requests a minute, all at once,
+// and 10 cloud recording requests a minute, with bursts of up to 20.
+func ParseLimits(value string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, spec, found := strings.Cut(entry, "=")
+		group = strings.Trim(strings.TrimSpace(group), "/")
+		if !found || group == "" || strings.Contains(group, "/") {
+			return nil, fmt.Errorf("invalid rate limit %q, expected group=requests/period[:burst]", entry)
+		}
+		spec, burstValue, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+		requestsValue, period, found := strings.Cut(spec, "/")
+		requests, err := strconv.Atoi(requestsValue)
+		if !found || err != nil || requests < 1 {
+			return nil, fmt.Errorf("invalid rate limit %q, expected group=requests/period[:burst]", entry)
+		}
+		periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+		duration, ok := periods[period]
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, the period must be s, m or h", entry)
+		}
+		burst := requests
+		if hasBurst {
+			burst, err = strconv.Atoi(burstValue)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("invalid rate limit %q, the burst must be a positive number", entry)
+			}
+		}
+		if _, exists := limits[group]; exists {
+			return nil, fmt.Errorf("duplicate rate limit for %q", group)
+		}
+		limits[group] = Limit{Rate: float64(requests) / duration.Seconds(), Burst: burst}
+	}
+	return limits, nil
+}
+
+// Middleware limits the request rate of each client for the route groups with a limit.
+// Returns an HTTP 429 error with a Retry-After header when the client's bucket is empty.
+// Requests are allowed when the store fails, so an unavailable shared store does not take the server down.
+//
+// Notes:
+//   - Register it after the tenant_registry middleware when keying by tenant.
+//   - Register it after token_service.TokenService.Identify when keying by API key, requests without a verified caller are keyed by IP.
+//   - The legacy token routes use the "token" limit, unless their group has its own.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := routeGroup(c.Request.URL.Path)
+		if _, own := l.limits[group]; !own && legacyTokenGroups[group] {
+			group = "token"
+		}
+		limit, limited := l.limits[group]
+		if !limited {
+			c.Next()
+			return
+		}
+
+		allowed, wait, err := l.store.Take(group+":"+l.clientKey(c), limit, time.Now())
+		if err != nil {
+			log.Println("Rate limiter store error, allowing the request:", err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			api_errors.AbortMessage(c, http.StatusTooManyRequests, "Rate limit exceeded, retry later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey returns the key that identifies the client of a request, falling back to the client IP.
+// Only verified identities are used, unverified credentials would let a client pick a new bucket for every request.
+func (l *Limiter) clientKey(c *gin.Context) string {
+	switch l.keyBy {
+	case KeyByAPIKey:
+		if caller, ok := token_service.CallerFromContext(c); ok {
+			return "caller:" + caller.Method + ":" + caller.Subject
+		}
+	case KeyByTenant:
+		if id := tenant_registry.IDFromContext(c.Request.Context()); id != "" {
+			return "tenant:" + id
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// routeGroup returns the first segment of a request path.
+func routeGroup(path string) string {
+	group, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return group
+}
@@ -0,0 +1,72 @@
+package rate_limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often a MemoryStore drops the buckets of idle clients.
+const pruneInterval = time.Minute
+
+// Store keeps the token buckets of the clients. Implement it on a shared store, e.g. Redis,
+// to apply the limits across several servers. Implementations must be safe for concurrent use.
+type Store interface {
+	// Take takes one request from the bucket of the key at the given time.
+	// Returns whether the request is allowed, and otherwise how long until the bucket has room for it.
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// MemoryStore keeps the token buckets in memory, so the limits apply per server.
+type MemoryStore struct {
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	lastPruned time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take takes one request from the bucket of the key, refilling the bucket for the time since the last request.
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastPruned) >= pruneInterval {
+		m.prune(now)
+	}
+
+	b, exists := m.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+	refill(b, now)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+		return false, wait, nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// prune drops the buckets that have refilled, a new bucket for the key starts full anyway. Must be called with m.mu held.
+func (m *MemoryStore) prune(now time.Time) {
+	for key, b := range m.buckets {
+		refill(b, now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastPruned = now
+}
+
+// refill adds the requests the bucket gained since it was last updated, up to the burst.
+func refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.updated = now
+	}
+}
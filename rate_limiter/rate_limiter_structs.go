@@ -0,0 +1,24 @@
+package rate_limiter
+
+import "time"
+
+// Sources of the key that identifies a client, see NewLimiter.
+const (
+	KeyByAPIKey = "apikey" // The verified caller of the request, see token_service.CallerFromContext, falling back to the client IP
+	KeyByIP     = "ip"     // The client IP
+	KeyByTenant = "tenant" // The tenant resolved by the tenant_registry middleware, falling back to the client IP
+)
+
+// Limit is the token bucket of a route group. A client can send Burst requests at once,
+// and the bucket refills at Rate requests per second.
+type Limit struct {
+	Rate  float64 // Requests per second added to the bucket
+	Burst int     // Size of the bucket, the most requests a client can send at once
+}
+
+// bucket is the state of the token bucket of one client in a MemoryStore.
+type bucket struct {
+	tokens  float64   // Requests left in the bucket at updated
+	updated time.Time // The time tokens was last computed
+	limit   Limit     // The limit of the bucket's last request
+}
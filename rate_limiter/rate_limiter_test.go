@@ -0,0 +1,170 @@
+package rate_limiter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("token=120/m, /cloud_recording/=10/m:20,rtt=2/s")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, Limit{Rate: 2, Burst: 120}, limits["token"])
+	assert.Equal(t, Limit{Rate: 10.0 / 60, Burst: 20}, limits["cloud_recording"])
+	assert.Equal(t, Limit{Rate: 2, Burst: 2}, limits["rtt"])
+
+	for _, value := range []string{"token", "token=10", "token=ten/m", "token=0/m", "token=10/d", "token=10/m:0", "token=1/s,token=2/s", "=1/s", "token/admin=1/s"} {
+		_, err := ParseLimits(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	_, err := NewLimiter(nil, "user", nil)
+	assert.Error(t, err)
+	_, err = NewLimiter(map[string]Limit{"token": {Rate: 0, Burst: 1}}, "", nil)
+	assert.Error(t, err)
+	limiter, err := NewLimiter(map[string]Limit{"token": {Rate: 1, Burst: 1}}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, KeyByIP, limiter.keyBy)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 0.5, Burst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, _ := store.Take("client", limit, now)
+		assert.True(t, allowed)
+	}
+	allowed, wait, _ := store.Take("client", limit, now)
+	assert.False(t, allowed)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// Other keys have their own bucket
+	allowed, _, _ = store.Take("other", limit, now)
+	assert.True(t, allowed)
+
+	allowed, _, _ = store.Take("client", limit, now.Add(2*time.Second))
+	assert.True(t, allowed)
+	allowed, wait, _ = store.Take("client", limit, now.Add(3*time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, wait)
+
+	// Buckets that have refilled are pruned
+	store.Take("client", limit, now.Add(time.Hour))
+	assert.Len(t, store.buckets, 1)
+}
+
+// failingStore is a Store that always fails.
+type failingStore struct{}
+
+func (failingStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("store unavailable")
+}
+
+func newTestRouter(t *testing.T, keyBy string, store Store) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter, err := NewLimiter(map[string]Limit{"token": {Rate: 1.0 / 60, Burst: 2}}, keyBy, store)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Stand-in for the tenant_registry middleware
+		if id := c.GetHeader(tenant_registry.TenantHeader); id != "" {
+			ctx := tenant_registry.NewContext(c.Request.Context(), &tenant_registry.Tenant{ID: id})
+			c.Request = c.Request.WithContext(ctx)
+		}
+	})
+	tokenService := token_service.NewTokenService("app", "cert")
+	tokenService.SetAuthenticators(token_service.NewAPIKeyAuthenticator(map[string]string{"key-a": "a", "key-b": "b"}))
+	router.Use(tokenService.Identify())
+	router.Use(limiter.Middleware())
+	router.POST("/token/getNew", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/rtc/:channelName/:role/uid/:uid", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/rtmp/start", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func send(router *gin.Engine, path string, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Key by IP", func(t *testing.T) {
+		router := newTestRouter(t, KeyByIP, nil)
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", nil).Code)
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1001", nil).Code)
+		w := send(router, "/token/getNew", "203.0.113.7:1002", nil)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.8:1000", nil).Code)
+		// Route groups without a limit are not limited
+		assert.Equal(t, http.StatusOK, send(router, "/rtmp/start", "203.0.113.7:1003", nil).Code)
+	})
+
+	t.Run("Key by API key", func(t *testing.T) {
+		router := newTestRouter(t, KeyByAPIKey, nil)
+		for i := 0; i < 2; i++ {
+			send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "key-a"})
+		}
+		assert.Equal(t, http.StatusTooManyRequests, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "key-a"}).Code)
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "key-b"}).Code)
+	})
+
+	t.Run("Unverified API keys are keyed by IP", func(t *testing.T) {
+		router := newTestRouter(t, KeyByAPIKey, nil)
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "random-1"}).Code)
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "random-2"}).Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "random-3"}).Code)
+		// Verified callers have their own bucket
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{"X-API-Key": "key-a"}).Code)
+	})
+
+	t.Run("Legacy token routes use the token limit", func(t *testing.T) {
+		router := newTestRouter(t, KeyByIP, nil)
+		for i := 0; i < 2; i++ {
+			send(router, "/token/getNew", "203.0.113.7:1000", nil)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rtc/test/publisher/uid/1", nil)
+		req.RemoteAddr = "203.0.113.7:1000"
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	})
+
+	t.Run("Key by tenant", func(t *testing.T) {
+		router := newTestRouter(t, KeyByTenant, nil)
+		for i := 0; i < 2; i++ {
+			send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{tenant_registry.TenantHeader: "video"})
+		}
+		assert.Equal(t, http.StatusTooManyRequests, send(router, "/token/getNew", "203.0.113.8:1000", map[string]string{tenant_registry.TenantHeader: "video"}).Code)
+		assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", map[string]string{tenant_registry.TenantHeader: "audio"}).Code)
+	})
+
+	t.Run("Store failure allows requests", func(t *testing.T) {
+		router := newTestRouter(t, KeyByIP, failingStore{})
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, send(router, "/token/getNew", "203.0.113.7:1000", nil).Code)
+		}
+	})
+}
@@ -1,24 +1,33 @@
 package real_time_transcription_service
 
 import (
+	"encoding/json"
 	"math/rand"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/cloud_recording_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
 	"github.com/gin-gonic/gin"
 )
 
 // RTTService struct holds all the necessary configurations and dependencies
 // required for managing real-time transcription services.
 type RTTService struct {
-	appID         string                                // Agora application ID to identify the application within Agora services.
-	baseURL       string                                // Base URL for the Agora cloud recording API where all API requests are sent.
-	basicAuth     string                                // Basic authentication credentials required for interacting with the Agora API.
-	tokenService  *token_service.TokenService           // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
-	storageConfig cloud_recording_service.StorageConfig // Configuration for storage options including directory structure and file naming.
+	appID                   string                                // Agora application ID to identify the application within Agora services.
+	baseURL                 string                                // Base URL for the Agora cloud recording API where all API requests are sent.
+	agoraClient             *agora_client.Client                  // Shared client used to send authenticated requests to the Agora API.
+	tokenService            *token_service.TokenService           // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
+	storageConfig           cloud_recording_service.StorageConfig // Default storage configuration, copied for each request.
+	allowedStorageOverrides []string                              // Storage fields that clients are allowed to override when starting a transcription.
+	tasks                   *taskRegistry                         // Running transcription tasks with their builder tokens.
+	uidDirectory            *uid_directory.Directory              // (Optional) directory that resolves user accounts in UID lists to integer UIDs.
 }
 
 // NewRTTService initializes a new instance of RTTService with the provided configurations.
@@ -27,25 +36,35 @@ type RTTService struct {
 // Parameters:
 //   - appID: The Agora application ID.
 //   - baseURL: Base URL for the API interactions.
-//   - basicAuth: Basic authentication credentials for the API.
+//   - agoraClient: Shared client used to send requests to the Agora API.
 //   - tokenService: Token service instance for generating tokens.
 //   - storageConfig: Storage configuration detailing file and directory naming conventions.
+//   - allowedStorageOverrides: Storage fields clients are allowed to override.
 //
 // Returns:
 //   - A pointer to the newly created RTTService.
-func NewRTTService(appID string, baseURL string, basicAuth string, tokenService *token_service.TokenService, storageConfig cloud_recording_service.StorageConfig) *RTTService {
+func NewRTTService(appID string, baseURL string, agoraClient *agora_client.Client, tokenService *token_service.TokenService, storageConfig cloud_recording_service.StorageConfig, allowedStorageOverrides []string) *RTTService {
 	rand.Seed(time.Now().UnixNano()) // Ensure varied randomness in the application operations.
 	return &RTTService{
-		appID:         appID,         // The Agora app ID used to identify the application within Agora services.
-		baseURL:       baseURL,       // The base URL for the Agora cloud recording API where all API requests are sent.
-		basicAuth:     basicAuth,     // Basic authentication credentials required for interacting with the Agora API.
-		tokenService:  tokenService,  // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
-		storageConfig: storageConfig, // Configuration for storage options including directory structure and file naming.
+		appID:                   appID,                   // The Agora app ID used to identify the application within Agora services.
+		baseURL:                 baseURL,                 // The base URL for the Agora cloud recording API where all API requests are sent.
+		agoraClient:             agoraClient,             // Shared client used to send authenticated requests to the Agora API.
+		tokenService:            tokenService,            // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
+		storageConfig:           storageConfig,           // Configuration for storage options including directory structure and file naming.
+		allowedStorageOverrides: allowedStorageOverrides, // Storage fields that clients are allowed to override when starting a transcription.
+		tasks:                   newTaskRegistry(),       // Running transcription tasks with their builder tokens.
 	}
 }
 
+// SetUIDDirectory sets the directory that resolves the user accounts in subscribeAudioUids to integer UIDs.
+// Without a directory the UIDs are sent to Agora unchanged.
+func (s *RTTService) SetUIDDirectory(directory *uid_directory.Directory) {
+	s.uidDirectory = directory
+}
+
 // RegisterRoutes sets up the API endpoints related to the real-time transcription service.
-// It creates a route group and registers individual routes for starting, stopping, and querying the transcription status.
+// It creates a route group and registers individual routes for starting, stopping, updating, and querying the transcription status.
+// Stop and status accept either a task ID in the path or a "channelName" query parameter.
 //
 // Parameters:
 //   - r: *gin.Engine - Gin engine instance to register routes.
@@ -55,7 +74,10 @@ func (s *RTTService) RegisterRoutes(r *gin.Engine) {
 	// routes
 	api.POST("/start", s.StartRTT)
 	api.DELETE("/stop", s.StopRTT)
+	api.DELETE("/stop/:taskId", s.StopRTT)
+	api.GET("/status", s.QueryRTT)
 	api.GET("/status/:taskId", s.QueryRTT)
+	api.PATCH("/update/:taskId", s.UpdateRTT)
 }
 
 // StartRTT handles the starting of the real-time transcription by binding JSON data from client requests,
@@ -64,22 +86,29 @@ func (s *RTTService) RegisterRoutes(r *gin.Engine) {
 // Parameters:
 //   - c: *gin.Context - Context instance containing HTTP request and response objects.
 func (s *RTTService) StartRTT(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientStartReq ClientStartRTTRequest
-	if err := c.ShouldBindJSON(&clientStartReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !request_validation.BindJSON(c, &clientStartReq) {
 		return
 	}
 
 	s.ValidateAndSetDefaults(&clientStartReq) // Validate client request and set default values.
 
+	// Replace the user accounts in the subscribed UIDs with their integer UIDs
+	subscribeAudioUIDs, err := s.uidDirectory.ResolveUids(tenant_registry.IDFromContext(c.Request.Context()), clientStartReq.ChannelName, clientStartReq.SubscribeAudioUIDs)
+	if err != nil {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Failed to resolve user accounts: "+err.Error())
+		return
+	}
+	clientStartReq.SubscribeAudioUIDs = subscribeAudioUIDs
+
 	// Acquire Builder Token
 	acquireReq := AcquireBuilderTokenRequest{
 		InstanceId: clientStartReq.ChannelName,
 	}
-	acquireResponse, builderToken, err := s.HandleAcquireBuilderTokenReq(acquireReq)
+	acquireResponse, builderToken, err := s.HandleAcquireBuilderTokenReq(c.Request.Context(), acquireReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acquire resource: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTT, "Failed to acquire resource", err)
 		return
 	}
 
@@ -92,9 +121,9 @@ func (s *RTTService) StartRTT(c *gin.Context) {
 		Channel:   clientStartReq.ChannelName,
 		Uid:       subscriberBotUid,
 	}
-	subscriberBotToken, err := s.tokenService.GenRtcToken(subscriberBotTokenRequest)
+	subscriberBotToken, err := s.tokenService.ForContext(c.Request.Context()).GenRtcToken(subscriberBotTokenRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		api_errors.Abort(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -104,9 +133,9 @@ func (s *RTTService) StartRTT(c *gin.Context) {
 		Channel:   clientStartReq.ChannelName,
 		Uid:       subscriberBotUid,
 	}
-	publisherBotToken, err := s.tokenService.GenRtcToken(publisherBotTokenRequest)
+	publisherBotToken, err := s.tokenService.ForContext(c.Request.Context()).GenRtcToken(publisherBotTokenRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		api_errors.Abort(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -130,27 +159,50 @@ func (s *RTTService) StartRTT(c *gin.Context) {
 
 	// If storage is in destinations list, add storage config
 	if clientStartReq.EnableStorage != nil && *clientStartReq.EnableStorage {
-		// Add dynamic directory structure ChannelName/YYYYMMDD/HHMMSS
+		// Build the storage config for this request, default to the dynamic directory structure ChannelName/YYYYMMDD/HHMMSS
 		currentTimeUTC := time.Now().UTC()
 		dateStr := currentTimeUTC.Format("20060102")
 		hrsMinSecStr := currentTimeUTC.Format("150405")
-		s.storageConfig.FileNamePrefix = &[]string{strings.ReplaceAll(clientStartReq.ChannelName, "-", ""), dateStr, hrsMinSecStr}
+		fileNamePrefix := []string{strings.ReplaceAll(clientStartReq.ChannelName, "-", ""), dateStr, hrsMinSecStr}
+		storageConfig, err := cloud_recording_service.BuildStorageConfig(cloud_recording_service.TenantStorageConfig(c.Request.Context(), s.storageConfig), clientStartReq.StorageConfig, s.allowedStorageOverrides, fileNamePrefix)
+		if err != nil {
+			api_errors.Abort(c, http.StatusBadRequest, err)
+			return
+		}
 
 		// Enable subtitle sync
 		if clientStartReq.EnableNTPtimestamp != nil && *clientStartReq.EnableNTPtimestamp {
-			s.storageConfig.ExtensionParams.EnableNTPtimestamp = clientStartReq.EnableNTPtimestamp
+			if storageConfig.ExtensionParams == nil {
+				storageConfig.ExtensionParams = &cloud_recording_service.ExtensionParams{}
+			}
+			storageConfig.ExtensionParams.EnableNTPtimestamp = clientStartReq.EnableNTPtimestamp
 		}
 		// set cloud storage in request
-		startRttRequest.CaptionConfig.Storage = s.storageConfig
+		startRttRequest.CaptionConfig = &CaptionConfig{Storage: storageConfig}
 	}
 
 	// Make the Start Request to Agora Endpoint
-	startResponse, err := s.HandleStartReq(startRttRequest, builderToken)
+	startResponse, err := s.HandleStartReq(c.Request.Context(), startRttRequest, builderToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transcription: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTT, "Failed to start transcription", err)
 		return
 	}
 
+	// Track the task so it can be stopped or queried without the client holding the builder token
+	var startedTask AgpraRTTResponse
+	if err := json.Unmarshal(startResponse, &startedTask); err == nil && startedTask.TaskId != "" {
+		now := time.Now()
+		s.tasks.save(RTTTask{
+			TaskId:                startedTask.TaskId,
+			InstanceId:            acquireReq.InstanceId,
+			ChannelName:           clientStartReq.ChannelName,
+			BuilderToken:          builderToken,
+			BuilderTokenCreatedAt: now,
+			CreatedAt:             now.UTC(),
+			TenantID:              tenant_registry.IDFromContext(c.Request.Context()),
+		})
+	}
+
 	// Return acquire and start responses
 	c.JSON(http.StatusOK, gin.H{
 		"acquire":   acquireResponse,
@@ -159,22 +211,41 @@ func (s *RTTService) StartRTT(c *gin.Context) {
 	})
 }
 
+// StopRTT handles stopping a real-time transcription task.
+// The task is identified by the taskId path parameter or the "channelName" query parameter,
+// the builder token is managed by the server and only needed for tasks it does not track.
+//
+// Parameters:
+//   - c: *gin.Context - Context instance containing HTTP request and response objects.
 func (s *RTTService) StopRTT(c *gin.Context) {
-	taskId := c.Param("taskId")
-	var stopReq struct {
-		BuilderToken string `json:"builderToken" binding:"required"`
+	// The request body is optional
+	var stopReq ClientStopRTTRequest
+	if !request_validation.BindOptionalJSON(c, &stopReq) {
+		return
+	}
+	if stopReq.ChannelName == "" {
+		stopReq.ChannelName = c.Query("channelName")
+	}
+	if stopReq.BuilderToken == "" {
+		stopReq.BuilderToken = c.Query("builderToken")
 	}
 
-	if err := c.ShouldBindJSON(&stopReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	taskId, builderToken, err := s.resolveTask(c.Request.Context(), c.Param("taskId"), stopReq.ChannelName, stopReq.BuilderToken)
+	if err != nil {
+		api_errors.Abort(c, taskErrorStatus(err), err)
 		return
 	}
 
-	stopResponse, err := s.HandleStopReq(taskId, stopReq.BuilderToken)
+	stopResponse, err := s.HandleStopReq(c.Request.Context(), taskId, builderToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop transcription: " + err.Error()})
+		// The task has already ended, so it is no longer running
+		if isTaskNotFound(err) {
+			s.tasks.remove(taskId)
+		}
+		api_errors.AbortUpstream(c, api_errors.ServiceRTT, "Failed to stop transcription", err)
 		return
 	}
+	s.tasks.remove(taskId)
 
 	c.JSON(http.StatusOK, gin.H{
 		"stop":      stopResponse,
@@ -182,21 +253,85 @@ func (s *RTTService) StopRTT(c *gin.Context) {
 	})
 }
 
-func (s *RTTService) QueryRTT(c *gin.Context) {
-	taskId := c.Param("taskId")
-	builderToken := c.Query("builderToken")
+// UpdateRTT handles updating the languages, translation settings and subscribed UIDs of a running transcription task.
+// The server sets the update mask from the fields in the request and manages the sequence ID for each tracked task,
+// the client supplies the sequence ID for tasks not tracked by the server.
+//
+// Parameters:
+//   - c: *gin.Context - Context instance containing HTTP request and response objects.
+func (s *RTTService) UpdateRTT(c *gin.Context) {
+	var clientUpdateReq ClientUpdateRTTRequest
+	if !request_validation.BindJSON(c, &clientUpdateReq) {
+		return
+	}
 
-	if builderToken == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "builderToken is required"})
+	// Build the update request and mask from the fields that are set
+	updateReq, updateMask, err := s.BuildUpdateRequest(clientUpdateReq)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
 		return
 	}
 
-	queryResponse, err := s.HandleQueryReq(taskId, builderToken)
+	taskId, builderToken, err := s.resolveTask(c.Request.Context(), c.Param("taskId"), "", clientUpdateReq.BuilderToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query transcription status: " + err.Error()})
+		api_errors.Abort(c, taskErrorStatus(err), err)
 		return
 	}
 
+	// Replace the user accounts in the subscribed UIDs with their integer UIDs in the task's channel
+	if updateReq.RTCConfig != nil {
+		task, _ := s.tasks.get(taskId)
+		subscribeAudioUIDs, err := s.uidDirectory.ResolveUids(tenant_registry.IDFromContext(c.Request.Context()), task.ChannelName, updateReq.RTCConfig.SubscribeAudioUIDs)
+		if err != nil {
+			api_errors.AbortMessage(c, http.StatusBadRequest, "Failed to resolve user accounts: "+err.Error())
+			return
+		}
+		updateReq.RTCConfig.SubscribeAudioUIDs = subscribeAudioUIDs
+	}
+
+	sequenceId, err := s.tasks.nextSequenceId(taskId)
+	if err != nil {
+		if clientUpdateReq.SequenceId == 0 {
+			api_errors.AbortMessage(c, http.StatusBadRequest, "sequenceId is required for tasks not tracked by the server")
+			return
+		}
+		sequenceId = clientUpdateReq.SequenceId
+	}
+
+	updateResponse, err := s.HandleUpdateReq(c.Request.Context(), taskId, builderToken, sequenceId, updateMask, updateReq)
+	if err != nil {
+		api_errors.AbortUpstream(c, api_errors.ServiceRTT, "Failed to update transcription", err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", updateResponse)
+}
+
+// QueryRTT handles querying the status of a real-time transcription task.
+// The task is identified by the taskId path parameter or the "channelName" query parameter.
+//
+// Parameters:
+//   - c: *gin.Context - Context instance containing HTTP request and response objects.
+func (s *RTTService) QueryRTT(c *gin.Context) {
+	taskId, builderToken, err := s.resolveTask(c.Request.Context(), c.Param("taskId"), c.Query("channelName"), c.Query("builderToken"))
+	if err != nil {
+		api_errors.Abort(c, taskErrorStatus(err), err)
+		return
+	}
+
+	queryResponse, err := s.HandleQueryReq(c.Request.Context(), taskId, builderToken)
+	if err != nil {
+		if isTaskNotFound(err) {
+			s.tasks.remove(taskId)
+		}
+		api_errors.AbortUpstream(c, api_errors.ServiceRTT, "Failed to query transcription status", err)
+		return
+	}
+	// Stop tracking tasks that have ended, so the channel can be used by the next task
+	if taskEnded(queryResponse) {
+		s.tasks.remove(taskId)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"query":     queryResponse,
 		"timestamp": time.Now().UTC(),
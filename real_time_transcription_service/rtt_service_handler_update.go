@@ -0,0 +1,63 @@
+package real_time_transcription_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+)
+
+// HandleUpdateReq sends an update for a running real-time transcription task to the Agora RTT API.
+//
+// Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled if the client's request ends.
+//   - taskId: string - The ID of the transcription task to update.
+//   - builderToken: string - A valid builder token for the task.
+//   - sequenceId: int - The sequence number of the update, must be larger than the sequence of any previous update.
+//   - updateMask: string - Comma separated list of the fields to update.
+//   - updateReq: UpdateRTTRequest - The new values for the fields in the update mask.
+//
+// Returns:
+//   - json.RawMessage: The JSON response from the Agora RTT API with a timestamp appended.
+//   - error: Error object detailing any issues encountered during the API call.
+//
+// Behavior:
+//   - Constructs the URL with the builder token, sequence ID and update mask as query parameters.
+//   - Utilizes s.agoraClient.MakeRequest to perform the PATCH operation with the constructed URL and the update request.
+//   - Interprets the API's JSON response and appends a timestamp before returning it.
+//
+// Notes:
+//   - Assumes the availability of s.baseURL for constructing the request URL.
+func (s *RTTService) HandleUpdateReq(ctx context.Context, taskId string, builderToken string, sequenceId int, updateMask string, updateReq UpdateRTTRequest) (json.RawMessage, error) {
+
+	// Construct the URL for the PATCH request to update the task.
+	query := url.Values{}
+	query.Set("builderToken", builderToken)
+	query.Set("sequenceId", strconv.Itoa(sequenceId))
+	query.Set("updateMask", updateMask)
+	url := fmt.Sprintf("%s/tasks/%s?%s", tenant_registry.URLFor(ctx, s.baseURL, s.appID), taskId, query.Encode())
+
+	// Send the PATCH request to the Agora RTT API.
+	body, err := tenant_registry.AgoraClientFor(ctx, s.agoraClient).MakeRequest(ctx, "PATCH", url, updateReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body into a struct to validate the response
+	var response AgpraRTTResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	// Append a timestamp to the Agora response for auditing and record-keeping purposes.
+	timestampBody, err := s.AddTimestamp(&response)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding timestamped response: %v", err)
+	}
+
+	return timestampBody, nil
+}
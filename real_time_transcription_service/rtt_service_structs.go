@@ -5,16 +5,45 @@ import "github.com/AgoraIO-Community/agora-go-backend-middleware/cloud_recording
 // ClientStartRTTRequest represents the JSON payload structure sent by the client to start real time transcription.
 // It includes the instance ID ,
 type ClientStartRTTRequest struct {
-	ChannelName        string           `json:"channelName"`            // The name of the channel to transcribe
-	Languages          []string         `json:"languages"`              // The language(s) to transcribe
-	SubscribeAudioUIDs []string         `json:"subscribeAudioUids"`     // A list of UID's to subscribe to in the channel. Max 3
-	CryptionMode       *string          `json:"cryptionMode,omitempty"` // Cryption mode (Optional, if need cryption for audio and caption text)
-	Secret             *string          `json:"secret,omitempty"`       // Cryption secret (Optional, if need decryption for audio and caption text)
-	Salt               *string          `json:"salt,omitempty"`         // Cryption salt (Optional, if need decryption for audio and caption text)forceTranslateInterval.languages
-	MaxIdleTime        *int             `json:"maxIdleTime,omitempty"`  // The default is 30 seconds. The unit is seconds, Range 5 seconds - 2592000 seconds (30 days)
-	TranslateConfig    *TranslateConfig `json:"translateConfig,omitempty"`
-	EnableStorage      *bool            `json:"enableStorage,omitempty"`      // Use to enable storage of captions
-	EnableNTPtimestamp *bool            `json:"enableNTPtimestamp,omitempty"` // Use to enable subtitle sync
+	ChannelName        string                                       `json:"channelName"`                           // The name of the channel to transcribe
+	Languages          []string                                     `json:"languages"`                             // The language(s) to transcribe
+	SubscribeAudioUIDs []string                                     `json:"subscribeAudioUids" openapi:"optional"` // A list of UID's to subscribe to in the channel. Max 3
+	CryptionMode       *string                                      `json:"cryptionMode,omitempty"`                // Cryption mode (Optional, if need cryption for audio and caption text)
+	Secret             *string                                      `json:"secret,omitempty"`                      // Cryption secret (Optional, if need decryption for audio and caption text)
+	Salt               *string                                      `json:"salt,omitempty"`                        // Cryption salt (Optional, if need decryption for audio and caption text)forceTranslateInterval.languages
+	MaxIdleTime        *int                                         `json:"maxIdleTime,omitempty"`                 // The default is 30 seconds. The unit is seconds, Range 5 seconds - 2592000 seconds (30 days)
+	TranslateConfig    *TranslateConfig                             `json:"translateConfig,omitempty"`
+	EnableStorage      *bool                                        `json:"enableStorage,omitempty"`      // Use to enable storage of captions
+	EnableNTPtimestamp *bool                                        `json:"enableNTPtimestamp,omitempty"` // Use to enable subtitle sync
+	StorageConfig      *cloud_recording_service.ClientStorageConfig `json:"storageConfig,omitempty"`      // (Optional) overrides for the default storage configuration
+}
+
+// ClientUpdateRTTRequest represents the JSON payload structure sent by the client to update a running transcription task.
+// Only the fields that are set are updated.
+type ClientUpdateRTTRequest struct {
+	Languages          []string         `json:"languages,omitempty"`          // (Optional) the new language(s) to transcribe
+	SubscribeAudioUIDs []string         `json:"subscribeAudioUids,omitempty"` // (Optional) the new list of UID's to subscribe to. Max 3
+	TranslateConfig    *TranslateConfig `json:"translateConfig,omitempty"`    // (Optional) the new settings for real-time translation
+	BuilderToken       string           `json:"builderToken,omitempty"`       // (Optional) builder token, only needed for tasks not tracked by the server
+	SequenceId         int              `json:"sequenceId,omitempty"`         // (Optional) sequence ID of the update, only needed for tasks not tracked by the server
+}
+
+// ClientStopRTTRequest represents the optional JSON payload structure sent by the client to stop a transcription task.
+type ClientStopRTTRequest struct {
+	BuilderToken string `json:"builderToken" openapi:"optional"` // (Optional) builder token for tasks not tracked by the server
+	ChannelName  string `json:"channelName" openapi:"optional"`  // (Optional) channel name used to find the task
+}
+
+// UpdateRTTRequest defines the body of an update request sent to the Agora RTT API.
+type UpdateRTTRequest struct {
+	Languages       []string         `json:"languages,omitempty"`       // The language(s) to transcribe
+	RTCConfig       *UpdateRTCConfig `json:"rtcConfig,omitempty"`       // The updated RTC settings
+	TranslateConfig *TranslateConfig `json:"translateConfig,omitempty"` // The settings for real-time translation
+}
+
+// UpdateRTCConfig contains the RTC settings that can be updated on a running task.
+type UpdateRTCConfig struct {
+	SubscribeAudioUIDs []string `json:"subscribeAudioUids"` // A list of UID's to subscribe to in the channel. Max 3
 }
 
 // AcquireBuilderTokenRequest defines the structure for a request to acquire a builder token for real time transcription
@@ -89,6 +118,12 @@ func (s *AgpraRTTResponse) SetTimestamp(timestamp string) {
 	s.Timestamp = &timestamp
 }
 
+// Statuses of a task that has ended, as reported by Agora in AgpraRTTResponse.Status.
+const (
+	TaskStatusStopped = "STOPPED" // The task was stopped.
+	TaskStatusFailure = "FAILURE" // The task failed.
+)
+
 // StopRTTResponse represents the response received from the Agora server after successfully starting a recording.
 // It includes the identifiers of the recording session along with an optional timestamp.
 type StopRTTResponse struct {
@@ -0,0 +1,136 @@
+package real_time_transcription_service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	builderTokenTTL           = 5 * time.Minute  // Builder tokens are valid for 5 minutes after they are acquired.
+	builderTokenRefreshMargin = 30 * time.Second // Refresh the builder token this long before it expires.
+	maxTaskAge                = 24 * time.Hour   // Tasks are no longer tracked this long after they started, e.g. when they ended on their own.
+)
+
+// ErrTaskNotFound is returned when no tracked transcription task matches the given task ID or channel.
+var ErrTaskNotFound = errors.New("transcription task not found")
+
+// ErrAmbiguousTask is returned when a channel has more than one tracked transcription task,
+// in which case the client must identify the task using its task ID.
+var ErrAmbiguousTask = errors.New("multiple transcription tasks for channel, use taskId")
+
+// RTTTask holds the server-side state of a started real-time transcription task.
+type RTTTask struct {
+	TaskId                string    `json:"taskId"`             // The task ID returned by Agora when the task started.
+	InstanceId            string    `json:"instanceId"`         // The instance ID used to acquire the builder token.
+	ChannelName           string    `json:"channelName"`        // The channel being transcribed.
+	BuilderToken          string    `json:"-"`                  // The most recent builder token for the task.
+	BuilderTokenCreatedAt time.Time `json:"-"`                  // When the builder token was acquired.
+	CreatedAt             time.Time `json:"createdAt"`          // When the task was started.
+	TenantID              string    `json:"tenantId,omitempty"` // (Optional) the tenant that started the task.
+}
+
+// builderTokenExpired checks if the task's builder token is expired or about to expire.
+func (t RTTTask) builderTokenExpired(now time.Time) bool {
+	return t.BuilderToken == "" || now.Sub(t.BuilderTokenCreatedAt) >= builderTokenTTL-builderTokenRefreshMargin
+}
+
+// taskRegistry keeps track of the running transcription tasks, keyed by task ID.
+type taskRegistry struct {
+	mu          sync.RWMutex
+	tasks       map[string]RTTTask
+	sequenceIds map[string]int // Last update sequence ID used for each task
+}
+
+// newTaskRegistry returns an empty task registry.
+func newTaskRegistry() *taskRegistry {
+	return &taskRegistry{tasks: make(map[string]RTTTask), sequenceIds: make(map[string]int)}
+}
+
+// nextSequenceId returns the sequence ID for the next update of a tracked task, or ErrTaskNotFound if the task is not tracked.
+// Sequence IDs start at 1 and increase with every call, including updates that fail.
+func (r *taskRegistry) nextSequenceId(taskId string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tasks[taskId]; !ok {
+		return 0, ErrTaskNotFound
+	}
+	r.sequenceIds[taskId]++
+	return r.sequenceIds[taskId], nil
+}
+
+// save adds or replaces a task, and removes the tasks older than maxTaskAge.
+func (r *taskRegistry) save(task RTTTask) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks[task.TaskId] = task
+	r.expire(time.Now())
+}
+
+// expire removes the tasks that started more than maxTaskAge before now. Must be called with r.mu held.
+// Tasks that end on their own, e.g. after maxIdleTime, are never stopped through the server, so they are dropped once they are this old.
+func (r *taskRegistry) expire(now time.Time) {
+	for taskId, task := range r.tasks {
+		if now.Sub(task.CreatedAt) > maxTaskAge {
+			delete(r.tasks, taskId)
+			delete(r.sequenceIds, taskId)
+		}
+	}
+}
+
+// get returns the task with the given task ID.
+func (r *taskRegistry) get(taskId string) (RTTTask, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	task, ok := r.tasks[taskId]
+	if !ok {
+		return RTTTask{}, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+// findByChannel returns the only task of the tenant for the given channel, "" for tasks started without a tenant.
+func (r *taskRegistry) findByChannel(channelName string, tenantID string) (RTTTask, error) {
+	tasks := r.listByChannel(channelName, tenantID)
+	switch len(tasks) {
+	case 0:
+		return RTTTask{}, ErrTaskNotFound
+	case 1:
+		return tasks[0], nil
+	default:
+		return RTTTask{}, ErrAmbiguousTask
+	}
+}
+
+// listByChannel returns the tasks of the tenant for the given channel, "" for tasks started without a tenant.
+func (r *taskRegistry) listByChannel(channelName string, tenantID string) []RTTTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(time.Now())
+	var tasks []RTTTask
+	for _, task := range r.tasks {
+		if task.ChannelName == channelName && task.TenantID == tenantID {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// updateBuilderToken stores a new builder token for a task if the task is still tracked.
+func (r *taskRegistry) updateBuilderToken(taskId string, builderToken string, createdAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if task, ok := r.tasks[taskId]; ok {
+		task.BuilderToken = builderToken
+		task.BuilderTokenCreatedAt = createdAt
+		r.tasks[taskId] = task
+	}
+}
+
+// remove deletes the task with the given task ID.
+func (r *taskRegistry) remove(taskId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tasks, taskId)
+	delete(r.sequenceIds, taskId)
+}
@@ -2,12 +2,17 @@ package real_time_transcription_service
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/cloud_recording_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -299,3 +304,364 @@ func TestAddTimestamp(t *testing.T) {
 		t.Errorf("Timestamp is not recent: %v", *updatedResponse.Timestamp)
 	}
 }
+
+func TestStartRTTParallelStorageConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora RTT API, capturing the caption storage config sent for each channel
+	var mu sync.Mutex
+	startedStorage := make(map[string]*CaptionConfig)
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/builderTokens") {
+			w.Write([]byte(`{"tokenName":"test_builder_token","createTs":1609459200,"instanceId":"test"}`))
+			return
+		}
+		var startReq StartRTTRequest
+		if err := json.NewDecoder(r.Body).Decode(&startReq); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		startedStorage[startReq.RTCConfig.ChannelName] = startReq.CaptionConfig
+		mu.Unlock()
+		w.Write([]byte(`{"createTs":1609459200,"status":"STARTED","taskId":"test_task_id"}`))
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	defaults := cloud_recording_service.StorageConfig{Vendor: 1, Bucket: "default-bucket", AccessKey: "key", SecretKey: "secret"}
+	service := NewRTTService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, defaults, []string{cloud_recording_service.StorageOverrideExtensionParams})
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	const starts = 20
+	var wg sync.WaitGroup
+	for i := 0; i < starts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"channelName":"channel%d","languages":["en-US"],"enableStorage":true,"enableNTPtimestamp":true}`, i)
+			if i%2 == 0 {
+				body = fmt.Sprintf(`{"channelName":"channel%d","languages":["en-US"],"enableStorage":true,"storageConfig":{"extensionParams":{"tag":"tag%d"}}}`, i, i)
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/rtt/start", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, startedStorage, starts)
+	for i := 0; i < starts; i++ {
+		channel := fmt.Sprintf("channel%d", i)
+		captionConfig := startedStorage[channel]
+		if !assert.NotNil(t, captionConfig) {
+			continue
+		}
+		storage := captionConfig.Storage
+		assert.Equal(t, channel, (*storage.FileNamePrefix)[0])
+		if i%2 == 0 {
+			assert.Equal(t, fmt.Sprintf("tag%d", i), *storage.ExtensionParams.Tag)
+			assert.Nil(t, storage.ExtensionParams.EnableNTPtimestamp)
+		} else {
+			assert.True(t, *storage.ExtensionParams.EnableNTPtimestamp)
+		}
+	}
+
+	// The shared defaults are never modified
+	assert.Nil(t, service.storageConfig.FileNamePrefix)
+	assert.Nil(t, service.storageConfig.ExtensionParams)
+}
+
+func TestRTTTaskTracking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora RTT API, issuing a new builder token on every acquire
+	var mu sync.Mutex
+	acquired := 0
+	var usedTokens []string
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/builderTokens") {
+			acquired++
+			w.Write([]byte(fmt.Sprintf(`{"tokenName":"builder_token_%d","createTs":1609459200,"instanceId":"test"}`, acquired)))
+			return
+		}
+		usedTokens = append(usedTokens, r.URL.Query().Get("builderToken"))
+		switch r.Method {
+		case "POST":
+			w.Write([]byte(`{"createTs":1609459200,"status":"STARTED","taskId":"test_task_id"}`))
+		case "GET":
+			w.Write([]byte(`{"createTs":1609459200,"status":"IN_PROGRESS","taskId":"test_task_id"}`))
+		case "DELETE":
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	service := NewRTTService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, cloud_recording_service.StorageConfig{}, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("POST", "/rtt/start", `{"channelName":"test","languages":["en-US"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Query by channel name uses the stored builder token
+	w = serve("GET", "/rtt/status?channelName=test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "builder_token_1", usedTokens[len(usedTokens)-1])
+
+	// An expired builder token is re-acquired
+	task, err := service.tasks.get("test_task_id")
+	assert.NoError(t, err)
+	task.BuilderTokenCreatedAt = time.Now().Add(-builderTokenTTL)
+	service.tasks.save(task)
+	w = serve("GET", "/rtt/status/test_task_id", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "builder_token_2", usedTokens[len(usedTokens)-1])
+
+	// Unknown tasks need the client's builder token
+	w = serve("GET", "/rtt/status/other_task_id", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("GET", "/rtt/status/other_task_id?builderToken=client_token", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client_token", usedTokens[len(usedTokens)-1])
+
+	// Missing identifiers
+	w = serve("GET", "/rtt/status", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Stop by task ID without a body, the task is no longer tracked afterwards
+	w = serve("DELETE", "/rtt/stop/test_task_id", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "builder_token_2", usedTokens[len(usedTokens)-1])
+	w = serve("DELETE", "/rtt/stop?channelName=test", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRTTTaskEviction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora RTT API, starting a new task on every start and answering with the status of each task
+	var mu sync.Mutex
+	statuses := make(map[string]string)
+	started := 0
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/builderTokens") {
+			w.Write([]byte(`{"tokenName":"test_builder_token","createTs":1609459200,"instanceId":"test"}`))
+			return
+		}
+		if r.Method == "POST" {
+			started++
+			taskId := fmt.Sprintf("task_%d", started)
+			statuses[taskId] = "IN_PROGRESS"
+			w.Write([]byte(fmt.Sprintf(`{"createTs":1609459200,"status":"STARTED","taskId":%q}`, taskId)))
+			return
+		}
+		taskId := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		status, ok := statuses[taskId]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"task not found"}`))
+			return
+		}
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(fmt.Sprintf(`{"createTs":1609459200,"status":%q,"taskId":%q}`, status, taskId)))
+		case "DELETE":
+			delete(statuses, taskId)
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	service := NewRTTService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, cloud_recording_service.StorageConfig{}, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	setStatus := func(taskId, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status == "" {
+			delete(statuses, taskId)
+			return
+		}
+		statuses[taskId] = status
+	}
+
+	for i := 0; i < 3; i++ {
+		w := serve("POST", "/rtt/start", `{"channelName":"test","languages":["en-US"]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// Tasks that ended on their own don't make the channel ambiguous
+	setStatus("task_1", "STOPPED")
+	setStatus("task_2", "")
+	w := serve("GET", "/rtt/status?channelName=test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"taskId":"task_3"`)
+	assert.Len(t, service.tasks.listByChannel("test", ""), 1)
+
+	// Both running tasks are returned while they are running
+	w = serve("POST", "/rtt/start", `{"channelName":"test","languages":["en-US"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("GET", "/rtt/status?channelName=test", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// A query that reports the task as stopped evicts it
+	setStatus("task_4", "FAILURE")
+	w = serve("GET", "/rtt/status/task_4", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err := service.tasks.get("task_4")
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+
+	// A stop that Agora answers with not found evicts the task
+	setStatus("task_3", "")
+	w = serve("DELETE", "/rtt/stop?channelName=test", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	_, err = service.tasks.get("task_3")
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+
+	// Tasks older than maxTaskAge are expired
+	service.tasks.save(RTTTask{TaskId: "old_task", ChannelName: "old", CreatedAt: time.Now().Add(-maxTaskAge - time.Minute)})
+	_, err = service.tasks.findByChannel("old", "")
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+}
+
+func TestUpdateRTT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Mock Agora RTT API, capturing the update requests
+	var mu sync.Mutex
+	var updateQueries []map[string]string
+	var updateBodies []UpdateRTTRequest
+	agoraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/builderTokens"):
+			w.Write([]byte(`{"tokenName":"test_builder_token","createTs":1609459200,"instanceId":"test"}`))
+		case r.Method == "POST":
+			w.Write([]byte(`{"createTs":1609459200,"status":"STARTED","taskId":"test_task_id"}`))
+		case r.Method == "PATCH":
+			query := r.URL.Query()
+			updateQueries = append(updateQueries, map[string]string{
+				"builderToken": query.Get("builderToken"),
+				"sequenceId":   query.Get("sequenceId"),
+				"updateMask":   query.Get("updateMask"),
+			})
+			var updateReq UpdateRTTRequest
+			json.NewDecoder(r.Body).Decode(&updateReq)
+			updateBodies = append(updateBodies, updateReq)
+			w.Write([]byte(`{"createTs":1609459200,"status":"IN_PROGRESS","taskId":"test_task_id"}`))
+		}
+	}))
+	defer agoraServer.Close()
+
+	tokenService := token_service.NewTokenService("6ce46dd303d54056a52f9a34c13c547e", "77be7e16f7482cef9fe796205b85831e")
+	service := NewRTTService("test_app_id", agoraServer.URL, agora_client.NewClient("Basic test"), tokenService, cloud_recording_service.StorageConfig{}, nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("POST", "/rtt/start", `{"channelName":"test","languages":["en-US"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Change languages
+	w = serve("PATCH", "/rtt/update/test_task_id", `{"languages":["es-ES"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response AgpraRTTResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "test_task_id", response.TaskId)
+	assert.NotNil(t, response.Timestamp)
+
+	// Change translation and subscribed UIDs
+	w = serve("PATCH", "/rtt/update/test_task_id", `{"subscribeAudioUids":["123"],"translateConfig":{"forceTranslateInterval":2,"languages":[{"source":"en-US","target":["fr-FR"]}]}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	if assert.Len(t, updateQueries, 2) {
+		assert.Equal(t, "test_builder_token", updateQueries[0]["builderToken"])
+		assert.Equal(t, "1", updateQueries[0]["sequenceId"])
+		assert.Equal(t, "languages", updateQueries[0]["updateMask"])
+		assert.Equal(t, []string{"es-ES"}, updateBodies[0].Languages)
+		assert.Equal(t, "2", updateQueries[1]["sequenceId"])
+		assert.Equal(t, "rtcConfig.subscribeAudioUids,translateConfig.forceTranslateInterval,translateConfig.languages", updateQueries[1]["updateMask"])
+		assert.Equal(t, []string{"123"}, updateBodies[1].RTCConfig.SubscribeAudioUIDs)
+		assert.Equal(t, "fr-FR", updateBodies[1].TranslateConfig.Languages[0].Target[0])
+	}
+
+	// Empty update
+	w = serve("PATCH", "/rtt/update/test_task_id", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Too many subscribed UIDs
+	w = serve("PATCH", "/rtt/update/test_task_id", `{"subscribeAudioUids":["1","2","3","4"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Translation without a target language
+	w = serve("PATCH", "/rtt/update/test_task_id", `{"translateConfig":{"languages":[{"source":"en-US","target":[]}]}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"translateConfig.languages[0].target"`)
+
+	// Misspelled field
+	w = serve("PATCH", "/rtt/update/test_task_id", `{"langauges":["es-ES"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"langauges"`)
+
+	// Start without languages or with an invalid channel name
+	w = serve("POST", "/rtt/start", `{"channelName":"test"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve("POST", "/rtt/start", `{"channelName":"test/channel","languages":["en-US"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Unknown task without a builder token
+	w = serve("PATCH", "/rtt/update/other_task_id", `{"languages":["es-ES"]}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Unknown tasks use the client's sequence ID and get no tracked sequence ID
+	w = serve("PATCH", "/rtt/update/other_task_id", `{"languages":["es-ES"],"builderToken":"client_token"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve("PATCH", "/rtt/update/other_task_id", `{"languages":["es-ES"],"builderToken":"client_token","sequenceId":-1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve("PATCH", "/rtt/update/other_task_id", `{"languages":["es-ES"],"builderToken":"client_token","sequenceId":7}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Len(t, updateQueries, 3) {
+		assert.Equal(t, "client_token", updateQueries[2]["builderToken"])
+		assert.Equal(t, "7", updateQueries[2]["sequenceId"])
+	}
+	_, tracked := service.tasks.sequenceIds["other_task_id"]
+	assert.False(t, tracked)
+}
@@ -1,11 +1,18 @@
 package real_time_transcription_service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // AddTimestamp adds a current timestamp to any response object that supports the Timestampable interface.
@@ -58,3 +65,137 @@ func (s *RTTService) ValidateAndSetDefaults(clientStartReq *ClientStartRTTReques
 		clientStartReq.MaxIdleTime = &defaultMaxIdleTime
 	}
 }
+
+// BuildUpdateRequest converts a client update request into the Agora update request and its update mask.
+// It returns an error if the request does not update any field or sets an invalid value.
+func (s *RTTService) BuildUpdateRequest(clientUpdateReq ClientUpdateRTTRequest) (UpdateRTTRequest, string, error) {
+	var updateReq UpdateRTTRequest
+	var updateMask []string
+
+	if clientUpdateReq.Languages != nil {
+		if len(clientUpdateReq.Languages) == 0 {
+			return UpdateRTTRequest{}, "", errors.New("languages cannot be empty")
+		}
+		updateReq.Languages = clientUpdateReq.Languages
+		updateMask = append(updateMask, "languages")
+	}
+	if clientUpdateReq.SubscribeAudioUIDs != nil {
+		if len(clientUpdateReq.SubscribeAudioUIDs) > 3 {
+			return UpdateRTTRequest{}, "", errors.New("subscribeAudioUids can contain at most 3 UIDs")
+		}
+		updateReq.RTCConfig = &UpdateRTCConfig{SubscribeAudioUIDs: clientUpdateReq.SubscribeAudioUIDs}
+		updateMask = append(updateMask, "rtcConfig.subscribeAudioUids")
+	}
+	if clientUpdateReq.TranslateConfig != nil {
+		updateReq.TranslateConfig = clientUpdateReq.TranslateConfig
+		updateMask = append(updateMask, "translateConfig.forceTranslateInterval", "translateConfig.languages")
+	}
+
+	if len(updateMask) == 0 {
+		return UpdateRTTRequest{}, "", errors.New("at least one of languages, subscribeAudioUids or translateConfig is required")
+	}
+	return updateReq, strings.Join(updateMask, ","), nil
+}
+
+// errMissingTaskIdentifiers is returned when a request does not identify a transcription task.
+var errMissingTaskIdentifiers = errors.New("taskId or channelName is required")
+
+// resolveTask finds the tracked task by task ID or channel name and returns the task ID with a valid builder token.
+// When the task is not tracked by this server, the builder token supplied by the client is used.
+// Only the tasks of the request's tenant are matched.
+func (s *RTTService) resolveTask(ctx context.Context, taskId string, channelName string, builderToken string) (string, string, error) {
+	tenantID := tenant_registry.IDFromContext(ctx)
+	var task RTTTask
+	var err error
+	switch {
+	case taskId != "":
+		task, err = s.tasks.get(taskId)
+		if err == nil && task.TenantID != tenantID {
+			task, err = RTTTask{}, ErrTaskNotFound
+		}
+	case channelName != "":
+		task, err = s.tasks.findByChannel(channelName, tenantID)
+		if errors.Is(err, ErrAmbiguousTask) {
+			// Tasks that ended on their own are still tracked, drop them and try again
+			s.removeEndedTasks(ctx, channelName, tenantID)
+			task, err = s.tasks.findByChannel(channelName, tenantID)
+		}
+	default:
+		return "", "", errMissingTaskIdentifiers
+	}
+	if err != nil {
+		// Fall back to the client's builder token for tasks that are not tracked, e.g. started before a restart
+		if errors.Is(err, ErrTaskNotFound) && taskId != "" && builderToken != "" {
+			return taskId, builderToken, nil
+		}
+		return "", "", err
+	}
+
+	token, err := s.builderTokenFor(ctx, task)
+	if err != nil {
+		return "", "", err
+	}
+	return task.TaskId, token, nil
+}
+
+// builderTokenFor returns the stored builder token for a task, acquiring a new one if the stored token has expired.
+func (s *RTTService) builderTokenFor(ctx context.Context, task RTTTask) (string, error) {
+	if !task.builderTokenExpired(time.Now()) {
+		return task.BuilderToken, nil
+	}
+
+	_, builderToken, err := s.HandleAcquireBuilderTokenReq(ctx, AcquireBuilderTokenRequest{InstanceId: task.InstanceId})
+	if err != nil {
+		return "", fmt.Errorf("error refreshing builder token: %v", err)
+	}
+	s.tasks.updateBuilderToken(task.TaskId, builderToken, time.Now())
+	return builderToken, nil
+}
+
+// taskErrorStatus maps a task lookup error to the HTTP status code returned to the client.
+func taskErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errMissingTaskIdentifiers):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAmbiguousTask):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// removeEndedTasks queries the status of the tracked tasks of a channel and stops tracking the tasks that have ended,
+// i.e. Agora no longer knows the task or reports it as stopped or failed. Tasks whose status can't be queried are kept.
+func (s *RTTService) removeEndedTasks(ctx context.Context, channelName string, tenantID string) {
+	for _, task := range s.tasks.listByChannel(channelName, tenantID) {
+		builderToken, err := s.builderTokenFor(ctx, task)
+		if err != nil {
+			continue
+		}
+		response, err := s.HandleQueryReq(ctx, task.TaskId, builderToken)
+		if isTaskNotFound(err) || (err == nil && taskEnded(response)) {
+			s.tasks.remove(task.TaskId)
+		}
+	}
+}
+
+// isTaskNotFound reports whether an error returned by the Agora client is Agora's "task not found" error,
+// e.g. for a task that ended after maxIdleTime. Agora signals this with an HTTP 404 status, or with a 404 code in the response body.
+func isTaskNotFound(err error) bool {
+	apiErr, ok := agora_client.AsAPIError(err)
+	if !ok {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.Code == http.StatusNotFound
+}
+
+// taskEnded reports whether a query response reports a task that has stopped or failed.
+func taskEnded(queryResponse json.RawMessage) bool {
+	var response AgpraRTTResponse
+	if err := json.Unmarshal(queryResponse, &response); err != nil {
+		return false
+	}
+	return response.Status == TaskStatusStopped || response.Status == TaskStatusFailure
+}
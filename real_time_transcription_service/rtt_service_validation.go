@@ -0,0 +1,63 @@
+package real_time_transcription_service
+
+import (
+	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+)
+
+// maxSubscribeAudioUIDs is the maximum number of UIDs a transcription task can subscribe to.
+const maxSubscribeAudioUIDs = 3
+
+// Validate checks the channel name, languages and subscribed UIDs of a start request.
+// The max idle time is not checked, out of range values are replaced by the default, see ValidateAndSetDefaults.
+func (r *ClientStartRTTRequest) Validate(errs *request_validation.Errors) {
+	errs.ChannelName("channelName", r.ChannelName)
+	validateLanguages(errs, "languages", r.Languages)
+	errs.MaxItems("subscribeAudioUids", len(r.SubscribeAudioUIDs), maxSubscribeAudioUIDs)
+	if r.TranslateConfig != nil {
+		validateTranslateConfig(errs, r.TranslateConfig)
+	}
+}
+
+// Validate checks the fields set in an update request, see BuildUpdateRequest, and the client's sequence ID.
+func (r *ClientUpdateRTTRequest) Validate(errs *request_validation.Errors) {
+	if r.Languages != nil {
+		validateLanguages(errs, "languages", r.Languages)
+	}
+	errs.MaxItems("subscribeAudioUids", len(r.SubscribeAudioUIDs), maxSubscribeAudioUIDs)
+	if r.TranslateConfig != nil {
+		validateTranslateConfig(errs, r.TranslateConfig)
+	}
+	if r.SequenceId < 0 {
+		errs.Add("sequenceId", "must not be negative")
+	}
+}
+
+// Validate checks the channel name of a stop request, if it is set.
+func (r *ClientStopRTTRequest) Validate(errs *request_validation.Errors) {
+	if r.ChannelName != "" {
+		errs.ChannelName("channelName", r.ChannelName)
+	}
+}
+
+// validateLanguages checks that a list of languages is not empty and has no empty language codes.
+func validateLanguages(errs *request_validation.Errors, field string, languages []string) {
+	if len(languages) == 0 {
+		errs.Add(field, "must have at least one language")
+	}
+	for i, language := range languages {
+		errs.Required(fmt.Sprintf("%s[%d]", field, i), language)
+	}
+}
+
+// validateTranslateConfig checks that each translation has a source and at least one target language.
+func validateTranslateConfig(errs *request_validation.Errors, config *TranslateConfig) {
+	if len(config.Languages) == 0 {
+		errs.Add("translateConfig.languages", "must have at least one translation")
+	}
+	for i, language := range config.Languages {
+		errs.Required(fmt.Sprintf("translateConfig.languages[%d].source", i), language.Source)
+		validateLanguages(errs, fmt.Sprintf("translateConfig.languages[%d].target", i), language.Target)
+	}
+}
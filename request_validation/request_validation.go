@@ -0,0 +1,181 @@
+package request_validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+)
+
+// MaxChannelNameLength is the maximum length of an Agora channel name, in bytes.
+const MaxChannelNameLength = 64
+
+// channelNameSymbols are the characters other than ASCII letters and digits allowed in an Agora channel name.
+const channelNameSymbols = " !#$%&()+-:;<=.>?@[]^_{}|~,"
+
+// maxBodySize is the maximum size of a request body, larger bodies are rejected.
+const maxBodySize = 1 << 20
+
+// Validatable is implemented by the request structs that check their values after decoding.
+type Validatable interface {
+	// Validate adds the invalid fields of the request to errs.
+	Validate(errs *Errors)
+}
+
+// Errors collects the invalid fields of a request body.
+type Errors []api_errors.FieldError
+
+// Add adds an invalid field with the reason it is invalid.
+func (e *Errors) Add(field string, format string, args ...interface{}) {
+	*e = append(*e, api_errors.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Required adds an error when the value is empty.
+func (e *Errors) Required(field string, value string) {
+	if strings.TrimSpace(value) == "" {
+		e.Add(field, "is required")
+	}
+}
+
+// ChannelName adds an error when the value is not a valid Agora channel name:
+// at most 64 bytes of ASCII letters, digits, spaces and the symbols !#$%&()+-:;<=.>?@[]^_{}|~,
+func (e *Errors) ChannelName(field string, value string) {
+	if value == "" {
+		e.Add(field, "is required")
+		return
+	}
+	if len(value) > MaxChannelNameLength {
+		e.Add(field, "must be at most %d bytes", MaxChannelNameLength)
+		return
+	}
+	for _, char := range value {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || strings.ContainsRune(channelNameSymbols, char)) {
+			e.Add(field, "contains %q, only letters, digits, spaces and %s are allowed", char, channelNameSymbols[1:])
+			return
+		}
+	}
+}
+
+// OneOf adds an error when the value is not one of the allowed values.
+func (e *Errors) OneOf(field string, value string, allowed ...string) {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	e.Add(field, "must be one of %s", strings.Join(allowed, ", "))
+}
+
+// Range adds an error when the value is set and not between min and max, inclusive.
+func (e *Errors) Range(field string, value *int, min int, max int) {
+	if value != nil && (*value < min || *value > max) {
+		e.Add(field, "must be between %d and %d", min, max)
+	}
+}
+
+// MaxItems adds an error when the list has more than max items.
+func (e *Errors) MaxItems(field string, count int, max int) {
+	if count > max {
+		e.Add(field, "must have at most %d items", max)
+	}
+}
+
+// Err returns the validation error with the invalid fields, or nil when there are none.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	apiErr := api_errors.New(http.StatusBadRequest, "Invalid request: "+strings.Join(messages, "; "))
+	apiErr.Fields = e
+	return apiErr
+}
+
+// Decode decodes a JSON request body into req and validates it.
+//
+// Parameters:
+//   - body: io.Reader - The request body.
+//   - req: interface{} - Pointer to the request struct, validated with its Validate method if it implements Validatable.
+//
+// Returns:
+//   - error: io.EOF if the body is empty, otherwise a 400 *api_errors.Error with the invalid fields, or nil.
+//
+// Behavior:
+//   - Rejects unknown fields, so misspelled fields are reported instead of ignored.
+//   - Rejects values of the wrong type, and data after the JSON value.
+func Decode(body io.Reader, req interface{}) error {
+	decoder := json.NewDecoder(io.LimitReader(body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		return decodeError(err)
+	}
+	if decoder.More() {
+		return api_errors.New(http.StatusBadRequest, "Invalid request: the body must contain a single JSON object")
+	}
+
+	if validatable, ok := req.(Validatable); ok {
+		var errs Errors
+		validatable.Validate(&errs)
+		return errs.Err()
+	}
+	return nil
+}
+
+// decodeError returns the validation error for a JSON decoding error.
+func decodeError(err error) error {
+	var errs Errors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		errs.Add(typeErr.Field, "must be of type %s", typeErr.Type.String())
+	case errors.As(err, &syntaxErr):
+		return api_errors.New(http.StatusBadRequest, fmt.Sprintf("Invalid request: malformed JSON at offset %d", syntaxErr.Offset))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// The decoder has no typed error for unknown fields
+		errs.Add(strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), "is not a known field")
+	default:
+		return api_errors.New(http.StatusBadRequest, "Invalid request: "+err.Error())
+	}
+	return errs.Err()
+}
+
+// BindJSON decodes and validates the JSON request body into req, see Decode.
+// Writes an HTTP 400 error with the invalid fields and returns false when the body is missing or invalid.
+func BindJSON(c *gin.Context, req interface{}) bool {
+	err := Decode(c.Request.Body, req)
+	if errors.Is(err, io.EOF) {
+		err = api_errors.New(http.StatusBadRequest, "Invalid request: the request body is required")
+	}
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// BindOptionalJSON is BindJSON for routes where the request body is optional, an empty body leaves req unchanged.
+func BindOptionalJSON(c *gin.Context, req interface{}) bool {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return false
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return true
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return BindJSON(c, req)
+}
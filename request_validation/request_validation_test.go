@@ -0,0 +1,155 @@
+package request_validation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRequest is a request struct with nested fields and validation.
+type testRequest struct {
+	ChannelName string `json:"channelName"`
+	Count       *int   `json:"count,omitempty"`
+	Options     *struct {
+		Mode string `json:"mode"`
+	} `json:"options,omitempty"`
+}
+
+func (r *testRequest) Validate(errs *Errors) {
+	errs.ChannelName("channelName", r.ChannelName)
+	errs.Range("count", r.Count, 1, 10)
+	if r.Options != nil {
+		errs.OneOf("options.mode", r.Options.Mode, "a", "b")
+	}
+}
+
+// fieldsOf returns the invalid fields of a validation error.
+func fieldsOf(t *testing.T, err error) []api_errors.FieldError {
+	var apiErr *api_errors.Error
+	if !assert.True(t, errors.As(err, &apiErr)) {
+		return nil
+	}
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	return apiErr.Fields
+}
+
+func TestChannelName(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"Letters, digits and symbols", "Room 1_test-2:{a}|~,", true},
+		{"Maximum length", strings.Repeat("a", MaxChannelNameLength), true},
+		{"Empty", "", false},
+		{"Too long", strings.Repeat("a", MaxChannelNameLength+1), false},
+		{"Slash", "room/1", false},
+		{"Non-ASCII", "réunion", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs Errors
+			errs.ChannelName("channelName", tt.value)
+			assert.Equal(t, tt.valid, len(errs) == 0)
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("Valid request", func(t *testing.T) {
+		var req testRequest
+		assert.NoError(t, Decode(strings.NewReader(`{"channelName":"test","count":3,"options":{"mode":"a"}}`), &req))
+		assert.Equal(t, "test", req.ChannelName)
+	})
+
+	t.Run("Empty body", func(t *testing.T) {
+		var req testRequest
+		assert.Equal(t, io.EOF, Decode(strings.NewReader(""), &req))
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		var req testRequest
+		fields := fieldsOf(t, Decode(strings.NewReader(`{"channelName":"test","options":{"mdoe":"a"}}`), &req))
+		assert.Equal(t, []api_errors.FieldError{{Field: "mdoe", Message: "is not a known field"}}, fields)
+	})
+
+	t.Run("Wrong type", func(t *testing.T) {
+		var req testRequest
+		fields := fieldsOf(t, Decode(strings.NewReader(`{"channelName":"test","count":"3"}`), &req))
+		assert.Equal(t, []api_errors.FieldError{{Field: "count", Message: "must be of type int"}}, fields)
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		var req testRequest
+		err := Decode(strings.NewReader(`{"channelName":`), &req)
+		assert.Error(t, err)
+		assert.Empty(t, fieldsOf(t, err))
+	})
+
+	t.Run("Trailing data", func(t *testing.T) {
+		var req testRequest
+		assert.Error(t, Decode(strings.NewReader(`{"channelName":"test"} {}`), &req))
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		var req testRequest
+		fields := fieldsOf(t, Decode(strings.NewReader(`{"channelName":"","count":11,"options":{"mode":"c"}}`), &req))
+		assert.Equal(t, []api_errors.FieldError{
+			{Field: "channelName", Message: "is required"},
+			{Field: "count", Message: "must be between 1 and 10"},
+			{Field: "options.mode", Message: "must be one of a, b"},
+		}, fields)
+	})
+}
+
+func TestBindJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/required", func(c *gin.Context) {
+		var req testRequest
+		if BindJSON(c, &req) {
+			c.JSON(http.StatusOK, req)
+		}
+	})
+	router.POST("/optional", func(c *gin.Context) {
+		req := testRequest{ChannelName: "default"}
+		if BindOptionalJSON(c, &req) {
+			c.JSON(http.StatusOK, req)
+		}
+	})
+
+	send := func(path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/required", `{"channelName":"bad/name"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Error api_errors.Error `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, api_errors.CodeInvalidRequest, resp.Error.Code)
+	if assert.Len(t, resp.Error.Fields, 1) {
+		assert.Equal(t, "channelName", resp.Error.Fields[0].Field)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send("/required", "").Code)
+	assert.Equal(t, http.StatusOK, send("/required", `{"channelName":"test"}`).Code)
+
+	w = send("/optional", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"channelName":"default"}`, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, send("/optional", `{"channelName":"test","other":1}`).Code)
+}
@@ -0,0 +1,92 @@
+package rtmp_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+)
+
+// HandleGetPullListReq retrieves a page of cloud players using Agora's Cloud Player service.
+// It constructs the request URL with the optional filter and pagination parameters and returns the players to the client.
+//
+// Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled when the client request is.
+//   - channelName: string - (Optional) RTC channel name used to filter the players.
+//   - region: string - The region of the Agora endpoint to query.
+//   - pageSize: int - (Optional) maximum number of players to return, 0 uses Agora's default.
+//   - pageToken: string - (Optional) token returned by a previous request to fetch the next page.
+//   - requestID: string - The unique request ID for tracing the request.
+//
+// Returns:
+//   - json.RawMessage: The JSON encoded CloudPlayerListResponse.
+//   - error: Error object detailing any issues encountered during the API call.
+//
+// Behavior:
+//   - Constructs the URL for the player list, adding the channel filter and pagination parameters when given.
+//   - Sends a GET request to the Agora endpoint and converts the players into summaries.
+//   - Appends a timestamp to the response for record-keeping before returning the modified response.
+//
+// Notes:
+//   - Assumes the presence of s.baseURL & s.cloudPlayerURL for constructing the request URL.
+//   - Utilizes s.makeRequest for sending the HTTP request and handling the response.
+//   - Utilizes s.AddTimestamp to append a timestamp to the response.
+func (s *RtmpService) HandleGetPullListReq(ctx context.Context, channelName string, region string, pageSize int, pageToken string, requestID string) (json.RawMessage, error) {
+	// Construct the URL for the player list endpoint.
+	query := url.Values{}
+	if channelName != "" {
+		query.Set("filter", "channelName eq "+quoteFilterValue(channelName))
+	}
+	if pageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(pageSize))
+	}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	listURL := fmt.Sprintf("%s%s/%s/players", s.baseURL, region, tenant_registry.URLFor(ctx, s.cloudPlayerURL, s.appID))
+	if len(query) > 0 {
+		listURL = listURL + "?" + query.Encode()
+	}
+
+	fmt.Println("HandleGetPullListReq with url: ", listURL)
+
+	// Send a GET request to the player list endpoint.
+	body, err := s.makeRequest(ctx, "GET", listURL, nil, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body into a struct to validate the response.
+	var listResponse CloudPlayerListAgoraResponse
+	err = json.Unmarshal(body, &listResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing cloud player list response: %v", err)
+	}
+
+	response := CloudPlayerListResponse{
+		Players:       listResponse.Players,
+		TotalSize:     listResponse.TotalSize,
+		NextPageToken: listResponse.NextPageToken,
+	}
+	if response.Players == nil {
+		response.Players = []PlayerSummary{}
+	}
+
+	// Append a timestamp to the response for auditing and record-keeping purposes.
+	timestampBody, err := s.AddTimestamp(&response)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding timestamped cloud player list response: %v", err)
+	}
+
+	return timestampBody, nil
+}
+
+// quoteFilterValue quotes a string value for a Cloud Player list filter, e.g. 'my channel'.
+// Quotes in the value are escaped by doubling them, so the value can't change the filter expression.
+func quoteFilterValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,110 @@
+package rtmp_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+)
+
+// maxConverterListPages limits the number of pages followed when listing converters.
+// Longer lists are truncated, the response has the cursor to continue from.
+const maxConverterListPages = 50
+
+// HandleGetPushListReq retrieves the list of RTMP converters using Agora's Media Push service.
+// It constructs the request URL, follows Agora's pagination cursor, and returns the converters to the client.
+//
+// Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled when the client request is.
+//   - channel: string - (Optional) RTC channel name used to filter the converters.
+//   - region: string - (Optional) region used to scope the request to a regional endpoint.
+//   - cursor: int - (Optional) Agora's pagination cursor to start from, the "nextCursor" of a truncated list. 0 starts from the first page.
+//   - requestID: string - The unique request ID for tracing the request.
+//
+// Returns:
+//   - json.RawMessage: The JSON encoded ConverterListResponse.
+//   - error: Error object detailing any issues encountered during the API call.
+//
+// Behavior:
+//   - Constructs the URL for the converter list, using the channel specific endpoint when a channel is given.
+//   - Sends GET requests to the Agora endpoint until the returned cursor is 0, following at most maxConverterListPages pages.
+//   - Sets "truncated" and "nextCursor" when more pages remain, so the client can continue with the cursor.
+//   - Masks the stream key in each converter's RTMP URL.
+//   - Appends a timestamp to the response for record-keeping before returning the modified response.
+//
+// Notes:
+//   - Assumes the presence of s.baseURL & s.rtmpURL for constructing the request URL.
+//   - Utilizes s.makeRequest for sending the HTTP request and handling the response.
+//   - Utilizes s.AddTimestamp to append a timestamp to the response.
+func (s *RtmpService) HandleGetPushListReq(ctx context.Context, channel string, region string, cursor int, requestID string) (json.RawMessage, error) {
+	// Construct the URL for the converter list endpoint.
+	listPath := tenant_registry.URLFor(ctx, s.rtmpURL, s.appID)
+	if channel != "" {
+		// Agora exposes a channel scoped list at v1/projects/{appId}/channels/{cname}/rtmp-converters
+		projectPath := strings.TrimSuffix(listPath, "/rtmp-converters")
+		listPath = fmt.Sprintf("%s/channels/%s/rtmp-converters", projectPath, url.PathEscape(channel))
+	}
+	listURL := s.baseURL + listPath
+	if region != "" {
+		listURL = fmt.Sprintf("%s%s/%s", s.baseURL, region, listPath)
+	}
+
+	fmt.Println("HandleGetPushListReq with url: ", listURL)
+
+	response := ConverterListResponse{Converters: []ConverterSummary{}}
+	for page := 0; ; page++ {
+		// Stop following the cursor after maxConverterListPages pages, the client continues from the returned cursor.
+		if page == maxConverterListPages {
+			response.Truncated = true
+			response.NextCursor = cursor
+			break
+		}
+
+		pageURL := listURL
+		if cursor != 0 {
+			pageURL = fmt.Sprintf("%s?cursor=%d", listURL, cursor)
+		}
+
+		// Send a GET request to the converter list endpoint.
+		body, err := s.makeRequest(ctx, "GET", pageURL, nil, requestID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Parse the response body into a struct to validate the response.
+		var listResponse ConverterListAgoraResponse
+		err = json.Unmarshal(body, &listResponse)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rtmp converter list response: %v", err)
+		}
+
+		for _, member := range listResponse.Data.Members {
+			response.Converters = append(response.Converters, ConverterSummary{
+				ConverterId: member.ConverterId,
+				Name:        member.ConverterName,
+				State:       member.State,
+				CreateTs:    member.CreateTs,
+				RtmpUrl:     s.maskStreamKey(member.RtmpUrl),
+				RtcChannel:  member.RtcChannel,
+			})
+		}
+
+		// A cursor of 0 means there are no more pages.
+		cursor = listResponse.Data.Cursor
+		if cursor == 0 {
+			break
+		}
+	}
+	response.Total = len(response.Converters)
+
+	// Append a timestamp to the response for auditing and record-keeping purposes.
+	timestampBody, err := s.AddTimestamp(&response)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding timestamped rtmp converter list response: %v", err)
+	}
+
+	return timestampBody, nil
+}
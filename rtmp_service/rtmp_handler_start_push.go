@@ -1,8 +1,11 @@
 package rtmp_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleStartPushReq initiates an RTMP push request using Agora's Media Push service.
@@ -10,6 +13,7 @@ import (
 // to the Agora API using the makeRequest helper function.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled when the client request is.
 //   - startReq: RtmpPushRequest - Contains the configuration settings for the RTMP push request.
 //   - region: string - The region ID previously acquired to identify the resource for the recording.
 //   - regionHintIp: *string - Optional parameter to provide a specific IP hint for the region.
@@ -31,9 +35,9 @@ import (
 //   - Utilizes s.makeRequest for sending the HTTP request and handling the response.
 //   - Utilizes s.isValidIPv4 for validating the regionHintIp.
 //   - Utilizes s.AddTimestamp to append a timestamp to the response.
-func (s *RtmpService) HandleStartPushReq(startReq RtmpPushRequest, region string, regionHintIp *string, requestID string) (json.RawMessage, error) {
+func (s *RtmpService) HandleStartPushReq(ctx context.Context, startReq RtmpPushRequest, region string, regionHintIp *string, requestID string) (json.RawMessage, error) {
 	// Construct the URL for the start recording endpoint.
-	url := fmt.Sprintf("%s%s/%s", s.baseURL, region, s.rtmpURL)
+	url := fmt.Sprintf("%s%s/%s", s.baseURL, region, tenant_registry.URLFor(ctx, s.rtmpURL, s.appID))
 
 	// Append regionHintIp if available and valid IPv4 address.
 	if regionHintIp != nil && s.isValidIPv4(*regionHintIp) {
@@ -43,7 +47,7 @@ func (s *RtmpService) HandleStartPushReq(startReq RtmpPushRequest, region string
 	fmt.Println("HandleStartPushReq with url: ", url)
 
 	// Send a POST request to the start recording endpoint.
-	body, err := s.makeRequest("POST", url, startReq, requestID)
+	body, err := s.makeRequest(ctx, "POST", url, startReq, requestID)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,18 @@
 package rtmp_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleStopPullReq stops an RTMP push request using Agora's Media Push service.
 // It constructs the request URL and sends the stop request to the Agora API using the makeRequest helper function.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled when the client request is.
 //   - playerId: string - The ID of the Cloud Player returned in the start pull request.
 //   - region: string - The region ID previously acquired to identify the resource for the recording.
 //   - requestID: string - The unique request ID for tracing the request.
@@ -27,14 +31,14 @@ import (
 //   - Assumes the presence of s.baseURL & s.cloudPlayerURL for constructing the request URL.
 //   - Utilizes s.makeRequest for sending the HTTP request and handling the response.
 //   - Utilizes s.AddTimestamp to append a timestamp to the response.
-func (s *RtmpService) HandleStopPullReq(playerId string, region string, requestID string) (json.RawMessage, error) {
+func (s *RtmpService) HandleStopPullReq(ctx context.Context, playerId string, region string, requestID string) (json.RawMessage, error) {
 	// Construct the URL for the stop recording endpoint.
-	url := fmt.Sprintf("%s%s/%s/players/%s", s.baseURL, region, s.cloudPlayerURL, playerId)
+	url := fmt.Sprintf("%s%s/%s/players/%s", s.baseURL, region, tenant_registry.URLFor(ctx, s.cloudPlayerURL, s.appID), playerId)
 
 	fmt.Println("HandleStopPullReq with url: ", url)
 
 	// Send a DELETE request to the stop recording endpoint.
-	_, err := s.makeRequest("DELETE", url, nil, requestID)
+	_, err := s.makeRequest(ctx, "DELETE", url, nil, requestID)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,18 @@
 package rtmp_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // HandleUpdatePushReq updates an existing RTMP push request using Agora's Media Push service.
 // It constructs the request URL and sends the update request to the Agora API using the makeRequest helper function.
 //
 // Parameters:
+//   - ctx: context.Context - Context for the Agora API call, cancelled when the client request is.
 //   - updateReq: RtmpPushRequest - Contains the configuration settings for the update RTMP request.
 //   - converterId: string - The ID of the Converter returned in the start push request.
 //   - region: string - The region ID for the rtmp resource.
@@ -28,9 +32,9 @@ import (
 //   - Assumes the presence of s.baseURL and s.rtmpURL for constructing the request URL.
 //   - Utilizes s.makeRequest for sending the HTTP request and handling the response.
 //   - Utilizes s.AddTimestamp to append a timestamp to the response.
-func (s *RtmpService) HandleUpdatePushReq(updateReq RtmpPushRequest, converterId string, region string, requestID string, sequenceId *int) (json.RawMessage, error) {
+func (s *RtmpService) HandleUpdatePushReq(ctx context.Context, updateReq RtmpPushRequest, converterId string, region string, requestID string, sequenceId *int) (json.RawMessage, error) {
 	// Construct the URL for the update rtmp endpoint.
-	url := fmt.Sprintf("%s%s/%s/%s", s.baseURL, region, s.rtmpURL, converterId)
+	url := fmt.Sprintf("%s%s/%s/%s", s.baseURL, region, tenant_registry.URLFor(ctx, s.rtmpURL, s.appID), converterId)
 
 	// Append sequenceId if available
 	if sequenceId != nil {
@@ -40,7 +44,7 @@ func (s *RtmpService) HandleUpdatePushReq(updateReq RtmpPushRequest, converterId
 	fmt.Println("HandleUpdatePushReq with url: ", url)
 
 	// Send a PATCH request to the update rtmp endpoint.
-	body, err := s.makeRequest("PATCH", url, updateReq, requestID)
+	body, err := s.makeRequest(ctx, "PATCH", url, updateReq, requestID)
 	if err != nil {
 		return nil, err
 	}
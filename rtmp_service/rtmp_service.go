@@ -3,9 +3,14 @@ package rtmp_service
 import (
 	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
 	"github.com/AgoraIO-Community/agora-go-backend-middleware/token_service"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,8 +21,9 @@ type RtmpService struct {
 	baseURL        string                      // The base URL for the Agora API where all API requests are sent.
 	rtmpURL        string                      // The URL path for the Agora RTMP converter endpoint.
 	cloudPlayerURL string                      // The URL path for the Agora Clpoud Player endpoint.
-	basicAuth      string                      // Basic authentication credentials required for interacting with the Agora API.
+	agoraClient    *agora_client.Client        // Shared client used to send authenticated requests to the Agora API.
 	tokenService   *token_service.TokenService // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
+	uidDirectory   *uid_directory.Directory    // (Optional) directory that resolves user accounts in stream UIDs to integer UIDs.
 }
 
 // NewRtmpService returns a RtmpService pointer with all configurations set.
@@ -28,7 +34,7 @@ type RtmpService struct {
 //   - baseURL: string - The base URL for the Agora API.
 //   - rtmpURL: string - The URL path for Agora's RTMP converter service.
 //   - cloudPlayerURL: string - The URL path for Agora's Cloud Player service.
-//   - basicAuth: string - The basic authentication credentials.
+//   - agoraClient: *agora_client.Client - The shared client used to send requests to the Agora API.
 //
 // Returns:
 //   - *RtmpService: The initialized RtmpService struct.
@@ -39,7 +45,7 @@ type RtmpService struct {
 //
 // Notes:
 //   - Logs a fatal error and exits if any required environment variables are missing.
-func NewRtmpService(appID string, baseURL string, rtmpURL string, cloudPlayerURL string, basicAuth string, tokenService *token_service.TokenService) *RtmpService {
+func NewRtmpService(appID string, baseURL string, rtmpURL string, cloudPlayerURL string, agoraClient *agora_client.Client, tokenService *token_service.TokenService) *RtmpService {
 
 	// Seed the random number generator with the current time
 	rand.Seed(time.Now().UnixNano())
@@ -50,7 +56,7 @@ func NewRtmpService(appID string, baseURL string, rtmpURL string, cloudPlayerURL
 		baseURL:        baseURL,        // The base URL for the Agora API where all API requests are sent.
 		rtmpURL:        rtmpURL,        // The URL path for the Agora RTMP converter endpoint.
 		cloudPlayerURL: cloudPlayerURL, // The URL path for the Agora Clpoud Player endpoint.
-		basicAuth:      basicAuth,      // Basic authentication credentials required for interacting with the Agora API.
+		agoraClient:    agoraClient,    // Shared client used to send authenticated requests to the Agora API.
 		tokenService:   tokenService,   // Pointer to an instance of TokenService used to generate authentication tokens for Agora API requests.
 
 	}
@@ -60,7 +66,7 @@ func NewRtmpService(appID string, baseURL string, rtmpURL string, cloudPlayerURL
 func verifyRequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.GetHeader("X-Request-ID") == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "X-Request-ID header is required"})
+			api_errors.AbortMessage(c, http.StatusBadRequest, "X-Request-ID header is required")
 			c.Abort()
 			return
 		}
@@ -68,6 +74,12 @@ func verifyRequestID() gin.HandlerFunc {
 	}
 }
 
+// SetUIDDirectory sets the directory that resolves the user accounts in the stream UIDs of push requests to integer UIDs.
+// Without a directory the UIDs are sent to Agora unchanged.
+func (s *RtmpService) SetUIDDirectory(directory *uid_directory.Directory) {
+	s.uidDirectory = directory
+}
+
 // RegisterRoutes registers the routes for the RtmpService.
 // It sets up the API endpoints for request handling.
 //
@@ -105,23 +117,22 @@ func (s *RtmpService) RegisterRoutes(r *gin.Engine) {
 		pullAPI.POST("/start", s.StartPull)     // Route to start the RTMP push.
 		pullAPI.POST("/stop", s.StopPull)       // Route to stop the RTMP push.
 		pullAPI.POST("/update", s.UpdatePlayer) // Route to update the converter.
-		pullAPI.GET("/list", s.GetPullList)     // RRoute to get the list of cloud players
+		pullAPI.GET("/list", s.GetPullList)     // Route to get the list of cloud players
 	}
 }
 
 // StartPush handles the starting of an RTMP push.
 // It processes the request to start pushing the media stream to the specified RTMP URL.
 func (s *RtmpService) StartPush(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientStartReq ClientStartRtmpRequest
-	if err := c.ShouldBindJSON(&clientStartReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !request_validation.BindJSON(c, &clientStartReq) {
 		return
 	}
 
-	// Validate region
-	if !s.ValidateRegion(clientStartReq.Region) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region specified."})
+	// Replace the user accounts in the stream UIDs with their integer UIDs
+	if err := s.resolveStreamUids(c.Request.Context(), &clientStartReq); err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -152,9 +163,9 @@ func (s *RtmpService) StartPush(c *gin.Context) {
 	}
 
 	// Start RTMP
-	response, err := s.HandleStartPushReq(rtmpClientReq, clientStartReq.Region, clientStartReq.RegionHintIp, c.GetHeader("X-Request-ID"))
+	response, err := s.HandleStartPushReq(c.Request.Context(), rtmpClientReq, clientStartReq.Region, clientStartReq.RegionHintIp, c.GetHeader("X-Request-ID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start RTMP converter: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to start RTMP converter", err)
 		return
 	}
 
@@ -166,23 +177,16 @@ func (s *RtmpService) StartPush(c *gin.Context) {
 // StopPush handles the stopping of an RTMP push.
 // It processes the request to stop pushing the media stream to the specified RTMP URL.
 func (s *RtmpService) StopPush(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientStopReq ClientStopRtmpRequest
-	if err := c.ShouldBindJSON(&clientStopReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validate region
-	if !s.ValidateRegion(clientStopReq.Region) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region specified."})
+	if !request_validation.BindJSON(c, &clientStopReq) {
 		return
 	}
 
 	// Stop RTMP
-	response, err := s.HandleStopPushReq(clientStopReq.ConverterId, clientStopReq.Region, c.GetHeader("X-Request-ID"))
+	response, err := s.HandleStopPushReq(c.Request.Context(), clientStopReq.ConverterId, clientStopReq.Region, c.GetHeader("X-Request-ID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop RTMP converter: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to stop RTMP converter", err)
 		return
 	}
 
@@ -193,23 +197,44 @@ func (s *RtmpService) StopPush(c *gin.Context) {
 
 // GetPushList returns a list of the current RTMP converters.
 // It processes the request to get the current list of the media stream pushing operations.
+// The list can be filtered using the optional "channel" and "region" query parameters.
 func (s *RtmpService) GetPushList(c *gin.Context) {
-	// TODO: add logic to check context for api group
+	channel := c.Query("channel")
+	region := c.Query("region")
+
+	// Validate region if provided
+	if region != "" && !s.ValidateRegion(region) {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid region specified.")
+		return
+	}
+	// Continue a truncated list from its cursor
+	cursor := 0
+	if value := c.Query("cursor"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid cursor specified.")
+			return
+		}
+		cursor = parsed
+	}
+
+	// List RTMP converters
+	response, err := s.HandleGetPushListReq(c.Request.Context(), channel, region, cursor, c.GetHeader("X-Request-ID"))
+	if err != nil {
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to list RTMP converters", err)
+		return
+	}
+
+	// Return the wrapped Agora response
+	c.Data(http.StatusOK, "application/json", response)
 }
 
 // UpdateConverter handles updating the transcoding options for the RTMP push.
 // It processes the request to update the transcoding configuration for the media stream.
 func (s *RtmpService) UpdateConverter(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientUpdateReq ClientUpdateRtmpRequest
-	if err := c.ShouldBindJSON(&clientUpdateReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validate region
-	if !s.ValidateRegion(clientUpdateReq.Region) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region specified."})
+	if !request_validation.BindJSON(c, &clientUpdateReq) {
 		return
 	}
 
@@ -237,9 +262,9 @@ func (s *RtmpService) UpdateConverter(c *gin.Context) {
 	}
 
 	// Update RTMP
-	response, err := s.HandleUpdatePushReq(rtmpClientReq, clientUpdateReq.ConverterId, clientUpdateReq.Region, c.GetHeader("X-Request-ID"), clientUpdateReq.SequenceId)
+	response, err := s.HandleUpdatePushReq(c.Request.Context(), rtmpClientReq, clientUpdateReq.ConverterId, clientUpdateReq.Region, c.GetHeader("X-Request-ID"), clientUpdateReq.SequenceId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update RTMP converter: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to update RTMP converter", err)
 		return
 	}
 
@@ -250,16 +275,9 @@ func (s *RtmpService) UpdateConverter(c *gin.Context) {
 // StartPull handles the starting of an RTMP pull.
 // It processes the request to start pulling the media stream from the specified RTMP URL into the given channel.
 func (s *RtmpService) StartPull(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientStartReq ClientStartCloudPlayerRequest
-	if err := c.ShouldBindJSON(&clientStartReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validate region against a set list
-	if !s.ValidateRegion(clientStartReq.Region) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region specified."})
+	if !request_validation.BindJSON(c, &clientStartReq) {
 		return
 	}
 
@@ -283,9 +301,9 @@ func (s *RtmpService) StartPull(c *gin.Context) {
 		Channel:   clientStartReq.ChannelName,
 		Uid:       uid,
 	}
-	token, err := s.tokenService.GenRtcToken(tokenRequest)
+	token, err := s.tokenService.ForContext(c.Request.Context()).GenRtcToken(tokenRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		api_errors.Abort(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -321,9 +339,9 @@ func (s *RtmpService) StartPull(c *gin.Context) {
 	}
 
 	// Start Cloud Player
-	response, err := s.HandleStartPullReq(cloudPlayerClientReq, clientStartReq.Region, clientStartReq.StreamOriginIp, c.GetHeader("X-Request-ID"))
+	response, err := s.HandleStartPullReq(c.Request.Context(), cloudPlayerClientReq, clientStartReq.Region, clientStartReq.StreamOriginIp, c.GetHeader("X-Request-ID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start Cloud Player: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to start Cloud Player", err)
 		return
 	}
 
@@ -334,23 +352,16 @@ func (s *RtmpService) StartPull(c *gin.Context) {
 // StopPull handles the stopping of an RTMP push.
 // It processes the request to stop pushing the media stream to the specified RTMP URL.
 func (s *RtmpService) StopPull(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientStopReq ClientStopPullRequest
-	if err := c.ShouldBindJSON(&clientStopReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validate region
-	if !s.ValidateRegion(clientStopReq.Region) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region specified."})
+	if !request_validation.BindJSON(c, &clientStopReq) {
 		return
 	}
 
 	// Stop RTMP
-	response, err := s.HandleStopPullReq(clientStopReq.PlayerId, clientStopReq.Region, c.GetHeader("X-Request-ID"))
+	response, err := s.HandleStopPullReq(c.Request.Context(), clientStopReq.PlayerId, clientStopReq.Region, c.GetHeader("X-Request-ID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop Cloud Player: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to stop Cloud Player", err)
 		return
 	}
 
@@ -361,16 +372,9 @@ func (s *RtmpService) StopPull(c *gin.Context) {
 // UpdateConverter handles updating the transcoding options for the RTMP push.
 // It processes the request to update the transcoding configuration for the media stream.
 func (s *RtmpService) UpdatePlayer(c *gin.Context) {
-	// Verify the client's request. If binding fails, returns an HTTP 400 error with the specific binding error message.
+	// Verify the client's request. If validation fails, returns an HTTP 400 error with the invalid fields.
 	var clientUpdateReq ClientUpdatePullRequest
-	if err := c.ShouldBindJSON(&clientUpdateReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Validate region
-	if !s.ValidateRegion(clientUpdateReq.Region) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid region specified."})
+	if !request_validation.BindJSON(c, &clientUpdateReq) {
 		return
 	}
 
@@ -384,9 +388,9 @@ func (s *RtmpService) UpdatePlayer(c *gin.Context) {
 	}
 
 	// Update Cloud Player server
-	response, err := s.HandleUpdatePullReq(cloudPlayerClientReq, clientUpdateReq.PlayerId, clientUpdateReq.Region, c.GetHeader("X-Request-ID"), clientUpdateReq.SequenceId)
+	response, err := s.HandleUpdatePullReq(c.Request.Context(), cloudPlayerClientReq, clientUpdateReq.PlayerId, clientUpdateReq.Region, c.GetHeader("X-Request-ID"), clientUpdateReq.SequenceId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Cloud Player: " + err.Error()})
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to update Cloud Player", err)
 		return
 	}
 
@@ -396,4 +400,36 @@ func (s *RtmpService) UpdatePlayer(c *gin.Context) {
 
 // GetPullList returns a list of the current cloud players.
 // It processes the request to get the current list of the media stream pull operations.
-func (s *RtmpService) GetPullList(c *gin.Context) {}
+// The list can be filtered using the optional "channelName" query parameter and paged using "pageSize" and "pageToken".
+func (s *RtmpService) GetPullList(c *gin.Context) {
+	region := c.Query("region")
+	channelName := c.Query("channelName")
+	pageToken := c.Query("pageToken")
+
+	// Validate region
+	if !s.ValidateRegion(region) {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid region specified.")
+		return
+	}
+
+	// Validate page size if provided
+	pageSize := 0
+	if pageSizeParam := c.Query("pageSize"); pageSizeParam != "" {
+		size, err := strconv.Atoi(pageSizeParam)
+		if err != nil || size <= 0 {
+			api_errors.AbortMessage(c, http.StatusBadRequest, "pageSize must be a positive integer.")
+			return
+		}
+		pageSize = size
+	}
+
+	// List cloud players
+	response, err := s.HandleGetPullListReq(c.Request.Context(), channelName, region, pageSize, pageToken, c.GetHeader("X-Request-ID"))
+	if err != nil {
+		api_errors.AbortUpstream(c, api_errors.ServiceRTMP, "Failed to list cloud players", err)
+		return
+	}
+
+	// Return the wrapped Agora response
+	c.Data(http.StatusOK, "application/json", response)
+}
@@ -3,18 +3,18 @@ package rtmp_service
 // ClientStartRtmpRequest represents the JSON payload structure sent by the client to start an RTMP push.
 // It includes configuration details for the RTMP converter, stream settings, and (Optional) transcoding options.
 type ClientStartRtmpRequest struct {
-	ConverterName      *string           `json:"converterName,omitempty"`      // (Optional) name for the RTMP converter
-	RtcChannel         string            `json:"rtcChannel"`                   // The RTC channel name to push from
-	StreamUrl          string            `json:"streamUrl"`                    // The RTMP server URL to push to
-	StreamKey          string            `json:"streamKey"`                    // The stream key for the RTMP server
-	Region             string            `json:"region"`                       // The region for the RTMP push service
-	RegionHintIp       *string           `json:"regionHintIp"`                 // (Optional) IP hint for region selection
-	UseTranscoding     bool              `json:"useTranscoding"`               // Whether to use transcoding for the push
-	RtcStreamUid       *string           `json:"rtcStreamUid,omitempty"`       // (Optional) RTC stream UID to push
-	AudioOptions       *PushAudioOptions `json:"audioOptions,omitempty"`       // (Optional) audio transcoding options
-	VideoOptions       *PushVideoOptions `json:"videoOptions,omitempty"`       // (Optional) video transcoding options
-	IdleTimeOut        *int              `json:"idleTimeOut,omitempty"`        // (Optional) idle timeout in seconds
-	JitterBufferSizeMs *int              `json:"jitterBufferSizeMs,omitempty"` // (Optional) jitter buffer size in milliseconds
+	ConverterName      *string           `json:"converterName,omitempty"`           // (Optional) name for the RTMP converter
+	RtcChannel         string            `json:"rtcChannel"`                        // The RTC channel name to push from
+	StreamUrl          string            `json:"streamUrl"`                         // The RTMP server URL to push to
+	StreamKey          string            `json:"streamKey"`                         // The stream key for the RTMP server
+	Region             string            `json:"region"`                            // The region for the RTMP push service
+	RegionHintIp       *string           `json:"regionHintIp"`                      // (Optional) IP hint for region selection
+	UseTranscoding     bool              `json:"useTranscoding" openapi:"optional"` // Whether to use transcoding for the push
+	RtcStreamUid       *string           `json:"rtcStreamUid,omitempty"`            // (Optional) RTC stream UID to push
+	AudioOptions       *PushAudioOptions `json:"audioOptions,omitempty"`            // (Optional) audio transcoding options
+	VideoOptions       *PushVideoOptions `json:"videoOptions,omitempty"`            // (Optional) video transcoding options
+	IdleTimeOut        *int              `json:"idleTimeOut,omitempty"`             // (Optional) idle timeout in seconds
+	JitterBufferSizeMs *int              `json:"jitterBufferSizeMs,omitempty"`      // (Optional) jitter buffer size in milliseconds
 }
 
 // ClientStartCloudPlayerRequest represents the JSON payload structure sent by the client to start an Cloud Player instance.
@@ -63,13 +63,13 @@ type ClientUpdateRtmpRequest struct {
 // ClientUpdatePullRequest represents the JSON payload structure for updating an ongoing RTMP push.
 // It allows for modifications to certain parameters of an active RTMP push.
 type ClientUpdatePullRequest struct {
-	PlayerId     string            `json:"playerId"`               // The ID of the cloud player to update
-	Region       string            `json:"region"`                 // The region where the RTMP push is running
-	StreamUrl    *string           `json:"streamUrl"`              // The CDN/RTMP server URL to pull from
-	AudioOptions *PullAudioOptions `json:"audioOptions,omitempty"` // (Optional) updated audio options
-	IsPause      *bool             `json:"isPause,omitempty"`      // (Optional) updated jitter buffer size
-	SeekPosition *int              `json:"seekPosition,omitempty"` // (Optional) Start playback at this position
-	SequenceId   *int              `json:"sequenceId,omitempty"`   // (Optional) Agora server updates cloud player according to the latest sequence id
+	PlayerId     string            `json:"playerId"`                     // The ID of the cloud player to update
+	Region       string            `json:"region"`                       // The region where the RTMP push is running
+	StreamUrl    *string           `json:"streamUrl" openapi:"required"` // The CDN/RTMP server URL to pull from
+	AudioOptions *PullAudioOptions `json:"audioOptions,omitempty"`       // (Optional) updated audio options
+	IsPause      *bool             `json:"isPause,omitempty"`            // (Optional) updated jitter buffer size
+	SeekPosition *int              `json:"seekPosition,omitempty"`       // (Optional) Start playback at this position
+	SequenceId   *int              `json:"sequenceId,omitempty"`         // (Optional) Agora server updates cloud player according to the latest sequence id
 }
 
 // RtmpPushRequest defines the structure for a request to start or update an RTMP push to the Agora service.
@@ -287,3 +287,82 @@ type CloudPlayerUpdateResponse struct {
 func (s *CloudPlayerUpdateResponse) SetTimestamp(timestamp string) {
 	s.Timestamp = &timestamp
 }
+
+// ConverterListAgoraResponse represents a single page of the converter list returned by the Agora server.
+// The cursor is used to request the next page, a cursor of 0 means there are no more pages.
+type ConverterListAgoraResponse struct {
+	Status string `json:"status"` // Status of the list request
+	Data   struct {
+		Members []ConverterListMember `json:"members"` // The converters on this page
+		Cursor  int                   `json:"cursor"`  // Cursor for the next page, 0 when the list is complete
+	} `json:"data"`
+}
+
+// ConverterListMember contains the details of a single converter as returned by the Agora converter list API.
+type ConverterListMember struct {
+	ConverterId   string `json:"converterId"`          // Unique identifier for the converter
+	ConverterName string `json:"converterName"`        // Name of the converter
+	CreateTs      int64  `json:"createTs"`             // Timestamp of converter creation
+	UpdateTs      int64  `json:"updateTs"`             // Timestamp of last update
+	State         string `json:"state"`                // Current state of the converter
+	RtmpUrl       string `json:"rtmpUrl"`              // The RTMP URL the converter pushes to
+	RtcChannel    string `json:"rtcChannel,omitempty"` // The RTC channel the converter pushes from
+}
+
+// ConverterSummary contains the details of a running converter returned to the client.
+// The stream key in the RTMP URL is masked so it is not exposed to dashboards.
+type ConverterSummary struct {
+	ConverterId string `json:"id"`                   // Unique identifier for the converter
+	Name        string `json:"name"`                 // Name of the converter
+	State       string `json:"state"`                // Current state of the converter
+	CreateTs    int64  `json:"createTs"`             // Timestamp of converter creation
+	RtmpUrl     string `json:"rtmpUrl"`              // The RTMP URL with the stream key masked
+	RtcChannel  string `json:"rtcChannel,omitempty"` // The RTC channel the converter pushes from
+}
+
+// ConverterListResponse represents the list of converters returned to the client.
+// It includes the converters across all pages and an (Optional) timestamp.
+type ConverterListResponse struct {
+	Converters []ConverterSummary `json:"converters"`           // The converters matching the request filters
+	Total      int                `json:"total"`                // The number of converters returned
+	Truncated  bool               `json:"truncated,omitempty"`  // Whether more converters remain, the list stops after maxConverterListPages pages
+	NextCursor int                `json:"nextCursor,omitempty"` // (Optional) the cursor to list the remaining converters with, set when the list is truncated
+	Timestamp  *string            `json:"timestamp,omitempty"`  // (Optional) timestamp for when the list was retrieved
+}
+
+// SetTimestamp implements the Timestampable interface for ConverterListResponse.
+func (s *ConverterListResponse) SetTimestamp(timestamp string) {
+	s.Timestamp = &timestamp
+}
+
+// CloudPlayerListAgoraResponse represents a single page of the cloud player list returned by the Agora server.
+type CloudPlayerListAgoraResponse struct {
+	TotalSize     int             `json:"totalSize"`               // Total number of players matching the filter
+	Players       []PlayerSummary `json:"players"`                 // The players on this page
+	NextPageToken string          `json:"nextPageToken,omitempty"` // Token for the next page, empty when the list is complete
+}
+
+// PlayerSummary contains the details of a single cloud player, as returned by the Agora player list API and to the client.
+type PlayerSummary struct {
+	PlayerId    string `json:"id"`          // Unique identifier for the cloud player
+	Name        string `json:"name"`        // Name of the cloud player
+	ChannelName string `json:"channelName"` // The RTC channel the player pulls into
+	Uid         string `json:"uid"`         // The RTC UID used by the player
+	StreamUrl   string `json:"streamUrl"`   // The CDN/RTMP URL the player pulls from
+	Status      string `json:"status"`      // Current status of the cloud player
+	CreateTs    int64  `json:"createTs"`    // Timestamp of player creation
+}
+
+// CloudPlayerListResponse represents the list of cloud players returned to the client.
+// It includes a single page of players, the token for the next page and an (Optional) timestamp.
+type CloudPlayerListResponse struct {
+	Players       []PlayerSummary `json:"players"`                 // The players on this page
+	TotalSize     int             `json:"totalSize"`               // Total number of players matching the filter
+	NextPageToken string          `json:"nextPageToken,omitempty"` // (Optional) token used to request the next page
+	Timestamp     *string         `json:"timestamp,omitempty"`     // (Optional) timestamp for when the list was retrieved
+}
+
+// SetTimestamp implements the Timestampable interface for CloudPlayerListResponse.
+func (s *CloudPlayerListResponse) SetTimestamp(timestamp string) {
+	s.Timestamp = &timestamp
+}
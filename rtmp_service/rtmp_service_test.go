@@ -2,13 +2,16 @@ package rtmp_service
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -515,3 +518,276 @@ func TestValidateIdleTimeOut(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPushList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var requestedPaths []string
+	agora := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPaths = append(requestedPaths, r.URL.RequestURI())
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("cursor") == "" {
+			w.Write([]byte(`{"status":"success","data":{"members":[{"converterId":"c1","converterName":"first","createTs":1,"state":"running","rtmpUrl":"rtmp://live.example.com/app/secret-key","rtcChannel":"test"}],"cursor":7}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"members":[{"converterId":"c2","converterName":"second","createTs":2,"state":"connecting","rtmpUrl":"rtmp://live.example.com/app/other-key?token=abc","rtcChannel":"test"}],"cursor":0}}`))
+	}))
+	defer agora.Close()
+
+	service := NewRtmpService("test-app", agora.URL+"/", "v1/projects/test-app/rtmp-converters", "v1/projects/test-app/cloud-player", agora_client.NewClient("Basic test"), nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	t.Run("Channel and region filter with pagination", func(t *testing.T) {
+		requestedPaths = nil
+		req, _ := http.NewRequest("GET", "/rtmp/push/list?channel=test&region=na", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{
+			"/na/v1/projects/test-app/channels/test/rtmp-converters",
+			"/na/v1/projects/test-app/channels/test/rtmp-converters?cursor=7",
+		}, requestedPaths)
+
+		var response ConverterListResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, response.Total)
+		assert.Equal(t, "c1", response.Converters[0].ConverterId)
+		assert.Equal(t, "rtmp://live.example.com/app/****", response.Converters[0].RtmpUrl)
+		assert.Equal(t, "rtmp://live.example.com/app/****", response.Converters[1].RtmpUrl)
+		assert.NotNil(t, response.Timestamp)
+	})
+
+	t.Run("All converters", func(t *testing.T) {
+		requestedPaths = nil
+		req, _ := http.NewRequest("GET", "/rtmp/push/list", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/v1/projects/test-app/rtmp-converters", requestedPaths[0])
+	})
+
+	t.Run("Invalid region", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/rtmp/push/list?region=invalid", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestGetPushListTruncated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Every page points to a next page
+	var requests int
+	var firstCursor string
+	agora := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		if requests == 0 {
+			firstCursor = r.URL.Query().Get("cursor")
+		}
+		requests++
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":{"members":[{"converterId":"c%d","rtmpUrl":"rtmp://live.example.com/app"}],"cursor":%d}}`, cursor, cursor+1)
+	}))
+	defer agora.Close()
+
+	service := NewRtmpService("test-app", agora.URL+"/", "v1/projects/test-app/rtmp-converters", "v1/projects/test-app/cloud-player", agora_client.NewClient("Basic test"), nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	list := func(query string) (int, ConverterListResponse) {
+		requests = 0
+		req, _ := http.NewRequest("GET", "/rtmp/push/list"+query, nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response ConverterListResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := list("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, maxConverterListPages, requests)
+	assert.Equal(t, maxConverterListPages, response.Total)
+	assert.True(t, response.Truncated)
+	assert.Equal(t, maxConverterListPages, response.NextCursor)
+	// An app without a stream key is not masked
+	assert.Equal(t, "rtmp://live.example.com/app", response.Converters[0].RtmpUrl)
+
+	// The client continues from the cursor
+	code, response = list("?cursor=" + strconv.Itoa(response.NextCursor))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, strconv.Itoa(maxConverterListPages), firstCursor)
+	assert.Equal(t, fmt.Sprintf("c%d", maxConverterListPages), response.Converters[0].ConverterId)
+
+	code, _ = list("?cursor=-1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestQuoteFilterValue(t *testing.T) {
+	assert.Equal(t, "'test'", quoteFilterValue("test"))
+	assert.Equal(t, "'my channel'", quoteFilterValue("my channel"))
+	assert.Equal(t, "'it''s'", quoteFilterValue("it's"))
+}
+
+func TestMaskStreamKey(t *testing.T) {
+	service := &RtmpService{}
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Stream key", "rtmp://live.example.com/app/secret", "rtmp://live.example.com/app/****"},
+		{"Stream key with query", "rtmp://live.example.com/app/secret?auth=123", "rtmp://live.example.com/app/****"},
+		{"No stream key", "rtmp://live.example.com", "rtmp://live.example.com"},
+		{"App without a stream key", "rtmp://live.example.com/app", "rtmp://live.example.com/app"},
+		{"App without a stream key with query", "rtmp://live.example.com/app?auth=123", "rtmp://live.example.com/app"},
+		{"Nested app", "rtmp://live.example.com/app/instance/secret", "rtmp://live.example.com/app/instance/****"},
+		{"Trailing slash", "rtmp://live.example.com/app/", "rtmp://live.example.com/app/"},
+		{"Empty string", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, service.maskStreamKey(tc.input))
+		})
+	}
+}
+
+func TestGetPullList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var lastQuery url.Values
+	var lastPath string
+	agora := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.URL.Path
+		lastQuery = r.URL.Query()
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"totalSize":3,"players":[{"id":"p1","name":"player","channelName":"test","uid":"123","streamUrl":"rtmp://example.com/live/stream","status":"running","createTs":1700000000}],"nextPageToken":"next-token"}`))
+	}))
+	defer agora.Close()
+
+	service := NewRtmpService("test-app", agora.URL+"/", "v1/projects/test-app/rtmp-converters", "v1/projects/test-app/cloud-player", agora_client.NewClient("Basic test"), nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	t.Run("Channel filter and pagination", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/rtmp/pull/list?region=eu&channelName=test&pageSize=1&pageToken=abc", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/eu/v1/projects/test-app/cloud-player/players", lastPath)
+		assert.Equal(t, "channelName eq 'test'", lastQuery.Get("filter"))
+		assert.Equal(t, "1", lastQuery.Get("pageSize"))
+		assert.Equal(t, "abc", lastQuery.Get("pageToken"))
+
+		var response CloudPlayerListResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, response.TotalSize)
+		assert.Equal(t, "next-token", response.NextPageToken)
+		assert.Equal(t, PlayerSummary{
+			PlayerId:    "p1",
+			Name:        "player",
+			ChannelName: "test",
+			Uid:         "123",
+			StreamUrl:   "rtmp://example.com/live/stream",
+			Status:      "running",
+			CreateTs:    1700000000,
+		}, response.Players[0])
+		assert.NotNil(t, response.Timestamp)
+	})
+
+	t.Run("Channel name with a space", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/rtmp/pull/list?region=eu&channelName="+url.QueryEscape("my channel or x eq y"), nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "channelName eq 'my channel or x eq y'", lastQuery.Get("filter"))
+	})
+
+	t.Run("Missing region", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/rtmp/pull/list", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid page size", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/rtmp/pull/list?region=na&pageSize=zero", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	agora := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to Agora: %s", r.URL.Path)
+	}))
+	defer agora.Close()
+
+	service := NewRtmpService("test-app", agora.URL+"/", "v1/projects/test-app/rtmp-converters", "v1/projects/test-app/cloud-player", agora_client.NewClient("Basic test"), nil)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	testCases := []struct {
+		name          string
+		path          string
+		body          string
+		expectedField string
+	}{
+		{"Raw push without stream UID", "/rtmp/push/start", `{"rtcChannel":"test","streamUrl":"rtmp://live.example.com/app/","streamKey":"key","region":"na","useTranscoding":false}`, "rtcStreamUid"},
+		{"Invalid channel name", "/rtmp/push/start", `{"rtcChannel":"test/channel","streamUrl":"rtmp://live.example.com/app/","streamKey":"key","region":"na","rtcStreamUid":"123"}`, "rtcChannel"},
+		{"Invalid region", "/rtmp/push/stop", `{"converterId":"test_converter_id","region":"invalid"}`, "region"},
+		{"Stream URL without stream key", "/rtmp/push/update", `{"converterId":"test_converter_id","region":"na","rtcChannel":"test","streamUrl":"rtmp://live.example.com/app/"}`, "streamUrl"},
+		{"Pull update without stream URL", "/rtmp/pull/update", `{"playerId":"test_player_id","region":"na"}`, "streamUrl"},
+		{"Unknown field", "/rtmp/pull/stop", `{"playerId":"test_player_id","region":"na","regoin":"eu"}`, "regoin"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-ID", "test-request-id")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response struct {
+				Error struct {
+					Fields []struct {
+						Field string `json:"field"`
+					} `json:"fields"`
+				} `json:"error"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if assert.Len(t, response.Error.Fields, 1) {
+				assert.Equal(t, tc.expectedField, response.Error.Fields[0].Field)
+			}
+		})
+	}
+}
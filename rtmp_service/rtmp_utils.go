@@ -1,19 +1,22 @@
 package rtmp_service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
 )
 
 // ValidateRegion checks if a specific string is present within a slice of strings.
 // This is useful for determining if a particular item exists within a list.
 func (s *RtmpService) ValidateRegion(regionToCheck string) bool {
-	validRegions := []string{"na", "eu", "ap", "cn"}
 	for _, region := range validRegions {
 		if region == regionToCheck {
 			return true
@@ -54,6 +57,25 @@ func (s *RtmpService) isValidIPv4(ip string) bool {
 	return parsedIP != nil && parsedIP.To4() != nil
 }
 
+// maskStreamKey hides the stream key in an RTMP URL so it can be safely returned to clients.
+// The stream key is the last path segment after the application name, e.g. "key" in rtmp://host/app/key.
+// Any query string is dropped as it may contain credentials.
+func (s *RtmpService) maskStreamKey(rtmpUrl string) string {
+	if index := strings.Index(rtmpUrl, "?"); index != -1 {
+		rtmpUrl = rtmpUrl[:index]
+	}
+	address := rtmpUrl
+	if index := strings.Index(address, "://"); index != -1 {
+		address = address[index+len("://"):]
+	}
+	// Keep URLs without a stream key segment as they are, e.g. rtmp://host/app.
+	segments := strings.Split(address, "/")
+	if len(segments) < 3 || segments[len(segments)-1] == "" {
+		return rtmpUrl
+	}
+	return rtmpUrl[:strings.LastIndex(rtmpUrl, "/")+1] + "****"
+}
+
 // checks if a given string is a valid IdleTimeout time.
 func (s *RtmpService) ValidateIdleTimeOut(idleTimeOut *int) *int {
 	isInRange, err := s.checkIntInRange(*idleTimeOut, 5, 600)
@@ -79,3 +101,26 @@ func (s *RtmpService) checkIntInRange(input int, min int, max int) (bool, error)
 
 	return false, nil
 }
+
+// resolveStreamUids replaces the user accounts in the RTC stream UID and the layout of a push request with their integer UIDs in the channel,
+// for the tenant of a request, see uid_directory.Directory.ResolveUid.
+func (s *RtmpService) resolveStreamUids(ctx context.Context, clientStartReq *ClientStartRtmpRequest) error {
+	tenantID := tenant_registry.IDFromContext(ctx)
+	if clientStartReq.RtcStreamUid != nil {
+		uid, err := s.uidDirectory.ResolveUid(tenantID, clientStartReq.RtcChannel, *clientStartReq.RtcStreamUid)
+		if err != nil {
+			return fmt.Errorf("error resolving user account: %v", err)
+		}
+		clientStartReq.RtcStreamUid = &uid
+	}
+	if clientStartReq.VideoOptions != nil {
+		for i, layout := range clientStartReq.VideoOptions.Layout {
+			uid, err := s.uidDirectory.ResolveUid(tenantID, clientStartReq.RtcChannel, layout.RtcStreamUid)
+			if err != nil {
+				return fmt.Errorf("error resolving user account: %v", err)
+			}
+			clientStartReq.VideoOptions.Layout[i].RtcStreamUid = uid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package rtmp_service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+)
+
+// validRegions are the regions of the Media Push and Cloud Player services.
+var validRegions = []string{"na", "eu", "ap", "cn"}
+
+// Validate checks the channel, stream URL and region of a push request, and the stream UID of a raw push.
+func (r *ClientStartRtmpRequest) Validate(errs *request_validation.Errors) {
+	errs.ChannelName("rtcChannel", r.RtcChannel)
+	validateStreamUrl(errs, "streamUrl", r.StreamUrl, "rtmp://", "rtmps://")
+	errs.OneOf("region", r.Region, validRegions...)
+	// A raw push forwards a single stream
+	if !r.UseTranscoding && (r.RtcStreamUid == nil || *r.RtcStreamUid == "") {
+		errs.Add("rtcStreamUid", "is required when useTranscoding is false")
+	}
+	if r.UseTranscoding && r.VideoOptions != nil {
+		validatePushVideoOptions(errs, r.VideoOptions)
+	}
+	errs.Range("jitterBufferSizeMs", r.JitterBufferSizeMs, 0, 1000)
+}
+
+// Validate checks the channel, stream URL and region of a Cloud Player request.
+func (r *ClientStartCloudPlayerRequest) Validate(errs *request_validation.Errors) {
+	errs.ChannelName("channelName", r.ChannelName)
+	validateStreamUrl(errs, "streamUrl", r.StreamUrl, "rtmp://", "rtmps://", "http://", "https://")
+	errs.OneOf("region", r.Region, validRegions...)
+	if r.Uid != nil {
+		errs.Required("uid", *r.Uid)
+	}
+	if r.AudioOptions != nil {
+		errs.Range("audioOptions.profile", r.AudioOptions.Profile, 0, 5)
+		errs.Range("audioOptions.volume", r.AudioOptions.Volume, 0, 200)
+	}
+	if r.VideoOptions != nil && (r.VideoOptions.Width <= 0 || r.VideoOptions.Height <= 0) {
+		errs.Add("videoOptions", "width and height must be positive")
+	}
+}
+
+// Validate checks the converter ID and region of a stop push request.
+func (r *ClientStopRtmpRequest) Validate(errs *request_validation.Errors) {
+	errs.Required("converterId", r.ConverterId)
+	errs.OneOf("region", r.Region, validRegions...)
+}
+
+// Validate checks the player ID and region of a stop pull request.
+func (r *ClientStopPullRequest) Validate(errs *request_validation.Errors) {
+	errs.Required("playerId", r.PlayerId)
+	errs.OneOf("region", r.Region, validRegions...)
+}
+
+// Validate checks the converter ID and region of an update push request, and that the stream URL and key are set together.
+func (r *ClientUpdateRtmpRequest) Validate(errs *request_validation.Errors) {
+	errs.Required("converterId", r.ConverterId)
+	errs.OneOf("region", r.Region, validRegions...)
+	errs.ChannelName("rtcChannel", r.RtcChannel)
+	if (r.StreamUrl == nil) != (r.StreamKey == nil) {
+		errs.Add("streamUrl", "streamUrl and streamKey must be set together")
+	} else if r.StreamUrl != nil {
+		validateStreamUrl(errs, "streamUrl", *r.StreamUrl, "rtmp://", "rtmps://")
+	}
+	errs.Range("jitterBufferSizeMs", r.JitterBufferSizeMs, 0, 1000)
+}
+
+// Validate checks the player ID, region and stream URL of an update pull request.
+func (r *ClientUpdatePullRequest) Validate(errs *request_validation.Errors) {
+	errs.Required("playerId", r.PlayerId)
+	errs.OneOf("region", r.Region, validRegions...)
+	if r.StreamUrl == nil {
+		errs.Add("streamUrl", "is required")
+	} else {
+		validateStreamUrl(errs, "streamUrl", *r.StreamUrl, "rtmp://", "rtmps://", "http://", "https://")
+	}
+	if r.AudioOptions != nil {
+		errs.Range("audioOptions.profile", r.AudioOptions.Profile, 0, 5)
+		errs.Range("audioOptions.volume", r.AudioOptions.Volume, 0, 200)
+	}
+}
+
+// validatePushVideoOptions checks the canvas and layout of the video transcoding options of a push.
+func validatePushVideoOptions(errs *request_validation.Errors, options *PushVideoOptions) {
+	if options.Canvas.Width <= 0 || options.Canvas.Height <= 0 {
+		errs.Add("videoOptions.canvas", "width and height must be positive")
+	}
+	if options.Bitrate <= 0 {
+		errs.Add("videoOptions.bitrate", "must be positive")
+	}
+	for i, layout := range options.Layout {
+		if layout.RtcStreamUid == "" {
+			errs.Add(fmt.Sprintf("videoOptions.layout[%d].rtcStreamUid", i), "is required")
+		}
+	}
+}
+
+// validateStreamUrl checks that a stream URL is set and uses one of the schemes.
+func validateStreamUrl(errs *request_validation.Errors, field string, streamUrl string, schemes ...string) {
+	if streamUrl == "" {
+		errs.Add(field, "is required")
+		return
+	}
+	for _, scheme := range schemes {
+		if strings.HasPrefix(strings.ToLower(streamUrl), scheme) {
+			return
+		}
+	}
+	errs.Add(field, "must start with %s", strings.Join(schemes, ", "))
+}
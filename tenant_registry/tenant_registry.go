@@ -0,0 +1,361 @@
+package tenant_registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+)
+
+// Headers used to resolve the tenant of a request.
+const (
+	TenantHeader        = "X-Tenant-ID"      // ID of the tenant.
+	TenantKeyHeader     = "X-Tenant-Key"     // API key of the tenant, separate from the X-API-Key credentials of the token routes.
+	ForwardedHostHeader = "X-Forwarded-Host" // Host name the client requested, set by a trusted proxy.
+)
+
+// contextKey is the type of the request context key for the resolved Tenant.
+type contextKey struct{}
+
+// Errors returned when the tenant of a request can't be resolved.
+var (
+	ErrUnknownTenant  = errors.New("unknown tenant")                                                      // The X-Tenant-ID header names a tenant that is not in the registry.
+	ErrTenantMismatch = errors.New("tenant does not match the tenant key, host or caller of the request") // The request names a tenant it isn't allowed to use.
+)
+
+// Registry holds the tenants and resolves the tenant of each request.
+// It is read-only after it is created and safe for concurrent use.
+type Registry struct {
+	tenants         map[string]*Tenant // Tenants by ID.
+	byHost          map[string]*Tenant // Tenants by lower case host name.
+	byAPIKey        map[string]*Tenant // Tenants by API key.
+	defaultTenant   *Tenant            // (Optional) tenant for requests that resolve to no tenant.
+	trustedNetworks []*net.IPNet       // (Optional) networks of the proxies allowed to choose the tenant with the host or the X-Tenant-ID header.
+}
+
+// LoadRegistry reads the tenants from a JSON file and returns a Registry for them.
+//
+// Parameters:
+//   - tenantsFile: string - Path of the JSON file, with a "tenants" array, an optional "defaultTenant" ID and optional "trustedNetworks", see SetTrustedNetworks.
+//   - clientOpts: ...agora_client.Option - Options for the Agora clients of tenants with their own customer credentials.
+//
+// Returns:
+//   - *Registry: The registry of the tenants in the file.
+//   - error: An error if the file can't be read or a tenant is invalid, see NewRegistry.
+func LoadRegistry(tenantsFile string, clientOpts ...agora_client.Option) (*Registry, error) {
+	data, err := os.ReadFile(tenantsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %v", err)
+	}
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file: %v", err)
+	}
+	registry, err := NewRegistry(file.Tenants, file.DefaultTenant, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := registry.SetTrustedNetworks(file.TrustedNetworks); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// NewRegistry validates the tenants and returns a Registry for them.
+//
+// Parameters:
+//   - tenants: []*Tenant - The tenants, each with a unique ID, an app ID and an app certificate.
+//   - defaultTenantID: string - (Optional) ID of the tenant used when a request resolves to no tenant.
+//   - clientOpts: ...agora_client.Option - Options for the Agora clients of tenants with their own customer credentials.
+//
+// Returns:
+//   - *Registry: The registry of the tenants.
+//   - error: An error if a tenant is missing required fields, activates a missing certificate, or an ID, host or API key is used twice.
+//
+// Notes:
+//   - Tenants without customer credentials or storage use the server's, set in the environment.
+func NewRegistry(tenants []*Tenant, defaultTenantID string, clientOpts ...agora_client.Option) (*Registry, error) {
+	registry := &Registry{
+		tenants:  make(map[string]*Tenant),
+		byHost:   make(map[string]*Tenant),
+		byAPIKey: make(map[string]*Tenant),
+	}
+	for _, tenant := range tenants {
+		if tenant.ID == "" || tenant.AppID == "" || tenant.AppCertificate == "" {
+			return nil, errors.New("every tenant requires an id, appId and appCertificate")
+		}
+		if _, exists := registry.tenants[tenant.ID]; exists {
+			return nil, fmt.Errorf("duplicate tenant %q", tenant.ID)
+		}
+		if (tenant.CustomerID == "") != (tenant.CustomerSecret == "") {
+			return nil, fmt.Errorf("tenant %q requires both customerId and customerSecret", tenant.ID)
+		}
+		switch tenant.AppCertificateActive {
+		case "", "primary":
+		case "secondary":
+			if tenant.AppCertificateSecondary == "" {
+				return nil, fmt.Errorf("tenant %q activates the secondary app certificate without an appCertificateSecondary", tenant.ID)
+			}
+		default:
+			return nil, fmt.Errorf("tenant %q has an unknown appCertificateActive %q, use \"primary\" or \"secondary\"", tenant.ID, tenant.AppCertificateActive)
+		}
+		registry.tenants[tenant.ID] = tenant
+
+		for _, host := range tenant.Hosts {
+			host = strings.ToLower(host)
+			if other, exists := registry.byHost[host]; exists {
+				return nil, fmt.Errorf("host %q is used by tenants %q and %q", host, other.ID, tenant.ID)
+			}
+			registry.byHost[host] = tenant
+		}
+		for _, apiKey := range tenant.APIKeys {
+			if apiKey == "" {
+				return nil, fmt.Errorf("tenant %q has an empty API key", tenant.ID)
+			}
+			if other, exists := registry.byAPIKey[apiKey]; exists {
+				return nil, fmt.Errorf("an API key is used by tenants %q and %q", other.ID, tenant.ID)
+			}
+			registry.byAPIKey[apiKey] = tenant
+		}
+
+		if tenant.CustomerID != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(tenant.CustomerID + ":" + tenant.CustomerSecret))
+			tenant.agoraClient = agora_client.NewClient("Basic "+auth, clientOpts...)
+		}
+	}
+
+	if defaultTenantID != "" {
+		defaultTenant, exists := registry.tenants[defaultTenantID]
+		if !exists {
+			return nil, fmt.Errorf("default tenant %q is not in the registry", defaultTenantID)
+		}
+		registry.defaultTenant = defaultTenant
+	}
+	return registry, nil
+}
+
+// SetTrustedNetworks sets the networks of the proxies allowed to choose the tenant of a request with its host or the X-Tenant-ID header,
+// e.g. an API gateway that has already authenticated the client. Other clients can't choose their tenant, see Resolve.
+//
+// Parameters:
+//   - cidrs: []string - The networks in CIDR notation, e.g. "10.0.0.0/8". Empty trusts no client.
+//
+// Returns:
+//   - error: An error if a network is not in CIDR notation.
+func (r *Registry) SetTrustedNetworks(cidrs []string) error {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("invalid trusted network %q: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	r.trustedNetworks = networks
+	return nil
+}
+
+// Get returns the tenant with the given ID.
+func (r *Registry) Get(id string) (*Tenant, bool) {
+	tenant, exists := r.tenants[id]
+	return tenant, exists
+}
+
+// Tenants returns the tenants of the registry, ordered by ID.
+func (r *Registry) Tenants() []*Tenant {
+	tenants := make([]*Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Resolve returns the tenant of a request.
+//
+// Behavior:
+//  1. The X-Tenant-Key header, if it is one of a tenant's API keys.
+//  2. For requests from a trusted network, the X-Forwarded-Host header or the host of the request, if it is one of a tenant's hosts.
+//     The host of other requests is chosen by the client, so it is ignored, see SetTrustedNetworks.
+//  3. The default tenant.
+//  4. The X-Tenant-ID header only chooses the tenant of requests from a trusted network without a tenant API key.
+//     From other clients it must name the tenant resolved above, so a client can't use another tenant's credentials.
+//
+// Returns:
+//   - *Tenant: The tenant, or nil when the request resolves to no tenant and there is no default tenant,
+//     the services then use the server's credentials.
+//   - error: ErrUnknownTenant if the X-Tenant-ID header names a tenant that is not in the registry,
+//     or ErrTenantMismatch if it names another tenant than the one resolved for the request.
+func (r *Registry) Resolve(req *http.Request) (*Tenant, error) {
+	var byAPIKey *Tenant
+	if apiKey := req.Header.Get(TenantKeyHeader); apiKey != "" {
+		byAPIKey = r.byAPIKey[apiKey]
+	}
+	trusted := r.isTrusted(req)
+	tenant := byAPIKey
+	if tenant == nil && trusted {
+		tenant = r.byHost[requestHost(req)]
+	}
+	if tenant == nil {
+		tenant = r.defaultTenant
+	}
+
+	id := req.Header.Get(TenantHeader)
+	if id == "" || (tenant != nil && tenant.ID == id) {
+		return tenant, nil
+	}
+	named, exists := r.tenants[id]
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTenant, id)
+	}
+	if byAPIKey == nil && trusted {
+		return named, nil
+	}
+	return nil, fmt.Errorf("%w: X-Tenant-ID %q", ErrTenantMismatch, id)
+}
+
+// BindCaller returns a copy of the context with the tenant of an authenticated caller, e.g. from a "tenant" claim.
+// The tenant of the request, resolved by Middleware, must be the caller's tenant, only the default tenant is replaced by it.
+//
+// Parameters:
+//   - ctx: context.Context - The request context, see NewContext.
+//   - tenantID: string - The ID of the caller's tenant.
+//
+// Returns:
+//   - context.Context: The context with the caller's tenant.
+//   - error: ErrUnknownTenant if the tenant is not in the registry, or ErrTenantMismatch if the request has another tenant.
+func (r *Registry) BindCaller(ctx context.Context, tenantID string) (context.Context, error) {
+	tenant, exists := r.tenants[tenantID]
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTenant, tenantID)
+	}
+	current, ok := FromContext(ctx)
+	if current == tenant {
+		return ctx, nil
+	}
+	if ok && current != r.defaultTenant {
+		return nil, fmt.Errorf("%w: the caller belongs to tenant %q", ErrTenantMismatch, tenantID)
+	}
+	return NewContext(ctx, tenant), nil
+}
+
+// isTrusted reports whether the request was sent from one of the trusted networks.
+func (r *Registry) isTrusted(req *http.Request) bool {
+	if len(r.trustedNetworks) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.trustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHost returns the lower case host name a client requested, without the port.
+// The X-Forwarded-Host header of a proxy takes precedence over the host of the request, which is then the proxy's.
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if forwarded := req.Header.Get(ForwardedHostHeader); forwarded != "" {
+		host, _, _ = strings.Cut(forwarded, ",")
+		host = strings.TrimSpace(host)
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.ToLower(host)
+}
+
+// Middleware resolves the tenant of each request and adds it to the request context, see FromContext.
+// Returns an HTTP 400 error if the X-Tenant-ID header names an unknown tenant,
+// or an HTTP 403 error if it names another tenant than the request's tenant key or host, see Resolve.
+func (r *Registry) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, err := r.Resolve(c.Request)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrTenantMismatch) {
+				status = http.StatusForbidden
+			}
+			api_errors.Abort(c, status, err)
+			return
+		}
+		if tenant != nil {
+			c.Request = c.Request.WithContext(NewContext(c.Request.Context(), tenant))
+		}
+		c.Next()
+	}
+}
+
+// NewContext returns a copy of the context that carries the tenant.
+func NewContext(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant resolved for the request, if there is one.
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(*Tenant)
+	return tenant, ok && tenant != nil
+}
+
+// IDFromContext returns the ID of the tenant resolved for the request, or "" when the request has no tenant.
+// Services store it with their sessions, so a tenant only sees its own sessions.
+func IDFromContext(ctx context.Context) string {
+	if tenant, ok := FromContext(ctx); ok {
+		return tenant.ID
+	}
+	return ""
+}
+
+// AgoraClientFor returns the Agora client with the customer credentials of the tenant of a request,
+// or the fallback, the server's client, when the request has no tenant or the tenant uses the server's credentials.
+func AgoraClientFor(ctx context.Context, fallback *agora_client.Client) *agora_client.Client {
+	if tenant, ok := FromContext(ctx); ok {
+		return tenant.AgoraClient(fallback)
+	}
+	return fallback
+}
+
+// URLFor returns the Agora API URL for the tenant of a request, with the server's app ID replaced by the tenant's,
+// or the URL unchanged when the request has no tenant, see Tenant.ReplaceAppID.
+func URLFor(ctx context.Context, url string, serverAppID string) string {
+	if tenant, ok := FromContext(ctx); ok {
+		return tenant.ReplaceAppID(url, serverAppID)
+	}
+	return url
+}
+
+// AgoraClient returns the Agora client with the tenant's customer credentials, or the fallback when the tenant has none.
+func (t *Tenant) AgoraClient(fallback *agora_client.Client) *agora_client.Client {
+	if t.agoraClient != nil {
+		return t.agoraClient
+	}
+	return fallback
+}
+
+// ReplaceAppID returns the Agora API URL for the tenant, with the server's app ID replaced by the tenant's.
+// The services build their URLs from templates like "v1/apps/{appId}/cloud_recording" with the server's app ID.
+func (t *Tenant) ReplaceAppID(url string, serverAppID string) string {
+	if serverAppID == "" {
+		return url
+	}
+	return strings.Replace(url, serverAppID, t.AppID, 1)
+}
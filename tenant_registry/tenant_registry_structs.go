@@ -0,0 +1,37 @@
+package tenant_registry
+
+import (
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+)
+
+// Tenant holds the Agora project credentials and settings of one product hosted by the middleware.
+type Tenant struct {
+	ID                      string         `json:"id"`                                // Unique identifier of the tenant, see Registry.Resolve for the X-Tenant-ID header
+	AppID                   string         `json:"appId"`                             // The Agora app ID of the tenant's project
+	AppCertificate          string         `json:"appCertificate"`                    // The primary Agora app certificate of the tenant's project
+	AppCertificateSecondary string         `json:"appCertificateSecondary,omitempty"` // (Optional) the secondary app certificate, tokens signed with either certificate are verified
+	AppCertificateActive    string         `json:"appCertificateActive,omitempty"`    // (Optional) the certificate that signs new tokens: "primary" (default) or "secondary"
+	CustomerID              string         `json:"customerId,omitempty"`              // (Optional) customer ID for the Agora REST APIs, defaults to the server's
+	CustomerSecret          string         `json:"customerSecret,omitempty"`          // (Optional) customer secret for the Agora REST APIs, defaults to the server's
+	Storage                 *TenantStorage `json:"storage,omitempty"`                 // (Optional) cloud storage for recordings and transcriptions, defaults to the server's
+	Hosts                   []string       `json:"hosts,omitempty"`                   // (Optional) host names that resolve the tenant of requests from trusted networks, e.g. "video.example.com"
+	APIKeys                 []string       `json:"apiKeys,omitempty"`                 // (Optional) API keys, sent in the X-Tenant-Key header, that resolve to the tenant
+
+	agoraClient *agora_client.Client // Client with the tenant's customer credentials, nil when the tenant uses the server's
+}
+
+// TenantStorage is the cloud storage configuration of a tenant, see cloud_recording_service.StorageConfig.
+type TenantStorage struct {
+	Vendor    int    `json:"vendor"`
+	Region    int    `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+// registryFile is the JSON format of the tenants file.
+type registryFile struct {
+	DefaultTenant   string    `json:"defaultTenant,omitempty"`   // (Optional) tenant used when a request resolves to no tenant
+	TrustedNetworks []string  `json:"trustedNetworks,omitempty"` // (Optional) networks allowed to choose the tenant with the host or the X-Tenant-ID header
+	Tenants         []*Tenant `json:"tenants"`
+}
@@ -0,0 +1,235 @@
+package tenant_registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/agora_client"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry(t *testing.T, defaultTenantID string) *Registry {
+	registry, err := NewRegistry([]*Tenant{
+		{ID: "video", AppID: "video_app_id", AppCertificate: "video_cert", CustomerID: "video_customer", CustomerSecret: "video_secret", Hosts: []string{"Video.example.com"}, APIKeys: []string{"video-key"}},
+		{ID: "audio", AppID: "audio_app_id", AppCertificate: "audio_cert", Hosts: []string{"audio.example.com"}},
+	}, defaultTenantID)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return registry
+}
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []*Tenant
+		dflt    string
+	}{
+		{name: "Missing app ID", tenants: []*Tenant{{ID: "a", AppCertificate: "cert"}}},
+		{name: "Duplicate ID", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert"}, {ID: "a", AppID: "id", AppCertificate: "cert"}}},
+		{name: "Duplicate host", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert", Hosts: []string{"x.com"}}, {ID: "b", AppID: "id", AppCertificate: "cert", Hosts: []string{"X.com"}}}},
+		{name: "Duplicate API key", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert", APIKeys: []string{"k"}}, {ID: "b", AppID: "id", AppCertificate: "cert", APIKeys: []string{"k"}}}},
+		{name: "Empty API key", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert", APIKeys: []string{""}}}},
+		{name: "Secondary certificate active without one", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert", AppCertificateActive: "secondary"}}},
+		{name: "Unknown active certificate", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert", AppCertificateSecondary: "cert2", AppCertificateActive: "tertiary"}}},
+		{name: "Customer ID without secret", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert", CustomerID: "customer"}}},
+		{name: "Unknown default tenant", tenants: []*Tenant{{ID: "a", AppID: "id", AppCertificate: "cert"}}, dflt: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.tenants, tt.dflt)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	registry := newTestRegistry(t, "")
+	assert.NoError(t, registry.SetTrustedNetworks([]string{"10.0.0.0/8"}))
+
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		headers    map[string]string
+		wantTenant string
+		wantErr    error
+	}{
+		{name: "Tenant key", host: "audio.example.com", headers: map[string]string{TenantKeyHeader: "video-key"}, wantTenant: "video"},
+		{name: "Unknown tenant key falls back to the host", host: "audio.example.com", remoteAddr: "10.1.2.3:4000", headers: map[string]string{TenantKeyHeader: "other-key"}, wantTenant: "audio"},
+		{name: "Token API key doesn't choose the tenant", headers: map[string]string{"X-API-Key": "video-key"}},
+		{name: "Host with port", host: "VIDEO.example.com:8080", remoteAddr: "10.1.2.3:4000", wantTenant: "video"},
+		{name: "Forwarded host", host: "proxy.internal", remoteAddr: "10.1.2.3:4000", headers: map[string]string{ForwardedHostHeader: "audio.example.com, proxy.internal"}, wantTenant: "audio"},
+		{name: "Untrusted host is ignored", host: "video.example.com"},
+		{name: "Untrusted forwarded host is ignored", headers: map[string]string{ForwardedHostHeader: "video.example.com"}},
+		{name: "No tenant", host: "localhost:8080"},
+		{name: "Tenant header matching the host", host: "audio.example.com", remoteAddr: "10.1.2.3:4000", headers: map[string]string{TenantHeader: "audio"}, wantTenant: "audio"},
+		{name: "Tenant header matching the tenant key", headers: map[string]string{TenantKeyHeader: "video-key", TenantHeader: "video"}, wantTenant: "video"},
+		{name: "Unknown tenant header", headers: map[string]string{TenantHeader: "other"}, wantErr: ErrUnknownTenant},
+		{name: "Tenant header can't choose the tenant", host: "localhost:8080", headers: map[string]string{TenantHeader: "video"}, wantErr: ErrTenantMismatch},
+		{name: "Tenant header can't override the tenant key", headers: map[string]string{TenantKeyHeader: "video-key", TenantHeader: "audio"}, wantErr: ErrTenantMismatch},
+		{name: "Trusted network chooses the tenant", host: "audio.example.com", remoteAddr: "10.1.2.3:4000", headers: map[string]string{TenantHeader: "video"}, wantTenant: "video"},
+		{name: "Trusted network can't override the tenant key", remoteAddr: "10.1.2.3:4000", headers: map[string]string{TenantKeyHeader: "video-key", TenantHeader: "audio"}, wantErr: ErrTenantMismatch},
+		{name: "Untrusted network", remoteAddr: "203.0.113.7:4000", headers: map[string]string{TenantHeader: "video"}, wantErr: ErrTenantMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ping", nil)
+			req.Host = tt.host
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			tenant, err := registry.Resolve(req)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, tenant)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.wantTenant == "" {
+				assert.Nil(t, tenant)
+			} else if assert.NotNil(t, tenant) {
+				assert.Equal(t, tt.wantTenant, tenant.ID)
+			}
+		})
+	}
+
+	t.Run("Default tenant", func(t *testing.T) {
+		registry := newTestRegistry(t, "audio")
+		tenant, err := registry.Resolve(httptest.NewRequest("GET", "/ping", nil))
+		assert.NoError(t, err)
+		if assert.NotNil(t, tenant) {
+			assert.Equal(t, "audio", tenant.ID)
+		}
+
+		// The header can't switch from the default tenant either
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.Header.Set(TenantHeader, "video")
+		_, err = registry.Resolve(req)
+		assert.ErrorIs(t, err, ErrTenantMismatch)
+	})
+
+	t.Run("Invalid trusted network", func(t *testing.T) {
+		assert.Error(t, registry.SetTrustedNetworks([]string{"10.0.0.1"}))
+	})
+}
+
+func TestBindCaller(t *testing.T) {
+	registry := newTestRegistry(t, "audio")
+	video, _ := registry.Get("video")
+	audio, _ := registry.Get("audio")
+
+	// A request without a tenant, or with the default tenant, is bound to the caller's tenant
+	for _, ctx := range []context.Context{context.Background(), NewContext(context.Background(), audio)} {
+		bound, err := registry.BindCaller(ctx, "video")
+		assert.NoError(t, err)
+		assert.Equal(t, "video", IDFromContext(bound))
+	}
+
+	// The caller's own tenant is kept
+	bound, err := registry.BindCaller(NewContext(context.Background(), video), "video")
+	assert.NoError(t, err)
+	assert.Equal(t, "video", IDFromContext(bound))
+
+	// A caller of one tenant can't use another tenant resolved by tenant key or host
+	otherRegistry := newTestRegistry(t, "")
+	_, err = otherRegistry.BindCaller(NewContext(context.Background(), audio), "video")
+	assert.ErrorIs(t, err, ErrTenantMismatch)
+
+	_, err = registry.BindCaller(context.Background(), "other")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := newTestRegistry(t, "")
+	router := gin.New()
+	router.Use(registry.Middleware())
+	router.GET("/tenant", func(c *gin.Context) {
+		c.String(http.StatusOK, IDFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{name: "Tenant key", headers: map[string]string{TenantKeyHeader: "video-key"}, wantCode: http.StatusOK, wantBody: "video"},
+		{name: "No tenant", wantCode: http.StatusOK},
+		{name: "Unknown tenant", headers: map[string]string{TenantHeader: "other"}, wantCode: http.StatusBadRequest},
+		{name: "Another tenant than the tenant key", headers: map[string]string{TenantKeyHeader: "video-key", TenantHeader: "audio"}, wantCode: http.StatusForbidden},
+		{name: "Tenant header without credentials", headers: map[string]string{TenantHeader: "video"}, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/tenant", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTenantCredentials(t *testing.T) {
+	registry := newTestRegistry(t, "")
+	fallback := agora_client.NewClient("Basic server")
+
+	video, _ := registry.Get("video")
+	audio, _ := registry.Get("audio")
+	assert.NotSame(t, fallback, video.AgoraClient(fallback))
+	assert.Same(t, fallback, audio.AgoraClient(fallback))
+
+	assert.Equal(t, "https://api.agora.io/v1/apps/video_app_id/cloud_recording", video.ReplaceAppID("https://api.agora.io/v1/apps/server_app_id/cloud_recording", "server_app_id"))
+
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+	ctx := NewContext(context.Background(), video)
+	assert.Equal(t, "video", IDFromContext(ctx))
+
+	// Requests without a tenant use the server's client and URL
+	const serverURL = "https://api.agora.io/v1/apps/server_app_id/rtt"
+	assert.Same(t, fallback, AgoraClientFor(context.Background(), fallback))
+	assert.Equal(t, serverURL, URLFor(context.Background(), serverURL, "server_app_id"))
+	assert.Same(t, video.AgoraClient(fallback), AgoraClientFor(ctx, fallback))
+	assert.Equal(t, "https://api.agora.io/v1/apps/video_app_id/rtt", URLFor(ctx, serverURL, "server_app_id"))
+	assert.Same(t, fallback, AgoraClientFor(NewContext(context.Background(), audio), fallback))
+}
+
+func TestLoadRegistry(t *testing.T) {
+	tenantsFile := filepath.Join(t.TempDir(), "tenants.json")
+	os.WriteFile(tenantsFile, []byte(`{
+		"defaultTenant": "video",
+		"trustedNetworks": ["10.0.0.0/8", "fd00::/8"],
+		"tenants": [
+			{"id": "video", "appId": "video_app_id", "appCertificate": "video_cert", "storage": {"vendor": 1, "region": 0, "bucket": "video-bucket", "accessKey": "key", "secretKey": "secret"}}
+		]
+	}`), 0600)
+
+	registry, err := LoadRegistry(tenantsFile)
+	if assert.NoError(t, err) {
+		tenant, ok := registry.Get("video")
+		assert.True(t, ok)
+		assert.Equal(t, "video-bucket", tenant.Storage.Bucket)
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = "10.1.2.3:4000"
+		assert.True(t, registry.isTrusted(req))
+	}
+
+	_, err = LoadRegistry(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -1,33 +1,89 @@
 package token_service
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"net/http"
 	"os"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
 	"github.com/gin-gonic/gin"
 )
 
 // TokenService represents the main application token service.
 // It holds the necessary configurations and dependencies for managing tokens.
 type TokenService struct {
-	Server         *http.Server   // The HTTP server for the application
-	Sigint         chan os.Signal // Channel to handle OS signals, such as Ctrl+C
-	appID          string         // The Agora app ID
-	appCertificate string         // The Agora app certificate
+	Server              *http.Server                // The HTTP server for the application
+	Sigint              chan os.Signal              // Channel to handle OS signals, such as Ctrl+C
+	appID               string                      // The Agora app ID
+	certificates        *AppCertificates            // The Agora app certificates, the active one signs new tokens
+	maxBatchSize        int                         // The maximum number of token requests in a batch
+	authenticators      []Authenticator             // (Optional) authenticators for the token routes, the routes are open when empty
+	policy              *Policy                     // (Optional) policy limiting the tokens each caller may request
+	adminAuthenticators []Authenticator             // (Optional) authenticators for the admin routes, the routes are only registered when set
+	legacyRoutes        bool                        // Whether the routes compatible with the community agora-token-service are registered
+	uidDirectory        *uid_directory.Directory    // (Optional) directory that resolves the accounts of token requests to integer UIDs
+	tenantID            string                      // The tenant of the service returned by ForContext, used to resolve accounts
+	tenantRegistry      *tenant_registry.Registry   // (Optional) registry of the tenants callers are bound to by their "tenant" claim
+	tenantCertificates  map[string]*AppCertificates // The app certificates of each tenant of the registry, by tenant ID
+	auditSink           AuditSink                   // (Optional) sink that records every token request, see SetAuditSink
 }
 
+// DefaultMaxBatchSize is the maximum number of token requests in a batch, unless set with SetMaxBatchSize.
+const DefaultMaxBatchSize = 50
+
 // TokenRequest is a struct representing the JSON payload structure for token generation requests.
 // It contains fields necessary for generating different types of tokens (RTC, RTM, or chat) based on the "TokenType".
 // The "Channel", "RtcRole", "Uid", and "ExpirationSeconds" fields are used for specific token types.
+// The privilege expirations are optional and only used for RTC tokens, they set how long each RTC privilege is valid.
 //
-// TokenType options: "rtc" for RTC token, "rtm" for RTM token, and "chat" for chat token.
+// TokenType options: "rtc" for RTC token, "rtm" for RTM token, "chat" for chat token, and "rtc+rtm" for a token with both the RTC and RTM services.
+// "rtc+rtm" requests use the RTC fields and rules, the RTM service is for the same UID or account.
 type TokenRequest struct {
-	TokenType         string `json:"tokenType"`         // The token type: "rtc", "rtm", or "chat"
-	Channel           string `json:"channel,omitempty"` // The channel name (used for RTC and RTM tokens)
-	RtcRole           string `json:"role,omitempty"`    // The role of the user for RTC tokens (publisher or subscriber)
-	Uid               string `json:"uid,omitempty"`     // The user ID or account (used for RTC, RTM, and some chat tokens)
-	ExpirationSeconds int    `json:"expire,omitempty"`  // The token expiration time in seconds (used for all token types)
+	TokenType                    string `json:"tokenType"`                              // The token type: "rtc", "rtm", "chat", or "rtc+rtm"
+	Channel                      string `json:"channel,omitempty"`                      // The channel name (used for RTC and RTM tokens)
+	RtcRole                      string `json:"role,omitempty"`                         // The role of the user for RTC tokens (publisher or subscriber)
+	Uid                          string `json:"uid,omitempty"`                          // The user ID or account (used for RTC, RTM, and some chat tokens)
+	Account                      string `json:"account,omitempty"`                      // (Optional) user account to resolve to an integer UID with the UID directory, instead of the uid (RTC only)
+	ExpirationSeconds            int    `json:"expire,omitempty"`                       // The token expiration time in seconds (used for all token types)
+	JoinChannelPrivilegeExpire   int    `json:"joinChannelPrivilegeExpire,omitempty"`   // (Optional) seconds the user can join the channel (RTC only)
+	PubAudioPrivilegeExpire      int    `json:"pubAudioPrivilegeExpire,omitempty"`      // (Optional) seconds the user can publish audio (RTC only)
+	PubVideoPrivilegeExpire      int    `json:"pubVideoPrivilegeExpire,omitempty"`      // (Optional) seconds the user can publish video (RTC only)
+	PubDataStreamPrivilegeExpire int    `json:"pubDataStreamPrivilegeExpire,omitempty"` // (Optional) seconds the user can publish data streams (RTC only)
+	SeparateTokens               bool   `json:"separateTokens,omitempty"`               // (Optional) return separate RTC and RTM tokens instead of a combined token (rtc+rtm only)
+}
+
+// TokenResponse is the response of the token endpoint.
+type TokenResponse struct {
+	Token     string `json:"token,omitempty"`    // The generated token
+	RtcToken  string `json:"rtcToken,omitempty"` // The generated RTC token, for rtc+rtm requests with separate tokens
+	RtmToken  string `json:"rtmToken,omitempty"` // The generated RTM token, for rtc+rtm requests with separate tokens
+	ExpiresAt int64  `json:"expiresAt"`          // Unix timestamp (s) when the token expires
+	Uid       string `json:"uid,omitempty"`      // The UID resolved for the account of the request, if any
+}
+
+// TokenBatchResult is the result for a single TokenRequest in a batch, it contains either the token or the error.
+type TokenBatchResult struct {
+	Index     int    `json:"index"`              // Position of the request in the batch
+	TokenType string `json:"tokenType"`          // The token type of the request
+	Channel   string `json:"channel,omitempty"`  // The channel name of the request
+	Uid       string `json:"uid,omitempty"`      // The user ID or account of the request, or the UID resolved for the account
+	Account   string `json:"account,omitempty"`  // The user account of the request, if any
+	Token     string `json:"token,omitempty"`    // The generated token
+	RtcToken  string `json:"rtcToken,omitempty"` // The generated RTC token, for rtc+rtm requests with separate tokens
+	RtmToken  string `json:"rtmToken,omitempty"` // The generated RTM token, for rtc+rtm requests with separate tokens
+	Error     string `json:"error,omitempty"`    // The error if the token could not be generated
+	err       error  // The error if the token could not be generated, for the audit log
+}
+
+// TokenBatchResponse is the response of the batch endpoint, with a result for each request in the same order.
+type TokenBatchResponse struct {
+	Results   []TokenBatchResult `json:"results"`   // Results in the order of the requests
+	Succeeded int                `json:"succeeded"` // Number of tokens generated
+	Failed    int                `json:"failed"`    // Number of requests that failed
 }
 
 // NewTokenService initializes and returns a TokenService pointer with all configurations set.
@@ -46,10 +102,45 @@ type TokenRequest struct {
 //
 // Notes:
 //   - The necessary environment variables should be set before initializing the TokenService.
+//   - The app certificate is the primary certificate, use Certificates to add a secondary certificate and switch between them.
 func NewTokenService(appIDEnv string, appCertEnv string) *TokenService {
 	return &TokenService{
-		appID:          appIDEnv,
-		appCertificate: appCertEnv,
+		appID:        appIDEnv,
+		certificates: staticCertificates(appCertEnv),
+		maxBatchSize: DefaultMaxBatchSize,
+	}
+}
+
+// ForContext returns the TokenService for the tenant of a request, with the tenant's app ID and certificates.
+// Returns the service itself when the request has no tenant, see tenant_registry.FromContext.
+// Tenants of the registry share their AppCertificates across requests, so switching the signing certificate applies to later requests.
+func (s *TokenService) ForContext(ctx context.Context) *TokenService {
+	tenant, ok := tenant_registry.FromContext(ctx)
+	if !ok {
+		return s
+	}
+	tenantService := *s
+	tenantService.appID = tenant.AppID
+	if certificates, ok := s.tenantCertificates[tenant.ID]; ok {
+		tenantService.certificates = certificates
+	} else {
+		tenantService.certificates = staticCertificates(tenant.AppCertificate)
+	}
+	tenantService.tenantID = tenant.ID
+	return &tenantService
+}
+
+// SetUIDDirectory sets the directory that resolves the "account" of token requests to integer UIDs.
+// Token requests with an account are rejected when no directory is set.
+func (s *TokenService) SetUIDDirectory(directory *uid_directory.Directory) {
+	s.uidDirectory = directory
+}
+
+// SetMaxBatchSize sets the maximum number of token requests accepted by the batch endpoint.
+// Values below 1 keep the current maximum.
+func (s *TokenService) SetMaxBatchSize(maxBatchSize int) {
+	if maxBatchSize > 0 {
+		s.maxBatchSize = maxBatchSize
 	}
 }
 
@@ -61,14 +152,34 @@ func NewTokenService(appIDEnv string, appCertEnv string) *TokenService {
 //
 // Behavior:
 //   - Creates an API group for token routes.
-//   - Applies middleware for NoCache and CORS.
-//   - Registers routes for getting a new token.
+//   - Applies the Authenticate middleware, which verifies the caller when authenticators are set.
+//   - Registers routes for getting a new token, a batch of tokens, and inspecting a token.
+//   - Registers the admin routes for the app certificates when admin authenticators are set,
+//     and the admin routes for the audit log when an audit sink is also set.
+//   - Registers the routes compatible with the community agora-token-service when enabled, see SetLegacyRoutes.
 //
 // Notes:
 //   - This function organizes the API routes and ensures that requests are handled with appropriate middleware.
 func (s *TokenService) RegisterRoutes(r *gin.Engine) {
 	api := r.Group("/token")
+	api.Use(s.Authenticate())
 	api.POST("/getNew", s.GetToken)
+	api.POST("/batch", s.GetTokenBatch)
+	api.POST("/inspect", s.InspectToken)
+
+	if len(s.adminAuthenticators) > 0 {
+		admin := r.Group("/token/admin")
+		admin.Use(authenticate(s.adminAuthenticators, nil))
+		admin.GET("/certificates", s.GetCertificates)
+		admin.POST("/certificates/activate", s.ActivateCertificate)
+		if s.auditSink != nil {
+			admin.GET("/audit", s.GetAuditLog)
+			admin.GET("/audit/stats", s.GetAuditStats)
+		}
+	}
+	if s.legacyRoutes {
+		s.registerLegacyRoutes(r)
+	}
 }
 
 // GetToken handles the HTTP request to generate a token based on the provided TokenRequest.
@@ -80,10 +191,11 @@ func (s *TokenService) RegisterRoutes(r *gin.Engine) {
 //
 // Behavior:
 //   - Parses the request body into a TokenRequest struct.
-//   - Forwards the HTTP response writer and request to the HandleGetToken method for processing.
+//   - Returns an HTTP 403 error if the policy does not allow the caller to request the token.
+//   - Generates the token with the credentials of the request's tenant, as HandleGetToken does.
+//   - Records the outcome in the audit log when an audit sink is set.
 //
 // Notes:
-//   - This function acts as an intermediary to invoke the HandleGetToken method.
 //   - It handles parsing the request body and passing it to the token generation logic.
 //
 // Example usage:
@@ -94,10 +206,64 @@ func (s *TokenService) GetToken(c *gin.Context) {
 	var respWriter = c.Writer
 	var tokenReq TokenRequest
 	// Parse the request body into a TokenRequest struct
-	err := json.NewDecoder(req.Body).Decode(&tokenReq)
-	if err != nil {
-		http.Error(respWriter, err.Error(), http.StatusBadRequest)
+	if !request_validation.BindJSON(c, &tokenReq) {
 		return
 	}
-	s.HandleGetToken(tokenReq, respWriter)
+	if err := s.authorize(c, tokenReq); err != nil {
+		s.RecordAudit(c, NewAuditEvent("getNew", tokenReq, 0, err))
+		api_errors.Abort(c, http.StatusForbidden, err)
+		return
+	}
+	tokenReq, response, status, err := s.ForContext(req.Context()).issueToken(tokenReq)
+	s.RecordAudit(c, NewAuditEvent("getNew", tokenReq, response.ExpiresAt, err))
+	writeTokenResponse(respWriter, response, status, err)
+}
+
+// GetTokenBatch handles the HTTP request to generate the tokens for an array of TokenRequests.
+// Returns an HTTP 400 error if the body is not an array of TokenRequests, is empty, or has more requests than the maximum batch size.
+// Each request gets its own result, so one invalid or forbidden request does not fail the batch.
+// Each request is recorded in the audit log when an audit sink is set.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.POST("/batch", TokenService.GetTokenBatch)
+func (s *TokenService) GetTokenBatch(c *gin.Context) {
+	var tokenReqs []TokenRequest
+	if !request_validation.BindJSON(c, &tokenReqs) {
+		return
+	}
+	if len(tokenReqs) == 0 {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "At least one token request is required")
+		return
+	}
+	maxBatchSize := s.maxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = DefaultMaxBatchSize
+	}
+	if len(tokenReqs) > maxBatchSize {
+		api_errors.AbortMessage(c, http.StatusBadRequest, fmt.Sprintf("Batch has %d token requests, the maximum is %d", len(tokenReqs), maxBatchSize))
+		return
+	}
+
+	response := s.ForContext(c.Request.Context()).HandleGetTokenBatch(tokenReqs, func(tokenReq TokenRequest) error {
+		return s.authorize(c, tokenReq)
+	})
+	for _, result := range response.Results {
+		tokenReq := tokenReqs[result.Index]
+		tokenReq.Uid = result.Uid
+		var expiresAt int64
+		if result.err == nil {
+			// Separate tokens expire at the same time
+			token := result.Token
+			if token == "" {
+				token = result.RtcToken
+			}
+			expiresAt, _ = tokenExpiresAt(token)
+		}
+		s.RecordAudit(c, NewAuditEvent("batch", tokenReq, expiresAt, result.err))
+	}
+	c.JSON(http.StatusOK, response)
 }
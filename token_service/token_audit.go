@@ -0,0 +1,533 @@
+package token_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+// Outcomes of a token request recorded in AuditEvent.Outcome.
+const (
+	AuditOutcomeIssued = "issued" // The token was generated
+	AuditOutcomeDenied = "denied" // The policy did not allow the caller to request the token
+	AuditOutcomeFailed = "failed" // The request was invalid or the token could not be generated
+)
+
+// Limits of the number of events returned by the audit log endpoint.
+const (
+	DefaultAuditQueryLimit = 100
+	MaxAuditQueryLimit     = 1000
+)
+
+// AuditEvent is an entry of the audit log, recorded for each token request.
+type AuditEvent struct {
+	Time       time.Time `json:"time"`                 // The time the request was handled
+	Source     string    `json:"source"`               // The route of the request: "getNew", "batch", "legacy" or "invite"
+	Caller     string    `json:"caller,omitempty"`     // The authenticated caller, empty when the token routes are open
+	AuthMethod string    `json:"authMethod,omitempty"` // The authentication method of the caller: "apikey", "hmac" or "jwt"
+	ClientIP   string    `json:"clientIp,omitempty"`   // The IP address of the client, only taken from X-Forwarded-For behind the router's trusted proxies
+	TenantID   string    `json:"tenantId,omitempty"`   // The tenant of the request, if any
+	TokenType  string    `json:"tokenType"`            // The token type of the request
+	Channel    string    `json:"channel,omitempty"`    // The channel name of the request
+	Uid        string    `json:"uid,omitempty"`        // The user ID of the request, or the UID resolved for the account
+	Account    string    `json:"account,omitempty"`    // The user account of the request, if any
+	Role       string    `json:"role,omitempty"`       // The RTC role of the token, once defaults are applied
+	Expire     int       `json:"expire"`               // The token expiration in seconds, once defaults are applied
+	ExpiresAt  int64     `json:"expiresAt,omitempty"`  // Unix timestamp (s) when the issued token expires
+	Outcome    string    `json:"outcome"`              // "issued", "denied" or "failed"
+	Error      string    `json:"error,omitempty"`      // The error if the token was not issued
+}
+
+// AuditFilter selects the events returned by AuditSink.Query, empty fields match all events.
+type AuditFilter struct {
+	Channel  string    // Only events for this channel
+	Uid      string    // Only events for this UID or account
+	Caller   string    // Only events of this caller
+	TenantID string    // Only events of this tenant
+	Outcome  string    // Only events with this outcome
+	From     time.Time // Only events at or after this time
+	To       time.Time // Only events before this time
+	Limit    int       // The maximum number of events, the most recent are returned, 0 for no limit
+}
+
+// AuditStats are the counters of the audit log for a channel and RTC role.
+type AuditStats struct {
+	Channel string `json:"channel"`        // The channel name, empty for tokens without a channel
+	Role    string `json:"role,omitempty"` // The RTC role, empty for non RTC tokens
+	Issued  int    `json:"issued"`         // Number of tokens issued
+	Denied  int    `json:"denied"`         // Number of requests denied by the policy
+	Failed  int    `json:"failed"`         // Number of requests that failed
+}
+
+// AuditSink records the audit log of the token service and searches it.
+// Implementations must be safe for concurrent use, and should only ever append events.
+type AuditSink interface {
+	// Record appends an event to the audit log.
+	Record(event AuditEvent) error
+	// Query returns the events matching the filter, most recent first.
+	Query(filter AuditFilter) ([]AuditEvent, error)
+}
+
+// AuditStatsSink is implemented by audit sinks that count the outcomes without returning every matching event,
+// e.g. from running counters. The stats of other sinks are summarized from the events returned by Query.
+type AuditStatsSink interface {
+	// Stats returns the counters of the events matching the filter per channel and role, see SummarizeAudit. The limit is ignored.
+	Stats(filter AuditFilter) ([]AuditStats, error)
+}
+
+// SetAuditSink sets the sink that records every token request, and enables the audit admin routes.
+// Token requests are not audited when no sink is set.
+func (s *TokenService) SetAuditSink(sink AuditSink) {
+	s.auditSink = sink
+}
+
+// NewAuditEvent returns the audit event of a token request, with the role and expiration once defaults are applied.
+// The outcome is "issued" when err is nil, "denied" when err wraps ErrForbidden, and "failed" otherwise.
+// The caller, client IP and time are set by RecordAudit.
+func NewAuditEvent(source string, tokenReq TokenRequest, expiresAt int64, err error) AuditEvent {
+	role, expire := effectiveRoleAndExpire(tokenReq)
+	event := AuditEvent{
+		Source:    source,
+		TokenType: tokenReq.TokenType,
+		Channel:   tokenReq.Channel,
+		Uid:       tokenReq.Uid,
+		Account:   tokenReq.Account,
+		Role:      role,
+		Expire:    expire,
+		ExpiresAt: expiresAt,
+		Outcome:   AuditOutcomeIssued,
+	}
+	if err != nil {
+		event.Outcome = AuditOutcomeFailed
+		if errors.Is(err, ErrForbidden) {
+			event.Outcome = AuditOutcomeDenied
+		}
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// RecordAudit records an audit event for a request, filling in the time, client IP, authenticated caller and tenant when not set.
+// Does nothing when no audit sink is set. Failing to record the event is logged and does not fail the request.
+func (s *TokenService) RecordAudit(c *gin.Context, event AuditEvent) {
+	if s.auditSink == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.ClientIP == "" {
+		event.ClientIP = c.ClientIP()
+	}
+	if caller, ok := CallerFromContext(c); ok && event.Caller == "" {
+		event.Caller = caller.Subject
+		event.AuthMethod = caller.Method
+	}
+	if event.TenantID == "" {
+		event.TenantID = tenant_registry.IDFromContext(c.Request.Context())
+	}
+	if err := s.auditSink.Record(event); err != nil {
+		log.Println("Error recording token audit event:", err)
+	}
+}
+
+// GetAuditLog handles the HTTP request to search the audit log.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Behavior:
+//   - Reads the filter from the "channel", "uid", "caller", "tenant", "outcome", "from", "to" and "limit" query parameters.
+//   - "from" and "to" are RFC 3339 times or unix timestamps (s), "limit" defaults to DefaultAuditQueryLimit.
+//   - Responds with the matching events, most recent first.
+//
+// Example usage:
+//
+//	router.GET("/token/admin/audit", TokenService.GetAuditLog)
+func (s *TokenService) GetAuditLog(c *gin.Context) {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	filter.Limit = DefaultAuditQueryLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		filter.Limit, err = strconv.Atoi(limitParam)
+		if err != nil || filter.Limit < 1 || filter.Limit > MaxAuditQueryLimit {
+			api_errors.AbortMessage(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", MaxAuditQueryLimit))
+			return
+		}
+	}
+
+	events, err := s.auditSink.Query(filter)
+	if err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events, "count": len(events)})
+}
+
+// GetAuditStats handles the HTTP request for the counters of the audit log per channel and role.
+// Accepts the same filter query parameters as GetAuditLog, except "limit", and counts all matching events.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.GET("/token/admin/audit/stats", TokenService.GetAuditStats)
+func (s *TokenService) GetAuditStats(c *gin.Context) {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	var stats []AuditStats
+	if statsSink, ok := s.auditSink.(AuditStatsSink); ok {
+		stats, err = statsSink.Stats(filter)
+	} else {
+		var events []AuditEvent
+		events, err = s.auditSink.Query(filter)
+		stats = SummarizeAudit(events)
+	}
+	if err != nil {
+		api_errors.Abort(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+// auditFilterFromQuery reads an AuditFilter from the query parameters of a request, without the limit.
+func auditFilterFromQuery(c *gin.Context) (AuditFilter, error) {
+	filter := AuditFilter{
+		Channel:  c.Query("channel"),
+		Uid:      c.Query("uid"),
+		Caller:   c.Query("caller"),
+		TenantID: c.Query("tenant"),
+		Outcome:  c.Query("outcome"),
+	}
+	switch filter.Outcome {
+	case "", AuditOutcomeIssued, AuditOutcomeDenied, AuditOutcomeFailed:
+	default:
+		return filter, fmt.Errorf("outcome must be %q, %q or %q", AuditOutcomeIssued, AuditOutcomeDenied, AuditOutcomeFailed)
+	}
+	var err error
+	if filter.From, err = parseAuditTime(c.Query("from")); err != nil {
+		return filter, fmt.Errorf("invalid from: %v", err)
+	}
+	if filter.To, err = parseAuditTime(c.Query("to")); err != nil {
+		return filter, fmt.Errorf("invalid to: %v", err)
+	}
+	return filter, nil
+}
+
+// parseAuditTime parses an RFC 3339 time or a unix timestamp (s), an empty value is the zero time.
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 time or a unix timestamp")
+	}
+	return t, nil
+}
+
+// Matches reports whether the event is selected by the filter, ignoring the limit.
+func (f AuditFilter) Matches(event AuditEvent) bool {
+	switch {
+	case f.Channel != "" && event.Channel != f.Channel:
+		return false
+	case f.Uid != "" && event.Uid != f.Uid && event.Account != f.Uid:
+		return false
+	case f.Caller != "" && event.Caller != f.Caller:
+		return false
+	case f.TenantID != "" && event.TenantID != f.TenantID:
+		return false
+	case f.Outcome != "" && event.Outcome != f.Outcome:
+		return false
+	case !f.From.IsZero() && event.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !event.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// filterAuditEvents returns the events that match the filter, most recent first and up to its limit.
+// The events must be in recording order.
+func filterAuditEvents(events []AuditEvent, filter AuditFilter) []AuditEvent {
+	matches := []AuditEvent{}
+	for i := len(events) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(matches) == filter.Limit {
+			break
+		}
+		if filter.Matches(events[i]) {
+			matches = append(matches, events[i])
+		}
+	}
+	return matches
+}
+
+// SummarizeAudit counts the outcomes of the events per channel and role, ordered by channel then role.
+func SummarizeAudit(events []AuditEvent) []AuditStats {
+	counters := make(auditCounters)
+	for _, event := range events {
+		counters.add(event.Channel, event.Role, event.Outcome, 1)
+	}
+	return counters.summary()
+}
+
+// auditCounters counts the outcomes of audit events per channel and role.
+type auditCounters map[auditStatsKey]*AuditStats
+
+// auditStatsKey is the channel and role of the counters in auditCounters.
+type auditStatsKey struct{ channel, role string }
+
+// add adds count events with the outcome for the channel and role.
+func (counters auditCounters) add(channel string, role string, outcome string, count int) {
+	key := auditStatsKey{channel, role}
+	stats, ok := counters[key]
+	if !ok {
+		stats = &AuditStats{Channel: channel, Role: role}
+		counters[key] = stats
+	}
+	switch outcome {
+	case AuditOutcomeIssued:
+		stats.Issued += count
+	case AuditOutcomeDenied:
+		stats.Denied += count
+	default:
+		stats.Failed += count
+	}
+}
+
+// summary returns the counters ordered by channel then role.
+func (counters auditCounters) summary() []AuditStats {
+	summary := make([]AuditStats, 0, len(counters))
+	for _, stats := range counters {
+		summary = append(summary, *stats)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Channel == summary[j].Channel {
+			return summary[i].Role < summary[j].Role
+		}
+		return summary[i].Channel < summary[j].Channel
+	})
+	return summary
+}
+
+// MemoryAuditSink keeps the audit log in memory. The log is lost when the server restarts.
+type MemoryAuditSink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+// NewMemoryAuditSink returns an empty in-memory audit sink.
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+// Record appends an event to the audit log.
+func (m *MemoryAuditSink) Record(event AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+// Query returns the events matching the filter, most recent first.
+func (m *MemoryAuditSink) Query(filter AuditFilter) ([]AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return filterAuditEvents(m.events, filter), nil
+}
+
+// auditScanChunkSize is the number of bytes JSONLAuditSink reads at a time when it scans the audit log file.
+const auditScanChunkSize = 64 * 1024
+
+// JSONLAuditSink appends the audit log to a file with one JSON encoded event per line.
+// The file is only ever appended to, so it can be shipped or rotated by external tools.
+//
+// Queries read the file without blocking Record, from the most recent event back until the limit is reached.
+// The sink keeps running counters of the outcomes, so the stats of a channel, tenant or outcome don't need a scan.
+type JSONLAuditSink struct {
+	mu       sync.Mutex               // Guards file and counters
+	path     string                   // The audit log file
+	file     *os.File                 // The audit log file, opened for appending
+	counters map[string]auditCounters // Counters of the outcomes of the events in the file, by tenant
+}
+
+// NewJSONLAuditSink returns an audit sink that appends to the JSON lines file at path, creating it when missing.
+// The events already in the file are counted once, for the running counters.
+func NewJSONLAuditSink(path string) (*JSONLAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log file: %v", err)
+	}
+	sink := &JSONLAuditSink{path: path, file: file, counters: make(map[string]auditCounters)}
+	err = sink.scanBackward(func(event AuditEvent) bool {
+		sink.count(event)
+		return true
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+// Record appends an event to the audit log file as a single line.
+func (j *JSONLAuditSink) Record(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding audit event: %v", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing audit log file: %v", err)
+	}
+	j.count(event)
+	return nil
+}
+
+// Query scans the audit log file from the most recent event and returns the events matching the filter, most recent first.
+// The scan stops once the limit is reached. Lines that are not valid events, e.g. a line partially written during a crash, are skipped.
+func (j *JSONLAuditSink) Query(filter AuditFilter) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	err := j.scanBackward(func(event AuditEvent) bool {
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+		return filter.Limit == 0 || len(events) < filter.Limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Stats returns the counters of the events matching the filter per channel and role, see SummarizeAudit.
+// Filters on the channel, tenant and outcome are answered from the running counters, other filters scan the audit log file.
+func (j *JSONLAuditSink) Stats(filter AuditFilter) ([]AuditStats, error) {
+	counters := make(auditCounters)
+	if filter.Uid != "" || filter.Caller != "" || !filter.From.IsZero() || !filter.To.IsZero() {
+		err := j.scanBackward(func(event AuditEvent) bool {
+			if filter.Matches(event) {
+				counters.add(event.Channel, event.Role, event.Outcome, 1)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return counters.summary(), nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for tenantID, tenantCounters := range j.counters {
+		if filter.TenantID != "" && tenantID != filter.TenantID {
+			continue
+		}
+		for key, stats := range tenantCounters {
+			if filter.Channel != "" && key.channel != filter.Channel {
+				continue
+			}
+			for outcome, count := range map[string]int{AuditOutcomeIssued: stats.Issued, AuditOutcomeDenied: stats.Denied, AuditOutcomeFailed: stats.Failed} {
+				if count > 0 && (filter.Outcome == "" || filter.Outcome == outcome) {
+					counters.add(key.channel, key.role, outcome, count)
+				}
+			}
+		}
+	}
+	return counters.summary(), nil
+}
+
+// Close closes the audit log file.
+func (j *JSONLAuditSink) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// count adds an event to the running counters. Must be called with j.mu held, or before the sink is shared.
+func (j *JSONLAuditSink) count(event AuditEvent) {
+	tenantCounters, ok := j.counters[event.TenantID]
+	if !ok {
+		tenantCounters = make(auditCounters)
+		j.counters[event.TenantID] = tenantCounters
+	}
+	tenantCounters.add(event.Channel, event.Role, event.Outcome, 1)
+}
+
+// scanBackward calls fn with the events of the audit log file from the most recent to the oldest, until fn returns false.
+// Only the events written when the scan starts are read. Lines that are not valid events are skipped.
+func (j *JSONLAuditSink) scanBackward(fn func(event AuditEvent) bool) error {
+	file, err := os.Open(j.path)
+	if err != nil {
+		return fmt.Errorf("error opening audit log file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading audit log file: %v", err)
+	}
+
+	// Read the file in chunks from the end, rest is the start of the file up to the first complete line read so far
+	var rest []byte
+	chunk := make([]byte, auditScanChunkSize)
+	for offset := info.Size(); offset > 0; {
+		n := int64(len(chunk))
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		if _, err := file.ReadAt(chunk[:n], offset); err != nil {
+			return fmt.Errorf("error reading audit log file: %v", err)
+		}
+		rest = append(append([]byte{}, chunk[:n]...), rest...)
+		for {
+			i := bytes.LastIndexByte(rest, '\n')
+			if i < 0 {
+				break
+			}
+			line := rest[i+1:]
+			rest = rest[:i]
+			if !scanAuditLine(line, fn) {
+				return nil
+			}
+		}
+	}
+	scanAuditLine(rest, fn)
+	return nil
+}
+
+// scanAuditLine calls fn with the event of a line of the audit log file, and returns its result.
+// Returns true without calling fn when the line is not a valid event.
+func scanAuditLine(line []byte, fn func(event AuditEvent) bool) bool {
+	if len(line) == 0 {
+		return true
+	}
+	var event AuditEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return true
+	}
+	return fn(event)
+}
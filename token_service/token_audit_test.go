@@ -0,0 +1,292 @@
+package token_service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := NewMemoryAuditSink()
+	service := NewTestTokenService()
+	service.SetAuthenticators(NewAPIKeyAuthenticator(map[string]string{"kiosk-key": "kiosk"}))
+	service.SetPolicy(&Policy{Rules: []PolicyRule{{TokenTypes: []string{"rtc"}, Channels: []string{"lobby"}}, {TokenTypes: []string{"rtm"}}}})
+	service.SetAuditSink(sink)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(payload))
+		req.Header.Set(APIKeyHeader, "kiosk-key")
+		req.RemoteAddr = "203.0.113.7:50000"
+		router.ServeHTTP(w, req)
+		return w
+	}
+	post("/token/getNew", TokenRequest{TokenType: "rtc", Channel: "lobby", RtcRole: "publisher", Uid: "1234"})
+	post("/token/getNew", TokenRequest{TokenType: "rtc", Channel: "stage", Uid: "1234"})
+	post("/token/getNew", TokenRequest{TokenType: "rtc", Channel: "lobby"})
+	post("/token/batch", []TokenRequest{{TokenType: "rtm", Uid: "user123"}, {TokenType: "chat"}})
+
+	events, _ := sink.Query(AuditFilter{})
+	wantOutcomes := []string{AuditOutcomeDenied, AuditOutcomeIssued, AuditOutcomeFailed, AuditOutcomeDenied, AuditOutcomeIssued}
+	if len(events) != len(wantOutcomes) {
+		t.Fatalf("recorded %d events, want %d: %+v", len(events), len(wantOutcomes), events)
+	}
+	// The batch results are recorded in request order, the query returns the most recent first
+	for i, want := range wantOutcomes {
+		if events[i].Outcome != want {
+			t.Errorf("events[%d].Outcome = %q, want %q", i, events[i].Outcome, want)
+		}
+	}
+	issued := events[4]
+	if issued.Source != "getNew" || issued.Caller != "kiosk" || issued.AuthMethod != AuthMethodAPIKey || issued.ClientIP != "203.0.113.7" {
+		t.Errorf("issued event = %+v, want the getNew source, caller, auth method and client IP", issued)
+	}
+	if issued.Role != "publisher" || issued.Expire != 3600 || issued.ExpiresAt == 0 {
+		t.Errorf("issued event = %+v, want the publisher role, default expire and expiration time", issued)
+	}
+	if events[1].Source != "batch" || events[1].Uid != "user123" {
+		t.Errorf("batch event = %+v, want the batch source and uid", events[1])
+	}
+	if events[3].Error == "" {
+		t.Errorf("denied event = %+v, want the error", events[3])
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := AuditEvent{Time: now, Caller: "kiosk", TenantID: "video", Channel: "lobby", Uid: "1234", Account: "alice", Outcome: AuditOutcomeIssued}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   bool
+	}{
+		{name: "Empty filter", filter: AuditFilter{}, want: true},
+		{name: "Channel", filter: AuditFilter{Channel: "lobby"}, want: true},
+		{name: "Other channel", filter: AuditFilter{Channel: "stage"}, want: false},
+		{name: "UID", filter: AuditFilter{Uid: "1234"}, want: true},
+		{name: "Account", filter: AuditFilter{Uid: "alice"}, want: true},
+		{name: "Other UID", filter: AuditFilter{Uid: "5678"}, want: false},
+		{name: "Caller and tenant", filter: AuditFilter{Caller: "kiosk", TenantID: "video"}, want: true},
+		{name: "Other outcome", filter: AuditFilter{Outcome: AuditOutcomeDenied}, want: false},
+		{name: "Within time range", filter: AuditFilter{From: now, To: now.Add(time.Minute)}, want: true},
+		{name: "Before time range", filter: AuditFilter{From: now.Add(time.Second)}, want: false},
+		{name: "At end of time range", filter: AuditFilter{To: now}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, channel := range []string{"lobby", "stage", "lobby"} {
+		sink.Record(AuditEvent{Time: start.Add(time.Duration(i) * time.Minute), TokenType: "rtc", Channel: channel, Outcome: AuditOutcomeIssued})
+	}
+	sink.Close()
+
+	// Partially written lines are skipped and new events are appended to the existing log
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	file.WriteString("{\"time\":\n")
+	file.Close()
+	sink, err = NewJSONLAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	defer sink.Close()
+	sink.Record(AuditEvent{Time: start.Add(3 * time.Minute), TokenType: "rtc", Channel: "lobby", Outcome: AuditOutcomeDenied})
+
+	events, err := sink.Query(AuditFilter{Channel: "lobby"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(events) != 3 || events[0].Outcome != AuditOutcomeDenied {
+		t.Errorf("Query() = %+v, want 3 lobby events with the most recent first", events)
+	}
+	events, _ = sink.Query(AuditFilter{From: start.Add(time.Minute), To: start.Add(3 * time.Minute)})
+	if len(events) != 2 {
+		t.Errorf("Query() with time range returned %d events, want 2", len(events))
+	}
+	events, _ = sink.Query(AuditFilter{Limit: 1})
+	if len(events) != 1 || !events[0].Time.Equal(start.Add(3*time.Minute)) {
+		t.Errorf("Query() with limit = %+v, want the most recent event", events)
+	}
+}
+
+func TestJSONLAuditSinkScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewJSONLAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	// Enough events to span several chunks of the scan
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	channels := []string{"lobby", "stage", "backstage"}
+	outcomes := []string{AuditOutcomeIssued, AuditOutcomeIssued, AuditOutcomeDenied, AuditOutcomeFailed}
+	var recorded []AuditEvent
+	for i := 0; i < 2000; i++ {
+		event := AuditEvent{
+			Time:      start.Add(time.Duration(i) * time.Second),
+			Caller:    "caller-" + strconv.Itoa(i%2),
+			TenantID:  []string{"", "video"}[i%2],
+			TokenType: "rtc",
+			Channel:   channels[i%len(channels)],
+			Role:      "publisher",
+			Outcome:   outcomes[i%len(outcomes)],
+		}
+		sink.Record(event)
+		recorded = append(recorded, event)
+	}
+
+	events, err := sink.Query(AuditFilter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(events) != len(recorded) || !events[0].Time.Equal(recorded[len(recorded)-1].Time) || !events[len(events)-1].Time.Equal(start) {
+		t.Errorf("Query() returned %d events, want %d with the most recent first", len(events), len(recorded))
+	}
+
+	// Queries don't wait for the lock that Record holds while writing
+	sink.mu.Lock()
+	events, _ = sink.Query(AuditFilter{Channel: "stage", Limit: 10})
+	sink.mu.Unlock()
+	if len(events) != 10 || events[0].Channel != "stage" {
+		t.Errorf("Query() with limit = %+v, want the 10 most recent stage events", events)
+	}
+
+	// The stats match the summary of the events, from the counters or a scan
+	reopened, err := NewJSONLAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLAuditSink() error = %v", err)
+	}
+	defer reopened.Close()
+	filters := []AuditFilter{
+		{},
+		{Channel: "lobby"},
+		{TenantID: "video", Outcome: AuditOutcomeDenied},
+		{Caller: "caller-1"},
+		{From: start.Add(time.Minute), To: start.Add(time.Hour)},
+	}
+	for _, filter := range filters {
+		var matching []AuditEvent
+		for _, event := range recorded {
+			if filter.Matches(event) {
+				matching = append(matching, event)
+			}
+		}
+		want := SummarizeAudit(matching)
+		for _, s := range []*JSONLAuditSink{sink, reopened} {
+			stats, err := s.Stats(filter)
+			if err != nil {
+				t.Fatalf("Stats() error = %v", err)
+			}
+			if fmt.Sprint(stats) != fmt.Sprint(want) {
+				t.Errorf("Stats(%+v) = %+v, want %+v", filter, stats, want)
+			}
+		}
+	}
+}
+
+func TestSummarizeAudit(t *testing.T) {
+	stats := SummarizeAudit([]AuditEvent{
+		{Channel: "stage", Role: "publisher", Outcome: AuditOutcomeIssued},
+		{Channel: "lobby", Role: "subscriber", Outcome: AuditOutcomeIssued},
+		{Channel: "lobby", Role: "subscriber", Outcome: AuditOutcomeDenied},
+		{Channel: "lobby", Role: "publisher", Outcome: AuditOutcomeFailed},
+		{Channel: "lobby", Role: "subscriber", Outcome: AuditOutcomeIssued},
+	})
+	want := []AuditStats{
+		{Channel: "lobby", Role: "publisher", Failed: 1},
+		{Channel: "lobby", Role: "subscriber", Issued: 2, Denied: 1},
+		{Channel: "stage", Role: "publisher", Issued: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("SummarizeAudit() = %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+}
+
+func TestAuditAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := NewMemoryAuditSink()
+	sink.Record(AuditEvent{Time: time.Unix(1714564800, 0).UTC(), TokenType: "rtc", Channel: "lobby", Uid: "1234", Role: "publisher", Outcome: AuditOutcomeIssued})
+	sink.Record(AuditEvent{Time: time.Unix(1714564860, 0).UTC(), TokenType: "rtc", Channel: "stage", Uid: "5678", Role: "subscriber", Outcome: AuditOutcomeDenied})
+	service := NewTestTokenService()
+	service.SetAdminAuthenticators(NewAPIKeyAuthenticator(map[string]string{"admin-key": "admin"}))
+	service.SetAuditSink(sink)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		path           string
+		apiKey         string
+		wantStatusCode int
+		wantCount      int
+	}{
+		{name: "Without admin key", path: "/token/admin/audit", wantStatusCode: http.StatusUnauthorized},
+		{name: "All events", path: "/token/admin/audit", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 2},
+		{name: "By channel", path: "/token/admin/audit?channel=lobby", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 1},
+		{name: "By uid", path: "/token/admin/audit?uid=5678", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 1},
+		{name: "By unix time range", path: "/token/admin/audit?from=1714564830&to=1714564900", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 1},
+		{name: "By RFC 3339 time range", path: "/token/admin/audit?to=2024-05-01T12:00:30Z", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 1},
+		{name: "Invalid time", path: "/token/admin/audit?from=yesterday", apiKey: "admin-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Invalid limit", path: "/token/admin/audit?limit=0", apiKey: "admin-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Invalid outcome", path: "/token/admin/audit?outcome=lost", apiKey: "admin-key", wantStatusCode: http.StatusBadRequest},
+		{name: "Stats", path: "/token/admin/audit/stats", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 2},
+		{name: "Stats by outcome", path: "/token/admin/audit/stats?outcome=denied", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatusCode, w.Body.String())
+			}
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			var response struct {
+				Events []AuditEvent `json:"events"`
+				Stats  []AuditStats `json:"stats"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if got := len(response.Events) + len(response.Stats); got != tt.wantCount {
+				t.Errorf("response has %d entries, want %d: %s", got, tt.wantCount, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package token_service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+// Headers used by the authenticators.
+const (
+	APIKeyHeader        = "X-API-Key"        // Static API key.
+	HMACKeyIdHeader     = "X-Auth-Key-Id"    // ID of the HMAC key used to sign the request.
+	HMACTimestampHeader = "X-Auth-Timestamp" // Unix timestamp (s) when the request was signed.
+	HMACSignatureHeader = "X-Auth-Signature" // Hex encoded HMAC/SHA256 signature of the request.
+)
+
+// Authentication methods reported in Caller.Method.
+const (
+	AuthMethodAPIKey = "apikey"
+	AuthMethodHMAC   = "hmac"
+	AuthMethodJWT    = "jwt"
+)
+
+// TenantClaim is the claim that binds a caller to a tenant, see SetTenantRegistry.
+const TenantClaim = "tenant"
+
+// callerContextKey is the gin context key for the authenticated Caller.
+const callerContextKey = "tokenCaller"
+
+// maxAuthBodySize limits the size of a request body read to verify its signature.
+const maxAuthBodySize = 1 << 20
+
+// ErrNoTenant is returned when a tenant registry is set and the caller is not bound to a tenant, see SetTenantRegistry.
+var ErrNoTenant = errors.New("the caller is not bound to a tenant")
+
+// ErrNoCredentials is returned by an Authenticator when the request has no credentials for it, so the next authenticator is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Caller is the authenticated identity of a token request.
+type Caller struct {
+	Subject string                 // Identity of the caller, e.g. the API key name or the JWT "sub" claim.
+	Method  string                 // The authentication method: "apikey", "hmac" or "jwt".
+	Claims  map[string]interface{} // Claims of the caller, always including "sub", used by the Policy.
+}
+
+// Authenticator verifies the credentials of a request to the token routes.
+// It returns ErrNoCredentials when the request has no credentials for this authenticator.
+type Authenticator interface {
+	Authenticate(r *http.Request, body []byte) (*Caller, error)
+}
+
+// SetAuthenticators sets the authenticators for the token routes, tried in order.
+// Token routes are open when no authenticators are set.
+func (s *TokenService) SetAuthenticators(authenticators ...Authenticator) {
+	s.authenticators = authenticators
+}
+
+// SetPolicy sets the policy that limits the tokens an authenticated caller may request.
+// Authenticated callers may request any token when no policy is set.
+func (s *TokenService) SetPolicy(policy *Policy) {
+	s.policy = policy
+}
+
+// SetTenantRegistry sets the registry of the tenants that callers with a "tenant" claim are bound to.
+// An authenticated caller with the claim can only request tokens for that tenant, see tenant_registry.Registry.BindCaller.
+// Callers get the claim from their JWT, or from the tenant their API key or HMAC key is bound to, see APIKeyAuthenticator.SetTenants.
+// When a registry is set, callers without the claim are rejected, otherwise the claim is ignored.
+// Tokens of each tenant are signed and verified with the tenant's app certificates, see UpdateTenantCertificates.
+// Returns an error if the certificates of a tenant are invalid.
+func (s *TokenService) SetTenantRegistry(registry *tenant_registry.Registry) error {
+	certificates := make(map[string]*AppCertificates)
+	if registry != nil {
+		for _, tenant := range registry.Tenants() {
+			tenantCertificates, err := NewAppCertificates(tenant.AppCertificate, tenant.AppCertificateSecondary, tenant.AppCertificateActive)
+			if err != nil {
+				return fmt.Errorf("tenant %q: %v", tenant.ID, err)
+			}
+			certificates[tenant.ID] = tenantCertificates
+		}
+	}
+	s.tenantRegistry = registry
+	s.tenantCertificates = certificates
+	return nil
+}
+
+// Authenticate is the middleware for the token routes, it verifies the caller with the configured authenticators.
+// Returns an HTTP 401 error if the credentials are missing or invalid, the authenticated Caller is stored in the context.
+// Returns an HTTP 403 error if the caller is bound to another tenant than the request's, see SetTenantRegistry.
+func (s *TokenService) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(s.authenticators, s.bindTenant)(c)
+	}
+}
+
+// Identify is the middleware that verifies the credentials of a request, if it has any, and stores the caller in the context.
+// It lets middleware that runs before the routes, e.g. the rate limiter, read the verified caller with CallerFromContext.
+// Requests without valid credentials pass without a caller, the routes still authenticate every request with Authenticate.
+func (s *TokenService) Identify() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(s.authenticators) == 0 {
+			c.Next()
+			return
+		}
+		body, err := readAuthBody(c)
+		if err == nil && len(body) <= maxAuthBodySize {
+			if caller, err := verifyCaller(s.authenticators, c.Request, body); err == nil {
+				c.Set(callerContextKey, caller)
+			}
+		}
+		c.Next()
+	}
+}
+
+// bindTenant binds the request to the tenant of a caller with a "tenant" claim.
+func (s *TokenService) bindTenant(c *gin.Context, caller *Caller) error {
+	if s.tenantRegistry == nil {
+		return nil
+	}
+	tenantID, _ := caller.Claims[TenantClaim].(string)
+	if tenantID == "" {
+		return ErrNoTenant
+	}
+	ctx, err := s.tenantRegistry.BindCaller(c.Request.Context(), tenantID)
+	if err != nil {
+		return err
+	}
+	c.Request = c.Request.WithContext(ctx)
+	return nil
+}
+
+// authenticate returns the middleware that verifies the caller with the authenticators, tried in order.
+// Requests pass without a caller when there are no authenticators.
+// The optional bind function checks the authenticated caller against the request, the request is rejected with an HTTP 403 error if it fails.
+func authenticate(authenticators []Authenticator, bind func(c *gin.Context, caller *Caller) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(authenticators) == 0 {
+			c.Next()
+			return
+		}
+
+		body, err := readAuthBody(c)
+		if err != nil {
+			api_errors.AbortMessage(c, http.StatusBadRequest, "Failed to read request: "+err.Error())
+			return
+		}
+		// Reject larger bodies, a truncated body would be verified and handled without the rest
+		if len(body) > maxAuthBodySize {
+			api_errors.AbortMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body is larger than %d bytes", maxAuthBodySize))
+			return
+		}
+
+		caller, err := verifyCaller(authenticators, c.Request, body)
+		if errors.Is(err, ErrNoCredentials) {
+			api_errors.AbortMessage(c, http.StatusUnauthorized, "Unauthorized: missing credentials")
+			return
+		}
+		if err != nil {
+			api_errors.AbortMessage(c, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+			return
+		}
+		if bind != nil {
+			if err := bind(c, caller); err != nil {
+				api_errors.AbortMessage(c, http.StatusForbidden, "Forbidden: "+err.Error())
+				return
+			}
+		}
+		c.Set(callerContextKey, caller)
+		c.Next()
+	}
+}
+
+// readAuthBody reads the body for signature verification and restores it for the handler.
+// At most maxAuthBodySize+1 bytes are read, so a longer body is detected without reading all of it.
+func readAuthBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxAuthBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	return body, nil
+}
+
+// verifyCaller verifies the credentials of a request with the authenticators, tried in order.
+// Returns ErrNoCredentials when none of the authenticators found credentials in the request.
+func verifyCaller(authenticators []Authenticator, r *http.Request, body []byte) (*Caller, error) {
+	for _, authenticator := range authenticators {
+		caller, err := authenticator.Authenticate(r, body)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return caller, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// authorize checks a token request against the policy for the caller stored in the context.
+// Returns nil when no policy is set or the request is not authenticated.
+func (s *TokenService) authorize(c *gin.Context, tokenReq TokenRequest) error {
+	if s.policy == nil {
+		return nil
+	}
+	value, exists := c.Get(callerContextKey)
+	if !exists {
+		return nil
+	}
+	return s.policy.Authorize(value.(*Caller), tokenReq)
+}
+
+// Authorize checks a token request against the policy for the authenticated caller of the request, see SetPolicy.
+// Services that hand out tokens on behalf of a caller, e.g. invites, use it to apply the same limits as the token routes.
+// Returns nil when no policy is set or the request is not authenticated, otherwise an error wrapping ErrForbidden if the policy denies it.
+func (s *TokenService) Authorize(c *gin.Context, tokenReq TokenRequest) error {
+	return s.authorize(c, tokenReq)
+}
+
+// CallerFromContext returns the authenticated caller of a token request, if there is one.
+func CallerFromContext(c *gin.Context) (*Caller, bool) {
+	value, exists := c.Get(callerContextKey)
+	if !exists {
+		return nil, false
+	}
+	caller, ok := value.(*Caller)
+	return caller, ok
+}
+
+// APIKeyAuthenticator authenticates callers with static API keys sent in the X-API-Key header.
+type APIKeyAuthenticator struct {
+	keys    map[string]string // API key to the subject it identifies.
+	tenants map[string]string // (Optional) subject to the ID of the tenant it is bound to.
+}
+
+// NewAPIKeyAuthenticator returns an APIKeyAuthenticator for the given API keys, mapped to the subject each key identifies.
+func NewAPIKeyAuthenticator(keys map[string]string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys}
+}
+
+// Authenticate compares the API key with every configured key in constant time.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request, body []byte) (*Caller, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	var subject string
+	for configuredKey, configuredSubject := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(configuredKey)) == 1 {
+			subject = configuredSubject
+		}
+	}
+	if subject == "" {
+		return nil, errors.New("invalid API key")
+	}
+	return staticCaller(subject, AuthMethodAPIKey, a.tenants), nil
+}
+
+// SetTenants binds the callers of the API keys to tenants, see SetTenantRegistry.
+// The tenants are keyed by subject, the callers get a "tenant" claim with the ID of their tenant.
+func (a *APIKeyAuthenticator) SetTenants(tenants map[string]string) {
+	a.tenants = tenants
+}
+
+// HMACAuthenticator authenticates callers that sign their requests with a shared secret.
+//
+// The signature is the hex encoded HMAC/SHA256 of "<timestamp>\n<method>\n<uri>\n<body>", sent in the X-Auth-Signature header
+// with the key ID in X-Auth-Key-Id and the Unix timestamp in X-Auth-Timestamp. The URI is the canonical URI of the request, see CanonicalURI.
+type HMACAuthenticator struct {
+	secrets map[string]string // Key ID to the shared secret, the key ID is the caller's subject.
+	maxSkew time.Duration     // Maximum difference between the signature timestamp and the server time.
+	tenants map[string]string // (Optional) key ID to the ID of the tenant it is bound to.
+}
+
+// DefaultHMACMaxSkew is the maximum age of a signed request.
+const DefaultHMACMaxSkew = 5 * time.Minute
+
+// NewHMACAuthenticator returns an HMACAuthenticator for the given secrets, mapped by key ID.
+func NewHMACAuthenticator(secrets map[string]string) *HMACAuthenticator {
+	return &HMACAuthenticator{secrets: secrets, maxSkew: DefaultHMACMaxSkew}
+}
+
+// Authenticate verifies the timestamp and the signature of the request.
+func (a *HMACAuthenticator) Authenticate(r *http.Request, body []byte) (*Caller, error) {
+	signature := r.Header.Get(HMACSignatureHeader)
+	if signature == "" {
+		return nil, ErrNoCredentials
+	}
+	keyId := r.Header.Get(HMACKeyIdHeader)
+	secret, ok := a.secrets[keyId]
+	if !ok {
+		return nil, errors.New("unknown HMAC key")
+	}
+
+	timestamp := r.Header.Get(HMACTimestampHeader)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid signature timestamp")
+	}
+	if skew := time.Since(time.Unix(signedAt, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, errors.New("signature expired")
+	}
+
+	expected, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || !hmac.Equal(SignRequest(secret, timestamp, r.Method, CanonicalURI(r.URL), body), expected) {
+		return nil, errors.New("invalid signature")
+	}
+	return staticCaller(keyId, AuthMethodHMAC, a.tenants), nil
+}
+
+// SetTenants binds the callers of the HMAC keys to tenants, see SetTenantRegistry.
+// The tenants are keyed by key ID, the callers get a "tenant" claim with the ID of their tenant.
+func (a *HMACAuthenticator) SetTenants(tenants map[string]string) {
+	a.tenants = tenants
+}
+
+// staticCaller returns the Caller of a configured key, with a "tenant" claim when the subject is bound to a tenant.
+func staticCaller(subject string, method string, tenants map[string]string) *Caller {
+	claims := map[string]interface{}{"sub": subject}
+	if tenantID := tenants[subject]; tenantID != "" {
+		claims[TenantClaim] = tenantID
+	}
+	return &Caller{Subject: subject, Method: method, Claims: claims}
+}
+
+// SignRequest returns the HMAC/SHA256 signature of a request, as verified by HMACAuthenticator.
+// The uri is the canonical URI of the request, see CanonicalURI.
+func SignRequest(secret string, timestamp string, method string, uri string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + uri + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// CanonicalURI returns the URI of a request as it is signed: the path, followed by "?" and the query parameters
+// sorted by name and URL encoded when the request has a query, e.g. "/token/getNew?a=1&b=2".
+// Parameters with the same name keep their order.
+func CanonicalURI(u *url.URL) string {
+	query := u.Query().Encode()
+	if query == "" {
+		return u.Path
+	}
+	return u.Path + "?" + query
+}
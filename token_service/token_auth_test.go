@@ -0,0 +1,523 @@
+package token_service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+// testJWTKeys holds the keys used to sign test JWTs, and the JWKS file with their public keys.
+type testJWTKeys struct {
+	rsaKey   *rsa.PrivateKey
+	ecKey    *ecdsa.PrivateKey
+	ec384Key *ecdsa.PrivateKey
+	jwksFile string
+}
+
+func newTestJWTKeys(t *testing.T) *testJWTKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-key", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-key", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "EC", "kid": "ec384-key", "crv": "P-384", "x": encode(ec384Key.X.FillBytes(make([]byte, 48))), "y": encode(ec384Key.Y.FillBytes(make([]byte, 48)))},
+		{"kty": "oct", "kid": "ignored", "k": "c2VjcmV0"},
+	}}
+	data, _ := json.Marshal(jwks)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &testJWTKeys{rsaKey: rsaKey, ecKey: ecKey, ec384Key: ec384Key, jwksFile: jwksFile}
+}
+
+// sign returns a JWT with the claims, signed with RS256 ("rsa-key") or ES256 ("ec-key").
+// "ec384-key" signs with ES256 using a P-384 key, a curve that doesn't match the algorithm.
+func (k *testJWTKeys) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	alg := "RS256"
+	ecKey := k.ecKey
+	switch kid {
+	case "ec-key":
+		alg = "ES256"
+	case "ec384-key":
+		alg = "ES256"
+		ecKey = k.ec384Key
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	if alg == "RS256" {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsaKey, crypto.SHA256, digest[:])
+	} else {
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err == nil {
+			size := (ecKey.Curve.Params().BitSize + 7) / 8
+			signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	keys := newTestJWTKeys(t)
+	authenticator, err := NewJWTAuthenticator(keys.jwksFile, "https://issuer.example.com", "token-service")
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator() error = %v", err)
+	}
+
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "user-1",
+			"iss": "https://issuer.example.com",
+			"aud": []string{"other", "token-service"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr bool
+	}{
+		{name: "Valid RS256 token", token: func() string { return keys.sign(t, "rsa-key", validClaims()) }},
+		{name: "Valid ES256 token", token: func() string { return keys.sign(t, "ec-key", validClaims()) }},
+		{name: "ES256 token signed with a P-384 key", token: func() string { return keys.sign(t, "ec384-key", validClaims()) }, wantErr: true},
+		{
+			name: "Expired token",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return keys.sign(t, "rsa-key", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Token not valid yet",
+			token: func() string {
+				claims := validClaims()
+				claims["nbf"] = time.Now().Add(time.Hour).Unix()
+				return keys.sign(t, "rsa-key", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Wrong issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://other.example.com"
+				return keys.sign(t, "rsa-key", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Wrong audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "other"
+				return keys.sign(t, "ec-key", claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "Tampered claims",
+			token: func() string {
+				parts := strings.Split(keys.sign(t, "rsa-key", validClaims()), ".")
+				claims := validClaims()
+				claims["sub"] = "admin"
+				payload, _ := json.Marshal(claims)
+				return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+			},
+			wantErr: true,
+		},
+		{name: "Unknown key", token: func() string { return keys.sign(t, "ignored", validClaims()) }, wantErr: true},
+		{name: "Malformed token", token: func() string { return "not-a-jwt" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/token/getNew", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token())
+			caller, err := authenticator.Authenticate(req, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (caller.Subject != "user-1" || caller.Method != AuthMethodJWT) {
+				t.Errorf("Authenticate() caller = %+v", caller)
+			}
+		})
+	}
+
+	t.Run("No bearer token", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/token/getNew", nil)
+		if _, err := authenticator.Authenticate(req, nil); err != ErrNoCredentials {
+			t.Errorf("Authenticate() error = %v, want ErrNoCredentials", err)
+		}
+	})
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	policy := &Policy{Rules: []PolicyRule{
+		{
+			Name:       "hosts",
+			Match:      map[string]interface{}{"groups": "hosts"},
+			TokenTypes: []string{"rtc"},
+			Channels:   []string{"room-*"},
+			Uids:       []string{"{sub}"},
+			MaxExpire:  7200,
+		},
+		{
+			Name:      "audience",
+			Auth:      []string{AuthMethodJWT},
+			Channels:  []string{"room-*"},
+			Uids:      []string{"{sub}"},
+			Roles:     []string{"subscriber"},
+			MaxExpire: 3600,
+		},
+	}}
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	host := &Caller{Subject: "alice", Method: AuthMethodJWT, Claims: map[string]interface{}{"sub": "alice", "groups": []interface{}{"hosts"}}}
+	viewer := &Caller{Subject: "bob", Method: AuthMethodJWT, Claims: map[string]interface{}{"sub": "bob"}}
+	apiKeyViewer := &Caller{Subject: "bob", Method: AuthMethodAPIKey, Claims: map[string]interface{}{"sub": "bob"}}
+
+	tests := []struct {
+		name      string
+		caller    *Caller
+		tokenReq  TokenRequest
+		wantAllow bool
+	}{
+		{"Host publishes in a room", host, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "alice", RtcRole: "publisher", ExpirationSeconds: 7200}, true},
+		{"Host expiration too long", host, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "alice", RtcRole: "publisher", ExpirationSeconds: 7201}, false},
+		{"Host with another UID", host, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "bob", RtcRole: "publisher"}, false},
+		{"Host outside the rooms", host, TokenRequest{TokenType: "rtc", Channel: "lobby", Uid: "alice"}, false},
+		{"Viewer subscribes", viewer, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "bob"}, true},
+		{"Viewer publishes", viewer, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "bob", RtcRole: "publisher"}, false},
+		{"Viewer with a publish privilege", viewer, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "bob", PubAudioPrivilegeExpire: 600}, false},
+		{"Viewer default expiration", viewer, TokenRequest{TokenType: "rtm", Channel: "room-1", Uid: "bob"}, true},
+		{"Viewer negative expiration is the default", viewer, TokenRequest{TokenType: "rtm", Channel: "room-1", Uid: "bob", ExpirationSeconds: -1}, true},
+		{"Viewer expiration too long", viewer, TokenRequest{TokenType: "chat", Uid: "bob", ExpirationSeconds: 3601}, false},
+		{"Viewer with an API key", apiKeyViewer, TokenRequest{TokenType: "rtc", Channel: "room-1", Uid: "bob"}, false},
+		{"Host without the rtm token type", host, TokenRequest{TokenType: "rtc+rtm", Channel: "room-1", Uid: "alice", RtcRole: "publisher"}, false},
+		{"Viewer subscribes with RTM", viewer, TokenRequest{TokenType: "rtc+rtm", Channel: "room-1", Uid: "bob"}, true},
+		{"Viewer publishes with RTM", viewer, TokenRequest{TokenType: "rtc+rtm", Channel: "room-1", Uid: "bob", RtcRole: "publisher"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(tt.caller, tt.tokenReq)
+			if (err == nil) != tt.wantAllow {
+				t.Errorf("Authorize() error = %v, wantAllow %v", err, tt.wantAllow)
+			}
+		})
+	}
+
+	t.Run("RTC and RTM token types", func(t *testing.T) {
+		both := &Policy{Rules: []PolicyRule{{TokenTypes: []string{"rtc", "rtm"}}}}
+		if err := both.Authorize(host, TokenRequest{TokenType: "rtc+rtm", Channel: "room-1", Uid: "alice"}); err != nil {
+			t.Errorf("Authorize() error = %v, want rtc+rtm allowed by rtc and rtm", err)
+		}
+	})
+
+	t.Run("Invalid pattern", func(t *testing.T) {
+		invalid := &Policy{Rules: []PolicyRule{{Channels: []string{"room-["}}}}
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Validate() expected an error for an invalid pattern")
+		}
+	})
+}
+
+func TestTokenRoutesAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	service.SetAuthenticators(
+		NewAPIKeyAuthenticator(map[string]string{"test-api-key": "backend"}),
+		NewHMACAuthenticator(map[string]string{"signer": "test-secret"}),
+	)
+	service.SetPolicy(&Policy{Rules: []PolicyRule{
+		{Match: map[string]interface{}{"sub": "backend"}},
+		{Match: map[string]interface{}{"sub": "signer"}, Channels: []string{"signed-*"}},
+	}})
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	signedHeaders := func(uri string, body string, timestamp time.Time) map[string]string {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		return map[string]string{
+			HMACKeyIdHeader:     "signer",
+			HMACTimestampHeader: ts,
+			HMACSignatureHeader: hex.EncodeToString(SignRequest("test-secret", ts, "POST", uri, []byte(body))),
+		}
+	}
+	rtcBody := `{"tokenType": "rtc", "channel": "signed-1", "uid": "1234"}`
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		headers        map[string]string
+		wantStatusCode int
+	}{
+		{name: "Missing credentials", path: "/token/getNew", body: rtcBody, wantStatusCode: http.StatusUnauthorized},
+		{name: "Invalid API key", path: "/token/getNew", body: rtcBody, headers: map[string]string{APIKeyHeader: "wrong"}, wantStatusCode: http.StatusUnauthorized},
+		{name: "Valid API key", path: "/token/getNew", body: rtcBody, headers: map[string]string{APIKeyHeader: "test-api-key"}, wantStatusCode: http.StatusOK},
+		{name: "Valid signature", path: "/token/getNew", body: rtcBody, headers: signedHeaders("/token/getNew", rtcBody, time.Now()), wantStatusCode: http.StatusOK},
+		{name: "Signature for another body", path: "/token/getNew", body: `{"tokenType": "rtc", "channel": "signed-2", "uid": "1234"}`, headers: signedHeaders("/token/getNew", rtcBody, time.Now()), wantStatusCode: http.StatusUnauthorized},
+		{name: "Signature with a query", path: "/token/getNew?b=2&a=1", body: rtcBody, headers: signedHeaders("/token/getNew?a=1&b=2", rtcBody, time.Now()), wantStatusCode: http.StatusOK},
+		{name: "Signature for another query", path: "/token/getNew?a=1&b=3", body: rtcBody, headers: signedHeaders("/token/getNew?a=1&b=2", rtcBody, time.Now()), wantStatusCode: http.StatusUnauthorized},
+		{name: "Signature without the query", path: "/token/getNew?a=1", body: rtcBody, headers: signedHeaders("/token/getNew", rtcBody, time.Now()), wantStatusCode: http.StatusUnauthorized},
+		{name: "Body too large", path: "/token/getNew", body: strings.Repeat(" ", maxAuthBodySize) + rtcBody, headers: map[string]string{APIKeyHeader: "test-api-key"}, wantStatusCode: http.StatusRequestEntityTooLarge},
+		{name: "Expired signature", path: "/token/getNew", body: rtcBody, headers: signedHeaders("/token/getNew", rtcBody, time.Now().Add(-time.Hour)), wantStatusCode: http.StatusUnauthorized},
+		{
+			name:           "Channel not allowed by the policy",
+			path:           "/token/getNew",
+			body:           `{"tokenType": "rtc", "channel": "other", "uid": "1234"}`,
+			headers:        signedHeaders("/token/getNew", `{"tokenType": "rtc", "channel": "other", "uid": "1234"}`, time.Now()),
+			wantStatusCode: http.StatusForbidden,
+		},
+		{name: "Batch requires credentials", path: "/token/batch", body: `[` + rtcBody + `]`, wantStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", status, tt.wantStatusCode, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("Batch items are checked against the policy", func(t *testing.T) {
+		body := `[{"tokenType": "rtc", "channel": "signed-1", "uid": "1"}, {"tokenType": "rtc", "channel": "other", "uid": "2"}]`
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req, _ := http.NewRequest("POST", "/token/batch", strings.NewReader(body))
+		req.Header.Set(HMACKeyIdHeader, "signer")
+		req.Header.Set(HMACTimestampHeader, ts)
+		req.Header.Set(HMACSignatureHeader, hex.EncodeToString(SignRequest("test-secret", ts, "POST", "/token/batch", []byte(body))))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var response TokenBatchResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Error unmarshaling response: %v", err)
+		}
+		if response.Succeeded != 1 || response.Failed != 1 || !strings.Contains(response.Results[1].Error, "forbidden") {
+			t.Errorf("unexpected batch response: %+v", response)
+		}
+	})
+}
+
+func TestIdentify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	service.SetAuthenticators(
+		NewAPIKeyAuthenticator(map[string]string{"test-api-key": "backend"}),
+		NewHMACAuthenticator(map[string]string{"signer": "test-secret"}),
+	)
+	router := gin.New()
+	router.Use(service.Identify())
+	router.POST("/rtmp/start", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		subject := ""
+		if caller, ok := CallerFromContext(c); ok {
+			subject = caller.Subject
+		}
+		c.JSON(http.StatusOK, gin.H{"subject": subject, "body": string(body)})
+	})
+
+	body := `{"channelName": "test"}`
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantSubject string
+	}{
+		{name: "Missing credentials"},
+		{name: "Invalid API key", headers: map[string]string{APIKeyHeader: "wrong"}},
+		{name: "Valid API key", headers: map[string]string{APIKeyHeader: "test-api-key"}, wantSubject: "backend"},
+		{
+			name: "Valid signature",
+			headers: map[string]string{
+				HMACKeyIdHeader:     "signer",
+				HMACTimestampHeader: ts,
+				HMACSignatureHeader: hex.EncodeToString(SignRequest("test-secret", ts, "POST", "/rtmp/start", []byte(body))),
+			},
+			wantSubject: "signer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/rtmp/start", strings.NewReader(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			// Requests pass whether or not they have a caller, with the body restored for the handler
+			var response map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Error unmarshaling response: %v", err)
+			}
+			if rr.Code != http.StatusOK || response["subject"] != tt.wantSubject || response["body"] != body {
+				t.Errorf("unexpected response: %d %v", rr.Code, response)
+			}
+		})
+	}
+}
+
+func TestTokenRoutesCrossTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := newTestJWTKeys(t)
+	jwtAuthenticator, err := NewJWTAuthenticator(keys.jwksFile, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := tenant_registry.NewRegistry([]*tenant_registry.Tenant{
+		{ID: "video", AppID: "0123456789abcdef0123456789abcdef", AppCertificate: "fedcba9876543210fedcba9876543210", APIKeys: []string{"video-tenant-key"}, Hosts: []string{"video.example.com"}},
+		{ID: "audio", AppID: "abcdef0123456789abcdef0123456789", AppCertificate: "0123456789abcdef0123456789abcdef", APIKeys: []string{"audio-tenant-key"}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.SetTrustedNetworks([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	apiKeyAuthenticator := NewAPIKeyAuthenticator(map[string]string{"video-key": "video-backend", "unbound-key": "unbound-backend"})
+	apiKeyAuthenticator.SetTenants(map[string]string{"video-backend": "video"})
+	hmacAuthenticator := NewHMACAuthenticator(map[string]string{"audio-signer": "audio-secret"})
+	hmacAuthenticator.SetTenants(map[string]string{"audio-signer": "audio"})
+	service := NewTestTokenService()
+	service.SetAuthenticators(apiKeyAuthenticator, hmacAuthenticator, jwtAuthenticator)
+	if err := service.SetTenantRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(registry.Middleware())
+	service.RegisterRoutes(router)
+
+	bearer := func(tenant string) map[string]string {
+		claims := map[string]interface{}{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()}
+		if tenant != "" {
+			claims[TenantClaim] = tenant
+		}
+		return map[string]string{"Authorization": "Bearer " + keys.sign(t, "rsa-key", claims)}
+	}
+	withHeaders := func(headers map[string]string, extra map[string]string) map[string]string {
+		for key, value := range extra {
+			headers[key] = value
+		}
+		return headers
+	}
+
+	body := `{"tokenType": "rtm", "uid": "user"}`
+	signed := func() map[string]string {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		return map[string]string{
+			HMACKeyIdHeader:     "audio-signer",
+			HMACTimestampHeader: ts,
+			HMACSignatureHeader: hex.EncodeToString(SignRequest("audio-secret", ts, "POST", "/token/getNew", []byte(body))),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		host           string
+		remoteAddr     string
+		headers        map[string]string
+		wantStatusCode int
+		wantAppID      string
+	}{
+		{name: "API key bound to its tenant", headers: map[string]string{APIKeyHeader: "video-key"}, wantStatusCode: http.StatusOK, wantAppID: "0123456789abcdef0123456789abcdef"},
+		{name: "HMAC key bound to its tenant", headers: signed(), wantStatusCode: http.StatusOK, wantAppID: "abcdef0123456789abcdef0123456789"},
+		{name: "API key without a tenant", headers: map[string]string{APIKeyHeader: "unbound-key"}, wantStatusCode: http.StatusForbidden},
+		{name: "API key with another tenant's ID", headers: map[string]string{APIKeyHeader: "video-key", tenant_registry.TenantHeader: "audio"}, wantStatusCode: http.StatusForbidden},
+		{name: "API key with another tenant's key", headers: map[string]string{APIKeyHeader: "video-key", tenant_registry.TenantKeyHeader: "audio-tenant-key"}, wantStatusCode: http.StatusForbidden},
+		{name: "API key on another tenant's untrusted host", host: "audio.example.com", headers: map[string]string{APIKeyHeader: "video-key"}, wantStatusCode: http.StatusOK, wantAppID: "0123456789abcdef0123456789abcdef"},
+		{name: "Caller bound to its tenant", headers: bearer("audio"), wantStatusCode: http.StatusOK, wantAppID: "abcdef0123456789abcdef0123456789"},
+		{name: "Caller without a tenant", headers: bearer(""), wantStatusCode: http.StatusForbidden},
+		{name: "Caller without a tenant can't choose one", headers: withHeaders(bearer(""), map[string]string{tenant_registry.TenantHeader: "audio"}), wantStatusCode: http.StatusForbidden},
+		{name: "Caller of one tenant with another tenant's ID", headers: withHeaders(bearer("video"), map[string]string{tenant_registry.TenantHeader: "audio"}), wantStatusCode: http.StatusForbidden},
+		{name: "Caller of one tenant on another tenant's host", host: "video.example.com", remoteAddr: "10.1.2.3:4000", headers: bearer("audio"), wantStatusCode: http.StatusForbidden},
+		{name: "Untrusted host is ignored", host: "video.example.com", headers: bearer("audio"), wantStatusCode: http.StatusOK, wantAppID: "abcdef0123456789abcdef0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/token/getNew", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Host = tt.host
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.wantStatusCode, rr.Body.String())
+			}
+			if tt.wantAppID == "" {
+				return
+			}
+			var response TokenResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Error unmarshaling response: %v", err)
+			}
+			inspection, err := service.ParseToken(response.Token)
+			if err != nil {
+				t.Fatalf("ParseToken() error = %v", err)
+			}
+			if inspection.AppID != tt.wantAppID {
+				t.Errorf("token issued for %s, want %s", inspection.AppID, tt.wantAppID)
+			}
+		})
+	}
+}
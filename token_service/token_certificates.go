@@ -0,0 +1,223 @@
+package token_service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the app certificates of an Agora project.
+const (
+	CertificatePrimary   = "primary"
+	CertificateSecondary = "secondary"
+)
+
+// AppCertificates holds the primary and secondary app certificates of an Agora project and which of them signs new tokens.
+// Tokens signed with either certificate are verified, so the signing certificate can be switched without invalidating issued tokens.
+// It is safe for concurrent use.
+type AppCertificates struct {
+	mu        sync.RWMutex
+	primary   string // The primary app certificate
+	secondary string // (Optional) the secondary app certificate
+	active    string // The certificate that signs new tokens: "primary" or "secondary"
+}
+
+// CertificateStatus reports the configured certificates, it never includes the certificates themselves.
+type CertificateStatus struct {
+	Active             string `json:"active"`             // The certificate that signs new tokens: "primary" or "secondary"
+	SecondaryAvailable bool   `json:"secondaryAvailable"` // Whether a secondary certificate is configured
+}
+
+// CertificateActivateRequest is the JSON payload of the endpoint that switches the signing certificate.
+type CertificateActivateRequest struct {
+	Active string `json:"active"` // The certificate to sign new tokens with: "primary" or "secondary"
+}
+
+// NewAppCertificates validates the certificates and returns the AppCertificates for them.
+//
+// Parameters:
+//   - primary: string - The primary app certificate.
+//   - secondary: string - (Optional) the secondary app certificate.
+//   - active: string - The certificate that signs new tokens: "primary" or "secondary", defaults to "primary".
+//
+// Returns:
+//   - *AppCertificates: The certificates.
+//   - error: An error if the primary certificate is missing or the active certificate is unknown or not configured.
+func NewAppCertificates(primary string, secondary string, active string) (*AppCertificates, error) {
+	certificates := &AppCertificates{}
+	if err := certificates.Update(primary, secondary, active); err != nil {
+		return nil, err
+	}
+	return certificates, nil
+}
+
+// staticCertificates returns the AppCertificates for a single certificate, e.g. a tenant's.
+func staticCertificates(certificate string) *AppCertificates {
+	return &AppCertificates{primary: certificate, active: CertificatePrimary}
+}
+
+// Update replaces the certificates and the active certificate, e.g. when the configuration is reloaded.
+// The certificates are unchanged when an error is returned, see NewAppCertificates.
+func (a *AppCertificates) Update(primary string, secondary string, active string) error {
+	if primary == "" {
+		return errors.New("the primary app certificate is required")
+	}
+	if active == "" {
+		active = CertificatePrimary
+	}
+	if err := validateActiveCertificate(active, secondary != ""); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.primary, a.secondary, a.active = primary, secondary, active
+	return nil
+}
+
+// Activate sets the certificate that signs new tokens.
+// Returns an error if the certificate is unknown or not configured.
+func (a *AppCertificates) Activate(active string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := validateActiveCertificate(active, a.secondary != ""); err != nil {
+		return err
+	}
+	a.active = active
+	return nil
+}
+
+// Status returns the active certificate and whether a secondary certificate is configured.
+func (a *AppCertificates) Status() CertificateStatus {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return CertificateStatus{Active: a.active, SecondaryAvailable: a.secondary != ""}
+}
+
+// signing returns the certificate that signs new tokens.
+func (a *AppCertificates) signing() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.active == CertificateSecondary {
+		return a.secondary
+	}
+	return a.primary
+}
+
+// namedCertificate is an app certificate with its name: "primary" or "secondary".
+type namedCertificate struct {
+	name        string
+	certificate string
+}
+
+// verifying returns the configured certificates, the active certificate first.
+func (a *AppCertificates) verifying() []namedCertificate {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	certificates := []namedCertificate{{CertificatePrimary, a.primary}}
+	if a.secondary != "" {
+		certificates = append(certificates, namedCertificate{CertificateSecondary, a.secondary})
+		if a.active == CertificateSecondary {
+			certificates[0], certificates[1] = certificates[1], certificates[0]
+		}
+	}
+	return certificates
+}
+
+// validateActiveCertificate checks that the active certificate is known and configured.
+func validateActiveCertificate(active string, hasSecondary bool) error {
+	switch active {
+	case CertificatePrimary:
+		return nil
+	case CertificateSecondary:
+		if !hasSecondary {
+			return errors.New("no secondary app certificate is configured")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown app certificate %q, use %q or %q", active, CertificatePrimary, CertificateSecondary)
+	}
+}
+
+// Certificates returns the app certificates of the service, to switch the signing certificate at runtime.
+// The certificates of the tenants are separate, see ForContext and UpdateTenantCertificates.
+func (s *TokenService) Certificates() *AppCertificates {
+	return s.certificates
+}
+
+// UpdateTenantCertificates updates the app certificates of the tenants from a registry, e.g. the reloaded tenants file.
+// The certificates are only updated when every tenant's are valid.
+//
+// Parameters:
+//   - registry: *tenant_registry.Registry - The registry with the new certificates of the tenants.
+//
+// Returns:
+//   - error: An error if the certificates of a tenant are invalid, no tenant is updated then.
+//
+// Notes:
+//   - Tenants that are not in the registry set with SetTenantRegistry are ignored, adding or removing tenants requires a restart.
+//     Tenants missing from the new registry keep their certificates.
+func (s *TokenService) UpdateTenantCertificates(registry *tenant_registry.Registry) error {
+	updated := make(map[string]*tenant_registry.Tenant)
+	for id := range s.tenantCertificates {
+		tenant, exists := registry.Get(id)
+		if !exists {
+			continue
+		}
+		if _, err := NewAppCertificates(tenant.AppCertificate, tenant.AppCertificateSecondary, tenant.AppCertificateActive); err != nil {
+			return fmt.Errorf("tenant %q: %v", id, err)
+		}
+		updated[id] = tenant
+	}
+	for id, tenant := range updated {
+		s.tenantCertificates[id].Update(tenant.AppCertificate, tenant.AppCertificateSecondary, tenant.AppCertificateActive)
+	}
+	return nil
+}
+
+// SetAdminAuthenticators sets the authenticators for the admin routes, tried in order.
+// The admin routes are only registered when admin authenticators are set.
+func (s *TokenService) SetAdminAuthenticators(authenticators ...Authenticator) {
+	s.adminAuthenticators = authenticators
+}
+
+// GetCertificates handles the HTTP request for the status of the app certificates of the request's tenant, see ForContext.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.GET("/certificates", TokenService.GetCertificates)
+func (s *TokenService) GetCertificates(c *gin.Context) {
+	c.JSON(http.StatusOK, s.ForContext(c.Request.Context()).certificates.Status())
+}
+
+// ActivateCertificate handles the HTTP request to switch the certificate that signs new tokens of the request's tenant, see ForContext.
+// Returns an HTTP 400 error if the certificate is unknown or not configured.
+// Tokens signed with the previous certificate remain valid.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.POST("/certificates/activate", TokenService.ActivateCertificate)
+func (s *TokenService) ActivateCertificate(c *gin.Context) {
+	var activateReq CertificateActivateRequest
+	if !request_validation.BindJSON(c, &activateReq) {
+		return
+	}
+	certificates := s.ForContext(c.Request.Context()).certificates
+	if err := certificates.Activate(activateReq.Active); err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, certificates.Status())
+}
@@ -0,0 +1,179 @@
+package token_service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewAppCertificates(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   string
+		secondary string
+		active    string
+		wantErr   bool
+	}{
+		{name: "Primary only", primary: "primary_cert"},
+		{name: "Secondary active", primary: "primary_cert", secondary: "secondary_cert", active: CertificateSecondary},
+		{name: "Missing primary", secondary: "secondary_cert", wantErr: true},
+		{name: "Secondary active without secondary", primary: "primary_cert", active: CertificateSecondary, wantErr: true},
+		{name: "Unknown active", primary: "primary_cert", active: "tertiary", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAppCertificates(tt.primary, tt.secondary, tt.active)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAppCertificates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertificateRotation(t *testing.T) {
+	service := NewTestTokenService()
+	if err := service.certificates.Update("77be7e16f7482cef9fe796205b85831e", "0c5a1f8bd7d24d1bb1a4b4e5d8f0c9e2", ""); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	tokenReq := TokenRequest{TokenType: "rtm", Uid: "test-user"}
+
+	primaryToken, _ := service.GenRtmToken(tokenReq)
+	if err := service.certificates.Activate(CertificateSecondary); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	secondaryToken, _ := service.GenRtmToken(tokenReq)
+
+	for token, wantSignedWith := range map[string]string{primaryToken: CertificatePrimary, secondaryToken: CertificateSecondary} {
+		inspection, err := service.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if !inspection.SignatureValid || inspection.SignedWith != wantSignedWith {
+			t.Errorf("ParseToken() signatureValid = %v, signedWith = %q, want %q", inspection.SignatureValid, inspection.SignedWith, wantSignedWith)
+		}
+	}
+
+	// Tokens signed with a removed certificate are no longer valid
+	service.certificates.Update("0c5a1f8bd7d24d1bb1a4b4e5d8f0c9e2", "", "")
+	inspection, _ := service.ParseToken(primaryToken)
+	if inspection.SignatureValid {
+		t.Errorf("expected an invalid signature for a token signed with a removed certificate")
+	}
+}
+
+func TestCertificateAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	service.certificates.Update("77be7e16f7482cef9fe796205b85831e", "0c5a1f8bd7d24d1bb1a4b4e5d8f0c9e2", "")
+	service.SetAuthenticators(NewAPIKeyAuthenticator(map[string]string{"client-key": "client"}))
+	service.SetAdminAuthenticators(NewAPIKeyAuthenticator(map[string]string{"admin-key": "admin"}))
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		method         string
+		body           string
+		apiKey         string
+		wantStatusCode int
+		wantActive     string
+	}{
+		{name: "Status", method: "GET", apiKey: "admin-key", wantStatusCode: http.StatusOK, wantActive: CertificatePrimary},
+		{name: "Client key", method: "GET", apiKey: "client-key", wantStatusCode: http.StatusUnauthorized},
+		{name: "Missing key", method: "POST", body: `{"active": "secondary"}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "Activate secondary", method: "POST", body: `{"active": "secondary"}`, apiKey: "admin-key", wantStatusCode: http.StatusOK, wantActive: CertificateSecondary},
+		{name: "Unknown certificate", method: "POST", body: `{"active": "tertiary"}`, apiKey: "admin-key", wantStatusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/token/admin/certificates"
+			if tt.method == "POST" {
+				path += "/activate"
+			}
+			req, _ := http.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatusCode, w.Body.String())
+			}
+			if tt.wantActive != "" {
+				var status CertificateStatus
+				json.Unmarshal(w.Body.Bytes(), &status)
+				if status.Active != tt.wantActive || !status.SecondaryAvailable {
+					t.Errorf("status = %+v, want active %q", status, tt.wantActive)
+				}
+			}
+		})
+	}
+
+	if active := service.Certificates().Status().Active; active != CertificateSecondary {
+		t.Errorf("active certificate = %q, want %q", active, CertificateSecondary)
+	}
+}
+
+func TestTenantCertificateRotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tenant := &tenant_registry.Tenant{ID: "video", AppID: "0123456789abcdef0123456789abcdef", AppCertificate: "fedcba9876543210fedcba9876543210", AppCertificateSecondary: "0c5a1f8bd7d24d1bb1a4b4e5d8f0c9e2", APIKeys: []string{"video-tenant-key"}}
+	registry, err := tenant_registry.NewRegistry([]*tenant_registry.Tenant{tenant}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewTestTokenService()
+	if err := service.SetTenantRegistry(registry); err != nil {
+		t.Fatal(err)
+	}
+	service.SetAdminAuthenticators(NewAPIKeyAuthenticator(map[string]string{"admin-key": "admin"}))
+	router := gin.New()
+	router.Use(registry.Middleware())
+	service.RegisterRoutes(router)
+	ctx := tenant_registry.NewContext(context.Background(), tenant)
+	tokenReq := TokenRequest{TokenType: "rtm", Uid: "test-user"}
+
+	primaryToken, _ := service.ForContext(ctx).GenRtmToken(tokenReq)
+
+	// The admin route switches the certificate of the request's tenant only
+	req, _ := http.NewRequest("POST", "/token/admin/certificates/activate", strings.NewReader(`{"active": "secondary"}`))
+	req.Header.Set(APIKeyHeader, "admin-key")
+	req.Header.Set(tenant_registry.TenantKeyHeader, "video-tenant-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if active := service.Certificates().Status().Active; active != CertificatePrimary {
+		t.Errorf("server certificate = %q, want %q", active, CertificatePrimary)
+	}
+	secondaryToken, _ := service.ForContext(ctx).GenRtmToken(tokenReq)
+
+	for token, wantSignedWith := range map[string]string{primaryToken: CertificatePrimary, secondaryToken: CertificateSecondary} {
+		inspection, err := service.ForContext(ctx).ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if !inspection.SignatureValid || inspection.SignedWith != wantSignedWith {
+			t.Errorf("ParseToken() signatureValid = %v, signedWith = %q, want %q", inspection.SignatureValid, inspection.SignedWith, wantSignedWith)
+		}
+	}
+
+	// Updating the tenant's certificates removes the primary certificate
+	updated, _ := tenant_registry.NewRegistry([]*tenant_registry.Tenant{{ID: "video", AppID: tenant.AppID, AppCertificate: tenant.AppCertificateSecondary}}, "")
+	if err := service.UpdateTenantCertificates(updated); err != nil {
+		t.Fatalf("UpdateTenantCertificates() error = %v", err)
+	}
+	if inspection, _ := service.ForContext(ctx).ParseToken(primaryToken); inspection.SignatureValid {
+		t.Errorf("expected an invalid signature for a token signed with a removed certificate")
+	}
+	if inspection, _ := service.ForContext(ctx).ParseToken(secondaryToken); !inspection.SignatureValid {
+		t.Errorf("expected a valid signature for a token signed with the remaining certificate")
+	}
+}
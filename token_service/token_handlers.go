@@ -3,16 +3,19 @@ package token_service
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/go-tokenbuilder/accesstoken"
 	"github.com/AgoraIO-Community/go-tokenbuilder/chatTokenBuilder"
-	rtctokenbuilder2 "github.com/AgoraIO-Community/go-tokenbuilder/rtctokenbuilder"
 	rtmtokenbuilder2 "github.com/AgoraIO-Community/go-tokenbuilder/rtmtokenbuilder"
 )
 
 // HandleGetToken handles the HTTP request to generate a token based on the provided tokenType.
-// It checks the tokenType from the query parameters and calls the appropriate token generation method.
+// It calls GenToken, which checks the tokenType and calls the appropriate token generation method.
 // The generated token is sent as a JSON response to the client.
 //
 // Parameters:
@@ -21,46 +24,177 @@ import (
 //
 // Behavior:
 //  1. Retrieves the tokenType from the request. Error if invalid entry or not provided.
-//  2. Uses a switch statement to handle different tokenType cases:
+//  2. Uses GenToken to handle the different tokenType cases:
 //     - "rtc": Calls the GenRtcToken method to generate the RTC token and sends it as a JSON response.
 //     - "rtm": Calls the GenRtmToken method to generate the RTM token and sends it as a JSON response.
 //     - "chat": Calls the GenChatToken method to generate the chat token and sends it as a JSON response.
+//     - "rtc+rtm": Calls the GenRtcRtmToken method to generate a token with both services and sends it as a JSON response.
 //     - Default: Returns an error response indicating an unsupported token type.
 //
 // Notes:
 //   - The actual token generation methods (GenRtcToken, GenRtmToken, and GenChatToken) are part of the TokenService struct.
 //   - The generated token is sent as a JSON response with appropriate HTTP status codes.
+//   - The response includes "expiresAt", the Unix timestamp (s) when the token expires.
+//   - For a request with an "account", the response includes the "uid" resolved for the account, see resolveAccount.
+//   - An "rtc+rtm" request with "separateTokens" is answered with "rtcToken" and "rtmToken" instead of "token", see GenRtcRtmTokens.
 //
 // Example usage:
 //
 //	router.POST("/getNew", TokenService.HandleGetToken)
 func (s *TokenService) HandleGetToken(tokenReq TokenRequest, w http.ResponseWriter) {
-	var token string
-	var tokenErr error
+	_, response, status, err := s.issueToken(tokenReq)
+	writeTokenResponse(w, response, status, err)
+}
+
+// issueToken resolves the account of a token request and generates its token, or its separate RTC and RTM tokens.
+// Returns the request with the UID resolved for its account, the response, and the HTTP status and error if it fails.
+func (s *TokenService) issueToken(tokenReq TokenRequest) (TokenRequest, TokenResponse, int, error) {
+	var response TokenResponse
+	tokenReq, err := s.resolveAccount(tokenReq)
+	if err != nil {
+		return tokenReq, response, http.StatusBadRequest, err
+	}
+
+	if wantsSeparateTokens(tokenReq) {
+		response.RtcToken, response.RtmToken, err = s.GenRtcRtmTokens(tokenReq)
+	} else {
+		response.Token, err = s.GenToken(tokenReq)
+	}
+	if err != nil {
+		return tokenReq, response, http.StatusBadRequest, err
+	}
+
+	// Separate tokens expire at the same time
+	expiringToken := response.Token
+	if expiringToken == "" {
+		expiringToken = response.RtcToken
+	}
+	response.ExpiresAt, err = tokenExpiresAt(expiringToken)
+	if err != nil {
+		return tokenReq, response, http.StatusInternalServerError, err
+	}
+	if tokenReq.Account != "" {
+		response.Uid = tokenReq.Uid
+	}
+	return tokenReq, response, http.StatusOK, nil
+}
+
+// writeTokenResponse writes the response of a token request, or its error with the HTTP status.
+func writeTokenResponse(w http.ResponseWriter, response TokenResponse, status int, err error) {
+	if err != nil {
+		api_errors.Write(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolveAccount sets the UID of an RTC token request with an "account" to the integer UID of the account, see uid_directory.Directory.
+// The UID is resolved for the tenant of the service and the channel of the request.
+// Requests without an account are returned unchanged.
+func (s *TokenService) resolveAccount(tokenReq TokenRequest) (TokenRequest, error) {
+	if tokenReq.Account == "" {
+		return tokenReq, nil
+	}
+	if tokenReq.TokenType != "rtc" && tokenReq.TokenType != "rtc+rtm" {
+		return tokenReq, errors.New("invalid: account is only supported for rtc and rtc+rtm tokens")
+	}
+	if tokenReq.Uid != "" {
+		return tokenReq, errors.New("invalid: set either uid or account")
+	}
+	if s.uidDirectory == nil {
+		return tokenReq, errors.New("invalid: account requires the UID directory")
+	}
+	uids, err := s.uidDirectory.Resolve(s.tenantID, tokenReq.Channel, []string{tokenReq.Account})
+	if err != nil {
+		return tokenReq, fmt.Errorf("invalid account: %v", err)
+	}
+	tokenReq.Uid = strconv.FormatUint(uint64(uids[0]), 10)
+	return tokenReq, nil
+}
 
+// ErrUnsupportedTokenType is returned when a TokenRequest has a tokenType other than "rtc", "rtm", "chat" or "rtc+rtm".
+var ErrUnsupportedTokenType = errors.New("Unsupported tokenType")
+
+// GenToken generates a token of the type set in the TokenRequest.
+//
+// Parameters:
+//   - tokenReq: TokenRequest - The request object containing token type and other necessary fields.
+//
+// Returns:
+//   - string: The generated token.
+//   - error: ErrUnsupportedTokenType for an unknown token type, or the error returned by the token generation method.
+func (s *TokenService) GenToken(tokenReq TokenRequest) (string, error) {
 	switch tokenReq.TokenType {
 	case "rtc":
-		token, tokenErr = s.GenRtcToken(tokenReq)
+		return s.GenRtcToken(tokenReq)
 	case "rtm":
-		token, tokenErr = s.GenRtmToken(tokenReq)
+		return s.GenRtmToken(tokenReq)
 	case "chat":
-		token, tokenErr = s.GenChatToken(tokenReq)
+		return s.GenChatToken(tokenReq)
+	case "rtc+rtm":
+		return s.GenRtcRtmToken(tokenReq)
 	default:
-		http.Error(w, "Unsupported tokenType", http.StatusBadRequest)
-		return
-	}
-	if tokenErr != nil {
-		http.Error(w, tokenErr.Error(), http.StatusBadRequest)
-		return
+		return "", ErrUnsupportedTokenType
 	}
+}
 
-	response := struct {
-		Token string `json:"token"`
-	}{Token: token}
+// HandleGetTokenBatch generates the tokens for a batch of TokenRequests concurrently.
+//
+// Parameters:
+//   - tokenReqs: []TokenRequest - The requests to generate tokens for.
+//   - authorize: func(TokenRequest) error - (Optional) checks each request before its token is generated, nil allows all requests.
+//
+// Returns:
+//   - TokenBatchResponse: A result for each request in the same order, with either the token or the error for that request.
+//
+// Notes:
+//   - One failing request does not fail the batch, the batch size is validated by the caller.
+func (s *TokenService) HandleGetTokenBatch(tokenReqs []TokenRequest, authorize func(TokenRequest) error) TokenBatchResponse {
+	results := make([]TokenBatchResult, len(tokenReqs))
+	var wg sync.WaitGroup
+	for i, tokenReq := range tokenReqs {
+		wg.Add(1)
+		go func(i int, tokenReq TokenRequest) {
+			defer wg.Done()
+			result := TokenBatchResult{Index: i, TokenType: tokenReq.TokenType, Channel: tokenReq.Channel, Uid: tokenReq.Uid, Account: tokenReq.Account}
+			var token string
+			var err error
+			if authorize != nil {
+				err = authorize(tokenReq)
+			}
+			if err == nil {
+				tokenReq, err = s.resolveAccount(tokenReq)
+			}
+			if err == nil {
+				result.Uid = tokenReq.Uid
+				if wantsSeparateTokens(tokenReq) {
+					result.RtcToken, result.RtmToken, err = s.GenRtcRtmTokens(tokenReq)
+				} else {
+					token, err = s.GenToken(tokenReq)
+				}
+			}
+			if err != nil {
+				result.Error = err.Error()
+				result.err = err
+			} else {
+				result.Token = token
+			}
+			results[i] = result
+		}(i, tokenReq)
+	}
+	wg.Wait()
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	response := TokenBatchResponse{Results: results}
+	for _, result := range results {
+		if result.Error == "" {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	return response
 }
 
 // GenRtcToken generates an RTC token based on the provided TokenRequest and returns it.
@@ -73,56 +207,186 @@ func (s *TokenService) HandleGetToken(tokenReq TokenRequest, w http.ResponseWrit
 //   - error: An error if there are any issues during token generation or validation.
 //
 // Behavior:
-//  1. Validates the required fields in the TokenRequest (channel and UID).
-//  2. Sets a default expiration time of 3600 seconds (1 hour) if not provided in the request.
-//  3. Determines the user's role (publisher or subscriber) based on the "Role" field in the request.
-//  4. Generates the RTC token using the rtctokenbuilder2 package.
+//  1. Validates the required fields in the TokenRequest (channel and UID) and the role.
+//  2. Resolves the expiration of each privilege, see resolveRtcPrivileges.
+//  3. Generates the RTC token with the privileges using the accesstoken package.
 //
 // Notes:
-//   - The rtctokenbuilder2 package is used for generating RTC tokens.
-//   - The "Role" field can be "publisher" or "subscriber"; other values are considered invalid.
+//   - The "Role" field can be "publisher" or "subscriber", defaults to "subscriber" when empty; other values are rejected.
+//   - A UID that is not a number is used as a user account.
 //
 // Example usage:
 //
+//	// Audience token that can join for 4 hours and publish audio for 10 minutes ("raise hand")
 //	tokenReq := TokenRequest{
-//	    TokenType:  "rtc",
-//	    Channel:    "my_channel",
-//	    Uid:        "user123",
-//	    RtcRole:    "publisher",
-//	    ExpirationSeconds: 3600,
+//	    TokenType:               "rtc",
+//	    Channel:                 "my_channel",
+//	    Uid:                     "user123",
+//	    RtcRole:                 "subscriber",
+//	    ExpirationSeconds:       14400,
+//	    PubAudioPrivilegeExpire: 600,
 //	}
 //	token, err := TokenService.GenRtcToken(tokenReq)
 func (s *TokenService) GenRtcToken(tokenRequest TokenRequest) (string, error) {
+	token, _, err := s.newRtcAccessToken(tokenRequest)
+	if err != nil {
+		return "", err
+	}
+	return token.Build()
+}
+
+// GenRtcRtmToken generates a single AccessToken2 with both the RTC and the RTM service,
+// so a client can join the RTC channel and log in to Signaling with the same token.
+//
+// Parameters:
+//   - tokenRequest: TokenRequest - The TokenRequest struct containing the required information for RTC token generation.
+//
+// Returns:
+//   - string: The generated token.
+//   - error: An error if there are any issues during token generation or validation.
+//
+// Behavior:
+//  1. Builds the RTC service with the same validation, role and expiration rules as GenRtcToken.
+//  2. Adds the RTM service for the same UID or account, with the login privilege valid for the token expiration.
+//
+// Notes:
+//   - Combined tokens need a client SDK that supports them, older SDKs need the separate tokens of GenRtcRtmTokens.
+//
+// Example usage:
+//
+//	tokenReq := TokenRequest{
+//	    TokenType: "rtc+rtm",
+//	    Channel:   "my_channel",
+//	    Uid:       "user123",
+//	    RtcRole:   "publisher",
+//	}
+//	token, err := TokenService.GenRtcRtmToken(tokenReq)
+func (s *TokenService) GenRtcRtmToken(tokenRequest TokenRequest) (string, error) {
+	token, tokenExpire, err := s.newRtcAccessToken(tokenRequest)
+	if err != nil {
+		return "", err
+	}
+	serviceRtm := accesstoken.NewServiceRtm(tokenRequest.Uid)
+	serviceRtm.AddPrivilege(accesstoken.PrivilegeLogin, tokenExpire)
+	token.AddService(serviceRtm)
+	return token.Build()
+}
+
+// GenRtcRtmTokens generates the RTC and the RTM token of an "rtc+rtm" request as two separate tokens,
+// for client SDKs that can't use the combined token of GenRtcRtmToken.
+// Both tokens are for the same UID or account and expire at the same time, see GenRtcRtmToken.
+//
+// Returns:
+//   - string: The generated RTC token.
+//   - string: The generated RTM token.
+//   - error: An error if there are any issues during token generation or validation.
+func (s *TokenService) GenRtcRtmTokens(tokenRequest TokenRequest) (string, string, error) {
+	token, tokenExpire, err := s.newRtcAccessToken(tokenRequest)
+	if err != nil {
+		return "", "", err
+	}
+	rtcToken, err := token.Build()
+	if err != nil {
+		return "", "", err
+	}
+	rtmToken, err := s.GenRtmToken(TokenRequest{TokenType: "rtm", Uid: tokenRequest.Uid, ExpirationSeconds: int(tokenExpire)})
+	if err != nil {
+		return "", "", err
+	}
+	return rtcToken, rtmToken, nil
+}
+
+// newRtcAccessToken validates an RTC token request and returns the AccessToken2 with its RTC service, and the token expiration.
+// Used by GenRtcToken and the combined RTC and RTM tokens, so they share the same role and expiration rules.
+func (s *TokenService) newRtcAccessToken(tokenRequest TokenRequest) (*accesstoken.AccessToken, uint32, error) {
 	if tokenRequest.Channel == "" {
-		return "", errors.New("invalid: missing channel name")
+		return nil, 0, errors.New("invalid: missing channel name")
 	}
 	if tokenRequest.Uid == "" {
-		return "", errors.New("invalid: missing user ID or account")
+		return nil, 0, errors.New("invalid: missing user ID or account")
 	}
 
-	var userRole rtctokenbuilder2.Role
-	if tokenRequest.RtcRole == "publisher" {
-		userRole = rtctokenbuilder2.RolePublisher
-	} else {
-		userRole = rtctokenbuilder2.RoleSubscriber
+	tokenExpire, privileges, err := resolveRtcPrivileges(tokenRequest)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	if tokenRequest.ExpirationSeconds == 0 {
-		tokenRequest.ExpirationSeconds = 3600
+	// Numeric UIDs are encoded the same way as rtctokenbuilder2.BuildTokenWithUid
+	account := tokenRequest.Uid
+	if uid64, parseErr := strconv.ParseUint(tokenRequest.Uid, 10, 32); parseErr == nil {
+		account = accesstoken.GetUidStr(uint32(uid64))
 	}
 
-	uid64, parseErr := strconv.ParseUint(tokenRequest.Uid, 10, 64)
-	if parseErr != nil {
-		return rtctokenbuilder2.BuildTokenWithAccount(
-			s.appID, s.appCertificate, tokenRequest.Channel,
-			tokenRequest.Uid, userRole, uint32(tokenRequest.ExpirationSeconds),
-		)
+	token := accesstoken.NewAccessToken(s.appID, s.certificates.signing(), tokenExpire)
+	serviceRtc := accesstoken.NewServiceRtc(tokenRequest.Channel, account)
+	for privilege, expire := range privileges {
+		serviceRtc.AddPrivilege(privilege, expire)
 	}
+	token.AddService(serviceRtc)
+	return token, tokenExpire, nil
+}
 
-	return rtctokenbuilder2.BuildTokenWithUid(
-		s.appID, s.appCertificate, tokenRequest.Channel,
-		uint32(uid64), userRole, uint32(tokenRequest.ExpirationSeconds),
-	)
+// wantsSeparateTokens reports whether an "rtc+rtm" request asks for separate RTC and RTM tokens instead of a combined token.
+func wantsSeparateTokens(tokenReq TokenRequest) bool {
+	return tokenReq.TokenType == "rtc+rtm" && tokenReq.SeparateTokens
+}
+
+// resolveRtcPrivileges validates the role and privilege expirations of an RTC token request.
+// It returns the token expiration and the expiration of each privilege to add to the token.
+//
+// Behavior:
+//   - The token expiration defaults to the longest privilege expiration, or 3600 seconds (1 hour) if none is set.
+//   - The join channel privilege defaults to the token expiration.
+//   - Publishers get all publish privileges for the token expiration unless a shorter expiration is set.
+//   - Subscribers only get the publish privileges that have an expiration set, e.g. a "raise hand" window.
+//   - Negative expirations and privilege expirations longer than the token expiration are rejected.
+func resolveRtcPrivileges(tokenRequest TokenRequest) (uint32, map[uint16]uint32, error) {
+	var isPublisher bool
+	switch tokenRequest.RtcRole {
+	case "publisher":
+		isPublisher = true
+	case "subscriber", "":
+		isPublisher = false
+	default:
+		return 0, nil, fmt.Errorf("invalid: unknown role %q, expected publisher or subscriber", tokenRequest.RtcRole)
+	}
+
+	privilegeExpires := map[uint16]int{
+		accesstoken.PrivilegeJoinChannel:        tokenRequest.JoinChannelPrivilegeExpire,
+		accesstoken.PrivilegePublishAudioStream: tokenRequest.PubAudioPrivilegeExpire,
+		accesstoken.PrivilegePublishVideoStream: tokenRequest.PubVideoPrivilegeExpire,
+		accesstoken.PrivilegePublishDataStream:  tokenRequest.PubDataStreamPrivilegeExpire,
+	}
+
+	if tokenRequest.ExpirationSeconds < 0 {
+		return 0, nil, errors.New("invalid: expire must not be negative")
+	}
+	tokenExpire := tokenRequest.ExpirationSeconds
+	for _, expire := range privilegeExpires {
+		if expire < 0 {
+			return 0, nil, errors.New("invalid: privilege expirations must not be negative")
+		}
+		if tokenRequest.ExpirationSeconds == 0 && expire > tokenExpire {
+			tokenExpire = expire
+		}
+	}
+	if tokenExpire == 0 {
+		tokenExpire = 3600
+	}
+
+	privileges := make(map[uint16]uint32)
+	for privilege, expire := range privilegeExpires {
+		if expire > tokenExpire {
+			return 0, nil, errors.New("invalid: privilege expirations must not be longer than the token expiration")
+		}
+		switch {
+		case expire > 0:
+			privileges[privilege] = uint32(expire)
+		case privilege == accesstoken.PrivilegeJoinChannel || isPublisher:
+			privileges[privilege] = uint32(tokenExpire)
+		}
+	}
+	return uint32(tokenExpire), privileges, nil
 }
 
 // GenRtmToken generates an RTM (Real-Time Messaging) token based on the provided TokenRequest and returns it.
@@ -135,7 +399,7 @@ func (s *TokenService) GenRtcToken(tokenRequest TokenRequest) (string, error) {
 //   - error: An error if there are any issues during token generation or validation.
 //
 // Behavior:
-//  1. Validates the required field in the TokenRequest (UID).
+//  1. Validates the required field in the TokenRequest (UID), and rejects a negative expiration.
 //  2. Sets a default expiration time of 3600 seconds (1 hour) if not provided in the request.
 //  3. Generates the RTM token using the rtmtokenbuilder2 package.
 //
@@ -155,12 +419,15 @@ func (s *TokenService) GenRtmToken(tokenRequest TokenRequest) (string, error) {
 	if tokenRequest.Uid == "" {
 		return "", errors.New("invalid: missing user ID or account")
 	}
+	if tokenRequest.ExpirationSeconds < 0 {
+		return "", errors.New("invalid: expire must not be negative")
+	}
 	if tokenRequest.ExpirationSeconds == 0 {
 		tokenRequest.ExpirationSeconds = 3600
 	}
 
 	return rtmtokenbuilder2.BuildToken(
-		s.appID, s.appCertificate,
+		s.appID, s.certificates.signing(),
 		tokenRequest.Uid,
 		uint32(tokenRequest.ExpirationSeconds),
 		tokenRequest.Channel,
@@ -177,7 +444,7 @@ func (s *TokenService) GenRtmToken(tokenRequest TokenRequest) (string, error) {
 //   - error: An error if there are any issues during token generation or validation.
 //
 // Behavior:
-//  1. Sets a default expiration time of 3600 seconds (1 hour) if not provided in the request.
+//  1. Rejects a negative expiration, and sets a default expiration time of 3600 seconds (1 hour) if not provided in the request.
 //  2. Determines whether to generate a chat app token or a chat user token based on the "UID" field in the request.
 //  3. Generates the chat token using the chatTokenBuilder package.
 //
@@ -202,6 +469,9 @@ func (s *TokenService) GenRtmToken(tokenRequest TokenRequest) (string, error) {
 //	}
 //	token, err := TokenService.GenChatToken(tokenReq)
 func (s *TokenService) GenChatToken(tokenRequest TokenRequest) (string, error) {
+	if tokenRequest.ExpirationSeconds < 0 {
+		return "", errors.New("invalid: expire must not be negative")
+	}
 	if tokenRequest.ExpirationSeconds == 0 {
 		tokenRequest.ExpirationSeconds = 3600
 	}
@@ -211,11 +481,11 @@ func (s *TokenService) GenChatToken(tokenRequest TokenRequest) (string, error) {
 
 	if tokenRequest.Uid == "" {
 		chatToken, tokenErr = chatTokenBuilder.BuildChatAppToken(
-			s.appID, s.appCertificate, uint32(tokenRequest.ExpirationSeconds),
+			s.appID, s.certificates.signing(), uint32(tokenRequest.ExpirationSeconds),
 		)
 	} else {
 		chatToken, tokenErr = chatTokenBuilder.BuildChatUserToken(
-			s.appID, s.appCertificate,
+			s.appID, s.certificates.signing(),
 			tokenRequest.Uid,
 			uint32(tokenRequest.ExpirationSeconds),
 		)
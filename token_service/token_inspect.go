@@ -0,0 +1,266 @@
+package token_service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/go-tokenbuilder/accesstoken"
+	"github.com/gin-gonic/gin"
+)
+
+// TokenInspectRequest is the JSON payload of the inspect endpoint.
+type TokenInspectRequest struct {
+	Token string `json:"token"` // The AccessToken2 token to decode
+}
+
+// TokenInspection is the decoded content of an AccessToken2 token.
+// Expirations in an AccessToken2 are seconds after the issue time, the absolute timestamps are included for convenience.
+type TokenInspection struct {
+	AppID          string             `json:"appId"`                // The Agora app ID the token was issued for
+	IssuedAt       int64              `json:"issuedAt"`             // Unix timestamp (s) when the token was issued
+	Expire         uint32             `json:"expire"`               // Seconds the token is valid after it was issued
+	ExpiresAt      int64              `json:"expiresAt"`            // Unix timestamp (s) when the token expires
+	Expired        bool               `json:"expired"`              // Whether the token has expired
+	Salt           uint32             `json:"salt"`                 // Random salt of the token
+	SignatureValid bool               `json:"signatureValid"`       // Whether the token was signed with the configured app ID and one of its certificates
+	SignedWith     string             `json:"signedWith,omitempty"` // The certificate that signed the token: "primary" or "secondary"
+	Services       []TokenServiceInfo `json:"services"`             // The services in the token, ordered by service type
+}
+
+// TokenServiceInfo describes a service in an AccessToken2 token.
+type TokenServiceInfo struct {
+	Type        string               `json:"type"`              // The service name: "rtc", "rtm", "fpa", "chat" or "education"
+	ServiceType uint16               `json:"serviceType"`       // The numeric service type
+	Channel     string               `json:"channel,omitempty"` // The channel name (RTC)
+	Uid         string               `json:"uid,omitempty"`     // The user ID or account (RTC, RTM, chat and education)
+	Privileges  []TokenPrivilegeInfo `json:"privileges"`        // The privileges of the service, ordered by privilege
+}
+
+// TokenPrivilegeInfo describes a privilege of a service and its expiration.
+type TokenPrivilegeInfo struct {
+	Name      string `json:"name"`      // The privilege name, e.g. "joinChannel" or "publishAudioStream"
+	Privilege uint16 `json:"privilege"` // The numeric privilege
+	Expire    uint32 `json:"expire"`    // Seconds the privilege is valid after the token was issued, 0 means it doesn't expire separately
+	ExpiresAt int64  `json:"expiresAt"` // Unix timestamp (s) when the privilege expires
+}
+
+// maxTokenPayload is the largest decompressed token content ParseToken accepts, tokens are a few hundred bytes.
+const maxTokenPayload = 64 * 1024
+
+// serviceNames maps the AccessToken2 service types to their names.
+var serviceNames = map[uint16]string{
+	accesstoken.ServiceTypeRtc:       "rtc",
+	accesstoken.ServiceTypeRtm:       "rtm",
+	accesstoken.ServiceTypeFpa:       "fpa",
+	accesstoken.ServiceTypeChat:      "chat",
+	accesstoken.ServiceTypeEducation: "education",
+}
+
+// privilegeNames maps the privileges of each service type to their names.
+var privilegeNames = map[uint16]map[uint16]string{
+	accesstoken.ServiceTypeRtc: {
+		accesstoken.PrivilegeJoinChannel:        "joinChannel",
+		accesstoken.PrivilegePublishAudioStream: "publishAudioStream",
+		accesstoken.PrivilegePublishVideoStream: "publishVideoStream",
+		accesstoken.PrivilegePublishDataStream:  "publishDataStream",
+	},
+	accesstoken.ServiceTypeRtm: {accesstoken.PrivilegeLogin: "login"},
+	accesstoken.ServiceTypeFpa: {accesstoken.PrivilegeLogin: "login"},
+	accesstoken.ServiceTypeChat: {
+		accesstoken.PrivilegeChatUser: "user",
+		accesstoken.PrivilegeChatApp:  "app",
+	},
+	accesstoken.ServiceTypeEducation: {
+		accesstoken.PrivilegeEducationRoomUser: "roomUser",
+		accesstoken.PrivilegeEducationUser:     "user",
+		accesstoken.PrivilegeEducationApp:      "app",
+	},
+}
+
+// InspectToken handles the HTTP request to decode a token.
+// Returns an HTTP 400 error if the body has no token or the token is not a valid AccessToken2.
+// A token with an invalid signature is still decoded, with "signatureValid" set to false.
+// The signature is verified with the credentials of the request's tenant.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.POST("/inspect", TokenService.InspectToken)
+func (s *TokenService) InspectToken(c *gin.Context) {
+	var inspectReq TokenInspectRequest
+	if !request_validation.BindJSON(c, &inspectReq) {
+		return
+	}
+
+	inspection, err := s.ForContext(c.Request.Context()).ParseToken(inspectReq.Token)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, inspection)
+}
+
+// ParseToken decodes an AccessToken2 token and verifies its signature against the configured app certificates.
+//
+// Parameters:
+//   - token: string - The token to decode, as generated by GenRtcToken, GenRtmToken or GenChatToken.
+//
+// Returns:
+//   - *TokenInspection: The decoded token.
+//   - error: An error if the token is not a valid AccessToken2.
+//
+// Notes:
+//   - The signature is only valid for tokens issued with the configured app ID and its primary or secondary certificate.
+func (s *TokenService) ParseToken(token string) (inspection *TokenInspection, err error) {
+	signature, content, err := splitToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// accesstoken.Parse panics on unknown service types
+	defer func() {
+		if r := recover(); r != nil {
+			inspection, err = nil, fmt.Errorf("invalid token: %v", r)
+		}
+	}()
+	accessToken := accesstoken.CreateAccessToken()
+	if ok, parseErr := accessToken.Parse(token); !ok || parseErr != nil {
+		return nil, errors.New("invalid token: failed to decode")
+	}
+
+	issuedAt := time.Unix(int64(accessToken.IssueTs), 0)
+	expiresAt := issuedAt.Add(time.Duration(accessToken.Expire) * time.Second)
+	inspection = &TokenInspection{
+		AppID:     accessToken.AppId,
+		IssuedAt:  issuedAt.Unix(),
+		Expire:    accessToken.Expire,
+		ExpiresAt: expiresAt.Unix(),
+		Expired:   time.Now().After(expiresAt),
+		Salt:      accessToken.Salt,
+	}
+	if accessToken.AppId == s.appID {
+		for _, certificate := range s.certificates.verifying() {
+			if verifyTokenSignature(certificate.certificate, accessToken.IssueTs, accessToken.Salt, signature, content) {
+				inspection.SignatureValid, inspection.SignedWith = true, certificate.name
+				break
+			}
+		}
+	}
+
+	serviceTypes := make([]int, 0, len(accessToken.Services))
+	for serviceType := range accessToken.Services {
+		serviceTypes = append(serviceTypes, int(serviceType))
+	}
+	sort.Ints(serviceTypes)
+	for _, serviceType := range serviceTypes {
+		inspection.Services = append(inspection.Services, describeService(accessToken.Services[uint16(serviceType)], uint16(serviceType), accessToken.IssueTs))
+	}
+	return inspection, nil
+}
+
+// tokenExpiresAt returns the Unix timestamp when a generated token expires.
+func tokenExpiresAt(token string) (int64, error) {
+	accessToken := accesstoken.CreateAccessToken()
+	if ok, err := accessToken.Parse(token); !ok || err != nil {
+		return 0, errors.New("invalid token: failed to decode")
+	}
+	return int64(accessToken.IssueTs) + int64(accessToken.Expire), nil
+}
+
+// describeService returns the channel, UID and privileges of a decoded service.
+func describeService(service accesstoken.IService, serviceType uint16, issueTs uint32) TokenServiceInfo {
+	info := TokenServiceInfo{Type: serviceNames[serviceType], ServiceType: serviceType, Privileges: []TokenPrivilegeInfo{}}
+
+	var privileges map[uint16]uint32
+	switch svc := service.(type) {
+	case *accesstoken.ServiceRtc:
+		info.Channel, info.Uid, privileges = svc.ChannelName, svc.Uid, svc.Privileges
+	case *accesstoken.ServiceRtm:
+		info.Uid, privileges = svc.UserId, svc.Privileges
+	case *accesstoken.ServiceChat:
+		info.Uid, privileges = svc.UserId, svc.Privileges
+	case *accesstoken.ServiceEducation:
+		info.Uid, privileges = svc.UserUuid, svc.Privileges
+	case *accesstoken.ServiceFpa:
+		privileges = svc.Privileges
+	}
+
+	keys := make([]int, 0, len(privileges))
+	for privilege := range privileges {
+		keys = append(keys, int(privilege))
+	}
+	sort.Ints(keys)
+	for _, key := range keys {
+		privilege := uint16(key)
+		info.Privileges = append(info.Privileges, TokenPrivilegeInfo{
+			Name:      privilegeNames[serviceType][privilege],
+			Privilege: privilege,
+			Expire:    privileges[privilege],
+			ExpiresAt: int64(issueTs) + int64(privileges[privilege]),
+		})
+	}
+	return info
+}
+
+// splitToken decodes an AccessToken2 token into its signature and the signed content.
+func splitToken(token string) ([]byte, []byte, error) {
+	if len(token) <= accesstoken.VersionLength || token[:accesstoken.VersionLength] != accesstoken.Version {
+		return nil, nil, fmt.Errorf("invalid token: expected an AccessToken2 starting with %q", accesstoken.Version)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(token[accesstoken.VersionLength:])
+	if err != nil {
+		return nil, nil, errors.New("invalid token: not base64 encoded")
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, nil, errors.New("invalid token: not zlib compressed")
+	}
+	// Limit the decompressed size, a small token could otherwise decompress to gigabytes
+	data, err := io.ReadAll(io.LimitReader(reader, maxTokenPayload+1))
+	if err != nil {
+		return nil, nil, errors.New("invalid token: not zlib compressed")
+	}
+	if len(data) > maxTokenPayload {
+		return nil, nil, fmt.Errorf("invalid token: content larger than %d bytes", maxTokenPayload)
+	}
+
+	if len(data) < 2 {
+		return nil, nil, errors.New("invalid token: too short")
+	}
+	signatureLength := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+signatureLength {
+		return nil, nil, errors.New("invalid token: too short")
+	}
+	return data[2 : 2+signatureLength], data[2+signatureLength:], nil
+}
+
+// verifyTokenSignature checks the signature of the token content, computed the same way as accesstoken.Build.
+func verifyTokenSignature(appCertificate string, issueTs uint32, salt uint32, signature []byte, content []byte) bool {
+	issueTsKey := make([]byte, 4)
+	binary.LittleEndian.PutUint32(issueTsKey, issueTs)
+	hIssueTs := hmac.New(sha256.New, issueTsKey)
+	hIssueTs.Write([]byte(appCertificate))
+
+	saltKey := make([]byte, 4)
+	binary.LittleEndian.PutUint32(saltKey, salt)
+	hSalt := hmac.New(sha256.New, saltKey)
+	hSalt.Write(hIssueTs.Sum(nil))
+
+	hSign := hmac.New(sha256.New, hSalt.Sum(nil))
+	hSign.Write(content)
+	return hmac.Equal(hSign.Sum(nil), signature)
+}
@@ -0,0 +1,161 @@
+package token_service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AgoraIO-Community/go-tokenbuilder/accesstoken"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseToken(t *testing.T) {
+	service := NewTestTokenService()
+
+	t.Run("RTC token", func(t *testing.T) {
+		token, err := service.GenRtcToken(TokenRequest{TokenType: "rtc", Channel: "test-channel", Uid: "1234", RtcRole: "subscriber", ExpirationSeconds: 14400, PubAudioPrivilegeExpire: 600})
+		if err != nil {
+			t.Fatalf("GenRtcToken() error = %v", err)
+		}
+		inspection, err := service.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+
+		if inspection.AppID != service.appID || !inspection.SignatureValid || inspection.Expired {
+			t.Errorf("ParseToken() = %+v", inspection)
+		}
+		if inspection.Expire != 14400 || inspection.ExpiresAt != inspection.IssuedAt+14400 {
+			t.Errorf("expire = %d, expiresAt = %d, issuedAt = %d", inspection.Expire, inspection.ExpiresAt, inspection.IssuedAt)
+		}
+		if len(inspection.Services) != 1 {
+			t.Fatalf("got %d services, want 1", len(inspection.Services))
+		}
+		rtc := inspection.Services[0]
+		if rtc.Type != "rtc" || rtc.Channel != "test-channel" || rtc.Uid != "1234" {
+			t.Errorf("rtc service = %+v", rtc)
+		}
+		want := map[string]uint32{"joinChannel": 14400, "publishAudioStream": 600}
+		if len(rtc.Privileges) != len(want) {
+			t.Fatalf("privileges = %+v, want %v", rtc.Privileges, want)
+		}
+		for _, privilege := range rtc.Privileges {
+			if want[privilege.Name] != privilege.Expire || privilege.ExpiresAt != inspection.IssuedAt+int64(privilege.Expire) {
+				t.Errorf("privilege %+v, want expire %d", privilege, want[privilege.Name])
+			}
+		}
+	})
+
+	t.Run("RTM token with a channel", func(t *testing.T) {
+		token, _ := service.GenRtmToken(TokenRequest{TokenType: "rtm", Uid: "test-user", Channel: "test-channel"})
+		inspection, err := service.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if len(inspection.Services) != 2 || inspection.Services[0].Type != "rtc" || inspection.Services[1].Type != "rtm" || inspection.Services[1].Uid != "test-user" {
+			t.Errorf("services = %+v", inspection.Services)
+		}
+	})
+
+	t.Run("Chat app token", func(t *testing.T) {
+		token, _ := service.GenChatToken(TokenRequest{TokenType: "chat"})
+		inspection, err := service.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if len(inspection.Services) != 1 || inspection.Services[0].Privileges[0].Name != "app" {
+			t.Errorf("services = %+v", inspection.Services)
+		}
+	})
+
+	t.Run("Token signed with another certificate", func(t *testing.T) {
+		accessToken := accesstoken.NewAccessToken(service.appID, "00000000000000000000000000000000", 600)
+		accessToken.AddService(accesstoken.NewServiceRtm("test-user"))
+		token, _ := accessToken.Build()
+		inspection, err := service.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if inspection.SignatureValid {
+			t.Errorf("expected an invalid signature")
+		}
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		accessToken := accesstoken.NewAccessToken(service.appID, service.certificates.signing(), 60)
+		accessToken.IssueTs = uint32(time.Now().Add(-time.Hour).Unix())
+		accessToken.AddService(accesstoken.NewServiceRtm("test-user"))
+		token, _ := accessToken.Build()
+		inspection, err := service.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if !inspection.Expired || !inspection.SignatureValid {
+			t.Errorf("ParseToken() = %+v", inspection)
+		}
+	})
+
+	for _, token := range []string{"", "006abc", "007not-base64!", "007" + "eJwrSS0uAQAEXQHB", compressionBomb()} {
+		if _, err := service.ParseToken(token); err == nil {
+			t.Errorf("ParseToken(%q) expected an error", token)
+		}
+	}
+}
+
+func TestInspectToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	token, _ := service.GenRtcToken(TokenRequest{TokenType: "rtc", Channel: "test-channel", Uid: "1234"})
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		wantStatusCode int
+	}{
+		{name: "Valid token", requestBody: `{"token": "` + token + `"}`, wantStatusCode: http.StatusOK},
+		{name: "Missing token", requestBody: `{}`, wantStatusCode: http.StatusBadRequest},
+		{name: "Invalid token", requestBody: `{"token": "not-a-token"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "Token decompressing past the limit", requestBody: `{"token": "` + compressionBomb() + `"}`, wantStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/token/inspect", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(rr)
+			c.Request = req
+
+			service.InspectToken(c)
+
+			if status := rr.Code; status != tt.wantStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.wantStatusCode)
+			}
+			if tt.wantStatusCode == http.StatusOK {
+				var inspection TokenInspection
+				if err := json.Unmarshal(rr.Body.Bytes(), &inspection); err != nil {
+					t.Fatalf("Error unmarshaling response: %v", err)
+				}
+				if !inspection.SignatureValid || len(inspection.Services) != 1 {
+					t.Errorf("unexpected inspection: %+v", inspection)
+				}
+			}
+		})
+	}
+}
+
+// compressionBomb returns a token of a few kilobytes that decompresses to 16 MB.
+func compressionBomb() string {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(make([]byte, 16<<20))
+	writer.Close()
+	return "007" + base64.StdEncoding.EncodeToString(compressed.Bytes())
+}
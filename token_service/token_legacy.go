@@ -0,0 +1,176 @@
+package token_service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+)
+
+// legacyTokenKeys maps the token types to their keys in the responses of the legacy routes.
+var legacyTokenKeys = map[string]string{
+	"rtc":  "rtcToken",
+	"rtm":  "rtmToken",
+	"chat": "chatToken",
+}
+
+// SetLegacyRoutes enables the routes compatible with the community agora-token-service, e.g. GET /rtc/:channelName/:role/:tokentype/:uid/.
+// Clients built against that service can use this service without changes.
+func (s *TokenService) SetLegacyRoutes(enabled bool) {
+	s.legacyRoutes = enabled
+}
+
+// registerLegacyRoutes registers the routes of the community agora-token-service, with the same authentication as the token routes.
+func (s *TokenService) registerLegacyRoutes(r *gin.Engine) {
+	legacy := r.Group("/")
+	legacy.Use(s.Authenticate())
+	legacy.GET("/rtc/:channelName/:role/:tokentype/:uid/", s.GetLegacyRtcToken)
+	legacy.GET("/rtm/:uid/", s.GetLegacyRtmToken)
+	legacy.GET("/rte/:channelName/:role/:tokentype/:uid/", s.GetLegacyRteTokens)
+	legacy.GET("/rte/:channelName/:role/:tokentype/:uid/:rtmuid/", s.GetLegacyRteTokens)
+	legacy.GET("/chat/app/", s.GetLegacyChatToken)
+	legacy.GET("/chat/account/:uid/", s.GetLegacyChatToken)
+}
+
+// GetLegacyRtcToken handles the agora-token-service request for an RTC token, responding with {"rtcToken": "..."}.
+// Returns an HTTP 400 error if the token type, UID or expiry is invalid, and an HTTP 403 error if the policy denies the token.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Notes:
+//   - The path is /rtc/:channelName/:role/:tokentype/:uid/, the token type is "uid" or "userAccount".
+//   - The optional "expiry" query parameter sets the token expiration in seconds, defaults to 3600.
+//
+// Example usage:
+//
+//	router.GET("/rtc/:channelName/:role/:tokentype/:uid/", TokenService.GetLegacyRtcToken)
+func (s *TokenService) GetLegacyRtcToken(c *gin.Context) {
+	rtcReq, err := legacyRtcRequest(c)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	s.handleLegacyTokens(c, rtcReq)
+}
+
+// GetLegacyRtmToken handles the agora-token-service request for an RTM token, responding with {"rtmToken": "..."}.
+// The path is /rtm/:uid/, with the same "expiry" query parameter as GetLegacyRtcToken.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+func (s *TokenService) GetLegacyRtmToken(c *gin.Context) {
+	expire, err := legacyExpire(c)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	s.handleLegacyTokens(c, TokenRequest{TokenType: "rtm", Uid: c.Param("uid"), ExpirationSeconds: expire})
+}
+
+// GetLegacyRteTokens handles the agora-token-service request for both an RTC and an RTM token, responding with {"rtcToken": "...", "rtmToken": "..."}.
+// The path is /rte/:channelName/:role/:tokentype/:uid/ with an optional /:rtmuid/, the RTM token is for the RTC UID unless it is set.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+func (s *TokenService) GetLegacyRteTokens(c *gin.Context) {
+	rtcReq, err := legacyRtcRequest(c)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	rtmReq := TokenRequest{TokenType: "rtm", Uid: c.Param("rtmuid"), ExpirationSeconds: rtcReq.ExpirationSeconds}
+	if rtmReq.Uid == "" {
+		rtmReq.Uid = rtcReq.Uid
+	}
+	s.handleLegacyTokens(c, rtcReq, rtmReq)
+}
+
+// GetLegacyChatToken handles the agora-token-service request for a chat token, responding with {"chatToken": "..."}.
+// The path is /chat/app/ for an app token or /chat/account/:uid/ for a user token, with the same "expiry" query parameter as GetLegacyRtcToken.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+func (s *TokenService) GetLegacyChatToken(c *gin.Context) {
+	expire, err := legacyExpire(c)
+	if err != nil {
+		api_errors.Abort(c, http.StatusBadRequest, err)
+		return
+	}
+	s.handleLegacyTokens(c, TokenRequest{TokenType: "chat", Uid: c.Param("uid"), ExpirationSeconds: expire})
+}
+
+// handleLegacyTokens checks the token requests against the policy, generates the tokens with the credentials of the request's tenant,
+// records each request in the audit log, and responds with each token under the key of its token type.
+func (s *TokenService) handleLegacyTokens(c *gin.Context, tokenReqs ...TokenRequest) {
+	service := s.ForContext(c.Request.Context())
+	response := gin.H{}
+	for _, tokenReq := range tokenReqs {
+		if err := s.authorize(c, tokenReq); err != nil {
+			s.RecordAudit(c, NewAuditEvent("legacy", tokenReq, 0, err))
+			api_errors.Abort(c, http.StatusForbidden, err)
+			return
+		}
+		token, err := service.GenToken(tokenReq)
+		if err != nil {
+			s.RecordAudit(c, NewAuditEvent("legacy", tokenReq, 0, err))
+			api_errors.Abort(c, http.StatusBadRequest, err)
+			return
+		}
+		expiresAt, _ := tokenExpiresAt(token)
+		s.RecordAudit(c, NewAuditEvent("legacy", tokenReq, expiresAt, nil))
+		response[legacyTokenKeys[tokenReq.TokenType]] = token
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// legacyRtcRequest maps the path of a legacy RTC request onto a TokenRequest.
+// A "uid" token type requires a numeric UID, a "userAccount" token type accepts any account.
+func legacyRtcRequest(c *gin.Context) (TokenRequest, error) {
+	expire, err := legacyExpire(c)
+	if err != nil {
+		return TokenRequest{}, err
+	}
+	uid := c.Param("uid")
+	switch strings.ToLower(c.Param("tokentype")) {
+	case "uid":
+		if _, err := strconv.ParseUint(uid, 10, 32); err != nil {
+			return TokenRequest{}, errors.New("invalid: uid must be a 32-bit unsigned integer")
+		}
+	case "useraccount":
+	default:
+		return TokenRequest{}, errors.New("invalid: tokentype must be uid or userAccount")
+	}
+	return TokenRequest{
+		TokenType:         "rtc",
+		Channel:           c.Param("channelName"),
+		RtcRole:           legacyRole(c.Param("role")),
+		Uid:               uid,
+		ExpirationSeconds: expire,
+	}, nil
+}
+
+// legacyRole maps the role of a legacy RTC request onto an RTC role the way agora-token-service does:
+// "publisher" is a publisher and any other role, e.g. "audience", is a subscriber.
+func legacyRole(role string) string {
+	if role == "publisher" {
+		return "publisher"
+	}
+	return "subscriber"
+}
+
+// legacyExpire returns the token expiration from the "expiry" query parameter, 0 uses the default expiration.
+func legacyExpire(c *gin.Context) (int, error) {
+	expiry := c.Query("expiry")
+	if expiry == "" {
+		return 0, nil
+	}
+	expire, err := strconv.ParseUint(expiry, 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid: expiry must be a number of seconds")
+	}
+	return int(expire), nil
+}
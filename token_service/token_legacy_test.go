@@ -0,0 +1,142 @@
+package token_service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLegacyRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	service.SetLegacyRoutes(true)
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		path           string
+		wantStatusCode int
+		wantTokens     []string
+	}{
+		{name: "RTC token with UID", path: "/rtc/test-channel/publisher/uid/1234/", wantStatusCode: http.StatusOK, wantTokens: []string{"rtcToken"}},
+		{name: "RTC token with user account", path: "/rtc/test-channel/subscriber/userAccount/user123/?expiry=600", wantStatusCode: http.StatusOK, wantTokens: []string{"rtcToken"}},
+		{name: "RTC token with non-numeric UID", path: "/rtc/test-channel/publisher/uid/user123/", wantStatusCode: http.StatusBadRequest},
+		{name: "RTC token with unknown token type", path: "/rtc/test-channel/publisher/account/1234/", wantStatusCode: http.StatusBadRequest},
+		{name: "RTC token with another role", path: "/rtc/test-channel/audience/uid/1234/", wantStatusCode: http.StatusOK, wantTokens: []string{"rtcToken"}},
+		{name: "RTC token with invalid expiry", path: "/rtc/test-channel/publisher/uid/1234/?expiry=soon", wantStatusCode: http.StatusBadRequest},
+		{name: "RTM token", path: "/rtm/user123/", wantStatusCode: http.StatusOK, wantTokens: []string{"rtmToken"}},
+		{name: "RTC and RTM tokens", path: "/rte/test-channel/publisher/uid/1234/", wantStatusCode: http.StatusOK, wantTokens: []string{"rtcToken", "rtmToken"}},
+		{name: "RTC and RTM tokens with RTM UID", path: "/rte/test-channel/publisher/uid/1234/user123/", wantStatusCode: http.StatusOK, wantTokens: []string{"rtcToken", "rtmToken"}},
+		{name: "Chat app token", path: "/chat/app/", wantStatusCode: http.StatusOK, wantTokens: []string{"chatToken"}},
+		{name: "Chat user token", path: "/chat/account/user123/", wantStatusCode: http.StatusOK, wantTokens: []string{"chatToken"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatusCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatusCode, w.Body.String())
+			}
+			var response map[string]string
+			json.Unmarshal(w.Body.Bytes(), &response)
+			for _, key := range tt.wantTokens {
+				if response[key] == "" {
+					t.Errorf("response %v is missing %q", response, key)
+				}
+			}
+		})
+	}
+
+	t.Run("Roles other than publisher get subscriber tokens", func(t *testing.T) {
+		privileges := func(role string) []TokenPrivilegeInfo {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/rtc/test-channel/"+role+"/uid/1234/", nil)
+			router.ServeHTTP(w, req)
+			var response map[string]string
+			json.Unmarshal(w.Body.Bytes(), &response)
+			inspection, err := service.ParseToken(response["rtcToken"])
+			if err != nil {
+				t.Fatalf("ParseToken() error = %v", err)
+			}
+			return inspection.Services[0].Privileges
+		}
+		publisher := privileges("publisher")
+		if len(publisher) <= 1 {
+			t.Errorf("publisher privileges = %+v, want publish privileges", publisher)
+		}
+		for _, role := range []string{"subscriber", "audience", "Publisher"} {
+			if got := privileges(role); len(got) != 1 || got[0].Name != "joinChannel" {
+				t.Errorf("%s privileges = %+v, want only joinChannel", role, got)
+			}
+		}
+	})
+
+	t.Run("RTM token for the RTM UID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rte/test-channel/publisher/uid/1234/user123/", nil)
+		router.ServeHTTP(w, req)
+		var response map[string]string
+		json.Unmarshal(w.Body.Bytes(), &response)
+		inspection, err := service.ParseToken(response["rtmToken"])
+		if err != nil {
+			t.Fatalf("ParseToken() error = %v", err)
+		}
+		if inspection.Services[0].Uid != "user123" {
+			t.Errorf("RTM token uid = %q, want %q", inspection.Services[0].Uid, "user123")
+		}
+	})
+}
+
+func TestLegacyRoutesDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewTestTokenService().RegisterRoutes(router)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/rtm/user123/", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestLegacyRoutesPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	service.SetLegacyRoutes(true)
+	service.SetAuthenticators(NewAPIKeyAuthenticator(map[string]string{"kiosk-key": "kiosk"}))
+	service.SetPolicy(&Policy{Rules: []PolicyRule{{Name: "kiosk", Match: map[string]interface{}{"sub": "kiosk"}, TokenTypes: []string{"rtc"}, Channels: []string{"lobby"}}}})
+	router := gin.New()
+	service.RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		path           string
+		apiKey         string
+		wantStatusCode int
+	}{
+		{name: "Allowed", path: "/rtc/lobby/subscriber/uid/1234/", apiKey: "kiosk-key", wantStatusCode: http.StatusOK},
+		{name: "Missing API key", path: "/rtc/lobby/subscriber/uid/1234/", wantStatusCode: http.StatusUnauthorized},
+		{name: "Forbidden channel", path: "/rtc/stage/subscriber/uid/1234/", apiKey: "kiosk-key", wantStatusCode: http.StatusForbidden},
+		{name: "Forbidden RTM token", path: "/rte/lobby/subscriber/uid/1234/", apiKey: "kiosk-key", wantStatusCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatusCode, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package token_service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrForbidden is returned when the policy does not allow a caller to request a token.
+var ErrForbidden = errors.New("forbidden")
+
+// Policy limits the tokens each authenticated caller may request.
+// A token request is allowed when at least one rule that matches the caller allows it, everything else is denied.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule grants the callers it matches the tokens described by its limits.
+// Empty limits allow any value, patterns use path.Match syntax and may reference caller claims as "{claim}", e.g. "room-{sub}-*".
+type PolicyRule struct {
+	Name       string                 `json:"name,omitempty"`       // (Optional) name of the rule, for logs
+	Match      map[string]interface{} `json:"match,omitempty"`      // (Optional) claims the caller must have, array claims must contain the value
+	Auth       []string               `json:"auth,omitempty"`       // (Optional) authentication methods: "apikey", "hmac" or "jwt"
+	TokenTypes []string               `json:"tokenTypes,omitempty"` // (Optional) token types: "rtc", "rtm", "chat" or "rtc+rtm"
+	Channels   []string               `json:"channels,omitempty"`   // (Optional) channel name patterns
+	Uids       []string               `json:"uids,omitempty"`       // (Optional) UID or account patterns
+	Roles      []string               `json:"roles,omitempty"`      // (Optional) RTC roles: "publisher" or "subscriber"
+	MaxExpire  int                    `json:"maxExpire,omitempty"`  // (Optional) maximum token expiration in seconds
+}
+
+// claimPlaceholder matches the "{claim}" references in a pattern.
+var claimPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// LoadPolicy reads a Policy from a JSON file and validates its patterns.
+//
+// Parameters:
+//   - policyFile: string - Path of the JSON policy file.
+//
+// Returns:
+//   - *Policy: The policy in the file.
+//   - error: An error if the file can't be read or a pattern is invalid.
+func LoadPolicy(policyFile string) (*Policy, error) {
+	data, err := os.ReadFile(policyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %v", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate checks that every pattern of the policy is valid.
+func (p *Policy) Validate() error {
+	for i, rule := range p.Rules {
+		for _, pattern := range append(append([]string{}, rule.Channels...), rule.Uids...) {
+			if _, err := path.Match(claimPlaceholder.ReplaceAllString(pattern, "x"), ""); err != nil {
+				return fmt.Errorf("invalid pattern %q in policy rule %d", pattern, i)
+			}
+		}
+		if rule.MaxExpire < 0 {
+			return fmt.Errorf("invalid maxExpire in policy rule %d", i)
+		}
+	}
+	return nil
+}
+
+// Authorize checks whether the caller may request the token.
+// Returns nil when a rule allows the request, otherwise an error wrapping ErrForbidden.
+//
+// Notes:
+//   - RTC requests that set a publish privilege expiration count as the "publisher" role, since the token can publish.
+//   - The expiration is checked after defaults are applied, so a request without "expire" is checked as 3600 seconds.
+//   - "rtc+rtm" requests are allowed by rules that allow "rtc+rtm", or both "rtc" and "rtm".
+func (p *Policy) Authorize(caller *Caller, tokenReq TokenRequest) error {
+	if caller == nil {
+		return fmt.Errorf("%w: unauthenticated caller", ErrForbidden)
+	}
+	role, expire := effectiveRoleAndExpire(tokenReq)
+	for _, rule := range p.Rules {
+		if rule.matches(caller) && rule.allows(caller, tokenReq, role, expire) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q may not request this %s token", ErrForbidden, caller.Subject, tokenReq.TokenType)
+}
+
+// effectiveRoleAndExpire returns the RTC role and token expiration a request will get once defaults are applied.
+// An expiration that is not positive is treated as the default, the request is rejected when the token is generated if it is negative.
+func effectiveRoleAndExpire(tokenReq TokenRequest) (string, int) {
+	expire := tokenReq.ExpirationSeconds
+	if expire <= 0 {
+		expire = 3600
+	}
+	if tokenReq.TokenType != "rtc" && tokenReq.TokenType != "rtc+rtm" {
+		return "", expire
+	}
+
+	role := tokenReq.RtcRole
+	if role == "" {
+		role = "subscriber"
+	}
+	if tokenReq.PubAudioPrivilegeExpire > 0 || tokenReq.PubVideoPrivilegeExpire > 0 || tokenReq.PubDataStreamPrivilegeExpire > 0 {
+		role = "publisher"
+	}
+	// Invalid requests are rejected when the token is generated
+	tokenExpire, _, err := resolveRtcPrivileges(tokenReq)
+	if err != nil {
+		return role, expire
+	}
+	return role, int(tokenExpire)
+}
+
+// matches reports whether the rule applies to the caller.
+func (r PolicyRule) matches(caller *Caller) bool {
+	if len(r.Auth) > 0 && !containsString(r.Auth, caller.Method) {
+		return false
+	}
+	for claim, want := range r.Match {
+		value, ok := caller.Claims[claim]
+		if !ok {
+			return false
+		}
+		if values, isArray := value.([]interface{}); isArray {
+			found := false
+			for _, v := range values {
+				if fmt.Sprint(v) == fmt.Sprint(want) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		} else if fmt.Sprint(value) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows reports whether the rule's limits allow the token request.
+func (r PolicyRule) allows(caller *Caller, tokenReq TokenRequest, role string, expire int) bool {
+	if len(r.TokenTypes) > 0 && !containsString(r.TokenTypes, tokenReq.TokenType) &&
+		!(tokenReq.TokenType == "rtc+rtm" && containsString(r.TokenTypes, "rtc") && containsString(r.TokenTypes, "rtm")) {
+		return false
+	}
+	if len(r.Channels) > 0 && !matchesPattern(r.Channels, caller, tokenReq.Channel) {
+		return false
+	}
+	// Requests with an account are matched by the account, the UID is resolved from it
+	uid := tokenReq.Uid
+	if tokenReq.Account != "" {
+		uid = tokenReq.Account
+	}
+	if len(r.Uids) > 0 && !matchesPattern(r.Uids, caller, uid) {
+		return false
+	}
+	if len(r.Roles) > 0 && role != "" && !containsString(r.Roles, role) {
+		return false
+	}
+	if r.MaxExpire > 0 && expire > r.MaxExpire {
+		return false
+	}
+	return true
+}
+
+// matchesPattern reports whether the value matches one of the patterns once the caller's claims are substituted.
+// A pattern that references a claim the caller doesn't have never matches.
+func matchesPattern(patterns []string, caller *Caller, value string) bool {
+	for _, pattern := range patterns {
+		missingClaim := false
+		expanded := claimPlaceholder.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+			claim, ok := caller.Claims[strings.Trim(placeholder, "{}")]
+			if !ok {
+				missingClaim = true
+				return ""
+			}
+			return escapePattern(fmt.Sprint(claim))
+		})
+		if missingClaim {
+			continue
+		}
+		if matched, err := path.Match(expanded, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePattern escapes the path.Match meta characters of a claim value, so claims are matched literally.
+func escapePattern(value string) string {
+	var escaped strings.Builder
+	for _, char := range value {
+		if strings.ContainsRune(`*?[]\`, char) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(char)
+	}
+	return escaped.String()
+}
+
+// containsString reports whether the list contains the value.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
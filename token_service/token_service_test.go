@@ -1,12 +1,19 @@
 package token_service
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/uid_directory"
+	"github.com/AgoraIO-Community/go-tokenbuilder/accesstoken"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,8 +21,8 @@ import (
 func NewTestTokenService() *TokenService {
 	// Mock credentials for testing
 	return &TokenService{
-		appID:          "6ce46dd303d54056a52f9a34c13c547e",
-		appCertificate: "77be7e16f7482cef9fe796205b85831e",
+		appID:        "6ce46dd303d54056a52f9a34c13c547e",
+		certificates: staticCertificates("77be7e16f7482cef9fe796205b85831e"),
 	}
 }
 
@@ -72,6 +79,103 @@ func TestGenRtcToken(t *testing.T) {
 	}
 }
 
+// parseRtcPrivileges decodes a token and returns the expiration of its RTC privileges.
+func parseRtcPrivileges(t *testing.T, token string) (uint32, map[uint16]uint32) {
+	accessToken := accesstoken.CreateAccessToken()
+	if ok, err := accessToken.Parse(token); !ok || err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	serviceRtc, ok := accessToken.Services[accesstoken.ServiceTypeRtc].(*accesstoken.ServiceRtc)
+	if !ok {
+		t.Fatalf("token has no RTC service")
+	}
+	return accessToken.Expire, serviceRtc.Privileges
+}
+
+func TestGenRtcTokenPrivileges(t *testing.T) {
+	service := NewTestTokenService()
+
+	tests := []struct {
+		name           string
+		request        TokenRequest
+		wantExpire     uint32
+		wantPrivileges map[uint16]uint32
+		wantErr        bool
+	}{
+		{
+			name:       "Publisher gets all privileges",
+			request:    TokenRequest{Channel: "test-channel", Uid: "1234", RtcRole: "publisher", ExpirationSeconds: 600},
+			wantExpire: 600,
+			wantPrivileges: map[uint16]uint32{
+				accesstoken.PrivilegeJoinChannel:        600,
+				accesstoken.PrivilegePublishAudioStream: 600,
+				accesstoken.PrivilegePublishVideoStream: 600,
+				accesstoken.PrivilegePublishDataStream:  600,
+			},
+		},
+		{
+			name:           "Subscriber defaults to join only",
+			request:        TokenRequest{Channel: "test-channel", Uid: "1234"},
+			wantExpire:     3600,
+			wantPrivileges: map[uint16]uint32{accesstoken.PrivilegeJoinChannel: 3600},
+		},
+		{
+			name:       "Subscriber with raise hand window",
+			request:    TokenRequest{Channel: "test-channel", Uid: "user123", RtcRole: "subscriber", ExpirationSeconds: 14400, PubAudioPrivilegeExpire: 600},
+			wantExpire: 14400,
+			wantPrivileges: map[uint16]uint32{
+				accesstoken.PrivilegeJoinChannel:        14400,
+				accesstoken.PrivilegePublishAudioStream: 600,
+			},
+		},
+		{
+			name:       "Token expiration defaults to the longest privilege",
+			request:    TokenRequest{Channel: "test-channel", Uid: "1234", RtcRole: "publisher", JoinChannelPrivilegeExpire: 7200, PubVideoPrivilegeExpire: 300},
+			wantExpire: 7200,
+			wantPrivileges: map[uint16]uint32{
+				accesstoken.PrivilegeJoinChannel:        7200,
+				accesstoken.PrivilegePublishAudioStream: 7200,
+				accesstoken.PrivilegePublishVideoStream: 300,
+				accesstoken.PrivilegePublishDataStream:  7200,
+			},
+		},
+		{
+			name:    "Unknown role",
+			request: TokenRequest{Channel: "test-channel", Uid: "1234", RtcRole: "host"},
+			wantErr: true,
+		},
+		{
+			name:    "Privilege longer than token",
+			request: TokenRequest{Channel: "test-channel", Uid: "1234", ExpirationSeconds: 600, JoinChannelPrivilegeExpire: 1200},
+			wantErr: true,
+		},
+		{
+			name:    "Negative privilege expiration",
+			request: TokenRequest{Channel: "test-channel", Uid: "1234", PubDataStreamPrivilegeExpire: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := service.GenRtcToken(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenRtcToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			expire, privileges := parseRtcPrivileges(t, token)
+			if expire != tt.wantExpire {
+				t.Errorf("token expire = %d, want %d", expire, tt.wantExpire)
+			}
+			if !reflect.DeepEqual(privileges, tt.wantPrivileges) {
+				t.Errorf("privileges = %v, want %v", privileges, tt.wantPrivileges)
+			}
+		})
+	}
+}
+
 func TestGenRtmToken(t *testing.T) {
 	service := NewTestTokenService()
 
@@ -95,6 +199,15 @@ func TestGenRtmToken(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Negative expiration",
+			request: TokenRequest{
+				TokenType:         "rtm",
+				Uid:               "test-user",
+				ExpirationSeconds: -1,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -111,6 +224,85 @@ func TestGenRtmToken(t *testing.T) {
 	}
 }
 
+func TestGenRtcRtmToken(t *testing.T) {
+	service := NewTestTokenService()
+
+	tests := []struct {
+		name         string
+		request      TokenRequest
+		wantServices []string
+		wantExpire   uint32
+		wantErr      bool
+	}{
+		{
+			name:         "Publisher with UID",
+			request:      TokenRequest{TokenType: "rtc+rtm", Channel: "test-channel", Uid: "1234", RtcRole: "publisher", ExpirationSeconds: 600},
+			wantServices: []string{"rtc", "rtm"},
+			wantExpire:   600,
+		},
+		{
+			name:         "Subscriber with raise hand window",
+			request:      TokenRequest{TokenType: "rtc+rtm", Channel: "test-channel", Uid: "user123", PubAudioPrivilegeExpire: 600},
+			wantServices: []string{"rtc", "rtm"},
+			wantExpire:   600,
+		},
+		{
+			name:    "Missing channel",
+			request: TokenRequest{TokenType: "rtc+rtm", Uid: "1234"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown role",
+			request: TokenRequest{TokenType: "rtc+rtm", Channel: "test-channel", Uid: "1234", RtcRole: "admin"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := service.GenToken(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			inspection, err := service.ParseToken(token)
+			if err != nil {
+				t.Fatalf("ParseToken() error = %v", err)
+			}
+			if inspection.Expire != tt.wantExpire {
+				t.Errorf("expire = %d, want %d", inspection.Expire, tt.wantExpire)
+			}
+			var services []string
+			for _, info := range inspection.Services {
+				services = append(services, info.Type)
+			}
+			if !reflect.DeepEqual(services, tt.wantServices) {
+				t.Errorf("services = %v, want %v", services, tt.wantServices)
+			}
+			rtm := inspection.Services[1]
+			if rtm.Uid != tt.request.Uid || len(rtm.Privileges) != 1 || rtm.Privileges[0].Expire != tt.wantExpire {
+				t.Errorf("rtm service = %+v, want login for %q until %d", rtm, tt.request.Uid, tt.wantExpire)
+			}
+
+			// Separate tokens carry the same services and expiration
+			rtcToken, rtmToken, err := service.GenRtcRtmTokens(tt.request)
+			if err != nil {
+				t.Fatalf("GenRtcRtmTokens() error = %v", err)
+			}
+			rtcInspection, _ := service.ParseToken(rtcToken)
+			rtmInspection, _ := service.ParseToken(rtmToken)
+			if !reflect.DeepEqual(rtcInspection.Services, inspection.Services[:1]) {
+				t.Errorf("rtc token services = %+v, want %+v", rtcInspection.Services, inspection.Services[:1])
+			}
+			if !reflect.DeepEqual(rtmInspection.Services, inspection.Services[1:]) {
+				t.Errorf("rtm token services = %+v, want %+v", rtmInspection.Services, inspection.Services[1:])
+			}
+		})
+	}
+}
+
 func TestGenChatToken(t *testing.T) {
 	service := NewTestTokenService()
 
@@ -134,6 +326,14 @@ func TestGenChatToken(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Negative expiration",
+			request: TokenRequest{
+				TokenType:         "chat",
+				ExpirationSeconds: -1,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -185,6 +385,36 @@ func TestGetToken(t *testing.T) {
 			requestBody:    `{"tokenType": "rtc"}`,
 			wantStatusCode: http.StatusBadRequest,
 		},
+		{
+			name:           "Negative RTM expiration",
+			requestBody:    `{"tokenType": "rtm", "uid": "test-user", "expire": -1}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Negative chat expiration",
+			requestBody:    `{"tokenType": "chat", "uid": "test-user", "expire": -1}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown field",
+			requestBody:    `{"tokenType": "rtc", "channel": "test-channel", "uid": "1234", "expires": 600}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown RTC role",
+			requestBody:    `{"tokenType": "rtc", "channel": "test-channel", "uid": "1234", "role": "admin"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Valid RTC and RTM token request",
+			requestBody:    `{"tokenType": "rtc+rtm", "channel": "test-channel", "uid": "1234", "role": "publisher"}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "RTC token with privilege expirations",
+			requestBody:    `{"tokenType": "rtc", "channel": "test-channel", "uid": "1234", "role": "subscriber", "expire": 14400, "pubAudioPrivilegeExpire": 600}`,
+			wantStatusCode: http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
@@ -204,7 +434,8 @@ func TestGetToken(t *testing.T) {
 
 			if tt.wantStatusCode == http.StatusOK {
 				var response struct {
-					Token string `json:"token"`
+					Token     string `json:"token"`
+					ExpiresAt int64  `json:"expiresAt"`
 				}
 				err := json.Unmarshal(rr.Body.Bytes(), &response)
 				if err != nil {
@@ -213,7 +444,238 @@ func TestGetToken(t *testing.T) {
 				if response.Token == "" {
 					t.Errorf("Expected non-empty token in response")
 				}
+				if response.ExpiresAt <= time.Now().Unix() {
+					t.Errorf("Expected expiresAt in the future, got %d", response.ExpiresAt)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTokenSeparateTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+
+	req, _ := http.NewRequest("POST", "/token/getNew", strings.NewReader(`{"tokenType": "rtc+rtm", "channel": "test-channel", "uid": "1234", "expire": 600, "separateTokens": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rr)
+	c.Request = req
+
+	service.GetToken(c)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var response map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if response["token"] != nil || response["rtcToken"] == "" || response["rtmToken"] == "" {
+		t.Errorf("response = %v, want rtcToken and rtmToken without token", response)
+	}
+	rtcInspection, err := service.ParseToken(response["rtcToken"].(string))
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	if int64(response["expiresAt"].(float64)) != rtcInspection.ExpiresAt {
+		t.Errorf("expiresAt = %v, want %d", response["expiresAt"], rtcInspection.ExpiresAt)
+	}
+}
+
+func TestGetTokenAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	directory, _ := uid_directory.NewDirectory("", uid_directory.ScopeApp)
+	service := NewTestTokenService()
+	service.SetUIDDirectory(directory)
+	aliceUids, _ := directory.Resolve("", "", []string{"alice"})
+	alice := strconv.FormatUint(uint64(aliceUids[0]), 10)
+
+	tests := []struct {
+		name           string
+		service        *TokenService
+		requestBody    string
+		wantStatusCode int
+		wantUid        string
+	}{
+		{
+			name:           "RTC token for an account",
+			service:        service,
+			requestBody:    `{"tokenType": "rtc", "channel": "test-channel", "account": "alice", "role": "publisher"}`,
+			wantStatusCode: http.StatusOK,
+			wantUid:        alice,
+		},
+		{
+			name:           "Account and UID",
+			service:        service,
+			requestBody:    `{"tokenType": "rtc", "channel": "test-channel", "account": "alice", "uid": "1234"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "RTM token for an account",
+			service:        service,
+			requestBody:    `{"tokenType": "rtm", "account": "alice"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Account without a UID directory",
+			service:        NewTestTokenService(),
+			requestBody:    `{"tokenType": "rtc", "channel": "test-channel", "account": "alice"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/token/getNew", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(rr)
+			c.Request = req
+
+			tt.service.GetToken(c)
+
+			if status := rr.Code; status != tt.wantStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, tt.wantStatusCode, rr.Body.String())
+			}
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+			var response struct {
+				Token string `json:"token"`
+				Uid   string `json:"uid"`
+			}
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if response.Uid != tt.wantUid {
+				t.Errorf("uid = %q, want %q", response.Uid, tt.wantUid)
+			}
+			inspection, err := tt.service.ParseToken(response.Token)
+			if err != nil {
+				t.Fatalf("ParseToken() error = %v", err)
+			}
+			if inspection.Services[0].Uid != tt.wantUid {
+				t.Errorf("token uid = %q, want %q", inspection.Services[0].Uid, tt.wantUid)
+			}
+		})
+	}
+}
+
+func TestGetTokenBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := NewTestTokenService()
+	service.SetMaxBatchSize(3)
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		wantStatusCode int
+		wantSucceeded  int
+		wantFailed     int
+	}{
+		{
+			name: "Valid batch",
+			requestBody: `[
+				{"tokenType": "rtc", "channel": "test-channel", "uid": "1234", "role": "publisher"},
+				{"tokenType": "rtm", "uid": "1234"},
+				{"tokenType": "chat", "uid": "1234"}
+			]`,
+			wantStatusCode: http.StatusOK,
+			wantSucceeded:  3,
+		},
+		{
+			name: "Invalid item does not fail the batch",
+			requestBody: `[
+				{"tokenType": "rtc", "channel": "test-channel", "uid": "1234"},
+				{"tokenType": "invalid", "uid": "1234"},
+				{"tokenType": "rtc", "uid": "1234"}
+			]`,
+			wantStatusCode: http.StatusOK,
+			wantSucceeded:  1,
+			wantFailed:     2,
+		},
+		{
+			name: "Negative expiration fails the item",
+			requestBody: `[
+				{"tokenType": "rtm", "uid": "1234", "expire": -1},
+				{"tokenType": "chat", "uid": "1234", "expire": -1}
+			]`,
+			wantStatusCode: http.StatusOK,
+			wantFailed:     2,
+		},
+		{
+			name:           "Empty batch",
+			requestBody:    `[]`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Batch too large",
+			requestBody:    `[{"tokenType": "rtm", "uid": "1"}, {"tokenType": "rtm", "uid": "2"}, {"tokenType": "rtm", "uid": "3"}, {"tokenType": "rtm", "uid": "4"}]`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "Not an array",
+			requestBody:    `{"tokenType": "rtm", "uid": "1"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/token/batch", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(rr)
+			c.Request = req
+
+			service.GetTokenBatch(c)
+
+			if status := rr.Code; status != tt.wantStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", status, tt.wantStatusCode)
+			}
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+
+			var response TokenBatchResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Error unmarshaling response: %v", err)
+			}
+			if response.Succeeded != tt.wantSucceeded || response.Failed != tt.wantFailed {
+				t.Errorf("succeeded/failed = %d/%d, want %d/%d", response.Succeeded, response.Failed, tt.wantSucceeded, tt.wantFailed)
+			}
+			for i, result := range response.Results {
+				if result.Index != i {
+					t.Errorf("result %d has index %d", i, result.Index)
+				}
+				if (result.Token == "") == (result.Error == "") {
+					t.Errorf("result %d should have either a token or an error: %+v", i, result)
+				}
 			}
 		})
 	}
 }
+
+func TestTokenServiceForContext(t *testing.T) {
+	service := NewTestTokenService()
+	tenant := &tenant_registry.Tenant{ID: "video", AppID: "0123456789abcdef0123456789abcdef", AppCertificate: "fedcba9876543210fedcba9876543210"}
+
+	if got := service.ForContext(context.Background()); got != service {
+		t.Errorf("ForContext() without a tenant should return the service itself")
+	}
+
+	tenantService := service.ForContext(tenant_registry.NewContext(context.Background(), tenant))
+	token, err := tenantService.GenRtmToken(TokenRequest{TokenType: "rtm", Uid: "test-user"})
+	if err != nil {
+		t.Fatalf("GenRtmToken() error = %v", err)
+	}
+	inspection, err := tenantService.ParseToken(token)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+	if inspection.AppID != tenant.AppID || !inspection.SignatureValid {
+		t.Errorf("token issued for %s (valid %v), want %s", inspection.AppID, inspection.SignatureValid, tenant.AppID)
+	}
+	if service.appID == tenant.AppID {
+		t.Errorf("ForContext() modified the server's credentials")
+	}
+}
@@ -0,0 +1,34 @@
+package token_service
+
+import "github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+
+// Validate checks that the expirations of a token request are not negative.
+// The other fields depend on the token type and are checked when the token is generated, see GenToken.
+func (r *TokenRequest) Validate(errs *request_validation.Errors) {
+	expirations := []struct {
+		field  string
+		expire int
+	}{
+		{"expire", r.ExpirationSeconds},
+		{"joinChannelPrivilegeExpire", r.JoinChannelPrivilegeExpire},
+		{"pubAudioPrivilegeExpire", r.PubAudioPrivilegeExpire},
+		{"pubVideoPrivilegeExpire", r.PubVideoPrivilegeExpire},
+		{"pubDataStreamPrivilegeExpire", r.PubDataStreamPrivilegeExpire},
+	}
+	for _, expiration := range expirations {
+		if expiration.expire < 0 {
+			errs.Add(expiration.field, "must not be negative")
+		}
+	}
+}
+
+// Validate checks that an inspect request has a token.
+func (r *TokenInspectRequest) Validate(errs *request_validation.Errors) {
+	errs.Required("token", r.Token)
+}
+
+// Validate checks the certificate of an activate request.
+// Whether a secondary certificate is configured is checked by AppCertificates.Activate.
+func (r *CertificateActivateRequest) Validate(errs *request_validation.Errors) {
+	errs.OneOf("active", r.Active, CertificatePrimary, CertificateSecondary)
+}
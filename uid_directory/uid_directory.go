@@ -0,0 +1,474 @@
+package uid_directory
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/atomic_file"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes in which a UID is unique to an account.
+const (
+	ScopeApp     = "app"     // An account has the same UID in every channel.
+	ScopeChannel = "channel" // An account has its own UID in each channel.
+)
+
+// MaxResolveAccounts is the maximum number of accounts in a resolve request.
+const MaxResolveAccounts = 100
+
+// MaxAccountLength is the maximum length of an Agora user account in bytes.
+const MaxAccountLength = 255
+
+// DefaultMaxAccounts is the number of accounts a directory keeps a UID for, unless set with SetMaxAccounts.
+const DefaultMaxAccounts = 100000
+
+// minCompactEntries is the number of entries the directory file must have before it is compacted, see compact.
+const minCompactEntries = 1000
+
+// Errors returned when an account can't be resolved.
+var (
+	ErrChannelRequired = errors.New("channel is required when UIDs are assigned per channel")
+	ErrInvalidAccount  = errors.New("account must be 1 to 255 bytes")
+)
+
+// Directory assigns a stable integer UID to each user account, so services that only accept integer UIDs,
+// e.g. cloud recording subscribe lists, can reference users that join with a string account.
+// The UID is derived from a hash of the account and kept once assigned, a hash collision moves the account to the next free UID.
+// The directory keeps at most maxAccounts assignments, the least recently resolved accounts are removed beyond it.
+// It is safe for concurrent use.
+type Directory struct {
+	mu          sync.Mutex
+	path        string                       // (Optional) JSON lines file the assignments are appended to, in memory only when empty
+	scope       string                       // The scope in which a UID is unique: "app" or "channel"
+	maxAccounts int                          // The maximum number of assignments
+	assignments map[string]*list.Element     // Elements of recent by namespace and account, see assignmentKey
+	recent      *list.List                   // Assignments from the most to the least recently resolved
+	used        map[string]map[uint32]string // Accounts by namespace and UID
+	logEntries  int                          // Number of entries in the file, see compact
+}
+
+// logEntry is a line of the directory file: an assignment, or the removal of an assignment.
+type logEntry struct {
+	Assignment
+	Removed bool `json:"removed,omitempty"` // Whether the assignment was removed
+}
+
+// NewDirectory returns a Directory that assigns UIDs in the given scope.
+//
+// Parameters:
+//   - path: string - (Optional) JSON lines file to persist the assignments to, existing assignments are loaded from it. Empty keeps them in memory.
+//   - scope: string - "app" for one UID per account, or "channel" for one UID per account in each channel. Defaults to "app".
+//
+// Returns:
+//   - *Directory: The directory.
+//   - error: An error if the scope is unknown or the file can't be read.
+//
+// Notes:
+//   - A missing file is treated as an empty directory.
+//   - New assignments are appended to the file, which is rewritten with the current assignments once most of its entries are outdated.
+//   - Files written as a JSON array of assignments are loaded and rewritten as JSON lines.
+func NewDirectory(path string, scope string) (*Directory, error) {
+	if scope == "" {
+		scope = ScopeApp
+	}
+	if scope != ScopeApp && scope != ScopeChannel {
+		return nil, fmt.Errorf("unknown scope %q, use %q or %q", scope, ScopeApp, ScopeChannel)
+	}
+	directory := &Directory{
+		path:        path,
+		scope:       scope,
+		maxAccounts: DefaultMaxAccounts,
+		assignments: make(map[string]*list.Element),
+		recent:      list.New(),
+		used:        make(map[string]map[uint32]string),
+	}
+	if path == "" {
+		return directory, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return directory, nil
+		}
+		return nil, fmt.Errorf("error reading UID directory file: %v", err)
+	}
+	if err := directory.load(data); err != nil {
+		return nil, err
+	}
+	return directory, nil
+}
+
+// SetMaxAccounts sets the maximum number of accounts the directory keeps a UID for, DefaultMaxAccounts by default.
+// Beyond it, the least recently resolved accounts are removed and get a new UID when they are resolved again.
+// Returns an error if the maximum is lower than MaxResolveAccounts.
+func (d *Directory) SetMaxAccounts(maxAccounts int) error {
+	if maxAccounts < MaxResolveAccounts {
+		return fmt.Errorf("maximum accounts must be at least %d", MaxResolveAccounts)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxAccounts = maxAccounts
+	return nil
+}
+
+// Resolve returns the UIDs of the accounts, assigning a UID to each account that doesn't have one.
+//
+// Parameters:
+//   - tenantID: string - (Optional) the tenant of the accounts, each tenant has its own UIDs.
+//   - channel: string - The channel of the accounts, required when UIDs are assigned per channel and ignored otherwise.
+//   - accounts: []string - The user accounts.
+//
+// Returns:
+//   - []uint32: The UID of each account, in the order of the accounts.
+//   - error: ErrChannelRequired, ErrInvalidAccount, or an error if new assignments can't be persisted.
+func (d *Directory) Resolve(tenantID string, channel string, accounts []string) ([]uint32, error) {
+	if d.scope == ScopeChannel && channel == "" {
+		return nil, ErrChannelRequired
+	}
+	if d.scope == ScopeApp {
+		channel = ""
+	}
+	for _, account := range accounts {
+		if account == "" || len(account) > MaxAccountLength {
+			return nil, ErrInvalidAccount
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	uids := make([]uint32, len(accounts))
+	var added []Assignment
+	for i, account := range accounts {
+		if element, exists := d.assignments[assignmentKey(tenantID, channel, account)]; exists {
+			d.recent.MoveToFront(element)
+			uids[i] = element.Value.(Assignment).Uid
+			continue
+		}
+		assignment := Assignment{TenantID: tenantID, Channel: channel, Account: account, Uid: d.freeUid(tenantID, channel, account), AssignedAt: time.Now().UTC()}
+		d.add(assignment)
+		added = append(added, assignment)
+		uids[i] = assignment.Uid
+	}
+	if len(added) == 0 {
+		return uids, nil
+	}
+
+	// Remove the least recently resolved accounts beyond the maximum
+	var removed []Assignment
+	for len(d.assignments) > d.maxAccounts {
+		assignment := d.recent.Back().Value.(Assignment)
+		d.remove(assignment)
+		removed = append(removed, assignment)
+	}
+	if err := d.persist(added, removed); err != nil {
+		// Keep memory consistent with the file
+		for _, assignment := range added {
+			d.remove(assignment)
+		}
+		for i := len(removed) - 1; i >= 0; i-- {
+			d.add(removed[i])
+			d.recent.MoveToBack(d.assignments[assignmentKey(removed[i].TenantID, removed[i].Channel, removed[i].Account)])
+		}
+		return nil, err
+	}
+	return uids, nil
+}
+
+// ResolveUids replaces the user accounts in a list of UIDs with their integer UIDs, e.g. for a subscribe list.
+// Integer UIDs and values starting with "#", e.g. "#allstream#", are kept.
+// The list is returned unchanged when the directory is nil, so services can call it without checking whether a directory is configured.
+func (d *Directory) ResolveUids(tenantID string, channel string, values []string) ([]string, error) {
+	if d == nil {
+		return values, nil
+	}
+	var accounts []string
+	for _, value := range values {
+		if isAccount(value) {
+			accounts = append(accounts, value)
+		}
+	}
+	if len(accounts) == 0 {
+		return values, nil
+	}
+	uids, err := d.Resolve(tenantID, channel, accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([]string, len(values))
+	for i, value := range values {
+		if isAccount(value) {
+			value, uids = strconv.FormatUint(uint64(uids[0]), 10), uids[1:]
+		}
+		resolved[i] = value
+	}
+	return resolved, nil
+}
+
+// ResolveUid returns the integer UID for a value of ResolveUids, see ResolveUids.
+func (d *Directory) ResolveUid(tenantID string, channel string, value string) (string, error) {
+	resolved, err := d.ResolveUids(tenantID, channel, []string{value})
+	if err != nil {
+		return "", err
+	}
+	return resolved[0], nil
+}
+
+// RegisterRoutes registers the routes for the Directory.
+//
+// Parameters:
+//   - r: *gin.Engine - The Gin engine instance to register the routes with.
+//   - authenticate: gin.HandlerFunc - Middleware that authenticates the callers, e.g. the token service's Authenticate.
+//
+// Behavior:
+//   - Creates an API group for the UID routes, with the authenticate middleware.
+//   - Registers the route to resolve accounts to UIDs.
+func (d *Directory) RegisterRoutes(r *gin.Engine, authenticate gin.HandlerFunc) {
+	api := r.Group("/uid")
+	api.Use(authenticate)
+	api.POST("/resolve", d.HandleResolve)
+}
+
+// HandleResolve handles the HTTP request to resolve user accounts to their integer UIDs, assigning UIDs to new accounts.
+// The UIDs are assigned for the tenant of the request.
+// Returns an HTTP 400 error if there are no accounts, too many accounts, an invalid account, or no channel when UIDs are assigned per channel.
+//
+// Parameters:
+//   - c: *gin.Context - The Gin context representing the HTTP request and response.
+//
+// Example usage:
+//
+//	router.POST("/resolve", Directory.HandleResolve)
+func (d *Directory) HandleResolve(c *gin.Context) {
+	var resolveReq ResolveRequest
+	if !request_validation.BindJSON(c, &resolveReq) {
+		return
+	}
+
+	uids, err := d.Resolve(tenant_registry.IDFromContext(c.Request.Context()), resolveReq.Channel, resolveReq.Accounts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrChannelRequired) || errors.Is(err, ErrInvalidAccount) {
+			status = http.StatusBadRequest
+		}
+		api_errors.Abort(c, status, err)
+		return
+	}
+
+	response := ResolveResponse{Uids: make([]AccountUid, len(uids))}
+	if d.scope == ScopeChannel {
+		response.Channel = resolveReq.Channel
+	}
+	for i, uid := range uids {
+		response.Uids[i] = AccountUid{Account: resolveReq.Accounts[i], Uid: uid}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// freeUid returns the UID for a new account: the hash of the account, or the next UID not used in the namespace. Must be called with d.mu held.
+func (d *Directory) freeUid(tenantID string, channel string, account string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(assignmentKey(tenantID, channel, account)))
+	uid := hash.Sum32()
+	used := d.used[namespace(tenantID, channel)]
+	for uid == 0 || used[uid] != "" {
+		uid++
+	}
+	return uid
+}
+
+// add adds an assignment as the most recently resolved, replacing the account's previous assignment. Must be called with d.mu held.
+func (d *Directory) add(assignment Assignment) {
+	key := assignmentKey(assignment.TenantID, assignment.Channel, assignment.Account)
+	if element, exists := d.assignments[key]; exists {
+		d.remove(element.Value.(Assignment))
+	}
+	d.assignments[key] = d.recent.PushFront(assignment)
+	ns := namespace(assignment.TenantID, assignment.Channel)
+	if d.used[ns] == nil {
+		d.used[ns] = make(map[uint32]string)
+	}
+	d.used[ns][assignment.Uid] = assignment.Account
+}
+
+// remove removes an assignment. Must be called with d.mu held.
+func (d *Directory) remove(assignment Assignment) {
+	key := assignmentKey(assignment.TenantID, assignment.Channel, assignment.Account)
+	element, exists := d.assignments[key]
+	if !exists {
+		return
+	}
+	assignment = element.Value.(Assignment)
+	d.recent.Remove(element)
+	delete(d.assignments, key)
+	ns := namespace(assignment.TenantID, assignment.Channel)
+	delete(d.used[ns], assignment.Uid)
+	if len(d.used[ns]) == 0 {
+		delete(d.used, ns)
+	}
+}
+
+// load replays the entries of the directory file, or loads the assignments of a file written as a JSON array.
+// The file is compacted when it is a JSON array, ends with an incomplete entry, or has mostly outdated entries.
+func (d *Directory) load(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '[' {
+		var assignments []Assignment
+		if err := json.Unmarshal(data, &assignments); err != nil {
+			return fmt.Errorf("error parsing UID directory file: %v", err)
+		}
+		for _, assignment := range assignments {
+			d.add(assignment)
+		}
+		return d.compact()
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// The last entry is incomplete when the server stopped while appending it
+			if i == len(lines)-1 {
+				return d.compact()
+			}
+			return fmt.Errorf("error parsing UID directory file, line %d: %v", i+1, err)
+		}
+		if entry.Removed {
+			d.remove(entry.Assignment)
+		} else {
+			d.add(entry.Assignment)
+		}
+	}
+	d.logEntries = len(lines)
+	if d.needsCompaction() {
+		return d.compact()
+	}
+	return nil
+}
+
+// persist appends the added and removed assignments to the directory file,
+// and compacts the file once most of its entries are outdated. Must be called with d.mu held.
+func (d *Directory) persist(added []Assignment, removed []Assignment) error {
+	if d.path == "" {
+		return nil
+	}
+	var data bytes.Buffer
+	for _, assignment := range removed {
+		if err := writeEntry(&data, logEntry{Assignment: assignment, Removed: true}); err != nil {
+			return err
+		}
+	}
+	for _, assignment := range added {
+		if err := writeEntry(&data, logEntry{Assignment: assignment}); err != nil {
+			return err
+		}
+	}
+	if err := appendFile(d.path, data.Bytes()); err != nil {
+		return fmt.Errorf("error writing UID directory file: %v", err)
+	}
+	d.logEntries += len(added) + len(removed)
+
+	if d.needsCompaction() {
+		// The new assignments are saved, the file is compacted again after the next assignments
+		if err := d.compact(); err != nil {
+			log.Printf("Unable to compact the UID directory file: %v", err)
+		}
+	}
+	return nil
+}
+
+// needsCompaction reports whether most entries of the directory file are outdated. Must be called with d.mu held.
+func (d *Directory) needsCompaction() bool {
+	return d.logEntries > minCompactEntries && d.logEntries > 2*len(d.assignments)
+}
+
+// compact rewrites the directory file with the current assignments, from the least to the most recently resolved,
+// see atomic_file.WriteFile. Must be called with d.mu held.
+func (d *Directory) compact() error {
+	if d.path == "" {
+		return nil
+	}
+	var data bytes.Buffer
+	for element := d.recent.Back(); element != nil; element = element.Prev() {
+		if err := writeEntry(&data, logEntry{Assignment: element.Value.(Assignment)}); err != nil {
+			return err
+		}
+	}
+	if err := atomic_file.WriteFile(d.path, data.Bytes()); err != nil {
+		return fmt.Errorf("error writing UID directory file: %v", err)
+	}
+	d.logEntries = len(d.assignments)
+	return nil
+}
+
+// writeEntry writes an entry of the directory file as a JSON line.
+func writeEntry(data *bytes.Buffer, entry logEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding UID directory: %v", err)
+	}
+	data.Write(line)
+	data.WriteByte('\n')
+	return nil
+}
+
+// appendFile appends data to a file, creating it if needed, and syncs it to disk.
+// The file is truncated to its previous size if the data can't be written, so it never ends with part of the data.
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Truncate(info.Size())
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Truncate(info.Size())
+		return err
+	}
+	return nil
+}
+
+// namespace returns the key of the UIDs of a tenant and channel, the channel is empty when UIDs are assigned per app.
+func namespace(tenantID string, channel string) string {
+	return tenantID + "\x00" + channel
+}
+
+// assignmentKey returns the key of an account's assignment.
+func assignmentKey(tenantID string, channel string, account string) string {
+	return namespace(tenantID, channel) + "\x00" + account
+}
+
+// isAccount reports whether a UID list value is a user account, rather than an integer UID or a "#" placeholder.
+func isAccount(value string) bool {
+	if value == "" || strings.HasPrefix(value, "#") {
+		return false
+	}
+	_, err := strconv.ParseUint(value, 10, 32)
+	return err != nil
+}
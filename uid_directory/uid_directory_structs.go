@@ -0,0 +1,30 @@
+package uid_directory
+
+import "time"
+
+// Assignment is the integer UID assigned to a user account.
+type Assignment struct {
+	TenantID   string    `json:"tenantId,omitempty"` // (Optional) the tenant of the account
+	Channel    string    `json:"channel,omitempty"`  // The channel of the account, empty when UIDs are assigned per app
+	Account    string    `json:"account"`            // The user account
+	Uid        uint32    `json:"uid"`                // The integer UID assigned to the account
+	AssignedAt time.Time `json:"assignedAt"`         // The time the UID was assigned
+}
+
+// ResolveRequest is the JSON payload of the resolve endpoint.
+type ResolveRequest struct {
+	Channel  string   `json:"channel,omitempty"` // The channel of the accounts, required when UIDs are assigned per channel
+	Accounts []string `json:"accounts"`          // The user accounts to resolve
+}
+
+// ResolveResponse is the response of the resolve endpoint, with the UID of each account in the order of the request.
+type ResolveResponse struct {
+	Channel string       `json:"channel,omitempty"` // The channel of the accounts, empty when UIDs are assigned per app
+	Uids    []AccountUid `json:"uids"`              // The UID of each account
+}
+
+// AccountUid is a user account and its integer UID.
+type AccountUid struct {
+	Account string `json:"account"` // The user account
+	Uid     uint32 `json:"uid"`     // The integer UID of the account
+}
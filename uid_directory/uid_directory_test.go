@@ -0,0 +1,254 @@
+package uid_directory
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/tenant_registry"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	directory, err := NewDirectory("", ScopeApp)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	uids, err := directory.Resolve("", "room-1", []string{"alice", "bob", "alice"})
+	assert.NoError(t, err)
+	assert.NotZero(t, uids[0])
+	assert.NotEqual(t, uids[0], uids[1])
+	assert.Equal(t, uids[0], uids[2])
+
+	// Accounts have the same UID in every channel, and their own UID for each tenant
+	again, _ := directory.Resolve("", "room-2", []string{"alice"})
+	assert.Equal(t, uids[0], again[0])
+	other, _ := directory.Resolve("tenant-b", "room-1", []string{"alice"})
+	assert.NotEqual(t, uids[0], other[0])
+
+	_, err = directory.Resolve("", "", []string{""})
+	assert.ErrorIs(t, err, ErrInvalidAccount)
+	_, err = directory.Resolve("", "", []string{strings.Repeat("a", 256)})
+	assert.ErrorIs(t, err, ErrInvalidAccount)
+}
+
+func TestResolveChannelScope(t *testing.T) {
+	directory, _ := NewDirectory("", ScopeChannel)
+
+	_, err := directory.Resolve("", "", []string{"alice"})
+	assert.ErrorIs(t, err, ErrChannelRequired)
+
+	room1, _ := directory.Resolve("", "room-1", []string{"alice"})
+	room2, _ := directory.Resolve("", "room-2", []string{"alice"})
+	assert.NotEqual(t, room1[0], room2[0])
+
+	_, err = NewDirectory("", "tenant")
+	assert.Error(t, err)
+}
+
+func TestResolveCollision(t *testing.T) {
+	directory, _ := NewDirectory("", ScopeApp)
+	uids, _ := directory.Resolve("", "", []string{"alice"})
+
+	// Take alice's UID for another account, as if its hash collided
+	directory.mu.Lock()
+	directory.remove(Assignment{Account: "alice"})
+	directory.add(Assignment{Account: "mallory", Uid: uids[0]})
+	directory.mu.Unlock()
+
+	moved, _ := directory.Resolve("", "", []string{"alice"})
+	assert.Equal(t, uids[0]+1, moved[0])
+}
+
+func TestResolveUids(t *testing.T) {
+	directory, _ := NewDirectory("", ScopeApp)
+	alice, _ := directory.Resolve("", "", []string{"alice"})
+
+	resolved, err := directory.ResolveUids("", "room-1", []string{"#allstream#", "1234", "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"#allstream#", "1234", strconv.FormatUint(uint64(alice[0]), 10)}, resolved)
+
+	var nilDirectory *Directory
+	resolved, err = nilDirectory.ResolveUids("", "room-1", []string{"alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, resolved)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uids.json")
+	directory, err := NewDirectory(path, ScopeChannel)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	uids, err := directory.Resolve("tenant-a", "room-1", []string{"alice", "bob"})
+	assert.NoError(t, err)
+
+	reloaded, err := NewDirectory(path, ScopeChannel)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	reloadedUids, _ := reloaded.Resolve("tenant-a", "room-1", []string{"alice", "bob"})
+	assert.Equal(t, uids, reloadedUids)
+
+	_, err = NewDirectory(filepath.Join(t.TempDir(), "missing", "uids.json"), ScopeApp)
+	assert.NoError(t, err)
+}
+
+func TestPersistenceLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uids.json")
+	directory, _ := NewDirectory(path, ScopeApp)
+	uids, err := directory.Resolve("", "", []string{"alice", "bob"})
+	assert.NoError(t, err)
+
+	// New assignments are appended, resolving known accounts doesn't write
+	directory.Resolve("", "", []string{"alice", "carol"})
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+
+	// An incomplete last entry is dropped when the file is loaded
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString(`{"account":"dave","ui`)
+	file.Close()
+	reloaded, err := NewDirectory(path, ScopeApp)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	reloadedUids, _ := reloaded.Resolve("", "", []string{"alice", "bob"})
+	assert.Equal(t, uids, reloadedUids)
+	data, _ = os.ReadFile(path)
+	assert.NotContains(t, string(data), "dave")
+
+	// Files written as a JSON array are loaded and rewritten as JSON lines
+	legacyPath := filepath.Join(t.TempDir(), "uids.json")
+	os.WriteFile(legacyPath, []byte(`[{"account": "alice", "uid": 42, "assignedAt": "2024-01-01T00:00:00Z"}]`), 0600)
+	legacy, err := NewDirectory(legacyPath, ScopeApp)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	legacyUids, _ := legacy.Resolve("", "", []string{"alice"})
+	assert.Equal(t, []uint32{42}, legacyUids)
+	data, _ = os.ReadFile(legacyPath)
+	assert.Equal(t, byte('{'), data[0])
+}
+
+func TestMaxAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uids.json")
+	directory, _ := NewDirectory(path, ScopeApp)
+	assert.Error(t, directory.SetMaxAccounts(MaxResolveAccounts-1))
+	assert.NoError(t, directory.SetMaxAccounts(MaxResolveAccounts))
+
+	accounts := make([]string, MaxResolveAccounts)
+	for i := range accounts {
+		accounts[i] = "user-" + strconv.Itoa(i)
+	}
+	first, err := directory.Resolve("", "", accounts)
+	assert.NoError(t, err)
+
+	// Resolving "user-0" again keeps it, the least recently resolved "user-1" is removed for the new account
+	directory.Resolve("", "", []string{"user-0"})
+	_, err = directory.Resolve("", "", []string{"new-user"})
+	assert.NoError(t, err)
+	assert.Len(t, directory.assignments, MaxResolveAccounts)
+	assert.Contains(t, directory.assignments, assignmentKey("", "", "user-0"))
+	assert.NotContains(t, directory.assignments, assignmentKey("", "", "user-1"))
+
+	// The removal is persisted
+	reloaded, err := NewDirectory(path, ScopeApp)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Len(t, reloaded.assignments, MaxResolveAccounts)
+	assert.NotContains(t, reloaded.assignments, assignmentKey("", "", "user-1"))
+	uids, _ := reloaded.Resolve("", "", []string{"user-0"})
+	assert.Equal(t, first[0], uids[0])
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uids.json")
+	directory, _ := NewDirectory(path, ScopeApp)
+	directory.SetMaxAccounts(MaxResolveAccounts)
+
+	// Replacing the accounts adds an entry and a removal per account, until the file is compacted
+	for batch := 0; batch < 20; batch++ {
+		accounts := make([]string, MaxResolveAccounts)
+		for i := range accounts {
+			accounts[i] = "user-" + strconv.Itoa(batch) + "-" + strconv.Itoa(i)
+		}
+		_, err := directory.Resolve("", "", accounts)
+		assert.NoError(t, err)
+	}
+	data, _ := os.ReadFile(path)
+	assert.LessOrEqual(t, strings.Count(string(data), "\n"), minCompactEntries+2*MaxResolveAccounts)
+
+	reloaded, err := NewDirectory(path, ScopeApp)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Len(t, reloaded.assignments, MaxResolveAccounts)
+	assert.Contains(t, reloaded.assignments, assignmentKey("", "", "user-19-0"))
+}
+
+func TestHandleResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	directory, _ := NewDirectory("", ScopeChannel)
+	registry, _ := tenant_registry.NewRegistry([]*tenant_registry.Tenant{{ID: "video", AppID: "video_app_id", AppCertificate: "video_cert", APIKeys: []string{"video-key"}}}, "")
+	router := gin.New()
+	router.Use(registry.Middleware())
+	authenticate := func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer test" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+	directory.RegisterRoutes(router, authenticate)
+
+	tests := []struct {
+		name            string
+		body            string
+		tenant          string
+		unauthenticated bool
+		wantStatusCode  int
+	}{
+		{name: "Accounts", body: `{"channel": "room-1", "accounts": ["alice", "bob"]}`, wantStatusCode: http.StatusOK},
+		{name: "Missing credentials", body: `{"channel": "room-1", "accounts": ["alice", "bob"]}`, unauthenticated: true, wantStatusCode: http.StatusUnauthorized},
+		{name: "Tenant accounts", body: `{"channel": "room-1", "accounts": ["alice", "bob"]}`, tenant: "video", wantStatusCode: http.StatusOK},
+		{name: "Missing channel", body: `{"accounts": ["alice"]}`, wantStatusCode: http.StatusBadRequest},
+		{name: "No accounts", body: `{"channel": "room-1", "accounts": []}`, wantStatusCode: http.StatusBadRequest},
+		{name: "Invalid account", body: `{"channel": "room-1", "accounts": [""]}`, wantStatusCode: http.StatusBadRequest},
+		{name: "Account too long", body: `{"channel": "room-1", "accounts": ["` + strings.Repeat("a", MaxAccountLength+1) + `"]}`, wantStatusCode: http.StatusBadRequest},
+		{name: "Too many accounts", body: `{"channel": "room-1", "accounts": [` + strings.Repeat(`"a",`, MaxResolveAccounts) + `"a"]}`, wantStatusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/uid/resolve", bytes.NewBufferString(tt.body))
+			if !tt.unauthenticated {
+				req.Header.Set("Authorization", "Bearer test")
+			}
+			if tt.tenant != "" {
+				req.Header.Set(tenant_registry.TenantKeyHeader, tt.tenant+"-key")
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatusCode, w.Code, w.Body.String())
+			if tt.wantStatusCode != http.StatusOK {
+				return
+			}
+
+			var response ResolveResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "room-1", response.Channel)
+			if assert.Len(t, response.Uids, 2) {
+				assert.Equal(t, "alice", response.Uids[0].Account)
+				uids, _ := directory.Resolve(tt.tenant, "room-1", []string{"alice"})
+				assert.Equal(t, uids[0], response.Uids[0].Uid)
+			}
+		})
+	}
+}
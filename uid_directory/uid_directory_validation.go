@@ -0,0 +1,28 @@
+package uid_directory
+
+import (
+	"fmt"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/request_validation"
+)
+
+// Validate checks the number and length of the accounts of a resolve request.
+// The channel is checked by Resolve, it is only required when UIDs are assigned per channel.
+func (r *ResolveRequest) Validate(errs *request_validation.Errors) {
+	if len(r.Accounts) == 0 {
+		errs.Add("accounts", "must have at least one account")
+	}
+	ValidateAccounts(errs, "accounts", r.Accounts)
+}
+
+// ValidateAccounts checks that a list of accounts can be resolved in one request:
+// at most MaxResolveAccounts accounts of 1 to MaxAccountLength bytes.
+// Services that resolve accounts on behalf of a client, e.g. invites, use it to check the accounts up front.
+func ValidateAccounts(errs *request_validation.Errors, field string, accounts []string) {
+	errs.MaxItems(field, len(accounts), MaxResolveAccounts)
+	for i, account := range accounts {
+		if account == "" || len(account) > MaxAccountLength {
+			errs.Add(fmt.Sprintf("%s[%d]", field, i), "must be 1 to %d bytes", MaxAccountLength)
+		}
+	}
+}
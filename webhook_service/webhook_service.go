@@ -0,0 +1,277 @@
+package webhook_service
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AgoraIO-Community/agora-go-backend-middleware/api_errors"
+	"github.com/gin-gonic/gin"
+)
+
+// maxNotificationSize limits the size of a notification body.
+const maxNotificationSize = 1 << 20
+
+// defaultDedupeTTL is how long a notice ID is remembered to drop retried notifications.
+const defaultDedupeTTL = 24 * time.Hour
+
+// Handler types for the typed events, called after a notification has been verified and decoded.
+type (
+	NotificationHandler   func(notification Notification)
+	CloudRecordingHandler func(notification Notification, event CloudRecordingEvent)
+	MediaPushHandler      func(notification Notification, event MediaPushEvent)
+	CloudPlayerHandler    func(notification Notification, event CloudPlayerEvent)
+	ChannelHandler        func(notification Notification, event ChannelEvent)
+)
+
+// WebhookService receives notifications from Agora's Notification Center Service (NCS).
+// It verifies the notification signature, drops duplicate notifications and dispatches typed events to the registered handlers.
+type WebhookService struct {
+	secret    string        // The NCS secret used to verify notification signatures.
+	dedupeTTL time.Duration // How long a notice ID is remembered.
+
+	mu                     sync.RWMutex
+	notificationHandlers   []NotificationHandler   // Handlers called for every notification.
+	cloudRecordingHandlers []CloudRecordingHandler // Handlers for Cloud Recording events.
+	mediaPushHandlers      []MediaPushHandler      // Handlers for Media Push events.
+	cloudPlayerHandlers    []CloudPlayerHandler    // Handlers for Cloud Player events.
+	channelHandlers        []ChannelHandler        // Handlers for RTC channel events.
+
+	seenMu     sync.Mutex
+	seen       map[string]time.Time // Notice IDs that have already been processed, with the time they were received.
+	lastPruned time.Time            // When expired notice IDs were last removed.
+}
+
+// NewWebhookService returns a WebhookService pointer with all configurations set.
+//
+// Parameters:
+//   - secret: string - The NCS secret configured in Agora Console, used to verify notification signatures.
+//
+// Returns:
+//   - *WebhookService: The initialized WebhookService struct.
+//
+// Notes:
+//   - Handlers are registered with the On* methods before or after the routes are registered.
+func NewWebhookService(secret string) *WebhookService {
+	return &WebhookService{
+		secret:    secret,
+		dedupeTTL: defaultDedupeTTL,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// RegisterRoutes registers the routes for the WebhookService.
+//
+// Parameters:
+//   - r: *gin.Engine - The Gin engine instance to register the routes with.
+func (s *WebhookService) RegisterRoutes(r *gin.Engine) {
+	// group route
+	api := r.Group("/webhooks")
+	// routes
+	api.POST("/agora", s.ReceiveNotification)
+}
+
+// OnNotification registers a handler called for every verified notification, including unknown products.
+func (s *WebhookService) OnNotification(handler NotificationHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notificationHandlers = append(s.notificationHandlers, handler)
+}
+
+// OnCloudRecording registers a handler for Cloud Recording events.
+func (s *WebhookService) OnCloudRecording(handler CloudRecordingHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cloudRecordingHandlers = append(s.cloudRecordingHandlers, handler)
+}
+
+// OnMediaPush registers a handler for Media Push events.
+func (s *WebhookService) OnMediaPush(handler MediaPushHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mediaPushHandlers = append(s.mediaPushHandlers, handler)
+}
+
+// OnCloudPlayer registers a handler for Cloud Player events.
+func (s *WebhookService) OnCloudPlayer(handler CloudPlayerHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cloudPlayerHandlers = append(s.cloudPlayerHandlers, handler)
+}
+
+// OnChannel registers a handler for RTC channel events.
+func (s *WebhookService) OnChannel(handler ChannelHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelHandlers = append(s.channelHandlers, handler)
+}
+
+// ReceiveNotification handles a notification sent by Agora's Notification Center Service.
+// Returns an HTTP 401 error if the signature is invalid and an HTTP 400 error if the notification cannot be decoded.
+// Duplicate notifications are acknowledged without being dispatched again.
+func (s *WebhookService) ReceiveNotification(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxNotificationSize))
+	if err != nil {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Failed to read notification: "+err.Error())
+		return
+	}
+
+	// Verify the notification was sent by Agora
+	if err := s.VerifySignature(body, c.GetHeader("Agora-Signature"), c.GetHeader("Agora-Signature-V2")); err != nil {
+		api_errors.Abort(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	var notification Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid notification: "+err.Error())
+		return
+	}
+	if notification.NoticeId == "" {
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid notification: noticeId is required")
+		return
+	}
+
+	// Agora retries notifications that are not acknowledged, only process each notice once
+	if !s.markSeen(notification.NoticeId, time.Now()) {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+
+	if err := s.Dispatch(notification); err != nil {
+		// Allow Agora to retry the notification
+		s.forget(notification.NoticeId)
+		api_errors.AbortMessage(c, http.StatusBadRequest, "Invalid notification payload: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// VerifySignature checks the HMAC signature of a notification body.
+// The SHA256 signature (Agora-Signature-V2) is used when present, otherwise the SHA1 signature (Agora-Signature).
+func (s *WebhookService) VerifySignature(body []byte, signature string, signatureV2 string) error {
+	var mac hash.Hash
+	var expected string
+	switch {
+	case signatureV2 != "":
+		mac, expected = hmac.New(sha256.New, []byte(s.secret)), signatureV2
+	case signature != "":
+		mac, expected = hmac.New(sha1.New, []byte(s.secret)), signature
+	default:
+		return errors.New("missing notification signature")
+	}
+
+	expectedBytes, err := hex.DecodeString(strings.TrimSpace(expected))
+	if err != nil {
+		return errors.New("invalid notification signature")
+	}
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expectedBytes) {
+		return errors.New("invalid notification signature")
+	}
+	return nil
+}
+
+// Dispatch decodes the notification payload into the typed event for its product and calls the registered handlers.
+func (s *WebhookService) Dispatch(notification Notification) error {
+	// Copy the handlers, so handlers can register other handlers without deadlocking
+	s.mu.RLock()
+	notificationHandlers := append([]NotificationHandler(nil), s.notificationHandlers...)
+	cloudRecordingHandlers := append([]CloudRecordingHandler(nil), s.cloudRecordingHandlers...)
+	mediaPushHandlers := append([]MediaPushHandler(nil), s.mediaPushHandlers...)
+	cloudPlayerHandlers := append([]CloudPlayerHandler(nil), s.cloudPlayerHandlers...)
+	channelHandlers := append([]ChannelHandler(nil), s.channelHandlers...)
+	s.mu.RUnlock()
+
+	switch notification.ProductId {
+	case ProductIdCloudRecording:
+		var event CloudRecordingEvent
+		if err := decodePayload(notification, &event); err != nil {
+			return err
+		}
+		for _, handler := range cloudRecordingHandlers {
+			handler(notification, event)
+		}
+	case ProductIdMediaPush:
+		var event MediaPushEvent
+		if err := decodePayload(notification, &event); err != nil {
+			return err
+		}
+		for _, handler := range mediaPushHandlers {
+			handler(notification, event)
+		}
+	case ProductIdCloudPlayer:
+		var event CloudPlayerEvent
+		if err := decodePayload(notification, &event); err != nil {
+			return err
+		}
+		for _, handler := range cloudPlayerHandlers {
+			handler(notification, event)
+		}
+	case ProductIdChannel:
+		var event ChannelEvent
+		if err := decodePayload(notification, &event); err != nil {
+			return err
+		}
+		for _, handler := range channelHandlers {
+			handler(notification, event)
+		}
+	default:
+		log.Printf("Received notification for unknown productId %d, eventType %d", notification.ProductId, notification.EventType)
+	}
+
+	for _, handler := range notificationHandlers {
+		handler(notification)
+	}
+	return nil
+}
+
+// decodePayload unmarshals the notification payload into the given event.
+func decodePayload(notification Notification, event interface{}) error {
+	if len(notification.Payload) == 0 {
+		return errors.New("payload is required")
+	}
+	if err := json.Unmarshal(notification.Payload, event); err != nil {
+		return fmt.Errorf("error parsing payload for productId %d: %v", notification.ProductId, err)
+	}
+	return nil
+}
+
+// markSeen records a notice ID and reports whether it was new.
+// Expired notice IDs are removed once a minute so the map does not grow without bound.
+func (s *WebhookService) markSeen(noticeId string, now time.Time) bool {
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+	if now.Sub(s.lastPruned) > time.Minute {
+		for id, receivedAt := range s.seen {
+			if now.Sub(receivedAt) > s.dedupeTTL {
+				delete(s.seen, id)
+			}
+		}
+		s.lastPruned = now
+	}
+	if receivedAt, ok := s.seen[noticeId]; ok && now.Sub(receivedAt) <= s.dedupeTTL {
+		return false
+	}
+	s.seen[noticeId] = now
+	return true
+}
+
+// forget removes a notice ID, so a retry of the notification is processed.
+func (s *WebhookService) forget(noticeId string) {
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+	delete(s.seen, noticeId)
+}
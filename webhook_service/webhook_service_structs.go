@@ -0,0 +1,153 @@
+package webhook_service
+
+import "encoding/json"
+
+// Product IDs used by Agora's Notification Center Service (NCS) to identify the service that sent a notification.
+const (
+	ProductIdChannel        = 1 // RTC channel events
+	ProductIdCloudRecording = 3 // Cloud Recording events
+	ProductIdCloudPlayer    = 4 // Cloud Player (Media Pull) events
+	ProductIdMediaPush      = 5 // Media Push (RTMP converter) events
+)
+
+// Cloud Recording event types.
+const (
+	CloudRecordingEventError             = 1  // An error occurred during the recording.
+	CloudRecordingEventWarning           = 2  // A warning occurred during the recording.
+	CloudRecordingEventStatusUpdate      = 3  // The status of the recording service changed.
+	CloudRecordingEventFileInfos         = 4  // The M3U8 playlist file has been generated.
+	CloudRecordingEventSessionExit       = 11 // The recording session has exited.
+	CloudRecordingEventUploaderStarted   = 30 // The upload service started.
+	CloudRecordingEventUploaded          = 31 // All recorded files have been uploaded to the storage.
+	CloudRecordingEventBackuped          = 32 // Some files were uploaded to the Agora backup storage.
+	CloudRecordingEventUploadingProgress = 33 // The upload progress of the recorded files.
+	CloudRecordingEventRecorderStarted   = 40 // The recorder has started.
+	CloudRecordingEventRecorderLeave     = 41 // The recorder has left the channel.
+	CloudRecordingEventRecorderSlice     = 42 // The recorder started a new slice.
+)
+
+// Media Push event types.
+const (
+	MediaPushEventConverterCreated       = 1 // The converter was created.
+	MediaPushEventConverterConfigChanged = 2 // The converter configuration changed.
+	MediaPushEventConverterStateChanged  = 3 // The converter state changed.
+	MediaPushEventConverterDestroyed     = 4 // The converter was destroyed.
+)
+
+// Cloud Player event types.
+const (
+	CloudPlayerEventPlayerCreated      = 1 // The player was created.
+	CloudPlayerEventPlayerDestroyed    = 2 // The player was destroyed.
+	CloudPlayerEventPlayerStateChanged = 3 // The player state changed.
+)
+
+// Channel event types.
+const (
+	ChannelEventCreate            = 101 // The channel was created.
+	ChannelEventDestroy           = 102 // The channel was destroyed.
+	ChannelEventBroadcasterJoin   = 103 // A broadcaster joined the channel.
+	ChannelEventBroadcasterLeave  = 104 // A broadcaster left the channel.
+	ChannelEventAudienceJoin      = 105 // An audience member joined the channel.
+	ChannelEventAudienceLeave     = 106 // An audience member left the channel.
+	ChannelEventUserJoinComm      = 107 // A user joined a communication channel.
+	ChannelEventUserLeaveComm     = 108 // A user left a communication channel.
+	ChannelEventRoleToBroadcaster = 111 // A user switched role to broadcaster.
+	ChannelEventRoleToAudience    = 112 // A user switched role to audience.
+)
+
+// Notification represents the envelope of every notification sent by Agora's Notification Center Service.
+// The payload is decoded into a typed event based on the product ID.
+type Notification struct {
+	NoticeId  string          `json:"noticeId"`      // Unique ID of the notification, repeated when Agora retries a notification.
+	ProductId int             `json:"productId"`     // The Agora service that sent the notification.
+	EventType int             `json:"eventType"`     // The type of event, specific to the product.
+	NotifyMs  int64           `json:"notifyMs"`      // Unix timestamp (ms) when the notification was sent.
+	Sid       string          `json:"sid,omitempty"` // (Optional) session ID, set by some products.
+	Payload   json.RawMessage `json:"payload"`       // The product specific event payload.
+}
+
+// CloudRecordingEvent contains the payload of a Cloud Recording notification.
+type CloudRecordingEvent struct {
+	Cname       string                     `json:"cname"`       // The channel name of the recording.
+	Uid         string                     `json:"uid"`         // The UID of the recording bot.
+	Sid         string                     `json:"sid"`         // The recording session ID.
+	Sequence    int                        `json:"sequence"`    // Sequence number of the notification within the session.
+	SendTs      int64                      `json:"sendts"`      // Unix timestamp (ms) when the event occurred.
+	ServiceType int                        `json:"serviceType"` // The type of recording service.
+	Details     CloudRecordingEventDetails `json:"details"`     // Event specific details.
+}
+
+// CloudRecordingEventDetails contains the details of a Cloud Recording notification.
+// Only the fields related to the event type are set, the full details are kept in Raw.
+type CloudRecordingEventDetails struct {
+	MsgName      string          `json:"msgName"`                // The name of the event, e.g. "uploaded" or "session_exit".
+	Status       *int            `json:"status,omitempty"`       // (Optional) status code of the event.
+	ErrorCode    *int            `json:"errorCode,omitempty"`    // (Optional) error code for error and warning events.
+	ErrorMsg     string          `json:"errorMsg,omitempty"`     // (Optional) error message for error events.
+	ExitStatus   *int            `json:"exitStatus,omitempty"`   // (Optional) exit status of the recording session.
+	LeaveCode    *int            `json:"leaveCode,omitempty"`    // (Optional) reason the recorder left the channel.
+	FileListMode string          `json:"fileListMode,omitempty"` // (Optional) format of the file list.
+	FileList     json.RawMessage `json:"fileList,omitempty"`     // (Optional) list of recorded files.
+	Raw          json.RawMessage `json:"-"`                      // The full details object.
+}
+
+// UnmarshalJSON decodes the known fields and keeps the full details object in Raw.
+func (d *CloudRecordingEventDetails) UnmarshalJSON(data []byte) error {
+	type details CloudRecordingEventDetails
+	var decoded details
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*d = CloudRecordingEventDetails(decoded)
+	d.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MediaPushEvent contains the payload of a Media Push notification.
+type MediaPushEvent struct {
+	Converter     MediaPushConverter `json:"converter"`               // The converter the event relates to.
+	Lts           int64              `json:"lts"`                     // Unix timestamp (ms) when the event occurred.
+	XRequestId    string             `json:"xRequestId"`              // The X-Request-ID of the request that caused the event.
+	DestroyReason string             `json:"destroyReason,omitempty"` // (Optional) reason the converter was destroyed.
+}
+
+// MediaPushConverter contains the converter details of a Media Push notification.
+type MediaPushConverter struct {
+	Id          string `json:"id"`                    // Unique identifier for the converter.
+	Name        string `json:"name"`                  // Name of the converter.
+	RtmpUrl     string `json:"rtmpUrl,omitempty"`     // The RTMP URL the converter pushes to.
+	IdleTimeout int    `json:"idleTimeout,omitempty"` // Idle timeout in seconds.
+	CreateTs    int64  `json:"createTs"`              // Timestamp of converter creation.
+	UpdateTs    int64  `json:"updateTs"`              // Timestamp of the last update.
+	State       string `json:"state"`                 // Current state of the converter.
+}
+
+// CloudPlayerEvent contains the payload of a Cloud Player notification.
+type CloudPlayerEvent struct {
+	Player        CloudPlayerPlayer `json:"player"`                  // The player the event relates to.
+	Lts           int64             `json:"lts"`                     // Unix timestamp (ms) when the event occurred.
+	XRequestId    string            `json:"xRequestId"`              // The X-Request-ID of the request that caused the event.
+	DestroyReason string            `json:"destroyReason,omitempty"` // (Optional) reason the player was destroyed.
+}
+
+// CloudPlayerPlayer contains the player details of a Cloud Player notification.
+type CloudPlayerPlayer struct {
+	Id          string `json:"id"`          // Unique identifier for the player.
+	Name        string `json:"name"`        // Name of the player.
+	ChannelName string `json:"channelName"` // The RTC channel the player pulls into.
+	Uid         int64  `json:"uid"`         // The RTC UID used by the player.
+	StreamUrl   string `json:"streamUrl"`   // The CDN/RTMP URL the player pulls from.
+	Status      string `json:"status"`      // Current status of the player.
+	CreateTs    int64  `json:"createTs"`    // Timestamp of player creation.
+}
+
+// ChannelEvent contains the payload of an RTC channel notification.
+type ChannelEvent struct {
+	ChannelName string `json:"channelName"`         // The name of the channel.
+	Ts          int64  `json:"ts"`                  // Unix timestamp (s) when the event occurred.
+	Uid         int64  `json:"uid,omitempty"`       // (Optional) UID of the user, for user events.
+	Platform    int    `json:"platform,omitempty"`  // (Optional) platform of the user.
+	ClientSeq   int64  `json:"clientSeq,omitempty"` // (Optional) sequence number used to order the user's events.
+	Reason      int    `json:"reason,omitempty"`    // (Optional) reason the user left the channel.
+	Duration    int    `json:"duration,omitempty"`  // (Optional) time in seconds the user was in the channel.
+}
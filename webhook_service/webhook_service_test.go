@@ -0,0 +1,162 @@
+package webhook_service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "test_ncs_secret"
+
+func sign(newHash func() hash.Hash, body []byte) string {
+	mac := hmac.New(newHash, []byte(testSecret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func loadPayload(t *testing.T, name string) []byte {
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return bytes.TrimSpace(body)
+}
+
+func setupWebhookRouter() (*gin.Engine, *WebhookService) {
+	gin.SetMode(gin.TestMode)
+	service := NewWebhookService(testSecret)
+	router := gin.New()
+	service.RegisterRoutes(router)
+	return router, service
+}
+
+func postNotification(router *gin.Engine, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks/agora", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReceiveNotificationReplay(t *testing.T) {
+	router, service := setupWebhookRouter()
+
+	var recordingEvents []CloudRecordingEvent
+	var mediaPushEvents []MediaPushEvent
+	var cloudPlayerEvents []CloudPlayerEvent
+	var channelEvents []ChannelEvent
+	var notifications []Notification
+	service.OnCloudRecording(func(n Notification, e CloudRecordingEvent) { recordingEvents = append(recordingEvents, e) })
+	service.OnMediaPush(func(n Notification, e MediaPushEvent) { mediaPushEvents = append(mediaPushEvents, e) })
+	service.OnCloudPlayer(func(n Notification, e CloudPlayerEvent) { cloudPlayerEvents = append(cloudPlayerEvents, e) })
+	service.OnChannel(func(n Notification, e ChannelEvent) { channelEvents = append(channelEvents, e) })
+	service.OnNotification(func(n Notification) { notifications = append(notifications, n) })
+
+	payloads := []string{
+		"cloud_recording_uploaded.json",
+		"cloud_recording_session_exit.json",
+		"media_push_converter_destroyed.json",
+		"cloud_player_state_changed.json",
+		"channel_broadcaster_join.json",
+	}
+	for _, name := range payloads {
+		body := loadPayload(t, name)
+		w := postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, body)})
+		assert.Equal(t, http.StatusOK, w.Code, name)
+	}
+
+	assert.Len(t, notifications, len(payloads))
+
+	if assert.Len(t, recordingEvents, 2) {
+		assert.Equal(t, "test", recordingEvents[0].Cname)
+		assert.Equal(t, "uploaded", recordingEvents[0].Details.MsgName)
+		assert.Equal(t, 0, *recordingEvents[0].Details.Status)
+		assert.Equal(t, "session_exit", recordingEvents[1].Details.MsgName)
+		assert.Equal(t, 0, *recordingEvents[1].Details.ExitStatus)
+		assert.Contains(t, string(recordingEvents[1].Details.Raw), "exitStatus")
+	}
+	if assert.Len(t, mediaPushEvents, 1) {
+		assert.Equal(t, "4c014467d647bb87b60b719f6fa57686", mediaPushEvents[0].Converter.Id)
+		assert.Equal(t, "Delete Request", mediaPushEvents[0].DestroyReason)
+	}
+	if assert.Len(t, cloudPlayerEvents, 1) {
+		assert.Equal(t, "test", cloudPlayerEvents[0].Player.ChannelName)
+		assert.Equal(t, "running", cloudPlayerEvents[0].Player.Status)
+	}
+	if assert.Len(t, channelEvents, 1) {
+		assert.Equal(t, "test", channelEvents[0].ChannelName)
+		assert.Equal(t, int64(12121212), channelEvents[0].Uid)
+	}
+}
+
+func TestReceiveNotificationSignature(t *testing.T) {
+	router, _ := setupWebhookRouter()
+	body := loadPayload(t, "cloud_recording_uploaded.json")
+
+	t.Run("SHA1 signature", func(t *testing.T) {
+		w := postNotification(router, body, map[string]string{"Agora-Signature": sign(sha1.New, body)})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Missing signature", func(t *testing.T) {
+		w := postNotification(router, body, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Invalid signature", func(t *testing.T) {
+		w := postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, []byte("tampered"))})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Malformed signature", func(t *testing.T) {
+		w := postNotification(router, body, map[string]string{"Agora-Signature": "not-hex"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestReceiveNotificationDedupe(t *testing.T) {
+	router, service := setupWebhookRouter()
+
+	calls := 0
+	service.OnCloudRecording(func(n Notification, e CloudRecordingEvent) { calls++ })
+
+	body := loadPayload(t, "cloud_recording_uploaded.json")
+	headers := map[string]string{"Agora-Signature-V2": sign(sha256.New, body)}
+
+	w := postNotification(router, body, headers)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = postNotification(router, body, headers)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "duplicate")
+	assert.Equal(t, 1, calls)
+}
+
+func TestReceiveNotificationInvalidPayload(t *testing.T) {
+	router, _ := setupWebhookRouter()
+
+	body := []byte(`{"noticeId":"invalid","productId":3,"eventType":31,"payload":"not-an-object"}`)
+	w := postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, body)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A failed notification can be retried
+	w = postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, body)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	body = []byte(`{"productId":3}`)
+	w = postNotification(router, body, map[string]string{"Agora-Signature-V2": sign(sha256.New, body)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}